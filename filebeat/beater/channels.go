@@ -150,6 +150,13 @@ func (*countingEventer) Closed()    {}
 func (*countingEventer) Published() {}
 
 func (c *countingEventer) FilteredOut(_ beat.Event) {}
+
+// Emitted accounts for events created by processors. These events are not
+// passed to countingClient, but are ACKed like published events.
+func (c *countingEventer) Emitted(_ beat.Event) {
+	c.wgEvents.Add(1)
+}
+
 func (c *countingEventer) DroppedOnPublish(_ beat.Event) {
 	c.wgEvents.Done()
 }
@@ -178,3 +185,12 @@ func (c *combinedEventer) DroppedOnPublish(event beat.Event) {
 	c.a.DroppedOnPublish(event)
 	c.b.DroppedOnPublish(event)
 }
+
+func (c *combinedEventer) Emitted(event beat.Event) {
+	if e, ok := c.a.(beat.ClientEmitEventer); ok {
+		e.Emitted(event)
+	}
+	if e, ok := c.b.(beat.ClientEmitEventer); ok {
+		e.Emitted(event)
+	}
+}
@@ -0,0 +1,127 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// +build !integration
+
+package beater
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/publisher/pipeline"
+	"github.com/elastic/beats/v7/libbeat/publisher/pipetool"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
+)
+
+// summaryEmitter drops all events and emits a summary event instead.
+type summaryEmitter struct {
+	emit processors.EmitFunc
+}
+
+func (e *summaryEmitter) Run(_ *beat.Event) (*beat.Event, error) { return nil, nil }
+func (e *summaryEmitter) String() string                         { return "summary" }
+
+func (e *summaryEmitter) RegisterEmitFunc(emit processors.EmitFunc) func() {
+	e.emit = emit
+	return func() {}
+}
+
+type ackingOutput struct{}
+
+func (ackingOutput) Close() error   { return nil }
+func (ackingOutput) String() string { return "acking" }
+func (ackingOutput) Publish(_ context.Context, batch publisher.Batch) error {
+	batch.ACK()
+	return nil
+}
+
+// clientProcessors runs the processors of the client configuration only.
+type clientProcessors struct{}
+
+func (clientProcessors) Create(cfg beat.ProcessingConfig, _ bool) (beat.Processor, error) {
+	return cfg.Processor, nil
+}
+
+func (clientProcessors) Close() error { return nil }
+
+func TestEventCounterEmittedEvents(t *testing.T) {
+	pipe, err := pipeline.New(beat.Info{},
+		pipeline.Monitors{},
+		func(ackListener queue.ACKListener) (queue.Queue, error) {
+			return memqueue.NewQueue(logp.L(), memqueue.Settings{
+				ACKListener: ackListener,
+				Events:      16,
+			}), nil
+		},
+		outputs.Group{Clients: []outputs.Client{ackingOutput{}}, BatchSize: 16},
+		pipeline.Settings{Processors: clientProcessors{}},
+	)
+	require.NoError(t, err)
+	defer pipe.Close()
+
+	counter := &eventCounter{
+		count: monitoring.NewInt(nil, "active"),
+		added: monitoring.NewUint(nil, "added"),
+		done:  monitoring.NewUint(nil, "done"),
+	}
+	var connector beat.PipelineConnector = withPipelineEventCounter(pipe, counter)
+	connector = pipetool.WithACKer(connector, eventACKer(newFinishedLogger(counter), &mockStatefulLogger{}))
+
+	emitter := &summaryEmitter{}
+	procs := processors.NewList(nil)
+	procs.AddProcessor(emitter)
+
+	client, err := connector.ConnectWith(beat.ClientConfig{
+		Processing: beat.ProcessingConfig{Processor: procs},
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	// The raw events are dropped by the processor, the summary is published.
+	for i := 0; i < 3; i++ {
+		client.Publish(beat.Event{Fields: common.MapStr{"message": "raw"}})
+	}
+	emitter.emit(beat.Event{Fields: common.MapStr{"message": "summary"}})
+
+	done := make(chan struct{})
+	go func() {
+		counter.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for all events to be ACKed")
+	}
+
+	assert.Equal(t, uint64(4), counter.added.Get())
+	assert.Equal(t, uint64(4), counter.done.Get())
+	assert.Equal(t, int64(0), counter.count.Get())
+}
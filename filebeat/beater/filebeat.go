@@ -29,6 +29,7 @@ import (
 	cfg "github.com/elastic/beats/v7/filebeat/config"
 	"github.com/elastic/beats/v7/filebeat/fileset"
 	_ "github.com/elastic/beats/v7/filebeat/include"
+	"github.com/elastic/beats/v7/filebeat/ingest"
 	"github.com/elastic/beats/v7/filebeat/input"
 	v2 "github.com/elastic/beats/v7/filebeat/input/v2"
 	"github.com/elastic/beats/v7/filebeat/input/v2/compat"
@@ -216,12 +217,34 @@ func (fb *Filebeat) loadModulesPipelines(b *beat.Beat) error {
 	return err
 }
 
+// loadLocalPipelines compiles the ingest pipelines of the configured modules,
+// to be executed by Filebeat instead of Elasticsearch.
+func (fb *Filebeat) loadLocalPipelines(b *beat.Beat) (*ingest.Registry, error) {
+	version, err := common.NewVersion(b.Info.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	registry := ingest.NewRegistry()
+	if err := fb.moduleRegistry.LoadLocalPipelines(registry, *version); err != nil {
+		return nil, err
+	}
+	logp.Info("Ingest pipelines of modules are executed by Filebeat: %v", registry.IDs())
+	return registry, nil
+}
+
 // Run allows the beater to be run as a beat.
 func (fb *Filebeat) Run(b *beat.Beat) error {
 	var err error
 	config := fb.config
 
-	if !fb.moduleRegistry.Empty() {
+	var localPipelines *ingest.Registry
+	if config.PipelineLocal {
+		localPipelines, err = fb.loadLocalPipelines(b)
+		if err != nil {
+			return err
+		}
+	} else if !fb.moduleRegistry.Empty() {
 		err = fb.loadModulesPipelines(b)
 		if err != nil {
 			return err
@@ -277,14 +300,24 @@ func (fb *Filebeat) Run(b *beat.Beat) error {
 	// guarantees explicitly when connecting with the pipeline.
 	fb.pipeline = pipetool.WithDefaultGuarantees(fb.pipeline, beat.GuaranteedSend)
 
+	// Execute the module ingest pipelines before publishing the events, if
+	// the pipelines are not executed by Elasticsearch.
+	if localPipelines != nil {
+		fb.pipeline = ingest.WithLocalPipelines(fb.pipeline, localPipelines)
+	}
+
 	outDone := make(chan struct{}) // outDone closes down all active pipeline connections
 	pipelineConnector := channel.NewOutletFactory(outDone).Create
 
 	// Create a ES connection factory for dynamic modules pipeline loading
 	var pipelineLoaderFactory fileset.PipelineLoaderFactory
-	if b.Config.Output.Name() == "elasticsearch" {
+	var localPipelineRegistry fileset.LocalPipelineRegistry
+	switch {
+	case localPipelines != nil:
+		localPipelineRegistry = localPipelines
+	case b.Config.Output.Name() == "elasticsearch":
 		pipelineLoaderFactory = newPipelineLoaderFactory(b.Config.Output.Config())
-	} else {
+	default:
 		logp.Warn(pipelinesWarning)
 	}
 
@@ -306,7 +339,7 @@ func (fb *Filebeat) Run(b *beat.Beat) error {
 		compat.RunnerFactory(inputsLogger, b.Info, v2InputLoader),
 		input.NewRunnerFactory(pipelineConnector, registrar, fb.done),
 	))
-	moduleLoader := fileset.NewFactory(inputLoader, b.Info, pipelineLoaderFactory, config.OverwritePipelines)
+	moduleLoader := fileset.NewFactory(inputLoader, b.Info, pipelineLoaderFactory, config.OverwritePipelines, localPipelineRegistry)
 
 	crawler, err := newCrawler(inputLoader, moduleLoader, config.Inputs, fb.done, *once)
 	if err != nil {
@@ -47,6 +47,7 @@ type Factory struct {
 	overwritePipelines    bool
 	pipelineCallbackID    uuid.UUID
 	inputFactory          cfgfile.RunnerFactory
+	localPipelines        LocalPipelineRegistry
 }
 
 // Wrap an array of inputs and implements cfgfile.Runner interface
@@ -65,6 +66,7 @@ func NewFactory(
 	beatInfo beat.Info,
 	pipelineLoaderFactory PipelineLoaderFactory,
 	overwritePipelines bool,
+	localPipelines LocalPipelineRegistry,
 ) *Factory {
 	return &Factory{
 		inputFactory:          inputFactory,
@@ -72,6 +74,7 @@ func NewFactory(
 		pipelineLoaderFactory: pipelineLoaderFactory,
 		pipelineCallbackID:    uuid.Nil,
 		overwritePipelines:    overwritePipelines,
+		localPipelines:        localPipelines,
 	}
 }
 
@@ -88,6 +91,18 @@ func (f *Factory) Create(p beat.PipelineConnector, c *common.Config) (cfgfile.Ru
 		return nil, err
 	}
 
+	// Pipelines executed by Filebeat are loaded on creation, so they are
+	// available as soon as the inputs start publishing.
+	if f.localPipelines != nil {
+		version, err := common.NewVersion(f.beatInfo.Version)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.LoadLocalPipelines(f.localPipelines, *version); err != nil {
+			return nil, err
+		}
+	}
+
 	// Hash module ID
 	var h map[string]interface{}
 	c.Unpack(&h)
@@ -112,6 +112,34 @@ func (reg *ModuleRegistry) LoadPipelines(esClient PipelineLoader, overwrite bool
 	return nil
 }
 
+// LocalPipelineRegistry stores the pipelines that are executed by Filebeat
+// before the events are published, instead of by Elasticsearch.
+type LocalPipelineRegistry interface {
+	Register(id string, definition map[string]interface{}) error
+}
+
+// LoadLocalPipelines registers the pipelines of each configured fileset with
+// the local pipeline registry. The pipelines are rendered for the given
+// Elasticsearch version.
+func (reg *ModuleRegistry) LoadLocalPipelines(registry LocalPipelineRegistry, esVersion common.Version) error {
+	for module, filesets := range reg.registry {
+		for name, fileset := range filesets {
+			pipelines, err := fileset.GetPipelines(esVersion)
+			if err != nil {
+				return fmt.Errorf("Error getting pipeline for fileset %s/%s: %v", module, name, err)
+			}
+
+			for _, pipeline := range pipelines {
+				if err := registry.Register(pipeline.id, pipeline.contents); err != nil {
+					return fmt.Errorf("Error loading local pipeline for fileset %s/%s: %v", module, name, err)
+				}
+				logp.Debug("modules", "Local pipeline with ID '%s' loaded", pipeline.id)
+			}
+		}
+	}
+	return nil
+}
+
 func loadPipeline(esClient PipelineLoader, pipelineID string, content map[string]interface{}, overwrite bool) error {
 	path := makeIngestPipelinePath(pipelineID)
 	if !overwrite {
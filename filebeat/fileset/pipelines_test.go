@@ -20,15 +20,21 @@
 package fileset
 
 import (
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
 	"testing"
 	"time"
 
+	"github.com/elastic/beats/v7/filebeat/ingest"
 	"github.com/elastic/beats/v7/libbeat/common"
 	"github.com/elastic/beats/v7/libbeat/esleg/eslegclient"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLoadPipelinesWithMultiPipelineFileset(t *testing.T) {
@@ -107,6 +113,127 @@ func TestLoadPipelinesWithMultiPipelineFileset(t *testing.T) {
 	}
 }
 
+func TestLoadLocalPipelines(t *testing.T) {
+	fs := getModuleForTesting(t, "system", "syslog")
+	require.NoError(t, fs.Read(makeTestInfo("7.10.0")))
+	reg := ModuleRegistry{
+		registry: map[string]map[string]*Fileset{
+			"system": {"syslog": fs},
+		},
+	}
+
+	registry := ingest.NewRegistry()
+	err := reg.LoadLocalPipelines(registry, *common.MustNewVersion("7.10.0"))
+	require.NoError(t, err)
+
+	pipelineID := "filebeat-7.10.0-system-syslog-pipeline"
+	assert.Equal(t, []string{pipelineID}, registry.IDs())
+
+	fields := common.MapStr{
+		"@timestamp": time.Now(),
+		"message":    "Dec 13 11:35:28 a-mac-with-esc-key GoogleSoftwareUpdateAgent[21412]: update check finished",
+		"event":      common.MapStr{"timezone": "-02:00"},
+	}
+	keep, err := registry.Run(pipelineID, fields)
+	require.NoError(t, err)
+	assert.True(t, keep)
+
+	ts := fields["@timestamp"].(time.Time)
+	assert.Equal(t, time.Date(time.Now().Year(), 12, 13, 13, 35, 28, 0, time.UTC), ts.UTC())
+
+	delete(fields, "@timestamp")
+	fields.Delete("event.ingested")
+	assert.Equal(t, common.MapStr{
+		"message": "update check finished",
+		"event":   common.MapStr{"timezone": "-02:00", "kind": "event"},
+		"host":    common.MapStr{"hostname": "a-mac-with-esc-key"},
+		"process": common.MapStr{"name": "GoogleSoftwareUpdateAgent", "pid": int64(21412)},
+		"related": common.MapStr{"hosts": []interface{}{"a-mac-with-esc-key"}},
+		"system":  common.MapStr{"syslog": common.MapStr{}},
+	}, fields)
+}
+
+func TestLoadLocalPipelinesUnsupported(t *testing.T) {
+	fs := getModuleForTesting(t, "nginx", "access")
+	require.NoError(t, fs.Read(makeTestInfo("7.10.0")))
+	reg := ModuleRegistry{
+		registry: map[string]map[string]*Fileset{
+			"nginx": {"access": fs},
+		},
+	}
+
+	registry := ingest.NewRegistry()
+	err := reg.LoadLocalPipelines(registry, *common.MustNewVersion("7.10.0"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Error loading local pipeline for fileset nginx/access")
+	assert.Contains(t, err.Error(), "unknown variable 'def'")
+	assert.Empty(t, registry.IDs())
+}
+
+// TestLoadLocalPipelinesAllModules compiles the pipelines of all modules. A
+// pipeline is either compiled completely or rejected, such that no fileset
+// runs with processors that fail for each event.
+func TestLoadLocalPipelinesAllModules(t *testing.T) {
+	version := "7.10.0"
+	modules, err := ioutil.ReadDir("../module")
+	require.NoError(t, err)
+
+	var supported []string
+	for _, module := range modules {
+		filesets, err := ioutil.ReadDir(filepath.Join("../module", module.Name()))
+		require.NoError(t, err)
+
+		for _, fileset := range filesets {
+			manifest := filepath.Join("../module", module.Name(), fileset.Name(), "manifest.yml")
+			if _, err := os.Stat(manifest); err != nil {
+				continue
+			}
+
+			name := module.Name() + "/" + fileset.Name()
+			fs := getModuleForTesting(t, module.Name(), fileset.Name())
+			require.NoError(t, fs.Read(makeTestInfo(version)), name)
+			pipelines, err := fs.GetPipelines(*common.MustNewVersion(version))
+			require.NoError(t, err, name)
+
+			ok := true
+			for _, pipeline := range pipelines {
+				if err := ingest.NewRegistry().Register(pipeline.id, pipeline.contents); err != nil {
+					t.Logf("%s can not be run locally: %v", name, err)
+					ok = false
+				}
+			}
+			if ok {
+				supported = append(supported, name)
+			}
+		}
+	}
+
+	sort.Strings(supported)
+	assert.Equal(t, []string{
+		"elasticsearch/audit",
+		"elasticsearch/deprecation",
+		"elasticsearch/gc",
+		"elasticsearch/server",
+		"elasticsearch/slowlog",
+		"icinga/debug",
+		"icinga/main",
+		"icinga/startup",
+		"kafka/log",
+		"kibana/log",
+		"logstash/log",
+		"logstash/slowlog",
+		"mongodb/log",
+		"mysql/error",
+		"nats/log",
+		"nginx/error",
+		"postgresql/log",
+		"redis/log",
+		"redis/slowlog",
+		"santa/log",
+		"system/syslog",
+	}, supported)
+}
+
 func TestSetEcsProcessors(t *testing.T) {
 	cases := []struct {
 		name          string
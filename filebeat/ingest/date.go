@@ -0,0 +1,313 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type dateProcessor struct {
+	field        string
+	target       string
+	formats      []dateFormat
+	timezone     *template
+	outputFormat string
+}
+
+// dateFormat parses a date with one of the formats supported by the date
+// processor.
+type dateFormat func(s string, loc *time.Location, now time.Time) (time.Time, error)
+
+func newDate(o options) (processor, error) {
+	p := &dateProcessor{}
+	var err error
+	if p.field, err = o.string("field", true); err != nil {
+		return nil, err
+	}
+	if p.target, err = o.string("target_field", false); err != nil {
+		return nil, err
+	}
+	if p.target == "" {
+		p.target = timestampKey
+	}
+
+	timezone, err := o.string("timezone", false)
+	if err != nil {
+		return nil, err
+	}
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	if p.timezone, err = compileTemplate(timezone); err != nil {
+		return nil, err
+	}
+
+	formats, err := o.strings("formats", true)
+	if err != nil {
+		return nil, err
+	}
+	if len(formats) == 0 {
+		return nil, errors.New("[formats] property isn't a list, but of type [null]")
+	}
+	for _, format := range formats {
+		f, err := compileDateFormat(format)
+		if err != nil {
+			return nil, fmt.Errorf("[formats] %v", err)
+		}
+		p.formats = append(p.formats, f)
+	}
+
+	if output, err := o.string("output_format", false); err != nil {
+		return nil, err
+	} else if output != "" {
+		layout, _, err := javaToGoLayout(output)
+		if err != nil {
+			return nil, fmt.Errorf("[output_format] %v", err)
+		}
+		p.outputFormat = layout
+	}
+	return p, nil
+}
+
+func (p *dateProcessor) run(_ *runContext, doc *document) error {
+	v, _, err := fieldValue(doc, p.field, false)
+	if err != nil {
+		return err
+	}
+
+	loc, err := parseTimezone(p.timezone.render(doc))
+	if err != nil {
+		return err
+	}
+
+	value := toString(v)
+	if n, ok := toNumber(v); ok {
+		value = fmt.Sprint(n)
+	}
+
+	now := time.Now().In(loc)
+	var lastErr error
+	for _, format := range p.formats {
+		t, err := format(value, loc, now)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		var result interface{} = t
+		if p.outputFormat != "" {
+			result = t.Format(p.outputFormat)
+		}
+		return doc.put(p.target, result)
+	}
+	return fmt.Errorf("unable to parse date [%s]: %v", value, lastErr)
+}
+
+func parseTimezone(tz string) (*time.Location, error) {
+	switch tz {
+	case "", "UTC", "Z":
+		return time.UTC, nil
+	}
+
+	if tz[0] == '+' || tz[0] == '-' {
+		for _, layout := range []string{"-07:00", "-0700", "-07"} {
+			if t, err := time.Parse(layout, tz); err == nil {
+				_, offset := t.Zone()
+				return time.FixedZone(tz, offset), nil
+			}
+		}
+	}
+
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time-zone ID: %s", tz)
+	}
+	return loc, nil
+}
+
+// iso8601Layouts are the layouts accepted by the ISO8601 format. Fractional
+// seconds are accepted by all layouts with seconds.
+var iso8601Layouts = []string{
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+func compileDateFormat(format string) (dateFormat, error) {
+	switch format {
+	case "ISO8601", "ISO_INSTANT", "ISO_DATE_TIME", "ISO_OFFSET_DATE_TIME", "ISO_LOCAL_DATE_TIME",
+		"strict_date_optional_time", "date_optional_time":
+		return func(s string, loc *time.Location, _ time.Time) (time.Time, error) {
+			var err error
+			for _, layout := range iso8601Layouts {
+				var t time.Time
+				if t, err = time.ParseInLocation(layout, s, loc); err == nil {
+					return t, nil
+				}
+			}
+			return time.Time{}, err
+		}, nil
+
+	case "UNIX":
+		return func(s string, _ *time.Location, _ time.Time) (time.Time, error) {
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			sec, frac := math.Modf(f)
+			return time.Unix(int64(sec), int64(math.Round(frac*1e3))*int64(time.Millisecond)).UTC(), nil
+		}, nil
+
+	case "UNIX_MS":
+		return func(s string, _ *time.Location, _ time.Time) (time.Time, error) {
+			ms, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return time.Unix(0, ms*int64(time.Millisecond)).UTC(), nil
+		}, nil
+
+	case "TAI64N":
+		return parseTAI64N, nil
+	}
+
+	layout, hasYear, err := javaToGoLayout(format)
+	if err != nil {
+		return nil, err
+	}
+	return func(s string, loc *time.Location, now time.Time) (time.Time, error) {
+		t, err := time.ParseInLocation(layout, s, loc)
+		if err != nil {
+			return t, err
+		}
+		if !hasYear {
+			t = time.Date(now.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+		}
+		return t, nil
+	}, nil
+}
+
+func parseTAI64N(s string, _ *time.Location, _ time.Time) (time.Time, error) {
+	s = strings.TrimPrefix(s, "@")
+	if len(s) != 24 {
+		return time.Time{}, fmt.Errorf("invalid TAI64N value [%s]", s)
+	}
+	sec, err := strconv.ParseUint(s[:16], 16, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	nsec, err := strconv.ParseUint(s[16:], 16, 32)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(int64(sec-(1<<62))-10, int64(nsec)).UTC(), nil
+}
+
+// javaToGoLayout converts a Java date pattern to a Go time layout. It reports
+// whether the pattern contains a year.
+func javaToGoLayout(pattern string) (string, bool, error) {
+	var sb strings.Builder
+	hasYear := false
+
+	for i := 0; i < len(pattern); {
+		c := pattern[i]
+
+		if c == '\'' {
+			end := strings.IndexByte(pattern[i+1:], '\'')
+			if end < 0 {
+				return "", false, fmt.Errorf("unterminated quote in date pattern [%s]", pattern)
+			}
+			if end == 0 {
+				sb.WriteByte('\'')
+			} else {
+				sb.WriteString(pattern[i+1 : i+1+end])
+			}
+			i += end + 2
+			continue
+		}
+
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			sb.WriteByte(c)
+			i++
+			continue
+		}
+
+		n := 1
+		for i+n < len(pattern) && pattern[i+n] == c {
+			n++
+		}
+		i += n
+
+		var layout string
+		switch c {
+		case 'y', 'u', 'Y':
+			hasYear = true
+			layout = pick(n, "2006", "06", "2006")
+		case 'M', 'L':
+			layout = pick(n, "1", "01", "Jan", "January")
+		case 'd':
+			layout = pick(n, "2", "02")
+		case 'H', 'k':
+			layout = "15"
+		case 'h', 'K':
+			layout = pick(n, "3", "03")
+		case 'm':
+			layout = pick(n, "4", "04")
+		case 's':
+			layout = pick(n, "5", "05")
+		case 'S':
+			if s := sb.String(); len(s) == 0 || (s[len(s)-1] != '.' && s[len(s)-1] != ',') {
+				return "", false, fmt.Errorf("fraction of seconds must follow a '.' or ',' in date pattern [%s]", pattern)
+			}
+			layout = strings.Repeat("0", n)
+		case 'a':
+			layout = "PM"
+		case 'E':
+			layout = pick(n, "Mon", "Mon", "Mon", "Monday")
+		case 'Z':
+			layout = pick(n, "Z0700", "Z07:00", "MST")
+		case 'X':
+			layout = pick(n, "Z07", "Z0700", "Z07:00")
+		case 'x':
+			layout = pick(n, "-07", "-0700", "-07:00")
+		case 'z':
+			layout = "MST"
+		default:
+			return "", false, fmt.Errorf("unsupported pattern letter '%c' in date pattern [%s]", c, pattern)
+		}
+		sb.WriteString(layout)
+	}
+	return sb.String(), hasYear, nil
+}
+
+// pick returns the layout for a pattern letter repeated n times. Counts
+// larger than the number of layouts use the last layout.
+func pick(n int, layouts ...string) string {
+	if n > len(layouts) {
+		n = len(layouts)
+	}
+	return layouts[n-1]
+}
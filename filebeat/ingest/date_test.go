@@ -0,0 +1,132 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ingest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJavaToGoLayout(t *testing.T) {
+	cases := map[string]struct {
+		layout  string
+		hasYear bool
+	}{
+		"MMM  d HH:mm:ss":                   {"Jan  2 15:04:05", false},
+		"yyyy-MM-dd'T'HH:mm:ss.SSSZ":        {"2006-01-02T15:04:05.000Z0700", true},
+		"dd/MMM/yyyy:HH:mm:ss Z":            {"02/Jan/2006:15:04:05 Z0700", true},
+		"EEE MMM dd HH:mm:ss yyyy":          {"Mon Jan 02 15:04:05 2006", true},
+		"yyyy-MM-dd HH:mm:ss,SSS":           {"2006-01-02 15:04:05,000", true},
+		"yy-M-d h:mm:ss a XXX":              {"06-1-2 3:04:05 PM Z07:00", true},
+		"EEEE, dd MMMM yyyy 'at' HH'h'mm z": {"Monday, 02 January 2006 at 15h04 MST", true},
+	}
+
+	for pattern, test := range cases {
+		t.Run(pattern, func(t *testing.T) {
+			layout, hasYear, err := javaToGoLayout(pattern)
+			require.NoError(t, err)
+			assert.Equal(t, test.layout, layout)
+			assert.Equal(t, test.hasYear, hasYear)
+		})
+	}
+
+	for _, pattern := range []string{"ss SSS", "yyyy-MM-dd G", "'unterminated"} {
+		_, _, err := javaToGoLayout(pattern)
+		assert.Error(t, err, pattern)
+	}
+}
+
+func TestDateFormats(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := map[string]struct {
+		format string
+		value  string
+		loc    *time.Location
+		want   time.Time
+	}{
+		"ISO8601 with zone": {
+			format: "ISO8601",
+			value:  "2020-03-04T05:06:07.123+02:00",
+			want:   time.Date(2020, 3, 4, 3, 6, 7, 123000000, time.UTC),
+		},
+		"ISO8601 local time": {
+			format: "ISO8601",
+			value:  "2020-03-04T05:06:07",
+			loc:    berlin,
+			want:   time.Date(2020, 3, 4, 4, 6, 7, 0, time.UTC),
+		},
+		"UNIX": {
+			format: "UNIX",
+			value:  "1583298367.5",
+			want:   time.Date(2020, 3, 4, 5, 6, 7, 500000000, time.UTC),
+		},
+		"UNIX_MS": {
+			format: "UNIX_MS",
+			value:  "1583298367123",
+			want:   time.Date(2020, 3, 4, 5, 6, 7, 123000000, time.UTC),
+		},
+		"TAI64N": {
+			format: "TAI64N",
+			value:  "@4000000050d506482dbdf024",
+			want:   time.Date(2012, 12, 22, 1, 0, 46, 767422500, time.UTC),
+		},
+		"pattern without year": {
+			format: "MMM  d HH:mm:ss",
+			value:  "Dec  4 10:11:12",
+			want:   time.Date(2020, 12, 4, 10, 11, 12, 0, time.UTC),
+		},
+		"pattern with zone": {
+			format: "dd/MMM/yyyy:HH:mm:ss Z",
+			value:  "04/Mar/2020:05:06:07 -0100",
+			loc:    berlin,
+			want:   time.Date(2020, 3, 4, 6, 6, 7, 0, time.UTC),
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			loc := test.loc
+			if loc == nil {
+				loc = time.UTC
+			}
+
+			format, err := compileDateFormat(test.format)
+			require.NoError(t, err)
+
+			got, err := format(test.value, loc, now)
+			require.NoError(t, err)
+			assert.True(t, test.want.Equal(got), "expected %v, got %v", test.want, got)
+		})
+	}
+}
+
+func TestParseTimezone(t *testing.T) {
+	for _, tz := range []string{"UTC", "Europe/Berlin", "+02:00", "-0530"} {
+		_, err := parseTimezone(tz)
+		assert.NoError(t, err, tz)
+	}
+
+	_, err := parseTimezone("Mars/Olympus")
+	assert.Error(t, err)
+}
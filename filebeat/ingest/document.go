@@ -0,0 +1,230 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+const (
+	ingestKey    = "_ingest"
+	ingestPrefix = ingestKey + "."
+	timestampKey = "@timestamp"
+	idKey        = "_id"
+)
+
+// document is the ingest document processed by a pipeline. The fields hold
+// the document source, and the ingest metadata is available to processors
+// and templates via the _ingest prefix.
+type document struct {
+	fields common.MapStr
+	ingest common.MapStr
+}
+
+func newDocument(fields common.MapStr, now time.Time) *document {
+	return &document{
+		fields: fields,
+		ingest: common.MapStr{"timestamp": now},
+	}
+}
+
+func (d *document) target(key string) (common.MapStr, string) {
+	if strings.HasPrefix(key, ingestPrefix) {
+		return d.ingest, key[len(ingestPrefix):]
+	}
+	return d.fields, key
+}
+
+func (d *document) get(key string) (interface{}, error) {
+	m, k := d.target(key)
+	return m.GetValue(k)
+}
+
+func (d *document) has(key string) bool {
+	m, k := d.target(key)
+	ok, _ := m.HasKey(k)
+	return ok
+}
+
+func (d *document) put(key string, v interface{}) error {
+	m, k := d.target(key)
+	_, err := m.Put(k, v)
+	return err
+}
+
+func (d *document) remove(key string) error {
+	m, k := d.target(key)
+	return m.Delete(k)
+}
+
+// getString reads a string field. The returned flag is false if the field
+// does not exist or is null.
+func (d *document) getString(key string) (string, bool, error) {
+	v, err := d.get(key)
+	if err != nil {
+		if errors.Cause(err) == common.ErrKeyNotFound {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	if v == nil {
+		return "", false, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", false, fmt.Errorf("field [%s] of type [%s] cannot be cast to [String]", key, typeName(v))
+	}
+	return s, true, nil
+}
+
+// template is a compiled mustache template, as used in the values of set,
+// append and fail processors. Only variable substitutions are supported.
+type template struct {
+	parts []templatePart
+}
+
+type templatePart struct {
+	literal string
+	field   string
+}
+
+func compileTemplate(s string) (*template, error) {
+	t := &template{}
+	for len(s) > 0 {
+		start := strings.Index(s, "{{")
+		if start < 0 {
+			t.parts = append(t.parts, templatePart{literal: s})
+			break
+		}
+		if start > 0 {
+			t.parts = append(t.parts, templatePart{literal: s[:start]})
+		}
+
+		open, close := "{{", "}}"
+		if strings.HasPrefix(s[start:], "{{{") {
+			open, close = "{{{", "}}}"
+		}
+		end := strings.Index(s[start+len(open):], close)
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated template variable in '%s'", s)
+		}
+		field := strings.TrimSpace(s[start+len(open) : start+len(open)+end])
+		if field == "" || strings.ContainsAny(field, "#^/!>&") {
+			return nil, fmt.Errorf("unsupported template expression '%s'", field)
+		}
+		t.parts = append(t.parts, templatePart{field: field})
+		s = s[start+len(open)+end+len(close):]
+	}
+	return t, nil
+}
+
+// isConst reports whether the template does not reference any fields.
+func (t *template) isConst() bool {
+	for _, p := range t.parts {
+		if p.field != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *template) render(d *document) string {
+	if len(t.parts) == 1 && t.parts[0].field == "" {
+		return t.parts[0].literal
+	}
+
+	var sb strings.Builder
+	for _, p := range t.parts {
+		if p.field == "" {
+			sb.WriteString(p.literal)
+			continue
+		}
+
+		v, err := d.get(p.field)
+		if err != nil || v == nil {
+			continue
+		}
+		sb.WriteString(templateString(v))
+	}
+	return sb.String()
+}
+
+func templateString(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	case common.MapStr, map[string]interface{}, []interface{}:
+		b, err := json.Marshal(x)
+		if err != nil {
+			return fmt.Sprint(x)
+		}
+		return string(b)
+	}
+	return toString(v)
+}
+
+// valueTemplate renders processor values. String values are rendered as
+// templates, all other values are used as is.
+type valueTemplate struct {
+	value    interface{}
+	template *template
+}
+
+func compileValue(v interface{}) (*valueTemplate, error) {
+	s, ok := v.(string)
+	if !ok {
+		return &valueTemplate{value: v}, nil
+	}
+	t, err := compileTemplate(s)
+	if err != nil {
+		return nil, err
+	}
+	return &valueTemplate{template: t}, nil
+}
+
+func (v *valueTemplate) render(d *document) interface{} {
+	if v.template != nil {
+		return v.template.render(d)
+	}
+	return deepCopy(v.value)
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch x := v.(type) {
+	case common.MapStr:
+		return x.Clone()
+	case map[string]interface{}:
+		return common.MapStr(x).Clone()
+	case []interface{}:
+		l := make([]interface{}, len(x))
+		for i, item := range x {
+			l[i] = deepCopy(item)
+		}
+		return l
+	}
+	return v
+}
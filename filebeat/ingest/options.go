@@ -0,0 +1,112 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ingest
+
+import (
+	"fmt"
+)
+
+// options gives typed access to the configuration of a processor, following
+// the rules Elasticsearch applies to processor configurations.
+type options map[string]interface{}
+
+func (o options) string(key string, required bool) (string, error) {
+	v, ok := o[key]
+	if !ok || v == nil {
+		if required {
+			return "", fmt.Errorf("[%s] required property is missing", key)
+		}
+		return "", nil
+	}
+
+	switch s := v.(type) {
+	case string:
+		return s, nil
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(s), nil
+	}
+	return "", fmt.Errorf("[%s] property isn't a string, but of type [%T]", key, v)
+}
+
+func (o options) bool(key string, def bool) (bool, error) {
+	v, ok := o[key]
+	if !ok || v == nil {
+		return def, nil
+	}
+
+	switch b := v.(type) {
+	case bool:
+		return b, nil
+	case string:
+		switch b {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("[%s] property isn't a boolean, but of type [%T]", key, v)
+}
+
+// strings reads a property that can be a single string or a list of strings.
+func (o options) strings(key string, required bool) ([]string, error) {
+	v, ok := o[key]
+	if !ok || v == nil {
+		if required {
+			return nil, fmt.Errorf("[%s] required property is missing", key)
+		}
+		return nil, nil
+	}
+
+	if s, ok := v.(string); ok {
+		return []string{s}, nil
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("[%s] property isn't a list, but of type [%T]", key, v)
+	}
+	strs := make([]string, len(list))
+	for i, item := range list {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("[%s] list must only contain strings, found [%T]", key, item)
+		}
+		strs[i] = s
+	}
+	return strs, nil
+}
+
+func (o options) stringMap(key string) (map[string]string, error) {
+	v, ok := o[key]
+	if !ok || v == nil {
+		return nil, nil
+	}
+	m, ok := toMap(v)
+	if !ok {
+		return nil, fmt.Errorf("[%s] property isn't a map, but of type [%T]", key, v)
+	}
+	strs := make(map[string]string, len(m))
+	for k, item := range m {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("[%s] map must only contain strings, found [%T] for key [%s]", key, item, k)
+		}
+		strs[k] = s
+	}
+	return strs, nil
+}
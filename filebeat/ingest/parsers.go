@@ -0,0 +1,158 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ingest
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/elastic/beats/v7/libbeat/processors/dissect"
+	"github.com/elastic/beats/v7/libbeat/processors/grok"
+)
+
+type grokProcessor struct {
+	field         string
+	patterns      []*grok.Grok
+	ignoreMissing bool
+	traceMatch    bool
+}
+
+func newGrok(o options) (processor, error) {
+	p := &grokProcessor{}
+	var err error
+	if p.field, err = o.string("field", true); err != nil {
+		return nil, err
+	}
+	if p.ignoreMissing, err = o.bool("ignore_missing", false); err != nil {
+		return nil, err
+	}
+	if p.traceMatch, err = o.bool("trace_match", false); err != nil {
+		return nil, err
+	}
+
+	patterns, err := o.strings("patterns", true)
+	if err != nil {
+		return nil, err
+	}
+	if len(patterns) == 0 {
+		return nil, errors.New("[patterns] List of patterns must not be empty")
+	}
+	custom, err := o.stringMap("pattern_definitions")
+	if err != nil {
+		return nil, err
+	}
+
+	definitions := grok.DefaultPatterns()
+	for name, definition := range custom {
+		definitions[name] = definition
+	}
+	for _, pattern := range patterns {
+		g, err := grok.Compile(definitions, pattern)
+		if err != nil {
+			return nil, fmt.Errorf("[patterns] Invalid regex pattern found in: %v. %v", patterns, err)
+		}
+		p.patterns = append(p.patterns, g)
+	}
+	return p, nil
+}
+
+func (p *grokProcessor) run(_ *runContext, doc *document) error {
+	v, ok, err := fieldValue(doc, p.field, p.ignoreMissing)
+	if !ok {
+		return err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("field [%s] of type [%s] cannot be cast to [String]", p.field, typeName(v))
+	}
+
+	for i, g := range p.patterns {
+		captures, err := g.Match(s)
+		if err != nil {
+			return err
+		}
+		if captures == nil {
+			continue
+		}
+
+		for k, v := range captures.Flatten() {
+			if err := doc.put(k, v); err != nil {
+				return err
+			}
+		}
+		if p.traceMatch && len(p.patterns) > 1 {
+			doc.ingest["_grok_match_index"] = fmt.Sprint(i)
+		}
+		return nil
+	}
+	return errors.New("Provided Grok expressions do not match field value: [" + s + "]")
+}
+
+type dissectProcessor struct {
+	field         string
+	dissector     *dissect.Dissector
+	ignoreMissing bool
+}
+
+func newDissect(o options) (processor, error) {
+	p := &dissectProcessor{}
+	var err error
+	if p.field, err = o.string("field", true); err != nil {
+		return nil, err
+	}
+	if p.ignoreMissing, err = o.bool("ignore_missing", false); err != nil {
+		return nil, err
+	}
+	if sep, err := o.string("append_separator", false); err != nil || sep != "" {
+		if err == nil {
+			err = errors.New("[append_separator] custom append separators are not supported")
+		}
+		return nil, err
+	}
+
+	pattern, err := o.string("pattern", true)
+	if err != nil {
+		return nil, err
+	}
+	if p.dissector, err = dissect.New(pattern); err != nil {
+		return nil, fmt.Errorf("[pattern] %v", err)
+	}
+	return p, nil
+}
+
+func (p *dissectProcessor) run(_ *runContext, doc *document) error {
+	v, ok, err := fieldValue(doc, p.field, p.ignoreMissing)
+	if !ok {
+		return err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("field [%s] of type [%s] cannot be cast to [String]", p.field, typeName(v))
+	}
+
+	m, err := p.dissector.Dissect(s)
+	if err != nil {
+		return fmt.Errorf("Unable to find match for dissect pattern: %s against source: %s", p.dissector.Raw(), s)
+	}
+	for k, v := range m {
+		if err := doc.put(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// errDropped is returned by the drop processor to stop the execution of all
+// pipelines and to drop the document.
+var errDropped = errors.New("document dropped")
+
+// Registry holds the compiled pipelines that can be executed locally. Pipelines
+// are referenced by their ID, the same way Elasticsearch references the ingest
+// pipelines of the filesets.
+type Registry struct {
+	mu        sync.RWMutex
+	pipelines map[string]*Pipeline
+}
+
+// Pipeline is a compiled ingest pipeline.
+type Pipeline struct {
+	id         string
+	processors []*processorNode
+	onFailure  []*processorNode
+}
+
+// processorNode wraps a processor with the options common to all processor
+// types.
+type processorNode struct {
+	typ           string
+	tag           string
+	condition     *script
+	ignoreFailure bool
+	onFailure     []*processorNode
+	processor     processor
+}
+
+// processor is implemented by all ingest processors.
+type processor interface {
+	run(ctx *runContext, doc *document) error
+}
+
+// runContext holds the state of a single pipeline execution.
+type runContext struct {
+	registry *Registry
+	stack    []string
+}
+
+// processorError is returned if a processor fails. It keeps the type and tag
+// of the failed processor, for use by on_failure handlers.
+type processorError struct {
+	typ string
+	tag string
+	err error
+}
+
+func (e *processorError) Error() string { return e.err.Error() }
+
+// NewRegistry creates an empty pipeline registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		pipelines: map[string]*Pipeline{},
+	}
+}
+
+// Register compiles the pipeline definition and stores it under the given ID.
+// An existing pipeline with the same ID is replaced.
+// The pipeline is rejected if it contains processors the local engine does not
+// support, or processors and conditions using features that can not be
+// compiled, as the events would not be parsed the way Elasticsearch parses
+// them.
+func (r *Registry) Register(id string, definition map[string]interface{}) error {
+	p, err := compile(id, definition)
+	if err != nil {
+		return fmt.Errorf("failed to compile pipeline '%s': %v", id, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pipelines[id] = p
+	return nil
+}
+
+// Has checks if a pipeline with the given ID has been registered.
+func (r *Registry) Has(id string) bool {
+	return r.get(id) != nil
+}
+
+// IDs returns the sorted list of registered pipeline IDs.
+func (r *Registry) IDs() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ids := make([]string, 0, len(r.pipelines))
+	for id := range r.pipelines {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (r *Registry) get(id string) *Pipeline {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.pipelines[id]
+}
+
+// Run executes the pipeline with the given ID on the fields. The fields are
+// modified in place. The returned flag is false if the document has been
+// dropped by a drop processor.
+func (r *Registry) Run(id string, fields common.MapStr) (bool, error) {
+	p := r.get(id)
+	if p == nil {
+		return false, fmt.Errorf("pipeline with id [%s] does not exist", id)
+	}
+
+	ctx := &runContext{registry: r, stack: []string{id}}
+	doc := newDocument(fields, time.Now().UTC())
+	doc.ingest["pipeline"] = id
+	err := p.run(ctx, doc)
+	if err == errDropped {
+		return false, nil
+	}
+	return true, err
+}
+
+func compile(id string, definition map[string]interface{}) (*Pipeline, error) {
+	p := &Pipeline{id: id}
+
+	var err error
+	if p.processors, err = compileProcessors(definition["processors"]); err != nil {
+		return nil, err
+	}
+	if p.onFailure, err = compileProcessors(definition["on_failure"]); err != nil {
+		return nil, fmt.Errorf("on_failure: %v", err)
+	}
+	return p, nil
+}
+
+func compileProcessors(v interface{}) ([]*processorNode, error) {
+	if v == nil {
+		return nil, nil
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("processors must be a list, found %T", v)
+	}
+
+	var nodes []*processorNode
+	for i, item := range list {
+		definition, ok := toMap(item)
+		if !ok || len(definition) != 1 {
+			return nil, fmt.Errorf("processor %d must be an object with a single processor type", i)
+		}
+
+		for typ, cfg := range definition {
+			node, err := compileProcessor(typ, cfg)
+			if err != nil {
+				return nil, fmt.Errorf("processor %d [%s]: %v", i, typ, err)
+			}
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, nil
+}
+
+func compileProcessor(typ string, cfg interface{}) (*processorNode, error) {
+	opts, ok := toMap(cfg)
+	if !ok {
+		if typ != "drop" || cfg != nil {
+			return nil, fmt.Errorf("configuration must be an object, found %T", cfg)
+		}
+		opts = map[string]interface{}{}
+	}
+	o := options(opts)
+
+	node := &processorNode{typ: typ}
+	var err error
+	if node.tag, err = o.string("tag", false); err != nil {
+		return nil, err
+	}
+	if node.ignoreFailure, err = o.bool("ignore_failure", false); err != nil {
+		return nil, err
+	}
+	if node.onFailure, err = compileProcessors(o["on_failure"]); err != nil {
+		return nil, fmt.Errorf("on_failure: %v", err)
+	}
+	if cond, ok := o["if"]; ok {
+		if node.condition, err = compileCondition(cond); err != nil {
+			return nil, fmt.Errorf("failed to compile condition: %v", err)
+		}
+	}
+
+	factory, ok := processorFactories[typ]
+	if !ok {
+		return nil, errors.New("processor type is not supported when running pipelines locally")
+	}
+	if node.processor, err = factory(o); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+func compileCondition(v interface{}) (*script, error) {
+	if cond, ok := v.(string); ok {
+		return compileScript(cond, nil)
+	}
+	if cond, ok := toMap(v); ok {
+		return compileScriptOptions(options(cond))
+	}
+	return nil, fmt.Errorf("unsupported condition type %T", v)
+}
+
+func (p *Pipeline) run(ctx *runContext, doc *document) error {
+	for _, node := range p.processors {
+		err := node.run(ctx, doc)
+		if err == nil {
+			continue
+		}
+		if err == errDropped || len(p.onFailure) == 0 {
+			return err
+		}
+		return runOnFailure(ctx, doc, p.onFailure, err)
+	}
+	return nil
+}
+
+func (n *processorNode) run(ctx *runContext, doc *document) error {
+	if n.condition != nil {
+		ok, err := n.condition.test(doc.fields)
+		if err != nil {
+			return n.fail(ctx, doc, fmt.Errorf("failed to execute condition: %v", err))
+		}
+		if !ok {
+			return nil
+		}
+	}
+
+	err := n.processor.run(ctx, doc)
+	if err == nil || err == errDropped {
+		return err
+	}
+	return n.fail(ctx, doc, err)
+}
+
+func (n *processorNode) fail(ctx *runContext, doc *document, err error) error {
+	if n.ignoreFailure {
+		return nil
+	}
+	if _, ok := err.(*processorError); !ok {
+		err = &processorError{typ: n.typ, tag: n.tag, err: err}
+	}
+	if len(n.onFailure) == 0 {
+		return err
+	}
+	return runOnFailure(ctx, doc, n.onFailure, err)
+}
+
+// runOnFailure runs the on_failure handlers with the failure information
+// available in the ingest metadata.
+func runOnFailure(ctx *runContext, doc *document, handlers []*processorNode, err error) error {
+	failure := common.MapStr{"on_failure_message": err.Error()}
+	if perr, ok := err.(*processorError); ok {
+		failure["on_failure_processor_type"] = perr.typ
+		failure["on_failure_processor_tag"] = perr.tag
+	}
+
+	saved := doc.ingest.Clone()
+	doc.ingest.Update(failure)
+	defer func() { doc.ingest = saved }()
+
+	for _, handler := range handlers {
+		if err := handler.run(ctx, doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
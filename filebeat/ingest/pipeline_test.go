@@ -0,0 +1,283 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ingest
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+func TestPipelineProcessors(t *testing.T) {
+	cases := map[string]struct {
+		pipeline string
+		fields   common.MapStr
+		want     common.MapStr
+		err      string
+	}{
+		"set rename remove": {
+			pipeline: `{"processors": [
+				{"set": {"field": "event.kind", "value": "event"}},
+				{"set": {"field": "event.kind", "value": "alert", "override": false}},
+				{"set": {"field": "user.name", "value": "{{user_id}}@{{{domain}}}"}},
+				{"set": {"field": "source.ip", "copy_from": "client.ip"}},
+				{"rename": {"field": "domain", "target_field": "user.domain"}},
+				{"rename": {"field": "missing", "target_field": "x", "ignore_missing": true}},
+				{"remove": {"field": ["user_id", "client"]}}
+			]}`,
+			fields: common.MapStr{"user_id": "alice", "domain": "example.com", "client": common.MapStr{"ip": "10.0.0.1"}},
+			want: common.MapStr{
+				"event":  common.MapStr{"kind": "event"},
+				"user":   common.MapStr{"name": "alice@example.com", "domain": "example.com"},
+				"source": common.MapStr{"ip": "10.0.0.1"},
+			},
+		},
+		"convert and append": {
+			pipeline: `{"processors": [
+				{"convert": {"field": "pid", "type": "long"}},
+				{"convert": {"field": "ratio", "type": "double", "target_field": "score"}},
+				{"convert": {"field": "ok", "type": "boolean"}},
+				{"append": {"field": "tags", "value": ["b", "c"], "allow_duplicates": false}}
+			]}`,
+			fields: common.MapStr{"pid": "42", "ratio": "0.5", "ok": "TRUE", "tags": "b"},
+			want: common.MapStr{
+				"pid": int64(42), "ratio": "0.5", "score": 0.5, "ok": true,
+				"tags": []interface{}{"b", "c"},
+			},
+		},
+		"grok and date": {
+			pipeline: `{"processors": [
+				{"grok": {
+					"field": "message",
+					"patterns": ["%{TS:ts} %{WORD:level} %{GREEDYDATA:msg}"],
+					"pattern_definitions": {"TS": "%{YEAR}-%{MONTHNUM}-%{MONTHDAY} %{TIME}"}
+				}},
+				{"date": {"field": "ts", "formats": ["yyyy-MM-dd HH:mm:ss"], "target_field": "ts", "timezone": "{{tz}}", "output_format": "yyyy-MM-dd'T'HH:mm:ssXXX"}},
+				{"lowercase": {"field": "level"}}
+			]}`,
+			fields: common.MapStr{"message": "2020-03-04 05:06:07 WARN disk full", "tz": "+01:00"},
+			want: common.MapStr{
+				"message": "2020-03-04 05:06:07 WARN disk full", "tz": "+01:00",
+				"ts": "2020-03-04T05:06:07+01:00", "level": "warn", "msg": "disk full",
+			},
+		},
+		"string processors": {
+			pipeline: `{"processors": [
+				{"dissect": {"field": "message", "pattern": "%{a} %{b}"}},
+				{"gsub": {"field": "a", "pattern": "(\\d+)-(\\d+)", "replacement": "$2:$1"}},
+				{"split": {"field": "b", "separator": ","}},
+				{"trim": {"field": "b"}},
+				{"join": {"field": "b", "separator": "|", "target_field": "c"}},
+				{"kv": {"field": "kv", "field_split": " ", "value_split": "=", "target_field": "params", "strip_brackets": true}},
+				{"json": {"field": "doc", "add_to_root": true}},
+				{"urldecode": {"field": "path"}}
+			]}`,
+			fields: common.MapStr{
+				"message": "1-2 x, y ,z",
+				"kv":      "k=v n=[1] n=2",
+				"doc":     `{"id": 7, "nested": {"f": 1.5}}`,
+				"path":    "%2Fvar%2Flog",
+			},
+			want: common.MapStr{
+				"message": "1-2 x, y ,z",
+				"a":       "2:1",
+				"b":       []interface{}{"x", "y", "z"},
+				"c":       "x|y|z",
+				"kv":      "k=v n=[1] n=2",
+				"params":  common.MapStr{"k": "v", "n": []interface{}{"1", "2"}},
+				"doc":     `{"id": 7, "nested": {"f": 1.5}}`,
+				"id":      int64(7),
+				"nested":  map[string]interface{}{"f": 1.5},
+				"path":    "/var/log",
+			},
+		},
+		"foreach and dot expander": {
+			pipeline: `{"processors": [
+				{"foreach": {"field": "names", "processor": {"uppercase": {"field": "_ingest._value"}}}},
+				{"dot_expander": {"field": "a.b"}}
+			]}`,
+			fields: common.MapStr{"names": []interface{}{"x", "y"}, "a.b": 1},
+			want:   common.MapStr{"names": []interface{}{"X", "Y"}, "a": common.MapStr{"b": 1}},
+		},
+		"conditions and scripts": {
+			pipeline: `{"processors": [
+				{"set": {"if": "ctx.level == 'error'", "field": "event.type", "value": "error"}},
+				{"set": {"if": "ctx.level != 'error'", "field": "event.type", "value": "info"}},
+				{"script": {"lang": "painless", "source": "ctx.event.severity = params.severity[ctx.level]", "params": {"severity": {"error": 3}}}}
+			]}`,
+			fields: common.MapStr{"level": "error"},
+			want:   common.MapStr{"level": "error", "event": common.MapStr{"type": "error", "severity": float64(3)}},
+		},
+		"pipeline on_failure": {
+			pipeline: `{
+				"processors": [
+					{"set": {"field": "step", "value": "1"}},
+					{"grok": {"field": "message", "patterns": ["^%{INT:n}$"], "tag": "parse"}},
+					{"set": {"field": "step", "value": "2"}}
+				],
+				"on_failure": [
+					{"set": {"field": "error.message", "value": "{{ _ingest.on_failure_processor_type }}/{{ _ingest.on_failure_processor_tag }}: {{ _ingest.on_failure_message }}"}}
+				]
+			}`,
+			fields: common.MapStr{"message": "abc"},
+			want: common.MapStr{
+				"message": "abc",
+				"step":    "1",
+				"error":   common.MapStr{"message": "grok/parse: Provided Grok expressions do not match field value: [abc]"},
+			},
+		},
+		"processor on_failure continues the pipeline": {
+			pipeline: `{"processors": [
+				{"date": {"field": "ts", "formats": ["ISO8601"], "on_failure": [
+					{"append": {"field": "error.message", "value": "{{ _ingest.on_failure_message }}"}}
+				]}},
+				{"convert": {"field": "n", "type": "integer", "ignore_failure": true}},
+				{"set": {"field": "done", "value": true}}
+			]}`,
+			fields: common.MapStr{"ts": "yesterday", "n": "x"},
+			want: common.MapStr{
+				"ts":    "yesterday",
+				"n":     "x",
+				"done":  true,
+				"error": common.MapStr{"message": []interface{}{`unable to parse date [yesterday]: parsing time "yesterday" as "2006-01-02": cannot parse "yesterday" as "2006"`}},
+			},
+		},
+		"failure without handler": {
+			pipeline: `{"processors": [
+				{"fail": {"message": "unexpected value {{value}}"}}
+			]}`,
+			fields: common.MapStr{"value": 1},
+			want:   common.MapStr{"value": 1},
+			err:    "unexpected value 1",
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			registry := NewRegistry()
+			require.NoError(t, registry.Register("test", decodePipeline(t, test.pipeline)))
+
+			keep, err := registry.Run("test", test.fields)
+			assert.True(t, keep)
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.want, test.fields)
+		})
+	}
+}
+
+func TestPipelineProcessor(t *testing.T) {
+	registry := NewRegistry()
+	require.NoError(t, registry.Register("root", decodePipeline(t, `{"processors": [
+		{"pipeline": {"name": "{{type}}"}},
+		{"set": {"field": "root", "value": true}}
+	]}`)))
+	require.NoError(t, registry.Register("access", decodePipeline(t, `{"processors": [
+		{"set": {"field": "parsed", "value": "{{_ingest.pipeline}}"}}
+	]}`)))
+	require.NoError(t, registry.Register("loop", decodePipeline(t, `{"processors": [
+		{"pipeline": {"name": "root"}}
+	]}`)))
+	require.NoError(t, registry.Register("drop", decodePipeline(t, `{"processors": [
+		{"drop": {"if": "ctx.level == 'debug'"}}
+	]}`)))
+
+	fields := common.MapStr{"type": "access"}
+	keep, err := registry.Run("root", fields)
+	require.NoError(t, err)
+	assert.True(t, keep)
+	assert.Equal(t, common.MapStr{"type": "access", "parsed": "access", "root": true}, fields)
+
+	_, err = registry.Run("root", common.MapStr{"type": "loop"})
+	assert.EqualError(t, err, "Cycle detected for pipeline: root")
+
+	_, err = registry.Run("root", common.MapStr{"type": "other"})
+	assert.EqualError(t, err, "Pipeline processor configured for non-existent pipeline [other]")
+
+	keep, err = registry.Run("root", common.MapStr{"type": "drop", "level": "debug"})
+	assert.NoError(t, err)
+	assert.False(t, keep)
+
+	assert.Equal(t, []string{"access", "drop", "loop", "root"}, registry.IDs())
+}
+
+func TestRegisterInvalidPipeline(t *testing.T) {
+	cases := map[string]struct {
+		pipeline string
+		err      string
+	}{
+		"processors not a list": {
+			pipeline: `{"processors": {"set": {}}}`,
+		},
+		"multiple processor types": {
+			pipeline: `{"processors": [{"set": {}, "remove": {}}]}`,
+		},
+		"invalid on_failure": {
+			pipeline: `{"on_failure": "set"}`,
+		},
+		"invalid processor options": {
+			pipeline: `{"processors": [{"set": "x"}]}`,
+		},
+		"unsupported processor": {
+			pipeline: `{"processors": [
+				{"set": {"field": "a", "value": 1}},
+				{"user_agent": {"field": "user_agent.original"}}
+			]}`,
+			err: "failed to compile pipeline 'test': processor 1 [user_agent]: processor type is not supported when running pipelines locally",
+		},
+		"unsupported processor in on_failure": {
+			pipeline: `{"processors": [
+				{"set": {"field": "a", "value": 1, "on_failure": [{"geoip": {"field": "source.ip"}}]}}
+			]}`,
+			err: "failed to compile pipeline 'test': processor 0 [set]: on_failure: processor 0 [geoip]: processor type is not supported when running pipelines locally",
+		},
+		"invalid script": {
+			pipeline: `{"processors": [{"script": {"source": "ctx.a ==~ /x/"}}]}`,
+			err:      "failed to compile pipeline 'test': processor 0 [script]: unexpected character '~' at position 8",
+		},
+		"invalid condition": {
+			pipeline: `{"processors": [{"set": {"field": "a", "value": 1, "if": "ctx.a ==~ /x/"}}]}`,
+			err:      "failed to compile pipeline 'test': processor 0 [set]: failed to compile condition: unexpected character '~' at position 8",
+		},
+	}
+
+	for name, test := range cases {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			err := NewRegistry().Register("test", decodePipeline(t, test.pipeline))
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func decodePipeline(t *testing.T, s string) map[string]interface{} {
+	var pipeline map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(s), &pipeline))
+	return pipeline
+}
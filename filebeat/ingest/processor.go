@@ -0,0 +1,118 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ingest
+
+import (
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/publisher/pipetool"
+)
+
+// Processor executes the ingest pipeline an event is configured for, if the
+// pipeline is available in the registry. Events referencing other pipelines
+// are passed on unchanged, such that the pipeline is executed by
+// Elasticsearch.
+type Processor struct {
+	registry *Registry
+}
+
+// NewProcessor creates a processor that executes the pipelines of the
+// registry.
+func NewProcessor(registry *Registry) *Processor {
+	return &Processor{registry: registry}
+}
+
+// WithLocalPipelines adds a processor executing local pipelines to each client
+// that connects to the publisher pipeline. The pipelines run after the global
+// processors and the host metadata have been applied, like in Elasticsearch.
+func WithLocalPipelines(pipeline beat.PipelineConnector, registry *Registry) beat.PipelineConnector {
+	p := NewProcessor(registry)
+	return pipetool.WithClientConfigEdit(pipeline, func(cfg beat.ClientConfig) (beat.ClientConfig, error) {
+		procs := processors.NewList(nil)
+		if lst := cfg.Processing.PostProcessor; lst != nil {
+			procs.AddProcessor(lst)
+		}
+		procs.AddProcessor(p)
+		cfg.Processing.PostProcessor = procs
+		return cfg, nil
+	})
+}
+
+// Run executes the pipeline referenced by the pipeline metadata of the event.
+// The pipeline metadata is removed, so the event is not processed by
+// Elasticsearch again. If the pipeline fails, the error is written to the
+// error.message field of the event.
+func (p *Processor) Run(event *beat.Event) (*beat.Event, error) {
+	id, _ := event.Meta["pipeline"].(string)
+	if id == "" || !p.registry.Has(id) {
+		return event, nil
+	}
+	delete(event.Meta, "pipeline")
+
+	if event.Fields == nil {
+		event.Fields = common.MapStr{}
+	}
+	fields := event.Fields
+	fields[timestampKey] = event.Timestamp
+	if docID, ok := event.Meta[idKey]; ok {
+		fields[idKey] = docID
+	}
+
+	keep, err := p.registry.Run(id, fields)
+
+	if ts, ok := extractTimestamp(fields[timestampKey]); ok {
+		event.Timestamp = ts
+	}
+	delete(fields, timestampKey)
+	if docID, ok := fields[idKey].(string); ok {
+		event.SetID(docID)
+	}
+	delete(fields, idKey)
+
+	if !keep {
+		return nil, nil
+	}
+	if err != nil {
+		fields.Put("error.message", err.Error())
+		return event, err
+	}
+	return event, nil
+}
+
+func (p *Processor) String() string {
+	return "ingest_pipeline=[local]"
+}
+
+func extractTimestamp(v interface{}) (time.Time, bool) {
+	switch ts := v.(type) {
+	case time.Time:
+		return ts, true
+	case common.Time:
+		return time.Time(ts), true
+	case string:
+		for _, layout := range append([]string{time.RFC3339Nano}, iso8601Layouts...) {
+			if t, err := time.ParseInLocation(layout, ts, time.UTC); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,109 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ingest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	pubtest "github.com/elastic/beats/v7/libbeat/publisher/testing"
+)
+
+func TestProcessorRun(t *testing.T) {
+	registry := NewRegistry()
+	require.NoError(t, registry.Register("filebeat-test", decodePipeline(t, `{
+		"processors": [
+			{"rename": {"field": "@timestamp", "target_field": "event.created"}},
+			{"date": {"field": "ts", "formats": ["ISO8601"]}},
+			{"set": {"field": "_id", "value": "{{id}}"}},
+			{"remove": {"field": ["ts", "id"]}},
+			{"drop": {"if": "ctx.drop == true"}},
+			{"fail": {"if": "ctx.fail == true", "message": "failed"}}
+		]
+	}`)))
+	p := NewProcessor(registry)
+
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	newEvent := func(pipeline string, fields common.MapStr) *beat.Event {
+		fields["ts"] = "2020-03-04T05:06:07Z"
+		fields["id"] = "abc"
+		return &beat.Event{
+			Timestamp: created,
+			Meta:      common.MapStr{"pipeline": pipeline},
+			Fields:    fields,
+		}
+	}
+
+	t.Run("pipeline is executed", func(t *testing.T) {
+		event, err := p.Run(newEvent("filebeat-test", common.MapStr{}))
+		require.NoError(t, err)
+
+		assert.Equal(t, time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC), event.Timestamp)
+		assert.Equal(t, common.MapStr{"_id": "abc"}, event.Meta)
+		assert.Equal(t, common.MapStr{"event": common.MapStr{"created": created}}, event.Fields)
+	})
+
+	t.Run("unknown pipelines are left to Elasticsearch", func(t *testing.T) {
+		in := newEvent("other", common.MapStr{})
+		event, err := p.Run(in)
+		require.NoError(t, err)
+		assert.Equal(t, "other", event.Meta["pipeline"])
+		assert.Equal(t, created, event.Timestamp)
+	})
+
+	t.Run("dropped events", func(t *testing.T) {
+		event, err := p.Run(newEvent("filebeat-test", common.MapStr{"drop": true}))
+		assert.NoError(t, err)
+		assert.Nil(t, event)
+	})
+
+	t.Run("failures are reported in the event", func(t *testing.T) {
+		event, err := p.Run(newEvent("filebeat-test", common.MapStr{"fail": true}))
+		assert.Error(t, err)
+		require.NotNil(t, event)
+
+		msg, _ := event.GetValue("error.message")
+		assert.Equal(t, "failed", msg)
+		assert.NotContains(t, event.Meta, "pipeline")
+	})
+}
+
+func TestWithLocalPipelines(t *testing.T) {
+	var cfg beat.ClientConfig
+	connector := pubtest.FakeConnector{
+		ConnectFunc: func(c beat.ClientConfig) (beat.Client, error) {
+			cfg = c
+			return &pubtest.FakeClient{}, nil
+		},
+	}
+
+	registry := NewRegistry()
+	_, err := WithLocalPipelines(connector, registry).Connect()
+	require.NoError(t, err)
+
+	assert.Nil(t, cfg.Processing.Processor)
+	require.NotNil(t, cfg.Processing.PostProcessor)
+	procs := cfg.Processing.PostProcessor.All()
+	require.Len(t, procs, 1)
+	assert.Equal(t, "ingest_pipeline=[local]", procs[0].String())
+}
@@ -0,0 +1,1050 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+type processorFactory func(o options) (processor, error)
+
+// processorFactories lists the processor types supported by the local
+// pipeline engine.
+var processorFactories map[string]processorFactory
+
+func init() {
+	processorFactories = map[string]processorFactory{
+		"append":       newAppend,
+		"convert":      newConvert,
+		"date":         newDate,
+		"dissect":      newDissect,
+		"dot_expander": newDotExpander,
+		"drop":         newDrop,
+		"fail":         newFail,
+		"foreach":      newForeach,
+		"grok":         newGrok,
+		"gsub":         newGsub,
+		"join":         newJoin,
+		"json":         newJSON,
+		"kv":           newKV,
+		"lowercase":    newStringTransform(strings.ToLower),
+		"pipeline":     newPipelineProcessor,
+		"remove":       newRemove,
+		"rename":       newRename,
+		"script":       newScript,
+		"set":          newSet,
+		"split":        newSplit,
+		"trim":         newStringTransform(strings.TrimSpace),
+		"uppercase":    newStringTransform(strings.ToUpper),
+		"urldecode":    newURLDecode,
+	}
+}
+
+// fieldValue reads a field value. The returned flag is false if the field is
+// missing or null and ignore_missing is set. Otherwise missing fields result
+// in an error.
+func fieldValue(doc *document, field string, ignoreMissing bool) (interface{}, bool, error) {
+	v, err := doc.get(field)
+	if err != nil {
+		if errors.Cause(err) != common.ErrKeyNotFound {
+			return nil, false, err
+		}
+		if ignoreMissing {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("field [%s] not present as part of path [%s]", field, field)
+	}
+	if v == nil {
+		if ignoreMissing {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("field [%s] is null, cannot process it", field)
+	}
+	return v, true, nil
+}
+
+type setProcessor struct {
+	field            string
+	value            *valueTemplate
+	copyFrom         string
+	override         bool
+	ignoreEmptyValue bool
+}
+
+func newSet(o options) (processor, error) {
+	p := &setProcessor{}
+	var err error
+	if p.field, err = o.string("field", true); err != nil {
+		return nil, err
+	}
+	if p.copyFrom, err = o.string("copy_from", false); err != nil {
+		return nil, err
+	}
+	if p.override, err = o.bool("override", true); err != nil {
+		return nil, err
+	}
+	if p.ignoreEmptyValue, err = o.bool("ignore_empty_value", false); err != nil {
+		return nil, err
+	}
+
+	value, hasValue := o["value"]
+	switch {
+	case hasValue && p.copyFrom != "":
+		return nil, errors.New("[copy_from] cannot set both `copy_from` and `value` in the same processor")
+	case !hasValue && p.copyFrom == "":
+		return nil, errors.New("[value] required property is missing")
+	case hasValue:
+		if p.value, err = compileValue(value); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func (p *setProcessor) run(_ *runContext, doc *document) error {
+	if !p.override && doc.has(p.field) {
+		if v, _ := doc.get(p.field); v != nil {
+			return nil
+		}
+	}
+
+	var value interface{}
+	if p.copyFrom != "" {
+		v, err := doc.get(p.copyFrom)
+		if err != nil {
+			if errors.Cause(err) != common.ErrKeyNotFound || !p.ignoreEmptyValue {
+				return fmt.Errorf("field [%s] not present as part of path [%s]", p.copyFrom, p.copyFrom)
+			}
+			return nil
+		}
+		value = deepCopy(v)
+	} else {
+		value = p.value.render(doc)
+	}
+
+	if p.ignoreEmptyValue && (value == nil || value == "") {
+		return nil
+	}
+	return doc.put(p.field, value)
+}
+
+type removeProcessor struct {
+	fields        []string
+	ignoreMissing bool
+}
+
+func newRemove(o options) (processor, error) {
+	p := &removeProcessor{}
+	var err error
+	if p.fields, err = o.strings("field", true); err != nil {
+		return nil, err
+	}
+	if p.ignoreMissing, err = o.bool("ignore_missing", false); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *removeProcessor) run(_ *runContext, doc *document) error {
+	for _, field := range p.fields {
+		if err := doc.remove(field); err != nil {
+			if p.ignoreMissing && errors.Cause(err) == common.ErrKeyNotFound {
+				continue
+			}
+			return fmt.Errorf("field [%s] not present as part of path [%s]", field, field)
+		}
+	}
+	return nil
+}
+
+type renameProcessor struct {
+	field         string
+	target        string
+	ignoreMissing bool
+	override      bool
+}
+
+func newRename(o options) (processor, error) {
+	p := &renameProcessor{}
+	var err error
+	if p.field, err = o.string("field", true); err != nil {
+		return nil, err
+	}
+	if p.target, err = o.string("target_field", true); err != nil {
+		return nil, err
+	}
+	if p.ignoreMissing, err = o.bool("ignore_missing", false); err != nil {
+		return nil, err
+	}
+	if p.override, err = o.bool("override", false); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *renameProcessor) run(_ *runContext, doc *document) error {
+	if !doc.has(p.field) {
+		if p.ignoreMissing {
+			return nil
+		}
+		return fmt.Errorf("field [%s] doesn't exist", p.field)
+	}
+	if doc.has(p.target) && !p.override {
+		return fmt.Errorf("field [%s] already exists", p.target)
+	}
+
+	v, err := doc.get(p.field)
+	if err != nil {
+		return err
+	}
+	if err := doc.remove(p.field); err != nil {
+		return err
+	}
+	return doc.put(p.target, v)
+}
+
+type appendProcessor struct {
+	field           string
+	values          []*valueTemplate
+	allowDuplicates bool
+}
+
+func newAppend(o options) (processor, error) {
+	p := &appendProcessor{}
+	var err error
+	if p.field, err = o.string("field", true); err != nil {
+		return nil, err
+	}
+	if p.allowDuplicates, err = o.bool("allow_duplicates", true); err != nil {
+		return nil, err
+	}
+
+	value, ok := o["value"]
+	if !ok {
+		return nil, errors.New("[value] required property is missing")
+	}
+	values, isList := value.([]interface{})
+	if !isList {
+		values = []interface{}{value}
+	}
+	for _, v := range values {
+		t, err := compileValue(v)
+		if err != nil {
+			return nil, err
+		}
+		p.values = append(p.values, t)
+	}
+	return p, nil
+}
+
+func (p *appendProcessor) run(_ *runContext, doc *document) error {
+	var list []interface{}
+	if v, err := doc.get(p.field); err == nil && v != nil {
+		if isList(v) {
+			list = append(list, toList(v)...)
+		} else {
+			list = append(list, v)
+		}
+	}
+
+	for _, t := range p.values {
+		v := t.render(doc)
+		if !p.allowDuplicates && containsValue(list, v) {
+			continue
+		}
+		list = append(list, v)
+	}
+	return doc.put(p.field, list)
+}
+
+func containsValue(list []interface{}, v interface{}) bool {
+	for _, item := range list {
+		if equal(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+type convertProcessor struct {
+	field         string
+	target        string
+	typ           string
+	ignoreMissing bool
+}
+
+func newConvert(o options) (processor, error) {
+	p := &convertProcessor{}
+	var err error
+	if p.field, err = o.string("field", true); err != nil {
+		return nil, err
+	}
+	if p.target, err = o.string("target_field", false); err != nil {
+		return nil, err
+	}
+	if p.typ, err = o.string("type", true); err != nil {
+		return nil, err
+	}
+	if p.ignoreMissing, err = o.bool("ignore_missing", false); err != nil {
+		return nil, err
+	}
+
+	switch p.typ {
+	case "integer", "long", "float", "double", "boolean", "string", "ip", "auto":
+	default:
+		return nil, fmt.Errorf("[type] type [%s] not supported, cannot convert field", p.typ)
+	}
+	if p.target == "" {
+		p.target = p.field
+	}
+	return p, nil
+}
+
+func (p *convertProcessor) run(_ *runContext, doc *document) error {
+	v, ok, err := fieldValue(doc, p.field, p.ignoreMissing)
+	if !ok {
+		return err
+	}
+
+	var converted interface{}
+	if isList(v) {
+		items := toList(v)
+		list := make([]interface{}, len(items))
+		for i, item := range items {
+			if list[i], err = convertValue(p.typ, item); err != nil {
+				return err
+			}
+		}
+		converted = list
+	} else if converted, err = convertValue(p.typ, v); err != nil {
+		return err
+	}
+	return doc.put(p.target, converted)
+}
+
+func convertValue(typ string, v interface{}) (interface{}, error) {
+	s := toString(v)
+	if _, ok := v.(string); !ok && typ != "string" {
+		if n, ok := toNumber(v); ok {
+			s = fmt.Sprint(n)
+		}
+	}
+
+	switch typ {
+	case "integer", "long":
+		bits := 32
+		if typ == "long" {
+			bits = 64
+		}
+		i, err := parseInteger(s, bits)
+		if err != nil {
+			if f, ferr := strconv.ParseFloat(s, 64); ferr == nil && f == float64(int64(f)) {
+				i, err = int64(f), nil
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to convert [%s] to %s", s, typ)
+		}
+		if typ == "integer" {
+			return int(i), nil
+		}
+		return i, nil
+
+	case "float", "double":
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unable to convert [%s] to %s", s, typ)
+		}
+		if typ == "float" {
+			return float32(f), nil
+		}
+		return f, nil
+
+	case "boolean":
+		switch strings.ToLower(s) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return nil, fmt.Errorf("[%s] is not a boolean value, cannot convert to boolean", s)
+
+	case "ip":
+		if net.ParseIP(s) == nil {
+			return nil, fmt.Errorf("'%s' is not an IP string literal.", s)
+		}
+		return s, nil
+
+	case "auto":
+		str, ok := v.(string)
+		if !ok {
+			return v, nil
+		}
+		if i, err := parseInteger(str, 32); err == nil {
+			return int(i), nil
+		}
+		if i, err := parseInteger(str, 64); err == nil {
+			return i, nil
+		}
+		if f, err := strconv.ParseFloat(str, 32); err == nil {
+			return float32(f), nil
+		}
+		if b, err := strconv.ParseBool(str); err == nil && (str == "true" || str == "false") {
+			return b, nil
+		}
+		return str, nil
+	}
+	return s, nil
+}
+
+func parseInteger(s string, bits int) (int64, error) {
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		return strconv.ParseInt(s[2:], 16, bits)
+	}
+	return strconv.ParseInt(s, 10, bits)
+}
+
+// stringProcessor applies a string function to a field. Lists of strings are
+// transformed element wise.
+type stringProcessor struct {
+	field         string
+	target        string
+	ignoreMissing bool
+	fn            func(string) (interface{}, error)
+}
+
+func newStringProcessor(o options, fn func(string) (interface{}, error)) (*stringProcessor, error) {
+	p := &stringProcessor{fn: fn}
+	var err error
+	if p.field, err = o.string("field", true); err != nil {
+		return nil, err
+	}
+	if p.target, err = o.string("target_field", false); err != nil {
+		return nil, err
+	}
+	if p.ignoreMissing, err = o.bool("ignore_missing", false); err != nil {
+		return nil, err
+	}
+	if p.target == "" {
+		p.target = p.field
+	}
+	return p, nil
+}
+
+func newStringTransform(fn func(string) string) processorFactory {
+	return func(o options) (processor, error) {
+		return newStringProcessor(o, func(s string) (interface{}, error) {
+			return fn(s), nil
+		})
+	}
+}
+
+func (p *stringProcessor) run(_ *runContext, doc *document) error {
+	v, ok, err := fieldValue(doc, p.field, p.ignoreMissing)
+	if !ok {
+		return err
+	}
+
+	if s, ok := v.(string); ok {
+		result, err := p.fn(s)
+		if err != nil {
+			return err
+		}
+		return doc.put(p.target, result)
+	}
+
+	if !isList(v) {
+		return fmt.Errorf("field [%s] of type [%s] cannot be cast to [String]", p.field, typeName(v))
+	}
+	items := toList(v)
+	list := make([]interface{}, len(items))
+	for i, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return fmt.Errorf("value [%v] of type [%s] in list field [%s] cannot be cast to [String]", item, typeName(item), p.field)
+		}
+		if list[i], err = p.fn(s); err != nil {
+			return err
+		}
+	}
+	return doc.put(p.target, list)
+}
+
+func newGsub(o options) (processor, error) {
+	pattern, err := o.string("pattern", true)
+	if err != nil {
+		return nil, err
+	}
+	replacement, err := o.string("replacement", true)
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("[pattern] Invalid regex pattern. %v", err)
+	}
+
+	replacement = javaReplacement.ReplaceAllString(replacement, "$${$1}")
+	return newStringProcessor(o, func(s string) (interface{}, error) {
+		return re.ReplaceAllString(s, replacement), nil
+	})
+}
+
+// javaReplacement matches the group references of Java replacement strings.
+var javaReplacement = regexp.MustCompile(`\$(\d+)`)
+
+func newSplit(o options) (processor, error) {
+	separator, err := o.string("separator", true)
+	if err != nil {
+		return nil, err
+	}
+	preserveTrailing, err := o.bool("preserve_trailing", false)
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(separator)
+	if err != nil {
+		return nil, fmt.Errorf("[separator] Invalid regex pattern. %v", err)
+	}
+
+	p, err := newStringProcessor(o, func(s string) (interface{}, error) {
+		parts := re.Split(s, -1)
+		if !preserveTrailing {
+			for len(parts) > 0 && parts[len(parts)-1] == "" {
+				parts = parts[:len(parts)-1]
+			}
+		}
+		list := make([]interface{}, len(parts))
+		for i, part := range parts {
+			list[i] = part
+		}
+		return list, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &splitProcessor{p}, nil
+}
+
+// splitProcessor only accepts single strings, as a split list would be
+// nested otherwise.
+type splitProcessor struct{ *stringProcessor }
+
+func (p *splitProcessor) run(ctx *runContext, doc *document) error {
+	v, ok, err := fieldValue(doc, p.field, p.ignoreMissing)
+	if !ok {
+		return err
+	}
+	if _, ok := v.(string); !ok {
+		return fmt.Errorf("field [%s] of type [%s] cannot be cast to [String]", p.field, typeName(v))
+	}
+	return p.stringProcessor.run(ctx, doc)
+}
+
+func newURLDecode(o options) (processor, error) {
+	return newStringProcessor(o, func(s string) (interface{}, error) {
+		return url.QueryUnescape(s)
+	})
+}
+
+type joinProcessor struct {
+	field     string
+	target    string
+	separator string
+}
+
+func newJoin(o options) (processor, error) {
+	p := &joinProcessor{}
+	var err error
+	if p.field, err = o.string("field", true); err != nil {
+		return nil, err
+	}
+	if p.separator, err = o.string("separator", true); err != nil {
+		return nil, err
+	}
+	if p.target, err = o.string("target_field", false); err != nil {
+		return nil, err
+	}
+	if p.target == "" {
+		p.target = p.field
+	}
+	return p, nil
+}
+
+func (p *joinProcessor) run(_ *runContext, doc *document) error {
+	v, _, err := fieldValue(doc, p.field, false)
+	if err != nil {
+		return err
+	}
+	if !isList(v) {
+		return fmt.Errorf("field [%s] of type [%s] cannot be cast to [List]", p.field, typeName(v))
+	}
+
+	items := toList(v)
+	strs := make([]string, len(items))
+	for i, item := range items {
+		strs[i] = toString(item)
+	}
+	return doc.put(p.target, strings.Join(strs, p.separator))
+}
+
+type jsonProcessor struct {
+	field     string
+	target    string
+	addToRoot bool
+}
+
+func newJSON(o options) (processor, error) {
+	p := &jsonProcessor{}
+	var err error
+	if p.field, err = o.string("field", true); err != nil {
+		return nil, err
+	}
+	if p.target, err = o.string("target_field", false); err != nil {
+		return nil, err
+	}
+	if p.addToRoot, err = o.bool("add_to_root", false); err != nil {
+		return nil, err
+	}
+	if p.addToRoot && p.target != "" {
+		return nil, errors.New("[target_field] Cannot set a target field while also setting `add_to_root` to true")
+	}
+	if p.target == "" {
+		p.target = p.field
+	}
+	return p, nil
+}
+
+func (p *jsonProcessor) run(_ *runContext, doc *document) error {
+	s, ok, err := doc.getString(p.field)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("field [%s] not present as part of path [%s]", p.field, p.field)
+	}
+
+	var v interface{}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("failed to parse field [%s] as JSON: %v", p.field, err)
+	}
+	v = normalizeJSON(v)
+
+	if !p.addToRoot {
+		return doc.put(p.target, v)
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return errors.New("cannot add non-map fields to root of document")
+	}
+	for k, value := range m {
+		doc.fields[k] = value
+	}
+	return nil
+}
+
+func normalizeJSON(v interface{}) interface{} {
+	switch x := v.(type) {
+	case json.Number:
+		if i, err := x.Int64(); err == nil {
+			return i
+		}
+		f, _ := x.Float64()
+		return f
+	case map[string]interface{}:
+		for k, item := range x {
+			x[k] = normalizeJSON(item)
+		}
+	case []interface{}:
+		for i, item := range x {
+			x[i] = normalizeJSON(item)
+		}
+	}
+	return v
+}
+
+type dotExpanderProcessor struct {
+	field string
+	path  string
+}
+
+func newDotExpander(o options) (processor, error) {
+	p := &dotExpanderProcessor{}
+	var err error
+	if p.field, err = o.string("field", true); err != nil {
+		return nil, err
+	}
+	if p.path, err = o.string("path", false); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// run moves a field that has dots in its name to the nested field the name
+// describes.
+func (p *dotExpanderProcessor) run(_ *runContext, doc *document) error {
+	parent := doc.fields
+	if p.path != "" {
+		v, err := doc.get(p.path)
+		if err != nil {
+			return nil
+		}
+		m, ok := toMap(v)
+		if !ok {
+			return nil
+		}
+		parent = m
+	}
+
+	var keys []string
+	if p.field == "*" {
+		for k := range parent {
+			if strings.Contains(k, ".") {
+				keys = append(keys, k)
+			}
+		}
+	} else if _, ok := parent[p.field]; ok {
+		keys = []string{p.field}
+	}
+
+	for _, k := range keys {
+		v := parent[k]
+		delete(parent, k)
+		if _, err := common.MapStr(parent).Put(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type kvProcessor struct {
+	field         string
+	target        string
+	fieldSplit    *regexp.Regexp
+	valueSplit    *regexp.Regexp
+	includeKeys   map[string]bool
+	excludeKeys   map[string]bool
+	ignoreMissing bool
+	prefix        string
+	trimKey       string
+	trimValue     string
+	stripBrackets bool
+}
+
+func newKV(o options) (processor, error) {
+	p := &kvProcessor{}
+	var err error
+	if p.field, err = o.string("field", true); err != nil {
+		return nil, err
+	}
+	if p.target, err = o.string("target_field", false); err != nil {
+		return nil, err
+	}
+	if p.prefix, err = o.string("prefix", false); err != nil {
+		return nil, err
+	}
+	if p.trimKey, err = o.string("trim_key", false); err != nil {
+		return nil, err
+	}
+	if p.trimValue, err = o.string("trim_value", false); err != nil {
+		return nil, err
+	}
+	if p.ignoreMissing, err = o.bool("ignore_missing", false); err != nil {
+		return nil, err
+	}
+	if p.stripBrackets, err = o.bool("strip_brackets", false); err != nil {
+		return nil, err
+	}
+
+	for key, re := range map[string]**regexp.Regexp{"field_split": &p.fieldSplit, "value_split": &p.valueSplit} {
+		pattern, err := o.string(key, true)
+		if err != nil {
+			return nil, err
+		}
+		if *re, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("[%s] Invalid regex pattern. %v", key, err)
+		}
+	}
+
+	for key, set := range map[string]*map[string]bool{"include_keys": &p.includeKeys, "exclude_keys": &p.excludeKeys} {
+		keys, err := o.strings(key, false)
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) > 0 {
+			*set = make(map[string]bool, len(keys))
+			for _, k := range keys {
+				(*set)[k] = true
+			}
+		}
+	}
+	return p, nil
+}
+
+func (p *kvProcessor) run(_ *runContext, doc *document) error {
+	v, ok, err := fieldValue(doc, p.field, p.ignoreMissing)
+	if !ok {
+		return err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("field [%s] of type [%s] cannot be cast to [String]", p.field, typeName(v))
+	}
+
+	for _, pair := range p.fieldSplit.Split(s, -1) {
+		kv := p.valueSplit.Split(pair, 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("field [%s] does not contain value_split [%s]", p.field, p.valueSplit)
+		}
+
+		key := strings.Trim(kv[0], p.trimKey)
+		value := strings.Trim(kv[1], p.trimValue)
+		if p.stripBrackets {
+			value = stripBrackets(value)
+		}
+		if p.includeKeys != nil && !p.includeKeys[key] || p.excludeKeys[key] {
+			continue
+		}
+
+		field := p.prefix + key
+		if p.target != "" {
+			field = p.target + "." + field
+		}
+		if err := appendField(doc, field, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendField sets the field, or turns the field into a list if it already
+// has a value.
+func appendField(doc *document, field string, value interface{}) error {
+	old, err := doc.get(field)
+	if err != nil || old == nil {
+		return doc.put(field, value)
+	}
+	if isList(old) {
+		return doc.put(field, append(toList(old), value))
+	}
+	return doc.put(field, []interface{}{old, value})
+}
+
+func stripBrackets(s string) string {
+	for _, pair := range []string{"()", "<>", "[]", `""`, "''"} {
+		if len(s) >= 2 && s[0] == pair[0] && s[len(s)-1] == pair[1] {
+			return s[1 : len(s)-1]
+		}
+	}
+	return s
+}
+
+type foreachProcessor struct {
+	field         string
+	ignoreMissing bool
+	processor     *processorNode
+}
+
+func newForeach(o options) (processor, error) {
+	p := &foreachProcessor{}
+	var err error
+	if p.field, err = o.string("field", true); err != nil {
+		return nil, err
+	}
+	if p.ignoreMissing, err = o.bool("ignore_missing", false); err != nil {
+		return nil, err
+	}
+
+	definition, ok := toMap(o["processor"])
+	if !ok {
+		return nil, errors.New("[processor] required property is missing")
+	}
+	nodes, err := compileProcessors([]interface{}{definition})
+	if err != nil {
+		return nil, err
+	}
+	p.processor = nodes[0]
+	return p, nil
+}
+
+// run applies the processor to each element of a list, or to each value of
+// a map. The current element is available as _ingest._value.
+func (p *foreachProcessor) run(ctx *runContext, doc *document) error {
+	v, ok, err := fieldValue(doc, p.field, p.ignoreMissing)
+	if !ok {
+		return err
+	}
+
+	defer doc.ingest.Delete("_value")
+
+	if m, ok := toMap(v); ok {
+		for k, item := range m {
+			doc.ingest["_value"] = item
+			if err := p.processor.run(ctx, doc); err != nil {
+				return err
+			}
+			m[k] = doc.ingest["_value"]
+		}
+		return nil
+	}
+
+	if !isList(v) {
+		return fmt.Errorf("field [%s] of type [%s] cannot be cast to [List]", p.field, typeName(v))
+	}
+	items := toList(v)
+	list := make([]interface{}, len(items))
+	for i, item := range items {
+		doc.ingest["_value"] = item
+		if err := p.processor.run(ctx, doc); err != nil {
+			return err
+		}
+		list[i] = doc.ingest["_value"]
+	}
+	return doc.put(p.field, list)
+}
+
+type dropProcessor struct{}
+
+func newDrop(options) (processor, error) { return dropProcessor{}, nil }
+
+func (dropProcessor) run(*runContext, *document) error { return errDropped }
+
+type failProcessor struct {
+	message *template
+}
+
+func newFail(o options) (processor, error) {
+	message, err := o.string("message", true)
+	if err != nil {
+		return nil, err
+	}
+	t, err := compileTemplate(message)
+	if err != nil {
+		return nil, err
+	}
+	return &failProcessor{message: t}, nil
+}
+
+func (p *failProcessor) run(_ *runContext, doc *document) error {
+	return errors.New(p.message.render(doc))
+}
+
+type pipelineProcessor struct {
+	name          *template
+	ignoreMissing bool
+}
+
+func newPipelineProcessor(o options) (processor, error) {
+	name, err := o.string("name", true)
+	if err != nil {
+		return nil, err
+	}
+	p := &pipelineProcessor{}
+	if p.name, err = compileTemplate(name); err != nil {
+		return nil, err
+	}
+	if p.ignoreMissing, err = o.bool("ignore_missing_pipeline", false); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *pipelineProcessor) run(ctx *runContext, doc *document) error {
+	name := p.name.render(doc)
+	pipeline := ctx.registry.get(name)
+	if pipeline == nil {
+		if p.ignoreMissing {
+			return nil
+		}
+		return fmt.Errorf("Pipeline processor configured for non-existent pipeline [%s]", name)
+	}
+
+	for _, id := range ctx.stack {
+		if id == name {
+			return fmt.Errorf("Cycle detected for pipeline: %s", name)
+		}
+	}
+
+	ctx.stack = append(ctx.stack, name)
+	defer func() { ctx.stack = ctx.stack[:len(ctx.stack)-1] }()
+
+	saved := doc.ingest["pipeline"]
+	doc.ingest["pipeline"] = name
+	defer func() { doc.ingest["pipeline"] = saved }()
+	return pipeline.run(ctx, doc)
+}
+
+type scriptProcessor struct {
+	script *script
+}
+
+func newScript(o options) (processor, error) {
+	sc, err := compileScriptOptions(o)
+	if err != nil {
+		return nil, err
+	}
+	return &scriptProcessor{script: sc}, nil
+}
+
+func compileScriptOptions(o options) (*script, error) {
+	lang, err := o.string("lang", false)
+	if err != nil {
+		return nil, err
+	}
+	if lang != "" && lang != "painless" {
+		return nil, fmt.Errorf("script language [%s] is not supported", lang)
+	}
+	if id, _ := o.string("id", false); id != "" {
+		return nil, fmt.Errorf("stored script [%s] is not supported", id)
+	}
+
+	source, err := o.string("source", false)
+	if err != nil {
+		return nil, err
+	}
+	if source == "" {
+		if source, err = o.string("inline", true); err != nil {
+			return nil, errors.New("[source] required property is missing")
+		}
+	}
+
+	var params map[string]interface{}
+	if v, ok := o["params"]; ok && v != nil {
+		if params, ok = toMap(v); !ok {
+			return nil, fmt.Errorf("[params] property isn't a map, but of type [%T]", v)
+		}
+	}
+	return compileScript(source, params)
+}
+
+func (p *scriptProcessor) run(_ *runContext, doc *document) error {
+	_, err := p.script.run(doc.fields)
+	return err
+}
@@ -0,0 +1,1033 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+var errNullPointer = errors.New("null pointer exception")
+
+// script is a compiled Painless script. Scripts are used by the script
+// processor and to evaluate the 'if' conditions of processors.
+type script struct {
+	source string
+	body   []statement
+	params map[string]interface{}
+}
+
+// scope holds the state of a single script execution.
+type scope struct {
+	ctx      common.MapStr
+	params   map[string]interface{}
+	locals   map[string]interface{}
+	result   interface{}
+	returned bool
+}
+
+type statement interface {
+	exec(s *scope) error
+}
+
+type expression interface {
+	eval(s *scope) (interface{}, error)
+}
+
+// assignable is implemented by expressions that can be the target of an
+// assignment.
+type assignable interface {
+	expression
+	assign(s *scope, v interface{}) error
+}
+
+func compileScript(source string, params map[string]interface{}) (*script, error) {
+	sc, err := parseScript(source)
+	if err != nil {
+		return nil, err
+	}
+	sc.params = params
+	return sc, nil
+}
+
+// run executes the script against the document fields. It returns the value
+// of the first return statement, or the value of the last expression
+// statement if the script has no return statement.
+func (sc *script) run(ctx common.MapStr) (interface{}, error) {
+	s := &scope{ctx: ctx, params: sc.params, locals: map[string]interface{}{}}
+	for _, st := range sc.body {
+		if err := st.exec(s); err != nil {
+			return nil, err
+		}
+		if s.returned {
+			break
+		}
+	}
+	return s.result, nil
+}
+
+// test executes a condition script. The script must return a boolean.
+func (sc *script) test(ctx common.MapStr) (bool, error) {
+	v, err := sc.run(ctx)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("condition [%s] did not return a boolean, got %s", sc.source, typeName(v))
+	}
+	return b, nil
+}
+
+type exprStmt struct{ x expression }
+
+func (st *exprStmt) exec(s *scope) error {
+	v, err := st.x.eval(s)
+	s.result = v
+	return err
+}
+
+type assignStmt struct {
+	target assignable
+	value  expression
+}
+
+func (st *assignStmt) exec(s *scope) error {
+	v, err := st.value.eval(s)
+	if err != nil {
+		return err
+	}
+	s.result = nil
+	return st.target.assign(s, v)
+}
+
+type returnStmt struct{ value expression }
+
+func (st *returnStmt) exec(s *scope) error {
+	s.result = nil
+	if st.value != nil {
+		v, err := st.value.eval(s)
+		if err != nil {
+			return err
+		}
+		s.result = v
+	}
+	s.returned = true
+	return nil
+}
+
+type blockStmt struct{ body []statement }
+
+func (st *blockStmt) exec(s *scope) error {
+	for _, sub := range st.body {
+		if err := sub.exec(s); err != nil {
+			return err
+		}
+		if s.returned {
+			return nil
+		}
+	}
+	return nil
+}
+
+type ifStmt struct {
+	cond      expression
+	then      statement
+	otherwise statement
+}
+
+func (st *ifStmt) exec(s *scope) error {
+	ok, err := evalBool(s, st.cond)
+	if err != nil {
+		return err
+	}
+	switch {
+	case ok:
+		return st.then.exec(s)
+	case st.otherwise != nil:
+		return st.otherwise.exec(s)
+	}
+	return nil
+}
+
+type forStmt struct {
+	name       string
+	collection expression
+	body       statement
+}
+
+func (st *forStmt) exec(s *scope) error {
+	v, err := st.collection.eval(s)
+	if err != nil {
+		return err
+	}
+
+	var items []interface{}
+	switch {
+	case v == nil:
+		return errNullPointer
+	case isList(v):
+		items = toList(v)
+	default:
+		return fmt.Errorf("cannot iterate over %s", typeName(v))
+	}
+
+	for _, item := range items {
+		s.locals[st.name] = item
+		if err := st.body.exec(s); err != nil {
+			return err
+		}
+		if s.returned {
+			return nil
+		}
+	}
+	return nil
+}
+
+type literal struct{ value interface{} }
+
+func (x literal) eval(*scope) (interface{}, error) { return x.value, nil }
+
+type variable struct{ name string }
+
+func (x *variable) eval(s *scope) (interface{}, error) {
+	switch x.name {
+	case "ctx":
+		return s.ctx, nil
+	case "params":
+		return s.params, nil
+	}
+	return s.locals[x.name], nil
+}
+
+func (x *variable) assign(s *scope, v interface{}) error {
+	if x.name == "ctx" || x.name == "params" {
+		return fmt.Errorf("cannot assign to %s", x.name)
+	}
+	s.locals[x.name] = v
+	return nil
+}
+
+type member struct {
+	target   expression
+	name     string
+	nullSafe bool
+}
+
+func (x *member) eval(s *scope) (interface{}, error) {
+	t, err := x.target.eval(s)
+	if err != nil || t == nil {
+		if err == nil && !x.nullSafe {
+			err = fmt.Errorf("%v: cannot access field [%s] of null", errNullPointer, x.name)
+		}
+		return nil, err
+	}
+
+	if m, ok := toMap(t); ok {
+		return m[x.name], nil
+	}
+	if x.name == "length" && isList(t) {
+		return int64(len(toList(t))), nil
+	}
+	return nil, fmt.Errorf("cannot access field [%s] of %s", x.name, typeName(t))
+}
+
+func (x *member) assign(s *scope, v interface{}) error {
+	t, err := x.target.eval(s)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return fmt.Errorf("%v: cannot set field [%s] of null", errNullPointer, x.name)
+	}
+	m, ok := toMap(t)
+	if !ok {
+		return fmt.Errorf("cannot set field [%s] of %s", x.name, typeName(t))
+	}
+	m[x.name] = v
+	return nil
+}
+
+type index struct {
+	target expression
+	key    expression
+}
+
+func (x *index) eval(s *scope) (interface{}, error) {
+	t, k, err := x.operands(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if m, ok := toMap(t); ok {
+		return m[toString(k)], nil
+	}
+	if isList(t) {
+		l := toList(t)
+		i, err := listIndex(l, k)
+		if err != nil {
+			return nil, err
+		}
+		return l[i], nil
+	}
+	return nil, fmt.Errorf("cannot index %s", typeName(t))
+}
+
+func (x *index) assign(s *scope, v interface{}) error {
+	t, k, err := x.operands(s)
+	if err != nil {
+		return err
+	}
+
+	if m, ok := toMap(t); ok {
+		m[toString(k)] = v
+		return nil
+	}
+	if l, ok := t.([]interface{}); ok {
+		i, err := listIndex(l, k)
+		if err != nil {
+			return err
+		}
+		l[i] = v
+		return nil
+	}
+	return fmt.Errorf("cannot index %s", typeName(t))
+}
+
+func (x *index) operands(s *scope) (interface{}, interface{}, error) {
+	t, err := x.target.eval(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	if t == nil {
+		return nil, nil, errNullPointer
+	}
+	k, err := x.key.eval(s)
+	return t, k, err
+}
+
+func listIndex(l []interface{}, k interface{}) (int, error) {
+	n, ok := k.(int64)
+	if !ok {
+		return 0, fmt.Errorf("list index must be an integer, got %s", typeName(k))
+	}
+	if n < 0 || int(n) >= len(l) {
+		return 0, fmt.Errorf("index %d out of bounds for length %d", n, len(l))
+	}
+	return int(n), nil
+}
+
+type call struct {
+	target   expression
+	method   string
+	args     []expression
+	nullSafe bool
+}
+
+func (x *call) eval(s *scope) (interface{}, error) {
+	t, err := x.target.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		if x.nullSafe {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%v: cannot invoke method [%s] on null", errNullPointer, x.method)
+	}
+
+	args := make([]interface{}, len(x.args))
+	for i, arg := range x.args {
+		if args[i], err = arg.eval(s); err != nil {
+			return nil, err
+		}
+	}
+
+	// lists can not be modified in place, the extended list is assigned
+	// to the expression the list was read from instead.
+	if target, ok := x.target.(assignable); ok && isList(t) && (x.method == "add" || x.method == "addAll") {
+		if err := checkArgs(x.method, args, 1); err != nil {
+			return nil, err
+		}
+		items := args
+		if x.method == "addAll" {
+			if !isList(args[0]) {
+				return nil, fmt.Errorf("addAll expects a list, got %s", typeName(args[0]))
+			}
+			items = toList(args[0])
+		}
+		l := append(append([]interface{}{}, toList(t)...), items...)
+		return true, target.assign(s, l)
+	}
+	return invoke(t, x.method, args)
+}
+
+type staticCall struct {
+	name string
+	fn   func(args []interface{}) (interface{}, error)
+	args []expression
+}
+
+func (x *staticCall) eval(s *scope) (interface{}, error) {
+	args := make([]interface{}, len(x.args))
+	for i, arg := range x.args {
+		var err error
+		if args[i], err = arg.eval(s); err != nil {
+			return nil, err
+		}
+	}
+	v, err := x.fn(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", x.name, err)
+	}
+	return v, nil
+}
+
+type not struct{ x expression }
+
+func (x *not) eval(s *scope) (interface{}, error) {
+	b, err := evalBool(s, x.x)
+	return !b, err
+}
+
+type binary struct {
+	op          string
+	left, right expression
+}
+
+func (x *binary) eval(s *scope) (interface{}, error) {
+	if x.op == "&&" || x.op == "||" {
+		l, err := evalBool(s, x.left)
+		if err != nil || l == (x.op == "||") {
+			return l, err
+		}
+		return evalBool(s, x.right)
+	}
+
+	l, err := x.left.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	r, err := x.right.eval(s)
+	if err != nil {
+		return nil, err
+	}
+
+	switch x.op {
+	case "==":
+		return equal(l, r), nil
+	case "!=":
+		return !equal(l, r), nil
+	case "<", ">", "<=", ">=":
+		return compare(x.op, l, r)
+	case "+":
+		_, lstr := l.(string)
+		_, rstr := r.(string)
+		if lstr || rstr {
+			return toString(l) + toString(r), nil
+		}
+	}
+	return arithmetic(x.op, l, r)
+}
+
+type conditional struct {
+	cond, then, otherwise expression
+}
+
+func (x *conditional) eval(s *scope) (interface{}, error) {
+	ok, err := evalBool(s, x.cond)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return x.then.eval(s)
+	}
+	return x.otherwise.eval(s)
+}
+
+type elvis struct {
+	value, fallback expression
+}
+
+func (x *elvis) eval(s *scope) (interface{}, error) {
+	v, err := x.value.eval(s)
+	if err != nil || v != nil {
+		return v, err
+	}
+	return x.fallback.eval(s)
+}
+
+type instanceOf struct {
+	x        expression
+	typeName string
+}
+
+func (x *instanceOf) eval(s *scope) (interface{}, error) {
+	v, err := x.x.eval(s)
+	if err != nil || v == nil {
+		return false, err
+	}
+
+	switch x.typeName {
+	case "String", "CharSequence":
+		_, ok := v.(string)
+		return ok, nil
+	case "Map", "HashMap":
+		_, ok := toMap(v)
+		return ok, nil
+	case "List", "ArrayList", "Collection":
+		return isList(v), nil
+	case "Boolean":
+		_, ok := v.(bool)
+		return ok, nil
+	case "Number":
+		_, ok := toNumber(v)
+		return ok, nil
+	case "Integer", "Long", "Short", "Byte":
+		n, ok := toNumber(v)
+		_, isInt := n.(int64)
+		return ok && isInt, nil
+	case "Double", "Float":
+		n, ok := toNumber(v)
+		_, isFloat := n.(float64)
+		return ok && isFloat, nil
+	case "Object", "def":
+		return true, nil
+	}
+	return nil, fmt.Errorf("unsupported type [%s] in instanceof", x.typeName)
+}
+
+type mapLiteral struct {
+	keys, values []expression
+}
+
+func (x *mapLiteral) eval(s *scope) (interface{}, error) {
+	m := make(map[string]interface{}, len(x.keys))
+	for i := range x.keys {
+		k, err := x.keys[i].eval(s)
+		if err != nil {
+			return nil, err
+		}
+		v, err := x.values[i].eval(s)
+		if err != nil {
+			return nil, err
+		}
+		m[toString(k)] = v
+	}
+	return m, nil
+}
+
+type listLiteral struct{ items []expression }
+
+func (x *listLiteral) eval(s *scope) (interface{}, error) {
+	l := make([]interface{}, 0, len(x.items))
+	for _, item := range x.items {
+		v, err := item.eval(s)
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, v)
+	}
+	return l, nil
+}
+
+func evalBool(s *scope, x expression) (bool, error) {
+	v, err := x.eval(s)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("cannot cast %s to boolean", typeName(v))
+	}
+	return b, nil
+}
+
+// invoke calls a method on a value. Only a subset of the methods provided by
+// the Java types used in Painless scripts is available.
+func invoke(t interface{}, method string, args []interface{}) (interface{}, error) {
+	switch method {
+	case "equals":
+		if err := checkArgs(method, args, 1); err != nil {
+			return nil, err
+		}
+		return equal(t, args[0]), nil
+	case "toString":
+		return toString(t), nil
+	}
+
+	if str, ok := t.(string); ok {
+		return invokeString(str, method, args)
+	}
+	if m, ok := toMap(t); ok {
+		return invokeMap(m, method, args)
+	}
+	if isList(t) {
+		return invokeList(t, method, args)
+	}
+	return nil, fmt.Errorf("unsupported method [%s] on %s", method, typeName(t))
+}
+
+func invokeString(str, method string, args []interface{}) (interface{}, error) {
+	switch method {
+	case "length", "isEmpty", "trim", "toLowerCase", "toUpperCase":
+		if err := checkArgs(method, args, 0); err != nil {
+			return nil, err
+		}
+		switch method {
+		case "length":
+			return int64(len(str)), nil
+		case "isEmpty":
+			return str == "", nil
+		case "trim":
+			return strings.TrimSpace(str), nil
+		case "toLowerCase":
+			return strings.ToLower(str), nil
+		default:
+			return strings.ToUpper(str), nil
+		}
+
+	case "contains", "startsWith", "endsWith", "equalsIgnoreCase", "indexOf", "lastIndexOf", "splitOnToken":
+		if err := checkArgs(method, args, 1); err != nil {
+			return nil, err
+		}
+		arg, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("%s expects a string argument, got %s", method, typeName(args[0]))
+		}
+		switch method {
+		case "contains":
+			return strings.Contains(str, arg), nil
+		case "startsWith":
+			return strings.HasPrefix(str, arg), nil
+		case "endsWith":
+			return strings.HasSuffix(str, arg), nil
+		case "equalsIgnoreCase":
+			return strings.EqualFold(str, arg), nil
+		case "indexOf":
+			return int64(strings.Index(str, arg)), nil
+		case "lastIndexOf":
+			return int64(strings.LastIndex(str, arg)), nil
+		default:
+			parts := strings.Split(str, arg)
+			l := make([]interface{}, len(parts))
+			for i, part := range parts {
+				l[i] = part
+			}
+			return l, nil
+		}
+
+	case "replace":
+		if err := checkArgs(method, args, 2); err != nil {
+			return nil, err
+		}
+		return strings.Replace(str, toString(args[0]), toString(args[1]), -1), nil
+
+	case "substring":
+		if len(args) != 1 && len(args) != 2 {
+			return nil, fmt.Errorf("substring expects 1 or 2 arguments")
+		}
+		begin, end := args[0], interface{}(int64(len(str)))
+		if len(args) == 2 {
+			end = args[1]
+		}
+		b, ok1 := begin.(int64)
+		e, ok2 := end.(int64)
+		if !ok1 || !ok2 || b < 0 || e > int64(len(str)) || b > e {
+			return nil, fmt.Errorf("substring index out of range: begin %v, end %v, length %d", begin, end, len(str))
+		}
+		return str[b:e], nil
+	}
+	return nil, fmt.Errorf("unsupported method [%s] on String", method)
+}
+
+func invokeMap(m map[string]interface{}, method string, args []interface{}) (interface{}, error) {
+	switch method {
+	case "size":
+		return int64(len(m)), nil
+	case "isEmpty":
+		return len(m) == 0, nil
+	case "keySet", "values":
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		l := make([]interface{}, len(keys))
+		for i, k := range keys {
+			if method == "keySet" {
+				l[i] = k
+			} else {
+				l[i] = m[k]
+			}
+		}
+		return l, nil
+	case "containsKey", "get", "remove":
+		if err := checkArgs(method, args, 1); err != nil {
+			return nil, err
+		}
+		k := toString(args[0])
+		v, ok := m[k]
+		switch method {
+		case "containsKey":
+			return ok, nil
+		case "remove":
+			delete(m, k)
+		}
+		return v, nil
+	case "getOrDefault":
+		if err := checkArgs(method, args, 2); err != nil {
+			return nil, err
+		}
+		if v, ok := m[toString(args[0])]; ok {
+			return v, nil
+		}
+		return args[1], nil
+	case "put":
+		if err := checkArgs(method, args, 2); err != nil {
+			return nil, err
+		}
+		k := toString(args[0])
+		old := m[k]
+		m[k] = args[1]
+		return old, nil
+	}
+	return nil, fmt.Errorf("unsupported method [%s] on Map", method)
+}
+
+func invokeList(t interface{}, method string, args []interface{}) (interface{}, error) {
+	l := toList(t)
+	switch method {
+	case "size":
+		return int64(len(l)), nil
+	case "isEmpty":
+		return len(l) == 0, nil
+	case "contains", "indexOf":
+		if err := checkArgs(method, args, 1); err != nil {
+			return nil, err
+		}
+		for i, v := range l {
+			if equal(v, args[0]) {
+				if method == "contains" {
+					return true, nil
+				}
+				return int64(i), nil
+			}
+		}
+		if method == "contains" {
+			return false, nil
+		}
+		return int64(-1), nil
+	case "get":
+		if err := checkArgs(method, args, 1); err != nil {
+			return nil, err
+		}
+		i, err := listIndex(l, args[0])
+		if err != nil {
+			return nil, err
+		}
+		return l[i], nil
+	}
+	return nil, fmt.Errorf("unsupported method [%s] on List", method)
+}
+
+func checkArgs(method string, args []interface{}, n int) error {
+	if len(args) != n {
+		return fmt.Errorf("%s expects %d arguments, got %d", method, n, len(args))
+	}
+	return nil
+}
+
+var staticMethods = map[string]map[string]func([]interface{}) (interface{}, error){
+	"Integer": {"parseInt": parseIntArg(32)},
+	"Long":    {"parseLong": parseIntArg(64)},
+	"Double":  {"parseDouble": parseFloatArg},
+	"Float":   {"parseFloat": parseFloatArg},
+	"String": {"valueOf": func(args []interface{}) (interface{}, error) {
+		if err := checkArgs("valueOf", args, 1); err != nil {
+			return nil, err
+		}
+		return toString(args[0]), nil
+	}},
+	"Math": {
+		"abs": func(args []interface{}) (interface{}, error) {
+			if err := checkArgs("abs", args, 1); err != nil {
+				return nil, err
+			}
+			switch n, _ := toNumber(args[0]); v := n.(type) {
+			case int64:
+				if v < 0 {
+					return -v, nil
+				}
+				return v, nil
+			case float64:
+				return math.Abs(v), nil
+			}
+			return nil, fmt.Errorf("abs expects a number, got %s", typeName(args[0]))
+		},
+		"round": func(args []interface{}) (interface{}, error) {
+			if err := checkArgs("round", args, 1); err != nil {
+				return nil, err
+			}
+			n, ok := toNumber(args[0])
+			if !ok {
+				return nil, fmt.Errorf("round expects a number, got %s", typeName(args[0]))
+			}
+			return int64(math.Floor(toFloat(n) + 0.5)), nil
+		},
+	},
+}
+
+func parseIntArg(bits int) func([]interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		if err := checkArgs("parse", args, 1); err != nil {
+			return nil, err
+		}
+		return strconv.ParseInt(toString(args[0]), 10, bits)
+	}
+}
+
+func parseFloatArg(args []interface{}) (interface{}, error) {
+	if err := checkArgs("parse", args, 1); err != nil {
+		return nil, err
+	}
+	return strconv.ParseFloat(toString(args[0]), 64)
+}
+
+func equal(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if na, ok := toNumber(a); ok {
+		if nb, ok := toNumber(b); ok {
+			ia, aInt := na.(int64)
+			ib, bInt := nb.(int64)
+			if aInt && bInt {
+				return ia == ib
+			}
+			return toFloat(na) == toFloat(nb)
+		}
+		return false
+	}
+	if ma, ok := toMap(a); ok {
+		mb, ok := toMap(b)
+		return ok && reflect.DeepEqual(ma, mb)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func compare(op string, l, r interface{}) (interface{}, error) {
+	nl, okl := toNumber(l)
+	nr, okr := toNumber(r)
+	if !okl || !okr {
+		return nil, fmt.Errorf("cannot compare %s with %s", typeName(l), typeName(r))
+	}
+
+	var c int
+	il, lInt := nl.(int64)
+	ir, rInt := nr.(int64)
+	if lInt && rInt {
+		c = compareValues(il < ir, il > ir)
+	} else {
+		fl, fr := toFloat(nl), toFloat(nr)
+		c = compareValues(fl < fr, fl > fr)
+	}
+
+	switch op {
+	case "<":
+		return c < 0, nil
+	case ">":
+		return c > 0, nil
+	case "<=":
+		return c <= 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+func compareValues(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+func arithmetic(op string, l, r interface{}) (interface{}, error) {
+	nl, okl := toNumber(l)
+	nr, okr := toNumber(r)
+	if !okl || !okr {
+		return nil, fmt.Errorf("cannot apply operator '%s' to %s and %s", op, typeName(l), typeName(r))
+	}
+
+	il, lInt := nl.(int64)
+	ir, rInt := nr.(int64)
+	if lInt && rInt {
+		switch op {
+		case "+":
+			return il + ir, nil
+		case "-":
+			return il - ir, nil
+		case "*":
+			return il * ir, nil
+		}
+		if ir == 0 {
+			return nil, errors.New("division by zero")
+		}
+		if op == "/" {
+			return il / ir, nil
+		}
+		return il % ir, nil
+	}
+
+	fl, fr := toFloat(nl), toFloat(nr)
+	switch op {
+	case "+":
+		return fl + fr, nil
+	case "-":
+		return fl - fr, nil
+	case "*":
+		return fl * fr, nil
+	case "/":
+		return fl / fr, nil
+	}
+	return math.Mod(fl, fr), nil
+}
+
+// toNumber normalizes numeric values to int64 or float64.
+func toNumber(v interface{}) (interface{}, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint:
+		return int64(n), true
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case uint64:
+		return int64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return nil, false
+}
+
+func toFloat(n interface{}) float64 {
+	if i, ok := n.(int64); ok {
+		return float64(i)
+	}
+	return n.(float64)
+}
+
+func toMap(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case common.MapStr:
+		return m, true
+	case map[string]interface{}:
+		return m, true
+	}
+	return nil, false
+}
+
+func isList(v interface{}) bool {
+	if v == nil {
+		return false
+	}
+	return reflect.TypeOf(v).Kind() == reflect.Slice
+}
+
+func toList(v interface{}) []interface{} {
+	if l, ok := v.([]interface{}); ok {
+		return l
+	}
+	rv := reflect.ValueOf(v)
+	l := make([]interface{}, rv.Len())
+	for i := range l {
+		l[i] = rv.Index(i).Interface()
+	}
+	return l
+}
+
+func toString(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return x
+	case float32:
+		return formatFloat(float64(x))
+	case float64:
+		return formatFloat(x)
+	}
+	return fmt.Sprint(v)
+}
+
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.ContainsAny(s, ".eEnN") {
+		s += ".0"
+	}
+	return s
+}
+
+func typeName(v interface{}) string {
+	if v == nil {
+		return "null"
+	}
+	switch v.(type) {
+	case string:
+		return "String"
+	case bool:
+		return "Boolean"
+	}
+	if n, ok := toNumber(v); ok {
+		if _, ok := n.(int64); ok {
+			return "Long"
+		}
+		return "Double"
+	}
+	if _, ok := toMap(v); ok {
+		return "Map"
+	}
+	if isList(v) {
+		return "List"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,737 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ingest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The script language is a small subset of Painless. It covers the field
+// access, comparisons, string helpers and assignments used by the conditions
+// and scripts of the module pipelines. Scripts using other language features
+// fail to compile.
+
+type tokenKind uint8
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	val  interface{}
+	pos  int
+}
+
+var punctuators = []string{
+	"?.", "?:", "==", "!=", "<=", ">=", "&&", "||", "+=", "-=", "++", "--",
+	".", "(", ")", "[", "]", "{", "}", ",", ";", ":", "?", "!", "<", ">",
+	"=", "+", "-", "*", "/", "%",
+}
+
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case strings.HasPrefix(src[i:], "//"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				i = len(src)
+			} else {
+				i += end
+			}
+
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment at position %d", i)
+			}
+			i += end + 4
+
+		case c == '\'' || c == '"':
+			s, n, err := scanString(src[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%v at position %d", err, i)
+			}
+			tokens = append(tokens, token{kind: tokString, text: src[i : i+n], val: s, pos: i})
+			i += n
+
+		case c >= '0' && c <= '9':
+			v, n, err := scanNumber(src[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%v at position %d", err, i)
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: src[i : i+n], val: v, pos: i})
+			i += n
+
+		case c == '_' || c == '$' || unicode.IsLetter(rune(c)):
+			n := 1
+			for i+n < len(src) && isIdentChar(src[i+n]) {
+				n++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: src[i : i+n], pos: i})
+			i += n
+
+		default:
+			matched := false
+			for _, p := range punctuators {
+				if strings.HasPrefix(src[i:], p) {
+					tokens = append(tokens, token{kind: tokPunct, text: p, pos: i})
+					i += len(p)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character '%c' at position %d", c, i)
+			}
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || (c >= '0' && c <= '9') || unicode.IsLetter(rune(c))
+}
+
+func scanString(s string) (string, int, error) {
+	quote := s[0]
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote:
+			return sb.String(), i + 1, nil
+		case c == '\\' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			default:
+				sb.WriteByte(s[i])
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+func scanNumber(s string) (interface{}, int, error) {
+	n := 0
+	isFloat := false
+	for n < len(s) && (s[n] >= '0' && s[n] <= '9' || s[n] == '.') {
+		if s[n] == '.' {
+			// a dot not followed by a digit is a method call on an integer
+			if isFloat || n+1 >= len(s) || s[n+1] < '0' || s[n+1] > '9' {
+				break
+			}
+			isFloat = true
+		}
+		n++
+	}
+	text := s[:n]
+	if n < len(s) {
+		switch s[n] {
+		case 'L', 'l':
+			n++
+		case 'f', 'F', 'd', 'D':
+			isFloat = true
+			n++
+		}
+	}
+
+	if isFloat {
+		f, err := strconv.ParseFloat(text, 64)
+		return f, n, err
+	}
+	i, err := strconv.ParseInt(text, 10, 64)
+	return i, n, err
+}
+
+// parser builds the syntax tree of a script from its tokens.
+type parser struct {
+	tokens []token
+	pos    int
+	locals map[string]bool
+}
+
+// declarationTypes lists the type names that can be used to declare local
+// variables.
+var declarationTypes = map[string]bool{
+	"def": true, "var": true, "String": true, "int": true, "long": true,
+	"float": true, "double": true, "boolean": true, "Map": true, "List": true,
+	"Object": true,
+}
+
+func parseScript(src string) (*script, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, locals: map[string]bool{}}
+	var body []statement
+	for !p.at(tokEOF, "") {
+		st, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		if st != nil {
+			body = append(body, st)
+		}
+	}
+	return &script{source: src, body: body}, nil
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) peekAt(n int) token {
+	if p.pos+n >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+n]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) at(kind tokenKind, text string) bool {
+	t := p.peek()
+	return t.kind == kind && (text == "" || t.text == text)
+}
+
+func (p *parser) accept(text string) bool {
+	t := p.peek()
+	if (t.kind == tokPunct || t.kind == tokIdent) && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		return p.unexpected()
+	}
+	return nil
+}
+
+func (p *parser) unexpected() error {
+	t := p.peek()
+	if t.kind == tokEOF {
+		return fmt.Errorf("unexpected end of script")
+	}
+	return fmt.Errorf("unexpected '%s' at position %d", t.text, t.pos)
+}
+
+func (p *parser) statement() (statement, error) {
+	t := p.peek()
+	switch {
+	case p.accept(";"):
+		return nil, nil
+
+	case p.accept("{"):
+		return p.block()
+
+	case t.kind == tokIdent && t.text == "if":
+		p.next()
+		return p.ifStatement()
+
+	case t.kind == tokIdent && t.text == "for":
+		p.next()
+		return p.forStatement()
+
+	case t.kind == tokIdent && t.text == "return":
+		p.next()
+		var value expression
+		if !p.at(tokPunct, ";") && !p.at(tokPunct, "}") && !p.at(tokEOF, "") {
+			var err error
+			if value, err = p.expression(); err != nil {
+				return nil, err
+			}
+		}
+		p.accept(";")
+		return &returnStmt{value: value}, nil
+
+	case t.kind == tokIdent && declarationTypes[t.text] && p.peekAt(1).kind == tokIdent:
+		p.next()
+		name := p.next().text
+		p.locals[name] = true
+		var value expression = literal{}
+		if p.accept("=") {
+			var err error
+			if value, err = p.expression(); err != nil {
+				return nil, err
+			}
+		}
+		p.accept(";")
+		return &assignStmt{target: &variable{name: name}, value: value}, nil
+	}
+
+	x, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+
+	var st statement
+	switch op := p.peek().text; {
+	case p.at(tokPunct, "=") || p.at(tokPunct, "+=") || p.at(tokPunct, "-="):
+		p.next()
+		target, ok := x.(assignable)
+		if !ok {
+			return nil, fmt.Errorf("invalid assignment target at position %d", t.pos)
+		}
+		value, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if op != "=" {
+			value = &binary{op: op[:1], left: x, right: value}
+		}
+		st = &assignStmt{target: target, value: value}
+
+	case p.at(tokPunct, "++") || p.at(tokPunct, "--"):
+		p.next()
+		target, ok := x.(assignable)
+		if !ok {
+			return nil, fmt.Errorf("invalid assignment target at position %d", t.pos)
+		}
+		st = &assignStmt{target: target, value: &binary{op: op[:1], left: x, right: literal{value: int64(1)}}}
+
+	default:
+		st = &exprStmt{x: x}
+	}
+
+	if !p.accept(";") && !p.at(tokPunct, "}") && !p.at(tokEOF, "") {
+		return nil, p.unexpected()
+	}
+	return st, nil
+}
+
+func (p *parser) block() (statement, error) {
+	var body []statement
+	for !p.accept("}") {
+		if p.at(tokEOF, "") {
+			return nil, p.unexpected()
+		}
+		st, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		if st != nil {
+			body = append(body, st)
+		}
+	}
+	return &blockStmt{body: body}, nil
+}
+
+func (p *parser) body() (statement, error) {
+	st, err := p.statement()
+	if err != nil {
+		return nil, err
+	}
+	if st == nil {
+		return &blockStmt{}, nil
+	}
+	return st, nil
+}
+
+func (p *parser) ifStatement() (statement, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	cond, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+
+	st := &ifStmt{cond: cond}
+	if st.then, err = p.body(); err != nil {
+		return nil, err
+	}
+	if p.accept("else") {
+		if st.otherwise, err = p.body(); err != nil {
+			return nil, err
+		}
+	}
+	return st, nil
+}
+
+// forStatement parses enhanced for loops iterating over a collection. Classic
+// for loops are not supported.
+func (p *parser) forStatement() (statement, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	if t := p.next(); t.kind != tokIdent || !declarationTypes[t.text] {
+		return nil, fmt.Errorf("only enhanced for loops are supported, at position %d", t.pos)
+	}
+	name := p.next()
+	if name.kind != tokIdent {
+		return nil, fmt.Errorf("unexpected '%s' at position %d", name.text, name.pos)
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	p.locals[name.text] = true
+
+	coll, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	body, err := p.body()
+	if err != nil {
+		return nil, err
+	}
+	return &forStmt{name: name.text, collection: coll, body: body}, nil
+}
+
+func (p *parser) expression() (expression, error) {
+	return p.ternary()
+}
+
+func (p *parser) ternary() (expression, error) {
+	cond, err := p.binary(0)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.accept("?:"):
+		fallback, err := p.ternary()
+		if err != nil {
+			return nil, err
+		}
+		return &elvis{value: cond, fallback: fallback}, nil
+
+	case p.accept("?"):
+		then, err := p.ternary()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		otherwise, err := p.ternary()
+		if err != nil {
+			return nil, err
+		}
+		return &conditional{cond: cond, then: then, otherwise: otherwise}, nil
+	}
+	return cond, nil
+}
+
+// binaryLevels lists the binary operators from the lowest to the highest
+// precedence.
+var binaryLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!="},
+	{"<", ">", "<=", ">=", "instanceof"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) binary(level int) (expression, error) {
+	if level == len(binaryLevels) {
+		return p.unary()
+	}
+
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.binaryOperator(binaryLevels[level])
+		if !ok {
+			return left, nil
+		}
+
+		if op == "instanceof" {
+			t := p.next()
+			if t.kind != tokIdent {
+				return nil, fmt.Errorf("type name expected at position %d", t.pos)
+			}
+			left = &instanceOf{x: left, typeName: t.text}
+			continue
+		}
+
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) binaryOperator(ops []string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokPunct && t.kind != tokIdent {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.next()
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) unary() (expression, error) {
+	switch {
+	case p.accept("!"):
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &not{x: x}, nil
+
+	case p.accept("-"):
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &binary{op: "-", left: literal{value: int64(0)}, right: x}, nil
+	}
+	return p.postfix()
+}
+
+func (p *parser) postfix() (expression, error) {
+	x, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		switch {
+		case p.at(tokPunct, ".") || p.at(tokPunct, "?."):
+			nullSafe := p.next().text == "?."
+			name := p.next()
+			if name.kind != tokIdent {
+				return nil, fmt.Errorf("field name expected at position %d", name.pos)
+			}
+			if p.accept("(") {
+				args, err := p.arguments()
+				if err != nil {
+					return nil, err
+				}
+				x = &call{target: x, method: name.text, args: args, nullSafe: nullSafe}
+			} else {
+				x = &member{target: x, name: name.text, nullSafe: nullSafe}
+			}
+
+		case p.accept("["):
+			key, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			x = &index{target: x, key: key}
+
+		default:
+			return x, nil
+		}
+	}
+}
+
+func (p *parser) arguments() ([]expression, error) {
+	var args []expression
+	if p.accept(")") {
+		return args, nil
+	}
+	for {
+		arg, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.accept(")") {
+			return args, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) primary() (expression, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber, tokString:
+		return literal{value: t.val}, nil
+
+	case tokIdent:
+		switch t.text {
+		case "null":
+			return literal{}, nil
+		case "true":
+			return literal{value: true}, nil
+		case "false":
+			return literal{value: false}, nil
+		case "ctx", "params":
+			return &variable{name: t.text}, nil
+		case "new":
+			return p.newObject()
+		}
+
+		if p.locals[t.text] {
+			return &variable{name: t.text}, nil
+		}
+		if _, ok := staticMethods[t.text]; ok && p.accept(".") {
+			name := p.next()
+			if err := p.expect("("); err != nil {
+				return nil, err
+			}
+			args, err := p.arguments()
+			if err != nil {
+				return nil, err
+			}
+			fn, ok := staticMethods[t.text][name.text]
+			if !ok {
+				return nil, fmt.Errorf("unsupported method %s.%s", t.text, name.text)
+			}
+			return &staticCall{name: t.text + "." + name.text, fn: fn, args: args}, nil
+		}
+		return nil, fmt.Errorf("unknown variable '%s' at position %d", t.text, t.pos)
+
+	case tokPunct:
+		switch t.text {
+		case "(":
+			x, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return x, nil
+
+		case "[":
+			return p.collectionLiteral()
+		}
+	}
+
+	p.pos--
+	return nil, p.unexpected()
+}
+
+func (p *parser) newObject() (expression, error) {
+	t := p.next()
+	if t.kind != tokIdent {
+		return nil, fmt.Errorf("type name expected at position %d", t.pos)
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+
+	switch t.text {
+	case "HashMap", "LinkedHashMap", "TreeMap":
+		return &mapLiteral{}, nil
+	case "ArrayList", "LinkedList":
+		return &listLiteral{}, nil
+	}
+	return nil, fmt.Errorf("unsupported type '%s' at position %d", t.text, t.pos)
+}
+
+// collectionLiteral parses list initializers ([a, b]) and map initializers
+// ([:] or ['k': v]).
+func (p *parser) collectionLiteral() (expression, error) {
+	if p.accept(":") {
+		return &mapLiteral{}, p.expect("]")
+	}
+	if p.accept("]") {
+		return &listLiteral{}, nil
+	}
+
+	first, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.accept(":") {
+		m := &mapLiteral{}
+		key := first
+		for {
+			value, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			m.keys = append(m.keys, key)
+			m.values = append(m.values, value)
+			if p.accept("]") {
+				return m, nil
+			}
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+			if key, err = p.expression(); err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	l := &listLiteral{items: []expression{first}}
+	for !p.accept("]") {
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		item, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		l.items = append(l.items, item)
+	}
+	return l, nil
+}
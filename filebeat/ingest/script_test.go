@@ -0,0 +1,153 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ingest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+func TestScriptConditions(t *testing.T) {
+	ctx := common.MapStr{
+		"event": common.MapStr{"timezone": "Europe/Berlin", "code": 4624},
+		"host":  common.MapStr{"hostname": "web-1"},
+		"tags":  []interface{}{"a", "b"},
+		"count": int32(3),
+		"ratio": 0.5,
+	}
+
+	cases := map[string]struct {
+		source string
+		want   bool
+	}{
+		"null check":            {`ctx.event.timezone == null`, false},
+		"not null check":        {`ctx.event.timezone != null`, true},
+		"null safe access":      {`ctx.source?.ip == null`, true},
+		"and":                   {`ctx.host?.hostname != null && ctx.host?.hostname != ''`, true},
+		"or":                    {`ctx.missing != null || ctx.count == 3`, true},
+		"negation":              {`!(ctx.count > 5)`, true},
+		"mixed numeric types":   {`ctx.event.code == 4624L && ctx.ratio < 1`, true},
+		"string methods":        {`ctx.host.hostname.startsWith('web') && ctx.host.hostname.contains('-')`, true},
+		"list contains":         {`ctx.tags.contains('b')`, true},
+		"map methods":           {`ctx.containsKey('host') && !ctx.event.isEmpty()`, true},
+		"index access":          {`ctx['host']['hostname'] == "web-1"`, true},
+		"instanceof":            {`ctx.tags instanceof List && ctx.event instanceof Map`, true},
+		"ternary":               {`(ctx.count > 1 ? 'many' : 'one') == 'many'`, true},
+		"elvis":                 {`(ctx.missing ?: 'default') == 'default'`, true},
+		"arithmetic":            {`ctx.count * 2 + 1 == 7`, true},
+		"string concat":         {`'a' + ctx.count == 'a3'`, true},
+		"return statement":      {`if (ctx.count > 2) { return true; } return false;`, true},
+		"local variable":        {`def h = ctx.host; return h.hostname.length() == 5`, true},
+		"static method":         {`Integer.parseInt('42') == 42`, true},
+		"case insensitive test": {`ctx.host.hostname.toUpperCase().equals('WEB-1')`, true},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			sc, err := compileScript(test.source, nil)
+			require.NoError(t, err)
+
+			got, err := sc.test(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestScriptErrors(t *testing.T) {
+	cases := map[string]struct {
+		source     string
+		compileErr bool
+	}{
+		"null pointer":      {source: `ctx.source.ip == null`},
+		"not a boolean":     {source: `ctx.count`},
+		"unknown method":    {source: `ctx.message.matches('x')`},
+		"unknown variable":  {source: `foo == 1`, compileErr: true},
+		"regex match":       {source: `ctx.message =~ /x/`, compileErr: true},
+		"unterminated":      {source: `ctx.message == 'x`, compileErr: true},
+		"classic for loop":  {source: `for (int i = 0; i < 2; i++) {}`, compileErr: true},
+		"unsupported class": {source: `new Date()`, compileErr: true},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			sc, err := compileScript(test.source, nil)
+			if test.compileErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			_, err = sc.test(common.MapStr{"message": "x", "count": 1})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestScriptStatements(t *testing.T) {
+	source := `
+		// normalize the event
+		ctx.event.kind = 'event';
+		ctx.event.severity = params.levels[ctx.level];
+		ctx.tags.add('processed');
+		if (ctx.user == null) {
+			ctx.user = new HashMap();
+		}
+		ctx.user.name = ctx.remove('login');
+		def total = 0;
+		for (def n : ctx.values) {
+			total += n;
+		}
+		ctx.total = total;
+		ctx.related = ['hosts': [ctx.host]];
+	`
+	params := map[string]interface{}{
+		"levels": map[string]interface{}{"warn": int64(4)},
+	}
+
+	sc, err := compileScript(source, params)
+	require.NoError(t, err)
+
+	ctx := common.MapStr{
+		"event":  common.MapStr{},
+		"level":  "warn",
+		"tags":   []interface{}{"a"},
+		"login":  "alice",
+		"values": []interface{}{1, 2, int64(3)},
+		"host":   "web-1",
+	}
+	_, err = sc.run(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, common.MapStr{
+		"event":  common.MapStr{"kind": "event", "severity": int64(4)},
+		"level":  "warn",
+		"tags":   []interface{}{"a", "processed"},
+		"user":   map[string]interface{}{"name": "alice"},
+		"values": []interface{}{1, 2, int64(3)},
+		"host":   "web-1",
+		"total":  int64(6),
+		"related": map[string]interface{}{
+			"hosts": []interface{}{"web-1"},
+		},
+	}, ctx)
+}
@@ -0,0 +1,117 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dustin/go-humanize"
+
+	"github.com/elastic/beats/v7/libbeat/common/match"
+	"github.com/elastic/beats/v7/libbeat/reader/multiline"
+	"github.com/elastic/beats/v7/libbeat/reader/readfile"
+)
+
+// config stores the options of the filestream input.
+type config struct {
+	ReaderConfig `config:",inline"`
+
+	// prospector
+	Paths         []string        `config:"paths"`
+	ExcludeFiles  []match.Matcher `config:"exclude_files"`
+	RecursiveGlob bool            `config:"recursive_glob.enabled"`
+	ScanFrequency time.Duration   `config:"scan_frequency" validate:"min=0,nonzero"`
+	FileIdentity  string          `config:"file_identity"`
+	IgnoreOlder   time.Duration   `config:"ignore_older"`
+
+	// registry cleanup. clean_inactive configures the TTL of the per file
+	// cursors, see fileProspector.CleanTimeout.
+	CleanInactive time.Duration `config:"clean_inactive" validate:"min=0"`
+	CleanRemoved  bool          `config:"clean_removed"`
+}
+
+// ReaderConfig stores the options used by the harvesters to read and close
+// a file.
+type ReaderConfig struct {
+	Backoff       time.Duration `config:"backoff" validate:"min=0,nonzero"`
+	BackoffFactor int           `config:"backoff_factor" validate:"min=1"`
+	MaxBackoff    time.Duration `config:"max_backoff" validate:"min=0,nonzero"`
+	CloseInactive time.Duration `config:"close_inactive"`
+	CloseRemoved  bool          `config:"close_removed"`
+	CloseRenamed  bool          `config:"close_renamed"`
+	CloseEOF      bool          `config:"close_eof"`
+	CloseTimeout  time.Duration `config:"close_timeout" validate:"min=0"`
+
+	BufferSize     int                     `config:"harvester_buffer_size"`
+	Encoding       string                  `config:"encoding"`
+	LineTerminator readfile.LineTerminator `config:"line_terminator"`
+	ExcludeLines   []match.Matcher         `config:"exclude_lines"`
+	IncludeLines   []match.Matcher         `config:"include_lines"`
+	MaxBytes       int                     `config:"max_bytes" validate:"min=0,nonzero"`
+	Multiline      *multiline.Config       `config:"multiline"`
+}
+
+const (
+	identityNative = "native"
+	identityPath   = "path"
+)
+
+func defaultConfig() config {
+	return config{
+		ReaderConfig: ReaderConfig{
+			Backoff:        1 * time.Second,
+			BackoffFactor:  2,
+			MaxBackoff:     10 * time.Second,
+			CloseInactive:  5 * time.Minute,
+			CloseRemoved:   true,
+			CloseRenamed:   false,
+			CloseEOF:       false,
+			CloseTimeout:   0,
+			BufferSize:     16 * humanize.KiByte,
+			MaxBytes:       10 * humanize.MiByte,
+			LineTerminator: readfile.AutoLineTerminator,
+		},
+		RecursiveGlob: true,
+		ScanFrequency: 10 * time.Second,
+		FileIdentity:  identityNative,
+		IgnoreOlder:   0,
+		CleanInactive: 0,
+		CleanRemoved:  true,
+	}
+}
+
+func (c *config) Validate() error {
+	if len(c.Paths) == 0 {
+		return fmt.Errorf("no paths were defined for input")
+	}
+
+	if c.FileIdentity != identityNative && c.FileIdentity != identityPath {
+		return fmt.Errorf("unknown file_identity '%v', must be one of %v or %v", c.FileIdentity, identityNative, identityPath)
+	}
+
+	if c.CleanInactive != 0 && c.IgnoreOlder == 0 {
+		return fmt.Errorf("ignore_older must be enabled when clean_inactive is used")
+	}
+
+	if c.CleanInactive != 0 && c.CleanInactive <= c.IgnoreOlder+c.ScanFrequency {
+		return fmt.Errorf("clean_inactive must be > ignore_older + scan_frequency to make sure only files which are not monitored anymore are removed")
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+var (
+	ErrFileTruncate = errors.New("detected file being truncated")
+	ErrRenamed      = errors.New("file was renamed")
+	ErrRemoved      = errors.New("file was removed")
+	ErrInactive     = errors.New("file inactive")
+	ErrClosed       = errors.New("reader closed")
+)
+
+// logFile is an io.Reader that reads from a file and waits for new content
+// at EOF. It stops reading and returns an error if one of the configured
+// close conditions applies.
+type logFile struct {
+	file         *os.File
+	log          *logp.Logger
+	config       ReaderConfig
+	done         <-chan struct{}
+	offset       int64
+	lastTimeRead time.Time
+	backoff      time.Duration
+}
+
+func newLogFile(
+	log *logp.Logger,
+	file *os.File,
+	config ReaderConfig,
+	offset int64,
+	done <-chan struct{},
+) *logFile {
+	return &logFile{
+		file:         file,
+		log:          log,
+		config:       config,
+		done:         done,
+		offset:       offset,
+		lastTimeRead: time.Now(),
+		backoff:      config.Backoff,
+	}
+}
+
+// Read reads from the file and updates the offset.
+// The total number of bytes read is returned.
+func (f *logFile) Read(buf []byte) (int, error) {
+	totalN := 0
+
+	for {
+		select {
+		case <-f.done:
+			return 0, ErrClosed
+		default:
+		}
+
+		if err := f.checkFileDisappearedErrors(); err != nil {
+			return totalN, err
+		}
+
+		n, err := f.file.Read(buf)
+		if n > 0 {
+			f.offset += int64(n)
+			f.lastTimeRead = time.Now()
+		}
+		totalN += n
+
+		// Read from source completed without error
+		// Either end reached or buffer full
+		if err == nil {
+			// reset backoff for next read
+			f.backoff = f.config.Backoff
+			return totalN, nil
+		}
+
+		// Move buffer forward for next read
+		buf = buf[n:]
+
+		// Checks if an error happened or buffer is full
+		// If buffer is full, cannot continue reading.
+		// Can happen if n == bufferSize + io.EOF error
+		err = f.errorChecks(err)
+		if err != nil || len(buf) == 0 {
+			return totalN, err
+		}
+
+		f.log.Debugf("End of file reached: %s; Backoff now.", f.file.Name())
+		f.wait()
+	}
+}
+
+// errorChecks determines the cause for EOF errors, and how the EOF event
+// should be handled based on the config options.
+func (f *logFile) errorChecks(err error) error {
+	if err != io.EOF {
+		f.log.Errorf("Unexpected state reading from %s; error: %s", f.file.Name(), err)
+		return err
+	}
+
+	if f.config.CloseEOF {
+		return err
+	}
+
+	info, statErr := f.file.Stat()
+	if statErr != nil {
+		f.log.Errorf("Unexpected error reading from %s; error: %s", f.file.Name(), statErr)
+		return statErr
+	}
+
+	if info.Size() < f.offset {
+		f.log.Debugf("File was truncated as offset (%d) > size (%d): %s", f.offset, info.Size(), f.file.Name())
+		return ErrFileTruncate
+	}
+
+	if f.config.CloseInactive > 0 && time.Since(f.lastTimeRead) > f.config.CloseInactive {
+		return ErrInactive
+	}
+
+	return nil
+}
+
+// checkFileDisappearedErrors checks if the file has been removed or renamed.
+func (f *logFile) checkFileDisappearedErrors() error {
+	if !f.config.CloseRenamed && !f.config.CloseRemoved {
+		return nil
+	}
+
+	info, statErr := f.file.Stat()
+	if statErr != nil {
+		f.log.Errorf("Unexpected error reading from %s; error: %s", f.file.Name(), statErr)
+		return statErr
+	}
+
+	if f.config.CloseRenamed {
+		// Check if the file can still be found under the same path
+		if current, err := os.Stat(f.file.Name()); err != nil || !os.SameFile(current, info) {
+			f.log.Debugf("close_renamed is enabled and file %s has been renamed", f.file.Name())
+			return ErrRenamed
+		}
+	}
+
+	if f.config.CloseRemoved {
+		if _, err := os.Stat(f.file.Name()); os.IsNotExist(err) {
+			f.log.Debugf("close_removed is enabled and file %s has been removed", f.file.Name())
+			return ErrRemoved
+		}
+	}
+
+	return nil
+}
+
+func (f *logFile) wait() {
+	// Wait before trying to read file again. File reached EOF.
+	select {
+	case <-f.done:
+		return
+	case <-time.After(f.backoff):
+	}
+
+	// Increment backoff up to maxBackoff
+	if f.backoff < f.config.MaxBackoff {
+		f.backoff = f.backoff * time.Duration(f.config.BackoffFactor)
+		if f.backoff > f.config.MaxBackoff {
+			f.backoff = f.config.MaxBackoff
+		}
+	}
+}
+
+// Close closes the underlying file.
+func (f *logFile) Close() error {
+	return f.file.Close()
+}
@@ -0,0 +1,78 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"os"
+
+	"github.com/elastic/beats/v7/libbeat/common/file"
+)
+
+// fileSource is a file discovered by the prospector. The name of the source
+// is derived from the file identity and is used as key of the cursor in the
+// registry.
+type fileSource struct {
+	name string
+	path string
+	info os.FileInfo
+}
+
+func (s fileSource) Name() string { return s.name }
+
+// fileIdentifier computes the identity of a file. Files with the same
+// identity share the same cursor.
+type fileIdentifier interface {
+	Name() string
+	GetSource(path string, info os.FileInfo) fileSource
+}
+
+// nativeIdentifier identifies files by the inode and device id on Unix-like
+// systems, and by the volume serial and file index on Windows. Files keep their
+// identity and cursor when being renamed.
+type nativeIdentifier struct{}
+
+// pathIdentifier identifies files by their path. Renamed files are read from
+// the beginning.
+type pathIdentifier struct{}
+
+func newFileIdentifier(name string) fileIdentifier {
+	if name == identityPath {
+		return pathIdentifier{}
+	}
+	return nativeIdentifier{}
+}
+
+func (nativeIdentifier) Name() string { return identityNative }
+
+func (i nativeIdentifier) GetSource(path string, info os.FileInfo) fileSource {
+	return fileSource{
+		name: i.Name() + "::" + file.GetOSState(info).String(),
+		path: path,
+		info: info,
+	}
+}
+
+func (pathIdentifier) Name() string { return identityPath }
+
+func (i pathIdentifier) GetSource(path string, info os.FileInfo) fileSource {
+	return fileSource{
+		name: i.Name() + "::" + path,
+		path: path,
+		info: info,
+	}
+}
@@ -0,0 +1,314 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/elastic/go-concert/ctxtool"
+
+	"github.com/elastic/beats/v7/filebeat/harvester"
+	input "github.com/elastic/beats/v7/filebeat/input/v2"
+	cursor "github.com/elastic/beats/v7/filebeat/input/v2/input-cursor"
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/feature"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/reader"
+	"github.com/elastic/beats/v7/libbeat/reader/debug"
+	"github.com/elastic/beats/v7/libbeat/reader/multiline"
+	"github.com/elastic/beats/v7/libbeat/reader/readfile"
+	"github.com/elastic/beats/v7/libbeat/reader/readfile/encoding"
+)
+
+const pluginName = "filestream"
+
+// filestream is the harvester of the filestream input. It reads a single
+// file from the offset stored in the cursor.
+type filestream struct {
+	readerConfig ReaderConfig
+	encoding     encoding.EncodingFactory
+	ignoreOlder  time.Duration
+	offsets      *harvesterOffsets
+}
+
+// state is the cursor state stored in the registry for each file.
+type state struct {
+	Offset int64 `json:"offset" struct:"offset"`
+}
+
+// Plugin creates a new filestream input plugin for creating a stateful input.
+func Plugin(log *logp.Logger, store cursor.StateStore) input.Plugin {
+	return input.Plugin{
+		Name:       pluginName,
+		Stability:  feature.Experimental,
+		Deprecated: false,
+		Info:       "filestream input",
+		Doc:        "The filestream input collects logs from files",
+		Manager: &cursor.InputManager{
+			Logger:              log,
+			StateStore:          store,
+			Type:                pluginName,
+			ConfigureProspector: configure,
+		},
+	}
+}
+
+func configure(cfg *common.Config) (cursor.Prospector, cursor.Input, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, nil, err
+	}
+
+	encodingFactory, ok := encoding.FindEncoding(config.Encoding)
+	if !ok || encodingFactory == nil {
+		return nil, nil, fmt.Errorf("unknown encoding('%v')", config.Encoding)
+	}
+
+	offsets := newHarvesterOffsets()
+	prospector, err := newFileProspector(config, offsets)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return prospector, &filestream{
+		readerConfig: config.ReaderConfig,
+		encoding:     encodingFactory,
+		ignoreOlder:  config.IgnoreOlder,
+		offsets:      offsets,
+	}, nil
+}
+
+func (inp *filestream) Name() string { return pluginName }
+
+func (inp *filestream) Test(src cursor.Source, _ input.TestContext) error {
+	f, err := os.Open(src.(fileSource).path)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Run reads the file from the last known offset until one of the close
+// conditions applies or the input is stopped.
+func (inp *filestream) Run(
+	ctx input.Context,
+	src cursor.Source,
+	c cursor.Cursor,
+	publisher cursor.Publisher,
+) error {
+	fs := src.(fileSource)
+	log := ctx.Logger.With("path", fs.path)
+
+	st := state{}
+	if err := c.Unpack(&st); err != nil {
+		log.Errorf("Failed to read the cursor state, reading file from the beginning: %v", err)
+		st = state{}
+	}
+
+	if inp.ignoreOlder > 0 && time.Since(fs.info.ModTime()) > inp.ignoreOlder {
+		// Like the log input, files found for the first time after
+		// ignore_older has been reached are not collected, but their end of
+		// file offset is stored. Only content added later is collected.
+		if c.IsNew() {
+			log.Debugf("Ignore file because ignore_older reached, storing end of file offset %d.", fs.info.Size())
+			st.Offset = fs.info.Size()
+			if err := publisher.Publish(beat.Event{}, st); err != nil {
+				return nil
+			}
+		}
+		inp.offsets.set(fs.Name(), st.Offset)
+		return nil
+	}
+
+	f, err := inp.openFile(log, fs, st.Offset)
+	if err != nil {
+		return err
+	}
+	if f == nil {
+		return nil
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if info.Size() < st.Offset {
+		log.Infof("File was truncated. Reading file from the beginning.")
+		st.Offset = 0
+	}
+	if _, err := f.Seek(st.Offset, os.SEEK_SET); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to seek to offset %d: %w", st.Offset, err)
+	}
+	defer func() { inp.offsets.set(fs.Name(), st.Offset) }()
+
+	cancelCtx := ctxtool.FromCanceller(ctx.Cancelation)
+	if inp.readerConfig.CloseTimeout > 0 {
+		var cancel context.CancelFunc
+		cancelCtx, cancel = context.WithTimeout(cancelCtx, inp.readerConfig.CloseTimeout)
+		defer cancel()
+	}
+
+	lf := newLogFile(log, f, inp.readerConfig, st.Offset, cancelCtx.Done())
+	r, err := inp.newReader(lf)
+	if err != nil {
+		lf.Close()
+		return err
+	}
+	defer r.Close()
+
+	log.Infof("Harvester started for file at offset %d.", st.Offset)
+	for ctx.Cancelation.Err() == nil {
+		message, err := r.Next()
+		if err != nil {
+			switch err {
+			case ErrFileTruncate:
+				log.Info("File was truncated. Begin reading file from offset 0.")
+				st.Offset = 0
+				publisher.Publish(beat.Event{}, st)
+			case ErrClosed, ErrRemoved, ErrRenamed, ErrInactive:
+				log.Infof("Harvester stopped: %v", err)
+			default:
+				log.Infof("Stopped harvester: %v", err)
+			}
+			return nil
+		}
+
+		offset := st.Offset
+		st.Offset += int64(message.Bytes)
+
+		text := string(message.Content)
+		if message.IsEmpty() || !inp.shouldExportLine(text) {
+			// publish an empty event to update the cursor only
+			if err := publisher.Publish(beat.Event{}, st); err != nil {
+				return nil
+			}
+			continue
+		}
+
+		if err := publisher.Publish(inp.eventFromMessage(message, fs.path, offset), st); err != nil {
+			return nil
+		}
+	}
+	return nil
+}
+
+// openFile opens the file of the source. If the file at the path is not the
+// file that has been found by the prospector anymore, nil is returned. The
+// prospector will pick up the new file on the next scan.
+func (inp *filestream) openFile(log *logp.Logger, fs fileSource, offset int64) (*os.File, error) {
+	f, err := os.Open(fs.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening %s: %w", fs.path, err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to stat source file %s: %w", fs.path, err)
+	}
+	if !info.Mode().IsRegular() {
+		f.Close()
+		return nil, fmt.Errorf("tried to open non regular file: %q %s", info.Mode(), info.Name())
+	}
+	if !os.SameFile(info, fs.info) {
+		log.Debugf("File has been replaced since it was found by the prospector.")
+		f.Close()
+		return nil, nil
+	}
+	return f, nil
+}
+
+// newReader creates the reader chain used to read lines from the file.
+func (inp *filestream) newReader(lf *logFile) (reader.Reader, error) {
+	var r reader.Reader
+
+	dbgReader, err := debug.AppendReaders(lf)
+	if err != nil {
+		return nil, err
+	}
+
+	enc, err := inp.encoding(dbgReader)
+	if err != nil {
+		return nil, err
+	}
+
+	// Configure MaxBytes limit for EncodeReader as multiplied by 4
+	// for the worst case scenario where incoming UTF32 charchers are decoded to the single byte UTF-8 characters.
+	// This limit serves primarily to avoid memory bload or potential OOM with expectedly long lines in the file.
+	// The further size limiting is performed by LimitReader at the end of the readers pipeline as needed.
+	r, err = readfile.NewEncodeReader(dbgReader, readfile.Config{
+		Codec:      enc,
+		BufferSize: inp.readerConfig.BufferSize,
+		Terminator: inp.readerConfig.LineTerminator,
+		MaxBytes:   inp.readerConfig.MaxBytes * 4,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r = readfile.NewStripNewline(r, inp.readerConfig.LineTerminator)
+
+	if inp.readerConfig.Multiline != nil {
+		r, err = multiline.New(r, "\n", inp.readerConfig.MaxBytes, inp.readerConfig.Multiline)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return readfile.NewLimitReader(r, inp.readerConfig.MaxBytes), nil
+}
+
+// shouldExportLine decides if the line is exported or not based on
+// the include_lines and exclude_lines options.
+func (inp *filestream) shouldExportLine(line string) bool {
+	if len(inp.readerConfig.IncludeLines) > 0 {
+		if !harvester.MatchAny(inp.readerConfig.IncludeLines, line) {
+			return false
+		}
+	}
+	if len(inp.readerConfig.ExcludeLines) > 0 {
+		if harvester.MatchAny(inp.readerConfig.ExcludeLines, line) {
+			return false
+		}
+	}
+	return true
+}
+
+func (inp *filestream) eventFromMessage(m reader.Message, path string, offset int64) beat.Event {
+	fields := common.MapStr{
+		"log": common.MapStr{
+			"offset": offset, // Offset here is the offset before the starting char.
+			"file": common.MapStr{
+				"path": path,
+			},
+		},
+		"message": string(m.Content),
+	}
+	fields.DeepUpdate(m.Fields)
+
+	return beat.Event{
+		Timestamp: m.Ts,
+		Fields:    fields,
+	}
+}
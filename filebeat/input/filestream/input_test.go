@@ -0,0 +1,249 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	input "github.com/elastic/beats/v7/filebeat/input/v2"
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	pubtest "github.com/elastic/beats/v7/libbeat/publisher/testing"
+	"github.com/elastic/beats/v7/libbeat/statestore"
+	"github.com/elastic/beats/v7/libbeat/statestore/storetest"
+)
+
+type testStateStore struct {
+	store *statestore.Store
+}
+
+func (s testStateStore) Access() (*statestore.Store, error) { return s.store, nil }
+func (s testStateStore) CleanupInterval() time.Duration     { return time.Second }
+
+func TestFilestream_ReadAndContinue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filestream")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.log")
+	require.NoError(t, ioutil.WriteFile(path, []byte("first line\nsecond line\nthird line\n"), 0644))
+
+	store := newTestStore(t)
+	config := map[string]interface{}{
+		"paths":          []string{filepath.Join(dir, "*.log")},
+		"close_eof":      true,
+		"scan_frequency": "50ms",
+		"exclude_lines":  []string{"^second"},
+	}
+
+	events := runInput(t, store, config, 2)
+	require.Len(t, events, 2)
+	assert.Equal(t, "first line", events[0].Fields["message"])
+	assert.Equal(t, "third line", events[1].Fields["message"])
+
+	offset, _ := events[1].Fields.GetValue("log.offset")
+	assert.Equal(t, int64(23), offset)
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString("fourth line\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	events = runInput(t, store, config, 1)
+	require.Len(t, events, 1)
+	assert.Equal(t, "fourth line", events[0].Fields["message"])
+}
+
+func TestFilestream_IgnoreOlder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filestream")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.log")
+	require.NoError(t, ioutil.WriteFile(path, []byte("old line\n"), 0644))
+	old := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(path, old, old))
+
+	store := newTestStore(t)
+	config := map[string]interface{}{
+		"paths":          []string{filepath.Join(dir, "*.log")},
+		"close_eof":      true,
+		"scan_frequency": "50ms",
+		"ignore_older":   "1h",
+	}
+
+	// The end of file offset is stored without publishing the old content.
+	events := runInputUntil(t, store, config, func([]beat.Event) bool {
+		return storedOffset(t, store) == 9
+	})
+	assert.Empty(t, events)
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString("new line\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	events = runInput(t, store, config, 1)
+	require.Len(t, events, 1)
+	assert.Equal(t, "new line", events[0].Fields["message"])
+}
+
+func TestConfig_Validate(t *testing.T) {
+	cases := map[string]struct {
+		config  map[string]interface{}
+		wantErr bool
+	}{
+		"no paths": {
+			config:  map[string]interface{}{},
+			wantErr: true,
+		},
+		"paths": {
+			config: map[string]interface{}{"paths": []string{"/var/log/*.log"}},
+		},
+		"unknown file identity": {
+			config:  map[string]interface{}{"paths": []string{"/var/log/*.log"}, "file_identity": "hash"},
+			wantErr: true,
+		},
+		"clean_inactive without ignore_older": {
+			config:  map[string]interface{}{"paths": []string{"/var/log/*.log"}, "clean_inactive": "1h"},
+			wantErr: true,
+		},
+		"clean_inactive too small": {
+			config: map[string]interface{}{
+				"paths":          []string{"/var/log/*.log"},
+				"clean_inactive": "1h",
+				"ignore_older":   "1h",
+			},
+			wantErr: true,
+		},
+	}
+
+	for name, test := range cases {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			c := defaultConfig()
+			err := common.MustNewConfigFrom(test.config).Unpack(&c)
+			if test.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func newTestStore(t *testing.T) testStateStore {
+	reg := statestore.NewRegistry(storetest.NewMemoryStoreBackend())
+	store, err := reg.Get("test")
+	require.NoError(t, err)
+	return testStateStore{store: store}
+}
+
+// runInput runs a new filestream input until n events have been published.
+// All events are ACKed immediately.
+func runInput(t *testing.T, store testStateStore, config map[string]interface{}, n int) []beat.Event {
+	return runInputUntil(t, store, config, func(events []beat.Event) bool {
+		return len(events) == n
+	})
+}
+
+// runInputUntil runs a new filestream input until done returns true. done is
+// called with the events published so far, after each event or cursor
+// update has been ACKed.
+func runInputUntil(t *testing.T, store testStateStore, config map[string]interface{}, done func([]beat.Event) bool) []beat.Event {
+	plugin := Plugin(logp.NewLogger("test"), store)
+	inp, err := plugin.Manager.Create(common.MustNewConfigFrom(config))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var events []beat.Event
+	pipeline := pubtest.FakeConnector{
+		ConnectFunc: func(cfg beat.ClientConfig) (beat.Client, error) {
+			return &pubtest.FakeClient{
+				PublishFunc: func(event beat.Event) {
+					cfg.ACKHandler.AddEvent(event, true)
+					cfg.ACKHandler.ACKEvents(1)
+
+					mu.Lock()
+					defer mu.Unlock()
+					if event.Fields != nil {
+						events = append(events, event)
+					}
+					if done(events) {
+						cancel()
+					}
+				},
+			}, nil
+		},
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		inp.Run(input.Context{
+			ID:          "test",
+			Logger:      logp.NewLogger("test"),
+			Cancelation: ctx,
+		}, pipeline)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for events")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return events
+}
+
+// storedOffset returns the offset of the only file state in the store, or -1
+// if no offset has been stored yet.
+func storedOffset(t *testing.T, store testStateStore) int64 {
+	offset := int64(-1)
+	err := store.store.Each(func(_ string, dec statestore.ValueDecoder) (bool, error) {
+		var st struct {
+			Cursor *state
+		}
+		if err := dec.Decode(&st); err != nil {
+			return false, err
+		}
+		if st.Cursor != nil {
+			offset = st.Cursor.Offset
+		}
+		return true, nil
+	})
+	require.NoError(t, err)
+	return offset
+}
@@ -0,0 +1,245 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-concert/timed"
+
+	"github.com/elastic/beats/v7/filebeat/input/file"
+	input "github.com/elastic/beats/v7/filebeat/input/v2"
+	cursor "github.com/elastic/beats/v7/filebeat/input/v2/input-cursor"
+	"github.com/elastic/beats/v7/libbeat/common/match"
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+const recursiveGlobDepth = 8
+
+// noCleanTimeout keeps the state of a file in the registry until the file is
+// removed.
+const noCleanTimeout = time.Duration(math.MaxInt64)
+
+// fileProspector scans the configured glob patterns for files and starts a
+// harvester for each file that has new content.
+type fileProspector struct {
+	paths         []string
+	excludeFiles  []match.Matcher
+	interval      time.Duration
+	ignoreOlder   time.Duration
+	cleanInactive time.Duration
+	cleanRemoved  bool
+	identifier    fileIdentifier
+	offsets       *harvesterOffsets
+
+	// files known from the last scan, by source name
+	files map[string]fileSource
+}
+
+// harvesterOffsets stores the offset a harvester has stopped at for each
+// source. The prospector uses the offsets to decide if a file has new content
+// that needs to be collected.
+type harvesterOffsets struct {
+	mu      sync.Mutex
+	offsets map[string]int64
+}
+
+func newFileProspector(c config, offsets *harvesterOffsets) (*fileProspector, error) {
+	paths := c.Paths
+	if c.RecursiveGlob {
+		paths = nil
+		for _, path := range c.Paths {
+			patterns, err := file.GlobPatterns(path, recursiveGlobDepth)
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, patterns...)
+		}
+	}
+
+	for i, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the absolute path for %s: %v", path, err)
+		}
+		paths[i] = abs
+	}
+
+	return &fileProspector{
+		paths:         paths,
+		excludeFiles:  c.ExcludeFiles,
+		interval:      c.ScanFrequency,
+		ignoreOlder:   c.IgnoreOlder,
+		cleanInactive: c.CleanInactive,
+		cleanRemoved:  c.CleanRemoved,
+		identifier:    newFileIdentifier(c.FileIdentity),
+		offsets:       offsets,
+		files:         map[string]fileSource{},
+	}, nil
+}
+
+// Test checks that all glob patterns are valid.
+func (p *fileProspector) Test() error {
+	for _, path := range p.paths {
+		if _, err := filepath.Glob(path); err != nil {
+			return fmt.Errorf("invalid glob pattern '%v': %w", path, err)
+		}
+	}
+	return nil
+}
+
+// CleanTimeout returns the time to live of the file states. States are kept
+// until the file is removed, unless clean_inactive is configured.
+func (p *fileProspector) CleanTimeout() time.Duration {
+	if p.cleanInactive > 0 {
+		return p.cleanInactive
+	}
+	return noCleanTimeout
+}
+
+// Run scans for files every scan_frequency until the input is stopped.
+func (p *fileProspector) Run(ctx input.Context, hg cursor.HarvesterGroup) {
+	log := ctx.Logger.With("prospector", p.identifier.Name())
+
+	p.scan(ctx, log, hg)
+	timed.Periodic(ctx.Cancelation, p.interval, func() error {
+		p.scan(ctx, log, hg)
+		return nil
+	})
+}
+
+func (p *fileProspector) scan(ctx input.Context, log *logp.Logger, hg cursor.HarvesterGroup) {
+	current := map[string]fileSource{}
+	for path, info := range p.getFiles(log) {
+		src := p.identifier.GetSource(path, info)
+		current[src.Name()] = src
+
+		if p.ignoreOlder > 0 && time.Since(info.ModTime()) > p.ignoreOlder {
+			log.Debugf("Ignore file because ignore_older reached: %s", path)
+			// The harvester stores the end of file offset of new files, so
+			// only content added later is collected.
+			if !p.offsets.known(src) {
+				hg.Start(ctx, src)
+			}
+			continue
+		}
+
+		if p.offsets.hasNewContent(src) {
+			hg.Start(ctx, src)
+		}
+	}
+
+	for name, src := range p.files {
+		if _, exists := current[name]; exists {
+			continue
+		}
+
+		log.Debugf("File %s has been removed", src.path)
+		p.offsets.remove(name)
+		if p.cleanRemoved {
+			hg.Remove(src)
+		}
+	}
+	p.files = current
+}
+
+// getFiles returns all regular files matching the glob patterns, that are
+// not excluded.
+func (p *fileProspector) getFiles(log *logp.Logger) map[string]os.FileInfo {
+	files := map[string]os.FileInfo{}
+	for _, path := range p.paths {
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			log.Errorf("glob(%s) failed: %v", path, err)
+			continue
+		}
+
+		for _, file := range matches {
+			if p.isFileExcluded(file) {
+				log.Debugf("Exclude file: %s", file)
+				continue
+			}
+
+			// symlinks are not followed
+			info, err := os.Lstat(file)
+			if err != nil {
+				log.Debugf("stat(%s) failed: %s", file, err)
+				continue
+			}
+			if !info.Mode().IsRegular() {
+				continue
+			}
+
+			files[file] = info
+		}
+	}
+	return files
+}
+
+func (p *fileProspector) isFileExcluded(file string) bool {
+	for _, matcher := range p.excludeFiles {
+		if matcher.MatchString(file) {
+			return true
+		}
+	}
+	return false
+}
+
+func newHarvesterOffsets() *harvesterOffsets {
+	return &harvesterOffsets{offsets: map[string]int64{}}
+}
+
+// hasNewContent returns true if the file has not been collected by this
+// input yet, or if its size differs from the offset the last harvester
+// has stopped at.
+func (o *harvesterOffsets) hasNewContent(src fileSource) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	offset, known := o.offsets[src.Name()]
+	return !known || offset != src.info.Size()
+}
+
+// known returns true if a harvester has already run for the source.
+func (o *harvesterOffsets) known(src fileSource) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	_, known := o.offsets[src.Name()]
+	return known
+}
+
+// set records the offset a harvester has stopped at.
+func (o *harvesterOffsets) set(name string, offset int64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.offsets[name] = offset
+}
+
+// remove deletes the offset of a harvester. The next harvester for the
+// source will be started unconditionally.
+func (o *harvesterOffsets) remove(name string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.offsets, name)
+}
@@ -0,0 +1,127 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	input "github.com/elastic/beats/v7/filebeat/input/v2"
+	cursor "github.com/elastic/beats/v7/filebeat/input/v2/input-cursor"
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+type fakeHarvesterGroup struct {
+	started []string
+	removed []string
+}
+
+func (hg *fakeHarvesterGroup) Start(_ input.Context, src cursor.Source) {
+	hg.started = append(hg.started, src.(fileSource).path)
+}
+
+func (hg *fakeHarvesterGroup) Remove(src cursor.Source) {
+	hg.removed = append(hg.removed, src.(fileSource).path)
+}
+
+func TestFileProspector_Scan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filestream")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	pathA := filepath.Join(dir, "a.log")
+	pathB := filepath.Join(dir, "b.log")
+	require.NoError(t, ioutil.WriteFile(pathA, []byte("line\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(pathB, []byte("line\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "c.txt"), []byte("line\n"), 0644))
+
+	c := defaultConfig()
+	c.Paths = []string{filepath.Join(dir, "*.log")}
+	offsets := newHarvesterOffsets()
+	p, err := newFileProspector(c, offsets)
+	require.NoError(t, err)
+
+	log := logp.NewLogger("test")
+	ctx := input.Context{Logger: log, Cancelation: context.Background()}
+
+	hg := &fakeHarvesterGroup{}
+	p.scan(ctx, log, hg)
+	assert.ElementsMatch(t, []string{pathA, pathB}, hg.started)
+
+	// a has been read completely, b has been stopped before EOF
+	for _, src := range p.files {
+		if src.path == pathA {
+			offsets.set(src.Name(), src.info.Size())
+		} else {
+			offsets.set(src.Name(), 0)
+		}
+	}
+
+	hg = &fakeHarvesterGroup{}
+	p.scan(ctx, log, hg)
+	assert.Equal(t, []string{pathB}, hg.started)
+
+	require.NoError(t, os.Remove(pathB))
+	hg = &fakeHarvesterGroup{}
+	p.scan(ctx, log, hg)
+	assert.Empty(t, hg.started)
+	assert.Equal(t, []string{pathB}, hg.removed)
+}
+
+func TestFileProspector_CleanTimeout(t *testing.T) {
+	c := defaultConfig()
+	c.Paths = []string{"/var/log/*.log"}
+
+	p, err := newFileProspector(c, newHarvesterOffsets())
+	require.NoError(t, err)
+	assert.Equal(t, noCleanTimeout, p.CleanTimeout())
+
+	c.CleanInactive = time.Hour
+	p, err = newFileProspector(c, newHarvesterOffsets())
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, p.CleanTimeout())
+}
+
+func TestFileIdentifier(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filestream")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "a.log")
+	require.NoError(t, ioutil.WriteFile(path, []byte("line\n"), 0644))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+
+	renamed := filepath.Join(dir, "a.log.1")
+	require.NoError(t, os.Rename(path, renamed))
+	renamedInfo, err := os.Stat(renamed)
+	require.NoError(t, err)
+
+	native := newFileIdentifier(identityNative)
+	assert.Equal(t, native.GetSource(path, info).Name(), native.GetSource(renamed, renamedInfo).Name())
+
+	byPath := newFileIdentifier(identityPath)
+	assert.NotEqual(t, byPath.GetSource(path, info).Name(), byPath.GetSource(renamed, renamedInfo).Name())
+}
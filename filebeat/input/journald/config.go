@@ -23,8 +23,11 @@ import (
 	"errors"
 	"time"
 
+	"github.com/dustin/go-humanize"
+
 	"github.com/elastic/beats/v7/journalbeat/pkg/journalfield"
 	"github.com/elastic/beats/v7/journalbeat/pkg/journalread"
+	"github.com/elastic/beats/v7/libbeat/reader/multiline"
 )
 
 // Config stores the options of a journald input.
@@ -48,11 +51,29 @@ type config struct {
 	// Matches store the key value pairs to match entries.
 	Matches []journalfield.Matcher `config:"include_matches"`
 
+	// Units restricts the entries read to the given systemd units.
+	Units []string `config:"units"`
+
+	// IncludeFields lists the journal fields to keep. All fields are kept if empty.
+	IncludeFields []string `config:"include_fields"`
+
+	// ExcludeFields lists the journal fields to drop.
+	ExcludeFields []string `config:"exclude_fields"`
+
+	// Multiline combines consecutive entries of the same unit into one event.
+	Multiline *multiline.Config `config:"multiline"`
+
+	// MaxBytes is the maximum size of a multiline message.
+	MaxBytes int `config:"max_bytes" validate:"min=0,nonzero"`
+
 	// SaveRemoteHostname defines if the original source of the entry needs to be saved.
 	SaveRemoteHostname bool `config:"save_remote_hostname"`
 }
 
-var errInvalidSeekFallback = errors.New("invalid setting for cursor_seek_fallback")
+var (
+	errInvalidSeekFallback = errors.New("invalid setting for cursor_seek_fallback")
+	errEmptyUnit           = errors.New("unit name must not be empty")
+)
 
 func defaultConfig() config {
 	return config{
@@ -60,6 +81,7 @@ func defaultConfig() config {
 		MaxBackoff:         20 * time.Second,
 		Seek:               journalread.SeekCursor,
 		CursorSeekFallback: journalread.SeekHead,
+		MaxBytes:           10 * humanize.MiByte,
 		SaveRemoteHostname: false,
 	}
 }
@@ -68,5 +90,13 @@ func (c *config) Validate() error {
 	if c.CursorSeekFallback != journalread.SeekHead && c.CursorSeekFallback != journalread.SeekTail {
 		return errInvalidSeekFallback
 	}
+	for _, unit := range c.Units {
+		if unit == "" {
+			return errEmptyUnit
+		}
+	}
+	if _, err := newFieldFilter(c.IncludeFields, c.ExcludeFields); err != nil {
+		return err
+	}
 	return nil
 }
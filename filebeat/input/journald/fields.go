@@ -0,0 +1,69 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package journald
+
+import (
+	"fmt"
+	"path"
+)
+
+// fieldFilter removes journal fields from an entry after it has been read.
+// Patterns are matched against the raw journal field names (e.g. _SYSTEMD_UNIT)
+// and support shell-style wildcards.
+type fieldFilter struct {
+	include []string
+	exclude []string
+}
+
+func newFieldFilter(include, exclude []string) (*fieldFilter, error) {
+	for _, pattern := range append(append([]string{}, include...), exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid field pattern '%v': %v", pattern, err)
+		}
+	}
+
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, nil
+	}
+	return &fieldFilter{include: include, exclude: exclude}, nil
+}
+
+// apply removes all fields from the map that are not included, or that are
+// explicitely excluded. A nil filter keeps all fields.
+func (f *fieldFilter) apply(fields map[string]string) {
+	if f == nil {
+		return
+	}
+
+	for name := range fields {
+		if len(f.include) > 0 && !matchAny(f.include, name) {
+			delete(fields, name)
+		} else if matchAny(f.exclude, name) {
+			delete(fields, name)
+		}
+	}
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
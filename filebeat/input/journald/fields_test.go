@@ -0,0 +1,65 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package journald
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldFilter(t *testing.T) {
+	cases := map[string]struct {
+		include, exclude []string
+		want             map[string]string
+	}{
+		"no filter": {
+			want: map[string]string{"MESSAGE": "hello", "_SYSTEMD_UNIT": "app.service", "_PID": "42"},
+		},
+		"include": {
+			include: []string{"MESSAGE", "_SYSTEMD_*"},
+			want:    map[string]string{"MESSAGE": "hello", "_SYSTEMD_UNIT": "app.service"},
+		},
+		"exclude": {
+			exclude: []string{"_PID"},
+			want:    map[string]string{"MESSAGE": "hello", "_SYSTEMD_UNIT": "app.service"},
+		},
+		"include and exclude": {
+			include: []string{"MESSAGE", "_*"},
+			exclude: []string{"_SYSTEMD_*"},
+			want:    map[string]string{"MESSAGE": "hello", "_PID": "42"},
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			filter, err := newFieldFilter(test.include, test.exclude)
+			require.NoError(t, err)
+
+			fields := map[string]string{"MESSAGE": "hello", "_SYSTEMD_UNIT": "app.service", "_PID": "42"}
+			filter.apply(fields)
+			assert.Equal(t, test.want, fields)
+		})
+	}
+}
+
+func TestFieldFilterInvalidPattern(t *testing.T) {
+	_, err := newFieldFilter([]string{"[MESSAGE"}, nil)
+	assert.Error(t, err)
+}
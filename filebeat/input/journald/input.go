@@ -20,11 +20,15 @@
 package journald
 
 import (
+	"context"
+	"fmt"
 	"time"
 
 	"github.com/coreos/go-systemd/v22/sdjournal"
 	"github.com/urso/sderr"
 
+	"github.com/elastic/go-concert/ctxtool"
+
 	input "github.com/elastic/beats/v7/filebeat/input/v2"
 	cursor "github.com/elastic/beats/v7/filebeat/input/v2/input-cursor"
 	"github.com/elastic/beats/v7/journalbeat/pkg/journalfield"
@@ -33,6 +37,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/common/backoff"
 	"github.com/elastic/beats/v7/libbeat/feature"
 	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/reader/multiline"
 )
 
 type journald struct {
@@ -41,6 +46,10 @@ type journald struct {
 	Seek               journalread.SeekMode
 	CursorSeekFallback journalread.SeekMode
 	Matches            []journalfield.Matcher
+	Units              []string
+	FieldFilter        *fieldFilter
+	Multiline          *multiline.Config
+	MaxBytes           int
 	SaveRemoteHostname bool
 }
 
@@ -95,12 +104,21 @@ func configure(cfg *common.Config) ([]cursor.Source, cursor.Input, error) {
 		sources[i] = pathSource(p)
 	}
 
+	filter, err := newFieldFilter(config.IncludeFields, config.ExcludeFields)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	return sources, &journald{
 		Backoff:            config.Backoff,
 		MaxBackoff:         config.MaxBackoff,
 		Seek:               config.Seek,
 		CursorSeekFallback: config.CursorSeekFallback,
 		Matches:            config.Matches,
+		Units:              config.Units,
+		FieldFilter:        filter,
+		Multiline:          config.Multiline,
+		MaxBytes:           config.MaxBytes,
 		SaveRemoteHostname: config.SaveRemoteHostname,
 	}, nil
 }
@@ -134,12 +152,17 @@ func (inp *journald) Run(
 		log.Error("Continue from current position. Seek failed with: %v", err)
 	}
 
+	if inp.Multiline != nil {
+		return inp.runMultiline(ctx, log, reader, publisher)
+	}
+
 	for {
 		entry, err := reader.Next(ctx.Cancelation)
 		if err != nil {
 			return err
 		}
 
+		inp.FieldFilter.apply(entry.Fields)
 		event := eventFromFields(ctx.Logger, entry.RealtimeTimestamp, entry.Fields, inp.SaveRemoteHostname)
 
 		checkpoint.Position = entry.Cursor
@@ -152,9 +175,79 @@ func (inp *journald) Run(
 	}
 }
 
+// runMultiline reads entries in a separate go-routine and passes them to
+// the multiline aggregator. The checkpoint is only updated once all older
+// entries have been published.
+func (inp *journald) runMultiline(
+	ctx input.Context,
+	log *logp.Logger,
+	reader *journalread.Reader,
+	publisher cursor.Publisher,
+) error {
+	cancelCtx, cancel := context.WithCancel(ctxtool.FromCanceller(ctx.Cancelation))
+	defer cancel()
+
+	aggregator := newUnitAggregator(log, inp.Multiline, inp.MaxBytes)
+
+	readErr := make(chan error, 1)
+	go func() {
+		defer aggregator.Close()
+		readErr <- readEntries(cancelCtx, reader, aggregator)
+	}()
+
+	err := inp.publishAggregates(log, aggregator, publisher)
+	cancel()
+	aggregator.Close()
+	if rerr := <-readErr; err == nil {
+		err = rerr
+	}
+	return err
+}
+
+func readEntries(ctx context.Context, reader *journalread.Reader, aggregator *unitAggregator) error {
+	for {
+		e, err := reader.Next(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = aggregator.Add(entry{
+			fields:    e.Fields,
+			timestamp: e.RealtimeTimestamp,
+			cursor: checkpoint{
+				Version:            cursorVersion,
+				Position:           e.Cursor,
+				RealtimeTimestamp:  e.RealtimeTimestamp,
+				MonotonicTimestamp: e.MonotonicTimestamp,
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (inp *journald) publishAggregates(log *logp.Logger, aggregator *unitAggregator, publisher cursor.Publisher) error {
+	for {
+		agg, err := aggregator.Next()
+		if err != nil {
+			return err
+		}
+
+		inp.FieldFilter.apply(agg.fields)
+		event := eventFromFields(log, agg.timestamp, agg.fields, inp.SaveRemoteHostname)
+		event.Fields.DeepUpdate(agg.flags)
+
+		// The cursor is nil if the journal position can not be advanced yet.
+		if err := publisher.Publish(event, agg.cursor); err != nil {
+			return err
+		}
+	}
+}
+
 func (inp *journald) open(log *logp.Logger, canceler input.Canceler, src cursor.Source) (*journalread.Reader, error) {
 	backoff := backoff.NewExpBackoff(canceler.Done(), inp.Backoff, inp.MaxBackoff)
-	reader, err := journalread.Open(log, src.Name(), backoff, withFilters(inp.Matches))
+	reader, err := journalread.Open(log, src.Name(), backoff, withFilters(inp.Units, inp.Matches))
 	if err != nil {
 		return nil, sderr.Wrap(err, "failed to create reader for %{path} journal", src.Name())
 	}
@@ -182,8 +275,20 @@ func initCheckpoint(log *logp.Logger, c cursor.Cursor) checkpoint {
 	return cp
 }
 
-func withFilters(filters []journalfield.Matcher) func(*sdjournal.Journal) error {
+// withFilters adds the unit and field matches to the journal. Entries must
+// match one of the units and one of the field matchers.
+func withFilters(units []string, filters []journalfield.Matcher) func(*sdjournal.Journal) error {
 	return func(j *sdjournal.Journal) error {
+		for _, unit := range units {
+			if err := j.AddMatch(unitField + "=" + unit); err != nil {
+				return fmt.Errorf("error adding match for unit '%s' to journal: %v", unit, err)
+			}
+		}
+		if len(units) > 0 && len(filters) > 0 {
+			if err := j.AddConjunction(); err != nil {
+				return fmt.Errorf("error adding conjunction to journal: %v", err)
+			}
+		}
 		return journalfield.ApplyMatchersOr(j, filters)
 	}
 }
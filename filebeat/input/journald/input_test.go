@@ -0,0 +1,234 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// +build linux,cgo,withjournald
+
+package journald
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	input "github.com/elastic/beats/v7/filebeat/input/v2"
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	pubtest "github.com/elastic/beats/v7/libbeat/publisher/testing"
+	"github.com/elastic/beats/v7/libbeat/statestore"
+	"github.com/elastic/beats/v7/libbeat/statestore/storetest"
+)
+
+// testdata/units.journal contains these entries, besides the messages of
+// journald itself:
+//
+//	app.service    Exception in thread main
+//	other.service  started
+//	app.service      at Main.run
+//	app.service      at Main.main
+//	noise.service  debug output
+//	other.service  stopped
+//	app.service    done
+//
+// Each entry has a FIXTURE_SEQ field with its position in the list, and the
+// unit name without suffix as SYSLOG_IDENTIFIER.
+var unitsJournal = filepath.Join("testdata", "units.journal")
+
+type testStateStore struct {
+	store *statestore.Store
+}
+
+func (s testStateStore) Access() (*statestore.Store, error) { return s.store, nil }
+func (s testStateStore) CleanupInterval() time.Duration     { return time.Second }
+
+func TestInput_Units(t *testing.T) {
+	events := runInput(t, map[string]interface{}{
+		"paths": []string{unitsJournal},
+		"units": []string{"other.service", "noise.service"},
+	}, 3)
+
+	assert.Equal(t, []string{"started", "debug output", "stopped"}, messagesOf(events))
+	for _, event := range events {
+		unit, _ := event.Fields.GetValue("systemd.unit")
+		assert.Contains(t, []interface{}{"other.service", "noise.service"}, unit)
+	}
+}
+
+func TestInput_IncludeMatches(t *testing.T) {
+	events := runInput(t, map[string]interface{}{
+		"paths":           []string{unitsJournal},
+		"units":           []string{"app.service", "other.service"},
+		"include_matches": []string{"SYSLOG_IDENTIFIER=other", "SYSLOG_IDENTIFIER=noise"},
+	}, 2)
+
+	assert.Equal(t, []string{"started", "stopped"}, messagesOf(events))
+}
+
+func TestInput_FieldFilter(t *testing.T) {
+	cases := map[string]struct {
+		config  map[string]interface{}
+		present []string
+		absent  []string
+	}{
+		"include fields": {
+			config: map[string]interface{}{
+				"include_fields": []string{"MESSAGE", "_SYSTEMD_*"},
+			},
+			present: []string{"message", "systemd.unit"},
+			absent:  []string{"syslog.identifier", "journald.custom.fixture_seq", "host.boot_id"},
+		},
+		"exclude fields": {
+			config: map[string]interface{}{
+				"exclude_fields": []string{"FIXTURE_SEQ", "_BOOT_ID"},
+			},
+			present: []string{"message", "systemd.unit", "syslog.identifier"},
+			absent:  []string{"journald.custom.fixture_seq", "host.boot_id"},
+		},
+		"exclude included fields": {
+			config: map[string]interface{}{
+				"include_fields": []string{"MESSAGE", "SYSLOG_*"},
+				"exclude_fields": []string{"SYSLOG_IDENTIFIER"},
+			},
+			present: []string{"message"},
+			absent:  []string{"systemd.unit", "syslog.identifier"},
+		},
+	}
+
+	for name, test := range cases {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			config := map[string]interface{}{
+				"paths": []string{unitsJournal},
+				"units": []string{"noise.service"},
+			}
+			for k, v := range test.config {
+				config[k] = v
+			}
+
+			events := runInput(t, config, 1)
+			require.Len(t, events, 1)
+			assert.Equal(t, "debug output", events[0].Fields["message"])
+			for _, field := range test.present {
+				_, err := events[0].Fields.GetValue(field)
+				assert.NoError(t, err, "field %v is missing", field)
+			}
+			for _, field := range test.absent {
+				_, err := events[0].Fields.GetValue(field)
+				assert.Error(t, err, "field %v is not filtered", field)
+			}
+		})
+	}
+}
+
+func TestInput_Multiline(t *testing.T) {
+	events := runInput(t, map[string]interface{}{
+		"paths": []string{unitsJournal},
+		"units": []string{"app.service", "other.service"},
+		"multiline": map[string]interface{}{
+			"type":    "pattern",
+			"pattern": `^\s`,
+			"match":   "after",
+			"timeout": "100ms",
+		},
+	}, 4)
+
+	// Entries of other units logging in between do not interrupt the
+	// multiline event of app.service.
+	byMessage := map[string]beat.Event{}
+	for _, event := range events {
+		byMessage[event.Fields["message"].(string)] = event
+	}
+	assert.Len(t, byMessage, 4)
+	for _, message := range []string{"started", "stopped", "done"} {
+		assert.Contains(t, byMessage, message)
+	}
+
+	stacktrace, ok := byMessage["Exception in thread main\n  at Main.run\n  at Main.main"]
+	require.True(t, ok, "multiline event is missing")
+	unit, _ := stacktrace.Fields.GetValue("systemd.unit")
+	assert.Equal(t, "app.service", unit)
+	flags, _ := stacktrace.Fields.GetValue("log.flags")
+	assert.Equal(t, []string{"multiline"}, flags)
+}
+
+func messagesOf(events []beat.Event) []string {
+	messages := make([]string, len(events))
+	for i, event := range events {
+		messages[i], _ = event.Fields["message"].(string)
+	}
+	return messages
+}
+
+// runInput runs a new journald input until n events have been published.
+// All events are ACKed immediately.
+func runInput(t *testing.T, config map[string]interface{}, n int) []beat.Event {
+	reg := statestore.NewRegistry(storetest.NewMemoryStoreBackend())
+	store, err := reg.Get("test")
+	require.NoError(t, err)
+
+	plugin := Plugin(logp.NewLogger("test"), testStateStore{store: store})
+	inp, err := plugin.Manager.Create(common.MustNewConfigFrom(config))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var events []beat.Event
+	pipeline := pubtest.FakeConnector{
+		ConnectFunc: func(cfg beat.ClientConfig) (beat.Client, error) {
+			return &pubtest.FakeClient{
+				PublishFunc: func(event beat.Event) {
+					cfg.ACKHandler.AddEvent(event, true)
+					cfg.ACKHandler.ACKEvents(1)
+
+					mu.Lock()
+					defer mu.Unlock()
+					events = append(events, event)
+					if len(events) == n {
+						cancel()
+					}
+				},
+			}, nil
+		},
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		inp.Run(input.Context{
+			ID:          "test",
+			Logger:      logp.NewLogger("test"),
+			Cancelation: ctx,
+		}, pipeline)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for events")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return events
+}
@@ -0,0 +1,254 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package journald
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/reader"
+	"github.com/elastic/beats/v7/libbeat/reader/multiline"
+)
+
+// unitField is the journal field used to group entries for multiline
+// aggregation.
+const unitField = "_SYSTEMD_UNIT"
+
+const messageField = "MESSAGE"
+
+// entry is a journal entry passed to the multiline aggregator. The cursor is
+// an opaque value that is reported back once all entries up to this
+// entry have been aggregated.
+type entry struct {
+	fields    map[string]string
+	timestamp uint64
+	cursor    interface{}
+}
+
+// aggregate is a multiline event combining one or more journal entries of
+// the same unit. Fields and timestamp are taken from the first entry.
+// Cursor is nil if the journal position can not be advanced yet, because
+// older entries of another unit are still being aggregated.
+type aggregate struct {
+	fields    map[string]string
+	timestamp uint64
+	flags     common.MapStr
+	cursor    interface{}
+}
+
+// unitAggregator combines consecutive journal entries of the same systemd
+// unit into multiline events. A multiline reader is run per unit, such
+// that entries of other units logging in between do not interrupt the
+// aggregation.
+type unitAggregator struct {
+	log      *logp.Logger
+	config   *multiline.Config
+	maxBytes int
+
+	mu      sync.Mutex
+	units   map[string]*unitReader
+	pending []*pendingEntry
+
+	wg   sync.WaitGroup
+	out  chan unitMessage
+	done chan struct{}
+	once sync.Once
+}
+
+// pendingEntry tracks if an entry read from the journal has already been
+// published as part of a multiline event.
+type pendingEntry struct {
+	entry entry
+	done  bool
+}
+
+type unitMessage struct {
+	message reader.Message
+	entries []*pendingEntry
+}
+
+// unitReader implements reader.Reader. It returns the entries of one unit
+// to the multiline reader.
+type unitReader struct {
+	ch      chan reader.Message
+	done    chan struct{}
+	pending []*pendingEntry
+}
+
+func newUnitAggregator(log *logp.Logger, config *multiline.Config, maxBytes int) *unitAggregator {
+	return &unitAggregator{
+		log:      log,
+		config:   config,
+		maxBytes: maxBytes,
+		units:    map[string]*unitReader{},
+		out:      make(chan unitMessage),
+		done:     make(chan struct{}),
+	}
+}
+
+// Add passes a journal entry to the multiline reader of its unit. Add blocks
+// if the multiline reader can not keep up.
+func (a *unitAggregator) Add(e entry) error {
+	unit, err := a.unit(e.fields[unitField])
+	if err != nil {
+		return err
+	}
+
+	pe := &pendingEntry{entry: e}
+	a.mu.Lock()
+	a.pending = append(a.pending, pe)
+	unit.pending = append(unit.pending, pe)
+	a.mu.Unlock()
+
+	// Each entry is reported as having a size of 1 byte. This way the Bytes
+	// field of a multiline message tells us how many entries have been
+	// combined.
+	msg := reader.Message{
+		Ts:      time.Unix(0, int64(e.timestamp)*1000),
+		Content: []byte(e.fields[messageField]),
+		Bytes:   1,
+	}
+
+	select {
+	case <-a.done:
+		return io.EOF
+	case unit.ch <- msg:
+		return nil
+	}
+}
+
+// Next returns the next multiline event. Next blocks until an event is
+// available or the aggregator has been closed.
+func (a *unitAggregator) Next() (aggregate, error) {
+	select {
+	case <-a.done:
+		return aggregate{}, io.EOF
+	case msg := <-a.out:
+		first := msg.entries[0].entry
+
+		fields := make(map[string]string, len(first.fields))
+		for k, v := range first.fields {
+			fields[k] = v
+		}
+		fields[messageField] = string(msg.message.Content)
+
+		return aggregate{
+			fields:    fields,
+			timestamp: first.timestamp,
+			flags:     msg.message.Fields,
+			cursor:    a.ack(msg.entries),
+		}, nil
+	}
+}
+
+// Close stops all multiline readers. Entries that are still buffered are
+// dropped.
+func (a *unitAggregator) Close() {
+	a.once.Do(func() { close(a.done) })
+	a.wg.Wait()
+}
+
+// ack marks the entries as done and returns the cursor of the newest entry
+// for which all older entries have been published as well.
+func (a *unitAggregator) ack(entries []*pendingEntry) interface{} {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, e := range entries {
+		e.done = true
+	}
+
+	var cursor interface{}
+	i := 0
+	for ; i < len(a.pending) && a.pending[i].done; i++ {
+		cursor = a.pending[i].entry.cursor
+	}
+	a.pending = a.pending[i:]
+	return cursor
+}
+
+func (a *unitAggregator) unit(name string) (*unitReader, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if unit, exists := a.units[name]; exists {
+		return unit, nil
+	}
+
+	unit := &unitReader{ch: make(chan reader.Message), done: a.done}
+	r, err := multiline.New(unit, "\n", a.maxBytes, a.config)
+	if err != nil {
+		return nil, err
+	}
+	a.units[name] = unit
+
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		defer r.Close()
+		a.runUnit(name, unit, r)
+	}()
+	return unit, nil
+}
+
+func (a *unitAggregator) runUnit(name string, unit *unitReader, r reader.Reader) {
+	for {
+		msg, err := r.Next()
+		if err != nil {
+			if err != io.EOF {
+				a.log.Errorf("Failed to read multiline event for unit '%v': %v", name, err)
+			}
+			return
+		}
+
+		a.mu.Lock()
+		n := msg.Bytes
+		if n > len(unit.pending) {
+			n = len(unit.pending)
+		}
+		entries := unit.pending[:n:n]
+		unit.pending = unit.pending[n:]
+		a.mu.Unlock()
+
+		if len(entries) == 0 {
+			continue
+		}
+
+		select {
+		case <-a.done:
+			return
+		case a.out <- unitMessage{message: msg, entries: entries}:
+		}
+	}
+}
+
+func (r *unitReader) Next() (reader.Message, error) {
+	select {
+	case <-r.done:
+		return reader.Message{}, io.EOF
+	case msg := <-r.ch:
+		return msg, nil
+	}
+}
+
+func (r *unitReader) Close() error {
+	return nil
+}
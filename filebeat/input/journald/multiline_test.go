@@ -0,0 +1,120 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package journald
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/reader/multiline"
+)
+
+func TestUnitAggregator(t *testing.T) {
+	var config multiline.Config
+	err := common.MustNewConfigFrom(map[string]interface{}{
+		"type":    "pattern",
+		"pattern": `^\s`,
+		"match":   "after",
+		"timeout": "100ms",
+	}).Unpack(&config)
+	require.NoError(t, err)
+
+	aggregator := newUnitAggregator(logp.NewLogger("test"), &config, 1024)
+	defer aggregator.Close()
+
+	entries := []struct{ unit, message string }{
+		{"app.service", "Exception in thread main"},
+		{"other.service", "started"},
+		{"app.service", "  at Main.run"},
+		{"app.service", "  at Main.main"},
+		{"other.service", "stopped"},
+		{"app.service", "done"},
+	}
+	go func() {
+		for i, e := range entries {
+			aggregator.Add(entry{
+				fields:    map[string]string{unitField: e.unit, messageField: e.message},
+				timestamp: uint64(i + 1),
+				cursor:    i,
+			})
+		}
+	}()
+
+	type result struct {
+		unit, message string
+		timestamp     uint64
+		cursor        interface{}
+	}
+	var results []result
+	for len(results) < 4 {
+		agg, err := aggregator.Next()
+		require.NoError(t, err)
+		results = append(results, result{agg.fields[unitField], agg.fields[messageField], agg.timestamp, agg.cursor})
+	}
+
+	byMessage := map[string]result{}
+	for _, r := range results {
+		byMessage[r.message] = r
+	}
+
+	stacktrace := byMessage["Exception in thread main\n  at Main.run\n  at Main.main"]
+	assert.Equal(t, "app.service", stacktrace.unit)
+	assert.Equal(t, uint64(1), stacktrace.timestamp)
+	assert.Equal(t, "other.service", byMessage["started"].unit)
+	assert.Equal(t, "other.service", byMessage["stopped"].unit)
+	assert.Equal(t, "app.service", byMessage["done"].unit)
+
+	// Cursors must never move backwards and the last cursor covers all entries.
+	last := -1
+	for _, r := range results {
+		if r.cursor == nil {
+			continue
+		}
+		assert.True(t, r.cursor.(int) > last)
+		last = r.cursor.(int)
+	}
+	assert.Equal(t, len(entries)-1, last)
+}
+
+func TestUnitAggregatorClose(t *testing.T) {
+	var config multiline.Config
+	err := common.MustNewConfigFrom(map[string]interface{}{
+		"type":        "count",
+		"count_lines": 2,
+	}).Unpack(&config)
+	require.NoError(t, err)
+
+	aggregator := newUnitAggregator(logp.NewLogger("test"), &config, 1024)
+	require.NoError(t, aggregator.Add(entry{fields: map[string]string{messageField: "first"}}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := aggregator.Next()
+		assert.Error(t, err)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	aggregator.Close()
+	<-done
+}
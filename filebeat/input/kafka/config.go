@@ -53,6 +53,9 @@ type kafkaInputConfig struct {
 	Username                 string            `config:"username"`
 	Password                 string            `config:"password"`
 	ExpandEventListFromField string            `config:"expand_event_list_from_field"`
+	CommitInterval           time.Duration     `config:"commit_interval" validate:"min=0,nonzero"`
+	HeaderFields             []headerField     `config:"header_fields"`
+	Payload                  *payloadConfig    `config:"payload"`
 }
 
 type kafkaFetch struct {
@@ -114,6 +117,7 @@ func defaultConfig() kafkaInputConfig {
 		ConnectBackoff: 30 * time.Second,
 		ConsumeBackoff: 2 * time.Second,
 		WaitClose:      2 * time.Second,
+		CommitInterval: 1 * time.Second,
 		MaxWaitTime:    250 * time.Millisecond,
 		IsolationLevel: isolationLevelReadUncommitted,
 		Fetch: kafkaFetch{
@@ -143,6 +147,10 @@ func (c *kafkaInputConfig) Validate() error {
 	if c.Username != "" && c.Password == "" {
 		return fmt.Errorf("password must be set when username is configured")
 	}
+
+	if c.Payload != nil && c.ExpandEventListFromField != "" {
+		return fmt.Errorf("payload decoding can not be used together with expand_event_list_from_field")
+	}
 	return nil
 }
 
@@ -161,6 +169,11 @@ func newSaramaConfig(config kafkaInputConfig) (*sarama.Config, error) {
 	k.Consumer.MaxWaitTime = config.MaxWaitTime
 	k.Consumer.IsolationLevel = config.IsolationLevel.asSaramaIsolationLevel()
 
+	// Offsets are only marked after the events have been ACKed by the
+	// outputs. Marked offsets are committed periodically.
+	k.Consumer.Offsets.AutoCommit.Enable = true
+	k.Consumer.Offsets.AutoCommit.Interval = config.CommitInterval
+
 	k.Consumer.Fetch.Min = config.Fetch.Min
 	k.Consumer.Fetch.Default = config.Fetch.Default
 	k.Consumer.Fetch.Max = config.Fetch.Max
@@ -50,6 +50,7 @@ func init() {
 type kafkaInput struct {
 	config          kafkaInputConfig
 	saramaConfig    *sarama.Config
+	payloadDecoder  payloadDecoder
 	context         input.Context
 	outlet          channel.Outleter
 	saramaWaitGroup sync.WaitGroup // indicates a sarama consumer group is active
@@ -74,7 +75,7 @@ func NewInput(
 			acker.EventPrivateReporter(func(_ int, events []interface{}) {
 				for _, event := range events {
 					if meta, ok := event.(eventMeta); ok {
-						meta.handler.ack(meta.message)
+						meta.handler.ack(meta.state)
 					}
 				}
 			}),
@@ -91,12 +92,18 @@ func NewInput(
 		return nil, errors.Wrap(err, "initializing Sarama config")
 	}
 
+	decoder, err := newPayloadDecoder(config.Payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "initializing payload decoder")
+	}
+
 	input := &kafkaInput{
-		config:       config,
-		saramaConfig: saramaConfig,
-		context:      inputContext,
-		outlet:       out,
-		log:          logp.NewLogger("kafka input").With("hosts", config.Hosts),
+		config:         config,
+		saramaConfig:   saramaConfig,
+		payloadDecoder: decoder,
+		context:        inputContext,
+		outlet:         out,
+		log:            logp.NewLogger("kafka input").With("hosts", config.Hosts),
 	}
 
 	return input, nil
@@ -108,6 +115,11 @@ func (input *kafkaInput) runConsumerGroup(
 	handler := &groupHandler{
 		version: input.config.Version,
 		outlet:  input.outlet,
+		offsets: newOffsetTracker(),
+		// headerFields and payloadDecoder are assigned the configuration options header_fields and payload
+		headerFields:   input.config.HeaderFields,
+		payloadDecoder: input.payloadDecoder,
+		payloadTarget:  payloadTarget(input.config.Payload),
 		// expandEventListFromField will be assigned the configuration option expand_event_list_from_field
 		expandEventListFromField: input.config.ExpandEventListFromField,
 		log:                      input.log,
@@ -234,13 +246,15 @@ func (c channelCtx) Value(key interface{}) interface{} { return nil }
 // also currently responsible for marshalling kafka messages into beat.Event,
 // and passing ACKs from the output channel back to the kafka cluster.
 type groupHandler struct {
-	sync.Mutex
 	version kafka.Version
-	session sarama.ConsumerGroupSession
 	outlet  channel.Outleter
+	offsets *offsetTracker
 	// if the fileset using this input expects to receive multiple messages bundled under a specific field then this value is assigned
 	// ex. in this case are the azure fielsets where the events are found under the json object "records"
 	expandEventListFromField string
+	headerFields             []headerField
+	payloadDecoder           payloadDecoder
+	payloadTarget            string
 	log                      *logp.Logger
 }
 
@@ -248,7 +262,7 @@ type groupHandler struct {
 // been successfully sent.
 type eventMeta struct {
 	handler *groupHandler
-	message *sarama.ConsumerMessage
+	state   *messageState
 }
 
 func (h *groupHandler) createEvents(
@@ -284,16 +298,16 @@ func (h *groupHandler) createEvents(
 		messages = h.parseMultipleMessages(message.Value)
 	}
 	for _, msg := range messages {
+		fields := common.MapStr{
+			"message": msg,
+			"kafka":   kafkaFields,
+		}
+		h.addHeaderFields(fields, message.Headers)
+		h.decodePayload(fields, msg)
+
 		event := beat.Event{
 			Timestamp: timestamp,
-			Fields: common.MapStr{
-				"message": msg,
-				"kafka":   kafkaFields,
-			},
-			Private: eventMeta{
-				handler: h,
-				message: message,
-			},
+			Fields:    fields,
 		}
 		events = append(events, event)
 
@@ -301,40 +315,81 @@ func (h *groupHandler) createEvents(
 	return events
 }
 
+// addHeaderFields copies the values of the configured record headers into
+// the event fields.
+func (h *groupHandler) addHeaderFields(fields common.MapStr, headers []*sarama.RecordHeader) {
+	for _, mapping := range h.headerFields {
+		for _, header := range headers {
+			if header != nil && string(header.Key) == mapping.Header {
+				fields.Put(mapping.Field, string(header.Value))
+				break
+			}
+		}
+	}
+}
+
+// decodePayload decodes the message with the configured payload decoder.
+// The decoded payload replaces the message field. If decoding fails the
+// message is kept and the error is reported in error.message.
+func (h *groupHandler) decodePayload(fields common.MapStr, msg string) {
+	if h.payloadDecoder == nil {
+		return
+	}
+
+	obj, err := h.payloadDecoder.Decode([]byte(msg))
+	if err != nil {
+		h.log.Debugw("Failed to decode kafka message payload", "error", err)
+		fields.Put("error.message", err.Error())
+		return
+	}
+
+	fields.Delete("message")
+	if h.payloadTarget == "" {
+		fields.DeepUpdate(obj)
+	} else {
+		fields.Put(h.payloadTarget, obj)
+	}
+}
+
 func (h *groupHandler) Setup(session sarama.ConsumerGroupSession) error {
-	h.Lock()
-	h.session = session
-	h.Unlock()
+	h.offsets.reset(session)
 	return nil
 }
 
 func (h *groupHandler) Cleanup(_ sarama.ConsumerGroupSession) error {
-	h.Lock()
-	h.session = nil
-	h.Unlock()
+	h.offsets.reset(nil)
 	return nil
 }
 
-// ack informs the kafka cluster that this message has been consumed. Called
-// from the input's ACKEvents handler.
-func (h *groupHandler) ack(message *sarama.ConsumerMessage) {
-	h.Lock()
-	defer h.Unlock()
-	if h.session != nil {
-		h.session.MarkMessage(message, "")
-	}
+// ack informs the kafka cluster that this message has been consumed, once
+// all events of the message and of all prior messages of the same partition
+// have been ACKed. Called from the input's ACKEvents handler.
+func (h *groupHandler) ack(state *messageState) {
+	h.offsets.ack(state)
 }
 
 func (h *groupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
 	for msg := range claim.Messages() {
 		events := h.createEvents(sess, claim, msg)
+		state := h.offsets.add(msg, len(events))
 		for _, event := range events {
+			event.Private = eventMeta{
+				handler: h,
+				state:   state,
+			}
 			h.outlet.OnEvent(event)
 		}
 	}
 	return nil
 }
 
+func payloadTarget(c *payloadConfig) string {
+	if c == nil {
+		return ""
+	}
+	return c.Target
+}
+
 // parseMultipleMessages will try to split the message into multiple ones based on the group field provided by the configuration
 func (h *groupHandler) parseMultipleMessages(bMessage []byte) []string {
 	var obj map[string][]interface{}
@@ -0,0 +1,118 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// offsetTracker tracks the messages of each claimed partition in the order
+// they have been received. The offset of a message is only marked for commit
+// after all events created from the message and from all prior messages of
+// the same partition have been ACKed by the outputs. This way a crash never
+// commits offsets of messages that have not been published yet.
+type offsetTracker struct {
+	mu         sync.Mutex
+	session    sarama.ConsumerGroupSession
+	partitions map[topicPartition]*partitionOffsets
+}
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// partitionOffsets is the queue of messages of a single partition that have
+// not been marked yet.
+type partitionOffsets struct {
+	session sarama.ConsumerGroupSession
+	pending []*messageState
+}
+
+// messageState counts the events of a message that still need to be ACKed.
+type messageState struct {
+	partition *partitionOffsets
+	message   *sarama.ConsumerMessage
+	pending   int
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: map[topicPartition]*partitionOffsets{}}
+}
+
+// reset starts tracking messages for a new consumer group session. Messages
+// of previous sessions are not marked anymore, as their partitions might
+// have been assigned to another consumer.
+func (t *offsetTracker) reset(session sarama.ConsumerGroupSession) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.session = session
+	t.partitions = map[topicPartition]*partitionOffsets{}
+}
+
+// add registers a message from which events events have been created. If no
+// events have been created, the message is considered ACKed.
+func (t *offsetTracker) add(message *sarama.ConsumerMessage, events int) *messageState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := topicPartition{topic: message.Topic, partition: message.Partition}
+	partition := t.partitions[key]
+	if partition == nil {
+		partition = &partitionOffsets{session: t.session}
+		t.partitions[key] = partition
+	}
+
+	state := &messageState{partition: partition, message: message, pending: events}
+	partition.pending = append(partition.pending, state)
+	if events == 0 {
+		t.advance(partition)
+	}
+	return state
+}
+
+// ack marks one event of the message as ACKed.
+func (t *offsetTracker) ack(state *messageState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if state.pending > 0 {
+		state.pending--
+	}
+	if state.pending == 0 {
+		t.advance(state.partition)
+	}
+}
+
+// advance removes all fully ACKed messages from the head of the partition
+// queue and marks the offset of the last one removed.
+func (t *offsetTracker) advance(partition *partitionOffsets) {
+	var last *sarama.ConsumerMessage
+	for len(partition.pending) > 0 && partition.pending[0].pending == 0 {
+		last = partition.pending[0].message
+		partition.pending[0] = nil
+		partition.pending = partition.pending[1:]
+	}
+
+	if last == nil || partition.session == nil || partition.session != t.session {
+		return
+	}
+	partition.session.MarkMessage(last, "")
+}
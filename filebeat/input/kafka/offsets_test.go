@@ -0,0 +1,102 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSession struct {
+	marked map[int32]int64
+}
+
+func newFakeSession() *fakeSession { return &fakeSession{marked: map[int32]int64{}} }
+
+func (s *fakeSession) Claims() map[string][]int32                       { return nil }
+func (s *fakeSession) MemberID() string                                 { return "" }
+func (s *fakeSession) GenerationID() int32                              { return 0 }
+func (s *fakeSession) MarkOffset(_ string, _ int32, _ int64, _ string)  {}
+func (s *fakeSession) ResetOffset(_ string, _ int32, _ int64, _ string) {}
+func (s *fakeSession) Context() context.Context                         { return context.Background() }
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, _ string) {
+	s.marked[msg.Partition] = msg.Offset
+}
+
+func newConsumerMessage(partition int32, offset int64) *sarama.ConsumerMessage {
+	return &sarama.ConsumerMessage{Topic: "test", Partition: partition, Offset: offset}
+}
+
+func TestOffsetTracker_InOrder(t *testing.T) {
+	session := newFakeSession()
+	tracker := newOffsetTracker()
+	tracker.reset(session)
+
+	m0 := tracker.add(newConsumerMessage(0, 10), 2)
+	m1 := tracker.add(newConsumerMessage(0, 11), 1)
+	p1 := tracker.add(newConsumerMessage(1, 5), 1)
+
+	// out of order ACK of the second message does not mark anything
+	tracker.ack(m1)
+	assert.Empty(t, session.marked)
+
+	// first event of a message with two events
+	tracker.ack(m0)
+	assert.Empty(t, session.marked)
+
+	// last event of the first message marks both messages
+	tracker.ack(m0)
+	assert.Equal(t, map[int32]int64{0: 11}, session.marked)
+
+	tracker.ack(p1)
+	assert.Equal(t, map[int32]int64{0: 11, 1: 5}, session.marked)
+}
+
+func TestOffsetTracker_MessageWithoutEvents(t *testing.T) {
+	session := newFakeSession()
+	tracker := newOffsetTracker()
+	tracker.reset(session)
+
+	m0 := tracker.add(newConsumerMessage(0, 1), 1)
+	tracker.add(newConsumerMessage(0, 2), 0)
+	assert.Empty(t, session.marked)
+
+	tracker.ack(m0)
+	assert.Equal(t, map[int32]int64{0: 2}, session.marked)
+
+	tracker.add(newConsumerMessage(0, 3), 0)
+	assert.Equal(t, map[int32]int64{0: 3}, session.marked)
+}
+
+func TestOffsetTracker_SessionChange(t *testing.T) {
+	old := newFakeSession()
+	tracker := newOffsetTracker()
+	tracker.reset(old)
+
+	m0 := tracker.add(newConsumerMessage(0, 1), 1)
+
+	current := newFakeSession()
+	tracker.reset(current)
+	tracker.ack(m0)
+
+	assert.Empty(t, old.marked)
+	assert.Empty(t, current.marked)
+}
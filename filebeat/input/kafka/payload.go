@@ -0,0 +1,126 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/avro"
+)
+
+const (
+	payloadCodecJSON = "json"
+	payloadCodecAvro = "avro"
+)
+
+// payloadConfig configures the decoding of message payloads.
+type payloadConfig struct {
+	// Codec used to decode the payload: json or avro.
+	Codec string `config:"codec" validate:"required"`
+	// Schema is the path of the Avro schema file used to decode payloads.
+	Schema string `config:"schema"`
+	// ConfluentWireFormat strips the magic byte and the schema ID written by
+	// Confluent compatible producers in front of the Avro payload.
+	ConfluentWireFormat bool `config:"confluent_wire_format"`
+	// Target is the field the decoded payload is written to. The decoded
+	// payload is merged into the event root if empty.
+	Target string `config:"target"`
+}
+
+// headerField maps the value of a Kafka record header to an event field.
+type headerField struct {
+	Header string `config:"header" validate:"required"`
+	Field  string `config:"field" validate:"required"`
+}
+
+// payloadDecoder decodes a message payload into an object.
+type payloadDecoder interface {
+	Decode([]byte) (common.MapStr, error)
+}
+
+type jsonDecoder struct{}
+
+type avroDecoder struct {
+	schema              *avro.Schema
+	confluentWireFormat bool
+}
+
+func (c *payloadConfig) Validate() error {
+	switch c.Codec {
+	case payloadCodecJSON:
+		return nil
+	case payloadCodecAvro:
+		if c.Schema == "" {
+			return fmt.Errorf("payload.schema is required for the avro codec")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown payload codec '%v'", c.Codec)
+	}
+}
+
+func newPayloadDecoder(c *payloadConfig) (payloadDecoder, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	switch c.Codec {
+	case payloadCodecAvro:
+		contents, err := ioutil.ReadFile(c.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read avro schema: %w", err)
+		}
+		schema, err := avro.ParseSchema(contents)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse avro schema %v: %w", c.Schema, err)
+		}
+		if schema.Type != avro.TypeRecord && schema.Type != avro.TypeMap {
+			return nil, fmt.Errorf("avro schema %v must be a record or map", c.Schema)
+		}
+		return &avroDecoder{schema: schema, confluentWireFormat: c.ConfluentWireFormat}, nil
+	default:
+		return jsonDecoder{}, nil
+	}
+}
+
+func (jsonDecoder) Decode(payload []byte) (common.MapStr, error) {
+	obj := common.MapStr{}
+	if err := json.Unmarshal(payload, &obj); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON payload: %w", err)
+	}
+	return obj, nil
+}
+
+func (d *avroDecoder) Decode(payload []byte) (common.MapStr, error) {
+	if d.confluentWireFormat {
+		if len(payload) < 5 || payload[0] != 0 {
+			return nil, fmt.Errorf("payload is not in the confluent wire format")
+		}
+		// the schema ID is ignored, the local schema is always used
+		payload = payload[5:]
+	}
+
+	v, err := avro.Decode(d.schema, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode avro payload: %w", err)
+	}
+	return v.(common.MapStr), nil
+}
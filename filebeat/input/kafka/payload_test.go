@@ -0,0 +1,118 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+func TestDecodePayload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kafka")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	schemaPath := filepath.Join(dir, "schema.avsc")
+	require.NoError(t, ioutil.WriteFile(schemaPath, []byte(`{
+		"type": "record",
+		"name": "test",
+		"fields": [{"name": "user", "type": "string"}, {"name": "count", "type": "long"}]
+	}`), 0644))
+
+	cases := map[string]struct {
+		config  payloadConfig
+		payload []byte
+		want    common.MapStr
+	}{
+		"json at root": {
+			config:  payloadConfig{Codec: payloadCodecJSON},
+			payload: []byte(`{"user": "alice"}`),
+			want:    common.MapStr{"user": "alice"},
+		},
+		"json with target": {
+			config:  payloadConfig{Codec: payloadCodecJSON, Target: "data"},
+			payload: []byte(`{"user": "alice"}`),
+			want:    common.MapStr{"data": common.MapStr{"user": "alice"}},
+		},
+		"invalid json": {
+			config:  payloadConfig{Codec: payloadCodecJSON},
+			payload: []byte(`{"user"`),
+			want: common.MapStr{
+				"message": `{"user"`,
+				"error":   common.MapStr{"message": "failed to decode JSON payload: unexpected end of JSON input"},
+			},
+		},
+		"avro": {
+			config:  payloadConfig{Codec: payloadCodecAvro, Schema: schemaPath},
+			payload: []byte{0x0a, 'a', 'l', 'i', 'c', 'e', 0x04},
+			want:    common.MapStr{"user": "alice", "count": int64(2)},
+		},
+		"avro confluent wire format": {
+			config:  payloadConfig{Codec: payloadCodecAvro, Schema: schemaPath, ConfluentWireFormat: true},
+			payload: []byte{0x00, 0x00, 0x00, 0x00, 0x01, 0x0a, 'a', 'l', 'i', 'c', 'e', 0x04},
+			want:    common.MapStr{"user": "alice", "count": int64(2)},
+		},
+	}
+
+	for name, test := range cases {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, test.config.Validate())
+			decoder, err := newPayloadDecoder(&test.config)
+			require.NoError(t, err)
+
+			h := &groupHandler{
+				payloadDecoder: decoder,
+				payloadTarget:  test.config.Target,
+				log:            logp.NewLogger("test"),
+			}
+			fields := common.MapStr{"message": string(test.payload)}
+			h.decodePayload(fields, string(test.payload))
+			assert.Equal(t, test.want, fields)
+		})
+	}
+}
+
+func TestAddHeaderFields(t *testing.T) {
+	h := &groupHandler{
+		headerFields: []headerField{
+			{Header: "tenant", Field: "organization.id"},
+			{Header: "trace-id", Field: "trace.id"},
+			{Header: "missing", Field: "missing"},
+		},
+	}
+
+	fields := common.MapStr{}
+	h.addHeaderFields(fields, []*sarama.RecordHeader{
+		{Key: []byte("tenant"), Value: []byte("acme")},
+		{Key: []byte("trace-id"), Value: []byte("abc")},
+	})
+	assert.Equal(t, common.MapStr{
+		"organization": common.MapStr{"id": "acme"},
+		"trace":        common.MapStr{"id": "abc"},
+	}, fields)
+}
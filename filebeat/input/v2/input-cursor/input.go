@@ -62,6 +62,7 @@ type managedInput struct {
 	manager      *InputManager
 	userID       string
 	sources      []Source
+	prospector   Prospector
 	input        Input
 	cleanTimeout time.Duration
 }
@@ -71,6 +72,10 @@ func (inp *managedInput) Name() string { return inp.input.Name() }
 
 // Test runs the Test method for each configured source.
 func (inp *managedInput) Test(ctx input.TestContext) error {
+	if inp.prospector != nil {
+		return inp.prospector.Test()
+	}
+
 	var grp unison.MultiErrGroup
 	for _, source := range inp.sources {
 		source := source
@@ -110,6 +115,10 @@ func (inp *managedInput) Run(
 	defer cancel()
 	ctx.Cancelation = cancelCtx
 
+	if inp.prospector != nil {
+		return inp.runProspector(ctx, pipeline)
+	}
+
 	var grp unison.MultiErrGroup
 	for _, source := range inp.sources {
 		source := source
@@ -63,6 +63,13 @@ type InputManager struct {
 	// that will be used to collect events from each source.
 	Configure func(cfg *common.Config) ([]Source, Input, error)
 
+	// ConfigureProspector is used instead of Configure by inputs that can
+	// not list their sources at configuration time. It returns a Prospector
+	// that discovers the sources at runtime, and the Input that will be used
+	// to collect events from each discovered source. If the Prospector
+	// implements ProspectorCleanTimeout, it replaces the clean_timeout setting.
+	ConfigureProspector func(cfg *common.Config) (Prospector, Input, error)
+
 	initOnce sync.Once
 	initErr  error
 	store    *store
@@ -77,6 +84,7 @@ type Source interface {
 
 var errNoSourceConfigured = errors.New("no source has been configured")
 var errNoInputRunner = errors.New("no input runner available")
+var errNoProspector = errors.New("no prospector available")
 
 // StateStore interface and configurations used to give the Manager access to the persistent store.
 type StateStore interface {
@@ -157,6 +165,10 @@ func (cim *InputManager) Create(config *common.Config) (v2.Input, error) {
 		return nil, err
 	}
 
+	if cim.ConfigureProspector != nil {
+		return cim.createWithProspector(config, settings.ID, settings.CleanTimeout)
+	}
+
 	sources, inp, err := cim.Configure(config)
 	if err != nil {
 		return nil, err
@@ -177,6 +189,34 @@ func (cim *InputManager) Create(config *common.Config) (v2.Input, error) {
 	}, nil
 }
 
+func (cim *InputManager) createWithProspector(
+	config *common.Config,
+	userID string,
+	cleanTimeout time.Duration,
+) (v2.Input, error) {
+	prospector, inp, err := cim.ConfigureProspector(config)
+	if err != nil {
+		return nil, err
+	}
+	if prospector == nil {
+		return nil, errNoProspector
+	}
+	if inp == nil {
+		return nil, errNoInputRunner
+	}
+	if p, ok := prospector.(ProspectorCleanTimeout); ok {
+		cleanTimeout = p.CleanTimeout()
+	}
+
+	return &managedInput{
+		manager:      cim,
+		userID:       userID,
+		prospector:   prospector,
+		input:        inp,
+		cleanTimeout: cleanTimeout,
+	}, nil
+}
+
 // Lock locks a key for exclusive access and returns an resource that can be used to modify
 // the cursor state and unlock the key.
 func (cim *InputManager) lock(ctx v2.Context, key string) (*resource, error) {
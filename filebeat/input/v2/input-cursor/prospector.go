@@ -0,0 +1,124 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cursor
+
+import (
+	"sync"
+	"time"
+
+	input "github.com/elastic/beats/v7/filebeat/input/v2"
+	"github.com/elastic/beats/v7/libbeat/beat"
+)
+
+// Prospector discovers the sources of an input at runtime. It is used by
+// inputs that can not list all sources at configuration time, like inputs
+// collecting from files matching a glob pattern.
+type Prospector interface {
+	// Run starts the prospector. Run must block until the input is
+	// stopped. Sources are collected by starting a harvester via the
+	// HarvesterGroup.
+	Run(input.Context, HarvesterGroup)
+
+	// Test checks if the prospector can discover sources.
+	Test() error
+}
+
+// ProspectorCleanTimeout is implemented by Prospectors that configure the
+// time to live of the states of their sources, instead of using the
+// clean_timeout setting of the input.
+type ProspectorCleanTimeout interface {
+	CleanTimeout() time.Duration
+}
+
+// HarvesterGroup is used by a Prospector to manage the harvesters collecting
+// the discovered sources. Each harvester runs the Input returned by the
+// configure function in its own go-routine, with the cursor state of its
+// source.
+type HarvesterGroup interface {
+	// Start starts a harvester for the source, unless a harvester for the same
+	// source is already active in this input.
+	Start(input.Context, Source)
+
+	// Remove marks the state of the source for removal. The state is deleted
+	// from the persistent store by the cleaner, once the source is not
+	// collected anymore and all pending updates have been ACKed.
+	Remove(Source)
+}
+
+// harvesterGroup implements the HarvesterGroup interface for the managedInput.
+type harvesterGroup struct {
+	input    *managedInput
+	pipeline beat.PipelineConnector
+
+	mu     sync.Mutex
+	active map[string]struct{}
+	wg     sync.WaitGroup
+}
+
+// runProspector runs the prospector and waits for all harvesters to be
+// finished after the prospector has returned.
+func (inp *managedInput) runProspector(ctx input.Context, pipeline beat.PipelineConnector) error {
+	hg := &harvesterGroup{
+		input:    inp,
+		pipeline: pipeline,
+		active:   map[string]struct{}{},
+	}
+	defer hg.wg.Wait()
+
+	inp.prospector.Run(ctx, hg)
+	return nil
+}
+
+func (hg *harvesterGroup) Start(ctx input.Context, source Source) {
+	key := hg.input.createSourceID(source)
+
+	hg.mu.Lock()
+	if _, exists := hg.active[key]; exists {
+		hg.mu.Unlock()
+		return
+	}
+	hg.active[key] = struct{}{}
+	hg.mu.Unlock()
+
+	hg.wg.Add(1)
+	go func() {
+		defer hg.wg.Done()
+		defer func() {
+			hg.mu.Lock()
+			delete(hg.active, key)
+			hg.mu.Unlock()
+		}()
+
+		// refine per harvester context
+		harvesterCtx := ctx
+		harvesterCtx.ID = ctx.ID + "::" + source.Name()
+		harvesterCtx.Logger = ctx.Logger.With("source", source.Name())
+
+		err := hg.input.runSource(harvesterCtx, hg.input.manager.store, source, hg.pipeline)
+		if err != nil && ctx.Cancelation.Err() == nil {
+			harvesterCtx.Logger.Errorf("Harvester failed: %+v", err)
+		}
+	}()
+}
+
+func (hg *harvesterGroup) Remove(source Source) {
+	store := hg.input.manager.store
+	resource := store.Get(hg.input.createSourceID(source))
+	defer resource.Release()
+	store.UpdateTTL(resource, 0)
+}
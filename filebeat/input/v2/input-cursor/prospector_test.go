@@ -0,0 +1,173 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cursor
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	input "github.com/elastic/beats/v7/filebeat/input/v2"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	pubtest "github.com/elastic/beats/v7/libbeat/publisher/testing"
+	"github.com/elastic/beats/v7/libbeat/tests/resources"
+)
+
+type fakeProspector struct {
+	OnRun  func(input.Context, HarvesterGroup)
+	OnTest func() error
+}
+
+func (p *fakeProspector) Run(ctx input.Context, hg HarvesterGroup) { p.OnRun(ctx, hg) }
+func (p *fakeProspector) Test() error {
+	if p.OnTest != nil {
+		return p.OnTest()
+	}
+	return nil
+}
+
+func TestManager_Prospector(t *testing.T) {
+	t.Run("fail if no prospector is returned", func(t *testing.T) {
+		manager := prospectorManager(t, createSampleStore(t, nil), nil, &fakeTestInput{})
+		_, err := manager.Create(common.NewConfig())
+		require.Error(t, err)
+	})
+
+	t.Run("harvesters are started once per source", func(t *testing.T) {
+		defer resources.NewGoroutinesChecker().Check(t)
+
+		var mu sync.Mutex
+		runs := map[string]int{}
+		var wgStarted sync.WaitGroup
+		wgStarted.Add(2)
+
+		inp := &fakeTestInput{
+			OnRun: func(ctx input.Context, src Source, _ Cursor, _ Publisher) error {
+				mu.Lock()
+				runs[src.Name()]++
+				mu.Unlock()
+				wgStarted.Done()
+				<-ctx.Cancelation.Done()
+				return nil
+			},
+		}
+		prospector := &fakeProspector{
+			OnRun: func(ctx input.Context, hg HarvesterGroup) {
+				hg.Start(ctx, stringSource("a"))
+				hg.Start(ctx, stringSource("b"))
+				wgStarted.Wait()
+				hg.Start(ctx, stringSource("a"))
+				<-ctx.Cancelation.Done()
+			},
+		}
+
+		manager := prospectorManager(t, createSampleStore(t, nil), prospector, inp)
+		managed, err := manager.Create(common.NewConfig())
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var clientCounters pubtest.ClientCounter
+		go func() {
+			wgStarted.Wait()
+			cancel()
+		}()
+		err = managed.Run(input.Context{Logger: manager.Logger, Cancelation: ctx}, clientCounters.BuildConnector())
+		require.NoError(t, err)
+
+		assert.Equal(t, map[string]int{"a": 1, "b": 1}, runs)
+		assert.Equal(t, 0, clientCounters.Active())
+	})
+
+	t.Run("removed sources are cleaned", func(t *testing.T) {
+		store := createSampleStore(t, map[string]state{
+			"test::a": {TTL: 24 * time.Hour, Updated: time.Now().Add(-time.Hour)},
+			"test::b": {TTL: 24 * time.Hour, Updated: time.Now().Add(-time.Hour)},
+		})
+
+		prospector := &fakeProspector{
+			OnRun: func(ctx input.Context, hg HarvesterGroup) {
+				hg.Remove(stringSource("a"))
+			},
+		}
+
+		manager := prospectorManager(t, store, prospector, &fakeTestInput{})
+		managed, err := manager.Create(common.NewConfig())
+		require.NoError(t, err)
+
+		var clientCounters pubtest.ClientCounter
+		err = managed.Run(input.Context{Logger: manager.Logger, Cancelation: context.Background()}, clientCounters.BuildConnector())
+		require.NoError(t, err)
+
+		gcStore(manager.Logger, time.Now().Add(-time.Hour), manager.store)
+		assert.Equal(t, []string{"test::b"}, keysOf(store.snapshot()))
+	})
+
+	t.Run("clean timeout is taken from the input settings", func(t *testing.T) {
+		manager := prospectorManager(t, createSampleStore(t, nil), &fakeProspector{}, &fakeTestInput{})
+		managed, err := manager.Create(common.MustNewConfigFrom(map[string]interface{}{
+			"clean_timeout":  "5m",
+			"clean_inactive": "1m",
+		}))
+		require.NoError(t, err)
+		assert.Equal(t, 5*time.Minute, managed.(*managedInput).cleanTimeout)
+	})
+
+	t.Run("prospector overrides the clean timeout", func(t *testing.T) {
+		prospector := &fakeCleanTimeoutProspector{timeout: time.Minute}
+		manager := prospectorManager(t, createSampleStore(t, nil), prospector, &fakeTestInput{})
+		managed, err := manager.Create(common.MustNewConfigFrom(map[string]interface{}{
+			"clean_timeout": "5m",
+		}))
+		require.NoError(t, err)
+		assert.Equal(t, time.Minute, managed.(*managedInput).cleanTimeout)
+	})
+}
+
+type fakeCleanTimeoutProspector struct {
+	fakeProspector
+	timeout time.Duration
+}
+
+func (p *fakeCleanTimeoutProspector) CleanTimeout() time.Duration { return p.timeout }
+
+func prospectorManager(t *testing.T, store testStateStore, prospector Prospector, inp Input) *InputManager {
+	return &InputManager{
+		Logger:     logp.NewLogger("test"),
+		StateStore: store,
+		Type:       "test",
+		ConfigureProspector: func(_ *common.Config) (Prospector, Input, error) {
+			if prospector == nil {
+				return nil, inp, nil
+			}
+			return prospector, inp, nil
+		},
+	}
+}
+
+func keysOf(states map[string]state) []string {
+	keys := make([]string, 0, len(states))
+	for k := range states {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -115,6 +115,10 @@ type ProcessingConfig struct {
 	// the pipeline processors.
 	Processor ProcessorList
 
+	// PostProcessor passes additional processors to the client, to be executed
+	// after the pipeline processors.
+	PostProcessor ProcessorList
+
 	// KeepNull determines whether published events will keep null values or omit them.
 	KeepNull bool
 
@@ -136,6 +140,14 @@ type ClientEventer interface {
 	DroppedOnPublish(Event) // event has been dropped, while waiting for the queue
 }
 
+// ClientEmitEventer can optionally be implemented by a ClientEventer to be
+// informed about events emitted asynchronously by processors. Emitted events
+// are not passed to Publish, but are added to the ACKer and ACKed like any
+// other event. Emitted is called before the event is added to the ACKer.
+type ClientEmitEventer interface {
+	Emitted(Event) // event has been emitted by a processor
+}
+
 type ProcessorList interface {
 	Processor
 	All() []Processor
@@ -103,7 +103,8 @@ type beatConfig struct {
 	Instrumentation instrumentation.Config `config:"instrumentation"`
 
 	// output/publishing related configurations
-	Pipeline pipeline.Config `config:",inline"`
+	Pipeline pipeline.Config  `config:",inline"`
+	Outputs  []*common.Config `config:"outputs"`
 
 	// monitoring settings
 	MonitoringBeatConfig monitoring.BeatConfig `config:",inline"`
@@ -322,7 +323,10 @@ func (b *Beat) createBeater(bt beat.Creator) (beat.Beater, error) {
 	monitoring.NewBool(mgmt, "enabled").Set(b.Manager.Enabled())
 
 	debugf("Initializing output plugins")
-	outputEnabled := b.Config.Output.IsSet() && b.Config.Output.Config().Enabled()
+	if b.Config.Output.IsSet() && len(b.Config.Outputs) > 0 {
+		return nil, errors.New("output and outputs can not be used at the same time")
+	}
+	outputEnabled := (b.Config.Output.IsSet() && b.Config.Output.Config().Enabled()) || len(b.Config.Outputs) > 0
 	if !outputEnabled {
 		if b.Manager.Enabled() {
 			logp.Info("Output is configured through Central Management")
@@ -332,16 +336,26 @@ func (b *Beat) createBeater(bt beat.Creator) (beat.Beater, error) {
 			return nil, errors.New(msg)
 		}
 	}
+	monitors := pipeline.Monitors{
+		Metrics:   reg,
+		Telemetry: monitoring.GetNamespace("state").GetRegistry(),
+		Logger:    logp.L().Named("publisher"),
+		Tracer:    b.Instrumentation.Tracer(),
+	}
+	outputFactory := b.makeOutputFactory(b.Config.Output)
+	if len(b.Config.Outputs) > 0 {
+		destinations, err := pipeline.ReadDestinations(b.Config.Outputs, b.makeOutputFactory)
+		if err != nil {
+			return nil, fmt.Errorf("error initializing outputs: %+v", err)
+		}
+		outputFactory = pipeline.MultiOutputFactory(b.Info, monitors, destinations)
+	}
+
 	pipeline, err := pipeline.Load(b.Info,
-		pipeline.Monitors{
-			Metrics:   reg,
-			Telemetry: monitoring.GetNamespace("state").GetRegistry(),
-			Logger:    logp.L().Named("publisher"),
-			Tracer:    b.Instrumentation.Tracer(),
-		},
+		monitors,
 		b.Config.Pipeline,
 		b.processing,
-		b.makeOutputFactory(b.Config.Output),
+		outputFactory,
 	)
 
 	if err != nil {
@@ -503,11 +517,14 @@ func (b *Beat) Setup(settings Settings, bt beat.Creator, setup SetupSettings) er
 		}
 
 		if setup.IndexManagement || setup.Template || setup.ILMPolicy {
-			outCfg := b.Config.Output
-			if outCfg.Name() != "elasticsearch" {
+			esConfig, err := b.elasticsearchOutputConfig()
+			if err != nil {
+				return err
+			}
+			if esConfig == nil {
 				return fmt.Errorf("Index management requested but the Elasticsearch output is not configured/enabled")
 			}
-			esClient, err := eslegclient.NewConnectedClient(outCfg.Config())
+			esClient, err := eslegclient.NewConnectedClient(esConfig)
 			if err != nil {
 				return err
 			}
@@ -546,7 +563,13 @@ func (b *Beat) Setup(settings Settings, bt beat.Creator, setup SetupSettings) er
 		}
 
 		if setup.Pipeline && b.OverwritePipelinesCallback != nil {
-			esConfig := b.Config.Output.Config()
+			esConfig, err := b.elasticsearchOutputConfig()
+			if err != nil {
+				return err
+			}
+			if esConfig == nil {
+				esConfig = b.Config.Output.Config()
+			}
 			err = b.OverwritePipelinesCallback(esConfig)
 			if err != nil {
 				return err
@@ -805,17 +828,41 @@ func (b *Beat) loadDashboards(ctx context.Context, force bool) error {
 // policy as a callback with the elasticsearch output. It is important the
 // registration happens before the publisher is created.
 func (b *Beat) registerESIndexManagement() error {
-	if b.Config.Output.Name() != "elasticsearch" || !b.IdxSupporter.Enabled() {
+	if !b.IdxSupporter.Enabled() {
 		return nil
 	}
+	esConfig, err := b.elasticsearchOutputConfig()
+	if err != nil || esConfig == nil {
+		return err
+	}
 
-	_, err := elasticsearch.RegisterConnectCallback(b.indexSetupCallback())
+	_, err = elasticsearch.RegisterConnectCallback(b.indexSetupCallback())
 	if err != nil {
 		return fmt.Errorf("failed to register index management with elasticsearch: %+v", err)
 	}
 	return nil
 }
 
+// elasticsearchOutputConfig returns the configuration of the elasticsearch
+// output. If an outputs list is configured, the first enabled elasticsearch
+// output of the list is returned. It returns nil if no elasticsearch output
+// is configured.
+func (b *Beat) elasticsearchOutputConfig() (*common.Config, error) {
+	if b.Config.Output.Name() == "elasticsearch" {
+		return b.Config.Output.Config(), nil
+	}
+	for _, cfg := range b.Config.Outputs {
+		var dest pipeline.DestinationConfig
+		if err := dest.Unpack(cfg); err != nil {
+			return nil, err
+		}
+		if dest.Output.Name() == "elasticsearch" && dest.Output.Config().Enabled() {
+			return dest.Output.Config(), nil
+		}
+	}
+	return nil, nil
+}
+
 func (b *Beat) indexSetupCallback() elasticsearch.ConnectCallback {
 	return func(esClient *eslegclient.Connection) error {
 		m := b.IdxSupporter.Manager(idxmgmt.NewESClientHandler(esClient), idxmgmt.BeatsAssets(b.Fields))
@@ -829,9 +876,7 @@ func (b *Beat) makeOutputReloader(outReloader pipeline.OutputReloader) reload.Re
 	})
 }
 
-func (b *Beat) makeOutputFactory(
-	cfg common.ConfigNamespace,
-) func(outputs.Observer) (string, outputs.Group, error) {
+func (b *Beat) makeOutputFactory(cfg common.ConfigNamespace) pipeline.OutputFactory {
 	return func(outStats outputs.Observer) (string, outputs.Group, error) {
 		out, err := b.createOutput(outStats, cfg)
 		return cfg.Name(), out, err
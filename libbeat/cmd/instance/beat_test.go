@@ -25,9 +25,11 @@ import (
 	"testing"
 
 	"github.com/elastic/beats/v7/libbeat/cfgfile"
+	"github.com/elastic/beats/v7/libbeat/common"
 
 	"github.com/gofrs/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewInstance(t *testing.T) {
@@ -68,6 +70,52 @@ func TestNewInstanceUUID(t *testing.T) {
 	assert.NotEqual(t, b.Info.ID, differentUUID)
 }
 
+func TestElasticsearchOutputConfig(t *testing.T) {
+	tests := map[string]struct {
+		config map[string]interface{}
+		hosts  []string
+	}{
+		"elasticsearch output": {
+			config: map[string]interface{}{"output.elasticsearch.hosts": []string{"es:9200"}},
+			hosts:  []string{"es:9200"},
+		},
+		"other output": {
+			config: map[string]interface{}{"output.console.pretty": true},
+		},
+		"outputs list": {
+			config: map[string]interface{}{"outputs": []map[string]interface{}{
+				{"name": "archive", "file.path": "/tmp"},
+				{"name": "disabled", "elasticsearch": map[string]interface{}{"enabled": false, "hosts": []string{"old:9200"}}},
+				{"name": "main", "elasticsearch.hosts": []string{"es:9200"}},
+				{"name": "security", "elasticsearch.hosts": []string{"security:9200"}},
+			}},
+			hosts: []string{"es:9200"},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			b, err := NewBeat("testbeat", "testidx", "0.9")
+			require.NoError(t, err)
+			require.NoError(t, common.MustNewConfigFrom(test.config).Unpack(&b.Config))
+
+			esConfig, err := b.elasticsearchOutputConfig()
+			require.NoError(t, err)
+			if test.hosts == nil {
+				assert.Nil(t, esConfig)
+				return
+			}
+			require.NotNil(t, esConfig)
+			var config struct {
+				Hosts []string `config:"hosts"`
+			}
+			require.NoError(t, esConfig.Unpack(&config))
+			assert.Equal(t, test.hosts, config.Hosts)
+		})
+	}
+}
+
 func TestInitKibanaConfig(t *testing.T) {
 	b, err := NewBeat("filebeat", "testidx", "0.9")
 	if err != nil {
@@ -0,0 +1,232 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package avro
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+var errShortBuffer = errors.New("unexpected end of avro data")
+
+// Decode decodes a value using the Avro binary encoding. Records and maps
+// are returned as common.MapStr, arrays as []interface{}, enums as strings
+// and bytes or fixed as []byte. The value of a union is returned without the
+// union branch information.
+func Decode(s *Schema, data []byte) (interface{}, error) {
+	d := &decoder{buf: data}
+	v, err := d.decode(s)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.buf) {
+		return nil, fmt.Errorf("%d trailing bytes after avro data", len(d.buf)-d.pos)
+	}
+	return v, nil
+}
+
+type decoder struct {
+	buf []byte
+	pos int
+}
+
+func (d *decoder) decode(s *Schema) (interface{}, error) {
+	switch s.Type {
+	case TypeNull:
+		return nil, nil
+	case TypeBoolean:
+		b, err := d.readByte()
+		if err != nil {
+			return nil, err
+		}
+		return b != 0, nil
+	case TypeInt:
+		v, err := d.readLong()
+		if err != nil {
+			return nil, err
+		}
+		return int32(v), nil
+	case TypeLong:
+		return d.readLong()
+	case TypeFloat:
+		b, err := d.readN(4)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float32frombits(binary.LittleEndian.Uint32(b)), nil
+	case TypeDouble:
+		b, err := d.readN(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+	case TypeBytes:
+		b, err := d.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	case TypeString:
+		b, err := d.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case TypeFixed:
+		b, err := d.readN(s.Size)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	case TypeEnum:
+		idx, err := d.readLong()
+		if err != nil {
+			return nil, err
+		}
+		if idx < 0 || int(idx) >= len(s.Symbols) {
+			return nil, fmt.Errorf("invalid symbol index %d for enum %v", idx, s.Name)
+		}
+		return s.Symbols[idx], nil
+	case TypeUnion:
+		idx, err := d.readLong()
+		if err != nil {
+			return nil, err
+		}
+		if idx < 0 || int(idx) >= len(s.Branches) {
+			return nil, fmt.Errorf("invalid union branch %d", idx)
+		}
+		return d.decode(s.Branches[idx])
+	case TypeRecord:
+		record := common.MapStr{}
+		for _, f := range s.Fields {
+			v, err := d.decode(f.Type)
+			if err != nil {
+				return nil, fmt.Errorf("field %v: %w", f.Name, err)
+			}
+			record[f.Name] = v
+		}
+		return record, nil
+	case TypeArray:
+		arr := []interface{}{}
+		err := d.readBlocks(func() error {
+			v, err := d.decode(s.Items)
+			if err != nil {
+				return err
+			}
+			arr = append(arr, v)
+			return nil
+		})
+		return arr, err
+	case TypeMap:
+		m := common.MapStr{}
+		err := d.readBlocks(func() error {
+			key, err := d.readBytes()
+			if err != nil {
+				return err
+			}
+			v, err := d.decode(s.Values)
+			if err != nil {
+				return err
+			}
+			m[string(key)] = v
+			return nil
+		})
+		return m, err
+	default:
+		return nil, fmt.Errorf("unsupported avro type '%v'", s.Type)
+	}
+}
+
+// maxZeroSizeItems limits the number of items of an array or map that can
+// exceed the size of the remaining data. Only items encoded with zero bytes,
+// like null, can exceed it.
+const maxZeroSizeItems = 1 << 16
+
+// readBlocks reads the blocks of an array or map, calling fn for each item.
+func (d *decoder) readBlocks(fn func() error) error {
+	remaining := int64(len(d.buf) - d.pos)
+	total := int64(0)
+	for {
+		count, err := d.readLong()
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return nil
+		}
+		if count < 0 {
+			// negative count is followed by the block size in bytes
+			count = -count
+			if _, err := d.readLong(); err != nil {
+				return err
+			}
+		}
+		if count < 0 || count > remaining+maxZeroSizeItems-total {
+			return fmt.Errorf("invalid block count %d", count)
+		}
+		total += count
+		for i := int64(0); i < count; i++ {
+			if err := fn(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (d *decoder) readByte() (byte, error) {
+	if d.pos >= len(d.buf) {
+		return 0, errShortBuffer
+	}
+	b := d.buf[d.pos]
+	d.pos++
+	return b, nil
+}
+
+func (d *decoder) readN(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.buf) {
+		return nil, errShortBuffer
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *decoder) readBytes() ([]byte, error) {
+	n, err := d.readLong()
+	if err != nil {
+		return nil, err
+	}
+	if n > int64(len(d.buf)) {
+		return nil, errShortBuffer
+	}
+	return d.readN(int(n))
+}
+
+// readLong reads a zig-zag encoded variable length integer.
+func (d *decoder) readLong() (int64, error) {
+	v, n := binary.Uvarint(d.buf[d.pos:])
+	if n <= 0 {
+		return 0, errShortBuffer
+	}
+	d.pos += n
+	return int64(v>>1) ^ -int64(v&1), nil
+}
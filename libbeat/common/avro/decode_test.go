@@ -0,0 +1,125 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package avro
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+const testSchema = `{
+	"type": "record",
+	"name": "User",
+	"namespace": "test",
+	"fields": [
+		{"name": "name", "type": "string"},
+		{"name": "age", "type": "int"},
+		{"name": "tags", "type": {"type": "array", "items": "string"}},
+		{"name": "opt", "type": ["null", "long"], "default": null},
+		{"name": "color", "type": {"type": "enum", "name": "Color", "symbols": ["RED", "GREEN"]}},
+		{"name": "attrs", "type": {"type": "map", "values": "double"}},
+		{"name": "friend", "type": ["null", "User"]}
+	]
+}`
+
+func TestParseSchema(t *testing.T) {
+	s, err := ParseSchema([]byte(testSchema))
+	require.NoError(t, err)
+
+	assert.Equal(t, TypeRecord, s.Type)
+	assert.Equal(t, "test.User", s.Name)
+	require.Len(t, s.Fields, 7)
+	assert.Equal(t, TypeEnum, s.Fields[4].Type.Type)
+	assert.Equal(t, "test.Color", s.Fields[4].Type.Name)
+	assert.True(t, s.Fields[3].HasDefault)
+
+	// recursive reference
+	assert.Same(t, s, s.Fields[6].Type.Branches[1])
+}
+
+func TestParseSchemaErrors(t *testing.T) {
+	cases := map[string]string{
+		"invalid json":   `{`,
+		"unknown type":   `"foo"`,
+		"missing name":   `{"type": "record", "fields": []}`,
+		"missing fields": `{"type": "record", "name": "a"}`,
+		"nested union":   `["null", ["int"]]`,
+		"fixed size":     `{"type": "fixed", "name": "f"}`,
+		"duplicate":      `{"type": "record", "name": "a", "fields": [{"name": "b", "type": {"type": "record", "name": "a", "fields": []}}]}`,
+	}
+	for name, schema := range cases {
+		schema := schema
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseSchema([]byte(schema))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	s, err := ParseSchema([]byte(testSchema))
+	require.NoError(t, err)
+
+	data := []byte{
+		0x06, 'b', 'o', 'b', // name
+		0x3c,                             // age = 30
+		0x04, 0x02, 'a', 0x02, 'b', 0x00, // tags
+		0x02, 0x02, // opt = 1
+		0x02,                                                // color = GREEN
+		0x02, 0x02, 'x', 0, 0, 0, 0, 0, 0, 0xf0, 0x3f, 0x00, // attrs = {x: 1.0}
+		0x00, // friend = null
+	}
+
+	v, err := Decode(s, data)
+	require.NoError(t, err)
+	assert.Equal(t, common.MapStr{
+		"name":   "bob",
+		"age":    int32(30),
+		"tags":   []interface{}{"a", "b"},
+		"opt":    int64(1),
+		"color":  "GREEN",
+		"attrs":  common.MapStr{"x": float64(1)},
+		"friend": nil,
+	}, v)
+
+	_, err = Decode(s, data[:len(data)-1])
+	assert.Error(t, err)
+
+	_, err = Decode(s, append(data, 0x00))
+	assert.Error(t, err)
+}
+
+func TestDecodeNullArray(t *testing.T) {
+	s, err := ParseSchema([]byte(`{"type": "array", "items": "null"}`))
+	require.NoError(t, err)
+
+	v, err := Decode(s, []byte{0x06, 0x00})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{nil, nil, nil}, v)
+
+	// The number of zero sized items is limited.
+	buf := make([]byte, binary.MaxVarintLen64+1)
+	n := binary.PutVarint(buf, 1<<40)
+	_, err = Decode(s, buf[:n+1])
+	assert.Error(t, err)
+}
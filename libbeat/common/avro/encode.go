@@ -0,0 +1,404 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package avro
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// Encode encodes a value using the Avro binary encoding.
+func Encode(s *Schema, v interface{}) ([]byte, error) {
+	return AppendEncode(nil, s, v)
+}
+
+// AppendEncode appends the Avro binary encoding of a value to buf.
+// Records and maps are read from maps with string keys. Missing record fields
+// are encoded using the field default, or as null if the field type is a
+// union containing null. Timestamps are encoded as RFC3339 strings, or as
+// milliseconds or microseconds since epoch for longs with the
+// timestamp-millis or timestamp-micros logical type. Union branches are
+// selected by the type of the value, the first matching branch is used.
+func AppendEncode(buf []byte, s *Schema, v interface{}) ([]byte, error) {
+	e := encoder{buf: buf}
+	if err := e.encode(s, v); err != nil {
+		return buf, err
+	}
+	return e.buf, nil
+}
+
+type encoder struct {
+	buf     []byte
+	scratch [binary.MaxVarintLen64]byte
+}
+
+func (e *encoder) encode(s *Schema, v interface{}) error {
+	switch s.Type {
+	case TypeNull:
+		if v != nil {
+			return typeError(s, v)
+		}
+		return nil
+
+	case TypeBoolean:
+		b, ok := v.(bool)
+		if !ok {
+			return typeError(s, v)
+		}
+		if b {
+			e.buf = append(e.buf, 1)
+		} else {
+			e.buf = append(e.buf, 0)
+		}
+		return nil
+
+	case TypeInt:
+		i, ok := toInt64(v)
+		if !ok || i < math.MinInt32 || i > math.MaxInt32 {
+			return typeError(s, v)
+		}
+		e.writeLong(i)
+		return nil
+
+	case TypeLong:
+		if ts, ok := toTime(v); ok {
+			switch s.LogicalType {
+			case LogicalTimestampMillis:
+				e.writeLong(ts.UnixNano() / int64(time.Millisecond))
+				return nil
+			case LogicalTimestampMicros:
+				e.writeLong(ts.UnixNano() / int64(time.Microsecond))
+				return nil
+			}
+			return typeError(s, v)
+		}
+		i, ok := toInt64(v)
+		if !ok {
+			return typeError(s, v)
+		}
+		e.writeLong(i)
+		return nil
+
+	case TypeFloat:
+		f, ok := toFloat64(v)
+		if !ok {
+			return typeError(s, v)
+		}
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], math.Float32bits(float32(f)))
+		e.buf = append(e.buf, b[:]...)
+		return nil
+
+	case TypeDouble:
+		f, ok := toFloat64(v)
+		if !ok {
+			return typeError(s, v)
+		}
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], math.Float64bits(f))
+		e.buf = append(e.buf, b[:]...)
+		return nil
+
+	case TypeBytes:
+		switch b := v.(type) {
+		case []byte:
+			e.writeBytes(b)
+		case string:
+			e.writeString(b)
+		default:
+			return typeError(s, v)
+		}
+		return nil
+
+	case TypeString:
+		switch str := v.(type) {
+		case string:
+			e.writeString(str)
+		case []byte:
+			e.writeBytes(str)
+		default:
+			ts, ok := toTime(v)
+			if !ok {
+				return typeError(s, v)
+			}
+			e.writeString(ts.UTC().Format("2006-01-02T15:04:05.000Z"))
+		}
+		return nil
+
+	case TypeFixed:
+		var b []byte
+		switch f := v.(type) {
+		case []byte:
+			b = f
+		case string:
+			b = []byte(f)
+		}
+		if b == nil || len(b) != s.Size {
+			return typeError(s, v)
+		}
+		e.buf = append(e.buf, b...)
+		return nil
+
+	case TypeEnum:
+		sym, ok := v.(string)
+		if !ok {
+			return typeError(s, v)
+		}
+		for i, symbol := range s.Symbols {
+			if symbol == sym {
+				e.writeLong(int64(i))
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown symbol '%v' of enum %v", sym, s.Name)
+
+	case TypeUnion:
+		for i, branch := range s.Branches {
+			if matches(branch, v) {
+				e.writeLong(int64(i))
+				return e.encode(branch, v)
+			}
+		}
+		return fmt.Errorf("no union branch matches value of type %T", v)
+
+	case TypeRecord:
+		m, ok := toMap(v)
+		if !ok {
+			return typeError(s, v)
+		}
+		for _, f := range s.Fields {
+			value, exists := m[f.Name]
+			if !exists || value == nil {
+				if f.HasDefault {
+					value = f.Default
+				} else if !acceptsNull(f.Type) {
+					return fmt.Errorf("missing value for field %v of record %v", f.Name, s.Name)
+				}
+			}
+			if err := e.encode(f.Type, value); err != nil {
+				return fmt.Errorf("field %v: %w", f.Name, err)
+			}
+		}
+		return nil
+
+	case TypeArray:
+		rv := reflect.ValueOf(v)
+		if v == nil || (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) {
+			return typeError(s, v)
+		}
+		if n := rv.Len(); n > 0 {
+			e.writeLong(int64(n))
+			for i := 0; i < n; i++ {
+				if err := e.encode(s.Items, rv.Index(i).Interface()); err != nil {
+					return err
+				}
+			}
+		}
+		e.writeLong(0)
+		return nil
+
+	case TypeMap:
+		rv := reflect.ValueOf(v)
+		if v == nil || rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+			return typeError(s, v)
+		}
+		if n := rv.Len(); n > 0 {
+			e.writeLong(int64(n))
+			iter := rv.MapRange()
+			for iter.Next() {
+				e.writeString(iter.Key().String())
+				if err := e.encode(s.Values, iter.Value().Interface()); err != nil {
+					return fmt.Errorf("key %v: %w", iter.Key().String(), err)
+				}
+			}
+		}
+		e.writeLong(0)
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported avro type '%v'", s.Type)
+	}
+}
+
+// matches checks if a value can be encoded with a union branch.
+func matches(s *Schema, v interface{}) bool {
+	switch s.Type {
+	case TypeNull:
+		return v == nil
+	case TypeBoolean:
+		_, ok := v.(bool)
+		return ok
+	case TypeInt:
+		i, ok := toInt64(v)
+		return ok && i >= math.MinInt32 && i <= math.MaxInt32
+	case TypeLong:
+		if _, ok := toTime(v); ok {
+			return s.LogicalType == LogicalTimestampMillis || s.LogicalType == LogicalTimestampMicros
+		}
+		_, ok := toInt64(v)
+		return ok
+	case TypeFloat, TypeDouble:
+		_, ok := toFloat64(v)
+		return ok
+	case TypeString:
+		switch v.(type) {
+		case string, []byte:
+			return true
+		}
+		_, ok := toTime(v)
+		return ok
+	case TypeBytes:
+		switch v.(type) {
+		case string, []byte:
+			return true
+		}
+		return false
+	case TypeFixed:
+		b, ok := v.([]byte)
+		return ok && len(b) == s.Size
+	case TypeEnum:
+		str, ok := v.(string)
+		if !ok {
+			return false
+		}
+		for _, symbol := range s.Symbols {
+			if symbol == str {
+				return true
+			}
+		}
+		return false
+	case TypeRecord:
+		_, ok := toMap(v)
+		return ok
+	case TypeMap:
+		rv := reflect.ValueOf(v)
+		return v != nil && rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String
+	case TypeArray:
+		if _, ok := v.([]byte); ok {
+			return false
+		}
+		rv := reflect.ValueOf(v)
+		return v != nil && (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array)
+	}
+	return false
+}
+
+func acceptsNull(s *Schema) bool {
+	if s.Type == TypeNull {
+		return true
+	}
+	if s.Type == TypeUnion {
+		for _, branch := range s.Branches {
+			if branch.Type == TypeNull {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func typeError(s *Schema, v interface{}) error {
+	return fmt.Errorf("can not encode %T as avro %v", v, s.Type)
+}
+
+// writeLong writes a zig-zag encoded variable length integer.
+func (e *encoder) writeLong(i int64) {
+	n := binary.PutUvarint(e.scratch[:], uint64((i<<1)^(i>>63)))
+	e.buf = append(e.buf, e.scratch[:n]...)
+}
+
+func (e *encoder) writeBytes(b []byte) {
+	e.writeLong(int64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) writeString(s string) {
+	e.writeLong(int64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func toMap(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case common.MapStr:
+		return m, true
+	case map[string]interface{}:
+		return m, true
+	}
+	return nil, false
+}
+
+func toTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case common.Time:
+		return time.Time(t), true
+	}
+	return time.Time{}, false
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint:
+		return int64(n), uint64(n) <= math.MaxInt64
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case uint64:
+		return int64(n), n <= math.MaxInt64
+	case float32:
+		return int64(n), float64(n) == math.Trunc(float64(n))
+	case float64:
+		return int64(n), n == math.Trunc(n) && n >= math.MinInt64 && n <= math.MaxInt64
+	}
+	return 0, false
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	if i, ok := toInt64(v); ok {
+		return float64(i), true
+	}
+	if u, ok := v.(uint64); ok {
+		return float64(u), true
+	}
+	return 0, false
+}
@@ -0,0 +1,164 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package avro
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+func TestEncodeRoundtrip(t *testing.T) {
+	s, err := ParseSchema([]byte(testSchema))
+	require.NoError(t, err)
+
+	in := common.MapStr{
+		"name":  "bob",
+		"age":   30,
+		"tags":  []string{"a", "b"},
+		"color": "GREEN",
+		"attrs": map[string]float64{"x": 1},
+		"friend": map[string]interface{}{
+			"name":  "alice",
+			"age":   float64(31),
+			"tags":  []interface{}{},
+			"opt":   int64(5),
+			"color": "RED",
+			"attrs": common.MapStr{},
+		},
+	}
+
+	data, err := Encode(s, in)
+	require.NoError(t, err)
+
+	v, err := Decode(s, data)
+	require.NoError(t, err)
+	assert.Equal(t, common.MapStr{
+		"name":  "bob",
+		"age":   int32(30),
+		"tags":  []interface{}{"a", "b"},
+		"opt":   nil,
+		"color": "GREEN",
+		"attrs": common.MapStr{"x": float64(1)},
+		"friend": common.MapStr{
+			"name":   "alice",
+			"age":    int32(31),
+			"tags":   []interface{}{},
+			"opt":    int64(5),
+			"color":  "RED",
+			"attrs":  common.MapStr{},
+			"friend": nil,
+		},
+	}, v)
+}
+
+func TestEncodeTimestamp(t *testing.T) {
+	ts := time.Date(2020, 5, 1, 10, 20, 30, 123456000, time.UTC)
+
+	cases := map[string]struct {
+		schema string
+		value  interface{}
+		want   interface{}
+	}{
+		"millis": {
+			schema: `{"type": "long", "logicalType": "timestamp-millis"}`,
+			value:  ts,
+			want:   int64(1588328430123),
+		},
+		"micros": {
+			schema: `{"type": "long", "logicalType": "timestamp-micros"}`,
+			value:  common.Time(ts),
+			want:   int64(1588328430123456),
+		},
+		"string": {
+			schema: `"string"`,
+			value:  ts,
+			want:   "2020-05-01T10:20:30.123Z",
+		},
+	}
+
+	for name, test := range cases {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			s, err := ParseSchema([]byte(test.schema))
+			require.NoError(t, err)
+
+			data, err := Encode(s, test.value)
+			require.NoError(t, err)
+
+			v, err := Decode(s, data)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, v)
+		})
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	cases := map[string]struct {
+		schema string
+		value  interface{}
+	}{
+		"missing field": {
+			schema: `{"type": "record", "name": "a", "fields": [{"name": "b", "type": "string"}]}`,
+			value:  common.MapStr{},
+		},
+		"wrong type": {
+			schema: `"int"`,
+			value:  "1",
+		},
+		"int overflow": {
+			schema: `"int"`,
+			value:  int64(1) << 40,
+		},
+		"fractional long": {
+			schema: `"long"`,
+			value:  1.5,
+		},
+		"unknown symbol": {
+			schema: `{"type": "enum", "name": "e", "symbols": ["A"]}`,
+			value:  "B",
+		},
+		"fixed size": {
+			schema: `{"type": "fixed", "name": "f", "size": 4}`,
+			value:  []byte{1, 2},
+		},
+		"no union branch": {
+			schema: `["null", "int"]`,
+			value:  "x",
+		},
+		"plain long timestamp": {
+			schema: `"long"`,
+			value:  time.Now(),
+		},
+	}
+
+	for name, test := range cases {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			s, err := ParseSchema([]byte(test.schema))
+			require.NoError(t, err)
+
+			_, err = Encode(s, test.value)
+			assert.Error(t, err)
+		})
+	}
+}
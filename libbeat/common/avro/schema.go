@@ -0,0 +1,283 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package avro implements the parts of the Apache Avro specification that are
+// required to encode and decode events using the binary encoding. Schemas are
+// parsed from their JSON representation.
+package avro
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Logical types of timestamps encoded as long.
+const (
+	LogicalTimestampMillis = "timestamp-millis"
+	LogicalTimestampMicros = "timestamp-micros"
+)
+
+// Avro schema types.
+const (
+	TypeNull    = "null"
+	TypeBoolean = "boolean"
+	TypeInt     = "int"
+	TypeLong    = "long"
+	TypeFloat   = "float"
+	TypeDouble  = "double"
+	TypeBytes   = "bytes"
+	TypeString  = "string"
+	TypeRecord  = "record"
+	TypeEnum    = "enum"
+	TypeArray   = "array"
+	TypeMap     = "map"
+	TypeFixed   = "fixed"
+	TypeUnion   = "union"
+)
+
+// Schema is a parsed Avro schema.
+type Schema struct {
+	Type string
+
+	// Name is the full name of named types (record, enum, fixed).
+	Name string
+
+	// Fields of a record.
+	Fields []*Field
+
+	// Symbols of an enum.
+	Symbols []string
+
+	// Items of an array.
+	Items *Schema
+
+	// Values of a map.
+	Values *Schema
+
+	// Branches of a union.
+	Branches []*Schema
+
+	// Size of a fixed.
+	Size int
+
+	// LogicalType annotates primitive types, e.g. timestamp-millis.
+	LogicalType string
+}
+
+// Field is a field of a record.
+type Field struct {
+	Name       string
+	Type       *Schema
+	Default    interface{}
+	HasDefault bool
+}
+
+var primitives = map[string]bool{
+	TypeNull:    true,
+	TypeBoolean: true,
+	TypeInt:     true,
+	TypeLong:    true,
+	TypeFloat:   true,
+	TypeDouble:  true,
+	TypeBytes:   true,
+	TypeString:  true,
+}
+
+// ParseSchema parses a schema from its JSON representation.
+func ParseSchema(data []byte) (*Schema, error) {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	p := &schemaParser{named: map[string]*Schema{}}
+	return p.parse(raw, "")
+}
+
+type schemaParser struct {
+	named map[string]*Schema
+}
+
+func (p *schemaParser) parse(raw interface{}, namespace string) (*Schema, error) {
+	switch v := raw.(type) {
+	case string:
+		return p.parseReference(v, namespace)
+	case []interface{}:
+		return p.parseUnion(v, namespace)
+	case map[string]interface{}:
+		return p.parseComplex(v, namespace)
+	default:
+		return nil, fmt.Errorf("invalid schema definition: %v", raw)
+	}
+}
+
+func (p *schemaParser) parseReference(name, namespace string) (*Schema, error) {
+	if primitives[name] {
+		return &Schema{Type: name}, nil
+	}
+	if s, ok := p.named[fullName(name, namespace)]; ok {
+		return s, nil
+	}
+	if s, ok := p.named[name]; ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("unknown type '%v'", name)
+}
+
+func (p *schemaParser) parseUnion(branches []interface{}, namespace string) (*Schema, error) {
+	s := &Schema{Type: TypeUnion}
+	for _, raw := range branches {
+		branch, err := p.parse(raw, namespace)
+		if err != nil {
+			return nil, err
+		}
+		if branch.Type == TypeUnion {
+			return nil, fmt.Errorf("unions must not immediately contain other unions")
+		}
+		s.Branches = append(s.Branches, branch)
+	}
+	return s, nil
+}
+
+func (p *schemaParser) parseComplex(def map[string]interface{}, namespace string) (*Schema, error) {
+	typ, _ := def["type"].(string)
+	if typ == "" {
+		if nested, ok := def["type"]; ok {
+			return p.parse(nested, namespace)
+		}
+		return nil, fmt.Errorf("schema definition without type: %v", def)
+	}
+
+	switch typ {
+	case TypeRecord, "error":
+		return p.parseRecord(def, namespace)
+	case TypeEnum:
+		s, err := p.register(TypeEnum, def, namespace)
+		if err != nil {
+			return nil, err
+		}
+		symbols, _ := def["symbols"].([]interface{})
+		for _, sym := range symbols {
+			str, ok := sym.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid symbol '%v' in enum %v", sym, s.Name)
+			}
+			s.Symbols = append(s.Symbols, str)
+		}
+		return s, nil
+	case TypeFixed:
+		s, err := p.register(TypeFixed, def, namespace)
+		if err != nil {
+			return nil, err
+		}
+		size, ok := def["size"].(float64)
+		if !ok || size < 0 {
+			return nil, fmt.Errorf("fixed %v requires a size", s.Name)
+		}
+		s.Size = int(size)
+		return s, nil
+	case TypeArray:
+		items, err := p.parse(def["items"], namespace)
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: TypeArray, Items: items}, nil
+	case TypeMap:
+		values, err := p.parse(def["values"], namespace)
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: TypeMap, Values: values}, nil
+	default:
+		// primitive types can be written as {"type": "string"}, optionally
+		// with a logicalType. Logical types use the underlying type.
+		s, err := p.parseReference(typ, namespace)
+		if err != nil {
+			return nil, err
+		}
+		if logicalType, ok := def["logicalType"].(string); ok && primitives[typ] {
+			s.LogicalType = logicalType
+		}
+		return s, nil
+	}
+}
+
+func (p *schemaParser) parseRecord(def map[string]interface{}, namespace string) (*Schema, error) {
+	s, err := p.register(TypeRecord, def, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	// nested definitions use the namespace of the enclosing record
+	if i := strings.LastIndex(s.Name, "."); i >= 0 {
+		namespace = s.Name[:i]
+	}
+
+	fields, ok := def["fields"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("record %v requires fields", s.Name)
+	}
+	for _, rawField := range fields {
+		fieldDef, ok := rawField.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid field definition in record %v", s.Name)
+		}
+		name, _ := fieldDef["name"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("field without name in record %v", s.Name)
+		}
+		typ, err := p.parse(fieldDef["type"], namespace)
+		if err != nil {
+			return nil, fmt.Errorf("field %v of record %v: %w", name, s.Name, err)
+		}
+		def, hasDefault := fieldDef["default"]
+		s.Fields = append(s.Fields, &Field{
+			Name:       name,
+			Type:       typ,
+			Default:    def,
+			HasDefault: hasDefault,
+		})
+	}
+	return s, nil
+}
+
+// register creates a named schema and registers it, such that it can be
+// referenced by name later on.
+func (p *schemaParser) register(typ string, def map[string]interface{}, namespace string) (*Schema, error) {
+	name, _ := def["name"].(string)
+	if name == "" {
+		return nil, fmt.Errorf("%v requires a name", typ)
+	}
+	if ns, ok := def["namespace"].(string); ok {
+		namespace = ns
+	}
+
+	s := &Schema{Type: typ, Name: fullName(name, namespace)}
+	if _, exists := p.named[s.Name]; exists {
+		return nil, fmt.Errorf("type %v is defined twice", s.Name)
+	}
+	p.named[s.Name] = s
+	return s, nil
+}
+
+func fullName(name, namespace string) string {
+	if namespace == "" || strings.Contains(name, ".") {
+		return name
+	}
+	return namespace + "." + name
+}
@@ -0,0 +1,166 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package xml converts XML documents into common.MapStr.
+package xml
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// TextKey is the key used to store the text content of elements that also
+// have attributes or child elements.
+const TextKey = "#text"
+
+var errNoRootElement = errors.New("no XML root element found")
+
+// Decoder converts XML documents into nested common.MapStr values.
+//
+// The root element becomes the only key of the returned map. Elements
+// without attributes and child elements are decoded into strings. Repeated
+// elements with the same name are combined into an array.
+type Decoder struct {
+	// LowercaseKeys converts all element and attribute names to lower case.
+	LowercaseKeys bool
+
+	// AttributePrefix is prepended to the names of attributes, to distinguish
+	// them from child elements.
+	AttributePrefix string
+
+	// ArrayElements lists the element names that are always decoded into an
+	// array, even if the element is not repeated. The names are converted to
+	// lower case as well if LowercaseKeys is set.
+	ArrayElements []string
+}
+
+// Decode reads one XML document from r.
+func (d *Decoder) Decode(r io.Reader) (common.MapStr, error) {
+	dec := xml.NewDecoder(r)
+
+	// The document is expected to be UTF-8 encoded already, even if the XML
+	// declaration states another encoding.
+	dec.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil, errNoRootElement
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if start, ok := tok.(xml.StartElement); ok {
+			value, err := d.decodeElement(dec, start)
+			if err != nil {
+				return nil, err
+			}
+			return common.MapStr{d.key(start.Name.Local): value}, nil
+		}
+	}
+}
+
+// DecodeString decodes the XML document in s.
+func (d *Decoder) DecodeString(s string) (common.MapStr, error) {
+	return d.Decode(strings.NewReader(s))
+}
+
+func (d *Decoder) decodeElement(dec *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	fields := common.MapStr{}
+	for _, attr := range start.Attr {
+		// skip namespace declarations
+		if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+			continue
+		}
+		d.add(fields, d.AttributePrefix+attr.Name.Local, attr.Value)
+	}
+
+	var text strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			child, err := d.decodeElement(dec, t)
+			if err != nil {
+				return nil, err
+			}
+			d.add(fields, t.Name.Local, child)
+
+		case xml.CharData:
+			text.Write(t)
+
+		case xml.EndElement:
+			content := strings.TrimSpace(text.String())
+			if len(fields) == 0 {
+				return content, nil
+			}
+			if content != "" {
+				fields[TextKey] = content
+			}
+			return fields, nil
+		}
+	}
+}
+
+// add stores the value under name. Values of repeated names are combined
+// into an array.
+func (d *Decoder) add(fields common.MapStr, name string, value interface{}) {
+	key := d.key(name)
+
+	existing, exists := fields[key]
+	switch {
+	case !exists && d.isArray(key):
+		fields[key] = []interface{}{value}
+	case !exists:
+		fields[key] = value
+	default:
+		if arr, ok := existing.([]interface{}); ok {
+			fields[key] = append(arr, value)
+		} else {
+			fields[key] = []interface{}{existing, value}
+		}
+	}
+}
+
+func (d *Decoder) key(name string) string {
+	if d.LowercaseKeys {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// isArray reports whether the element with the normalized name key is
+// configured to always be decoded into an array.
+func (d *Decoder) isArray(key string) bool {
+	for _, elem := range d.ArrayElements {
+		if d.key(elem) == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package xml
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+func TestDecode(t *testing.T) {
+	cases := map[string]struct {
+		decoder Decoder
+		input   string
+		want    common.MapStr
+	}{
+		"simple": {
+			input: `<?xml version="1.0" encoding="UTF-8"?><Event><ID>4624</ID><Level>Info</Level></Event>`,
+			want:  common.MapStr{"Event": common.MapStr{"ID": "4624", "Level": "Info"}},
+		},
+		"attributes and text": {
+			decoder: Decoder{AttributePrefix: "@"},
+			input:   `<Data Name="TargetUserName">admin</Data>`,
+			want:    common.MapStr{"Data": common.MapStr{"@Name": "TargetUserName", "#text": "admin"}},
+		},
+		"repeated elements": {
+			input: `<catalog><book>A</book><book>B</book><book>C</book></catalog>`,
+			want:  common.MapStr{"catalog": common.MapStr{"book": []interface{}{"A", "B", "C"}}},
+		},
+		"forced arrays": {
+			decoder: Decoder{ArrayElements: []string{"book"}},
+			input:   `<catalog><book>A</book></catalog>`,
+			want:    common.MapStr{"catalog": common.MapStr{"book": []interface{}{"A"}}},
+		},
+		"forced arrays with lowercase keys": {
+			decoder: Decoder{LowercaseKeys: true, ArrayElements: []string{"Book", "author"}},
+			input:   `<Catalog><Book>A</Book><Author>B</Author></Catalog>`,
+			want:    common.MapStr{"catalog": common.MapStr{"book": []interface{}{"A"}, "author": []interface{}{"B"}}},
+		},
+		"lowercase keys": {
+			decoder: Decoder{LowercaseKeys: true},
+			input:   `<Envelope Version="1"><Body><Status>OK</Status></Body></Envelope>`,
+			want:    common.MapStr{"envelope": common.MapStr{"version": "1", "body": common.MapStr{"status": "OK"}}},
+		},
+		"namespaces": {
+			input: `<soap:Envelope xmlns:soap="http://www.w3.org/2003/05/soap-envelope" xmlns="urn:x"><soap:Body>ok</soap:Body></soap:Envelope>`,
+			want:  common.MapStr{"Envelope": common.MapStr{"Body": "ok"}},
+		},
+		"empty element": {
+			input: `<a><b/></a>`,
+			want:  common.MapStr{"a": common.MapStr{"b": ""}},
+		},
+		"declared encoding is ignored": {
+			input: `<?xml version="1.0" encoding="UTF-16"?><a>ü</a>`,
+			want:  common.MapStr{"a": "ü"},
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := test.decoder.DecodeString(test.input)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	cases := map[string]string{
+		"empty":       "",
+		"no element":  "just text",
+		"unclosed":    "<a><b>text</b>",
+		"mismatching": "<a></b>",
+	}
+
+	for name, input := range cases {
+		t.Run(name, func(t *testing.T) {
+			var d Decoder
+			_, err := d.DecodeString(input)
+			assert.Error(t, err)
+		})
+	}
+}
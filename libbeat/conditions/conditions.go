@@ -34,6 +34,7 @@ type Config struct {
 	Range     *Fields                `config:"range"`
 	HasFields []string               `config:"has_fields"`
 	Network   map[string]interface{} `config:"network"`
+	Expr      string                 `config:"expr"`
 	OR        []Config               `config:"or"`
 	AND       []Config               `config:"and"`
 	NOT       *Config                `config:"not"`
@@ -74,6 +75,8 @@ func NewCondition(config *Config) (Condition, error) {
 		condition = NewHasFieldsCondition(config.HasFields)
 	case config.Network != nil && len(config.Network) > 0:
 		condition, err = NewNetworkCondition(config.Network)
+	case config.Expr != "":
+		condition, err = NewExprCondition(config.Expr)
 	case len(config.OR) > 0:
 		var conditionsList []Condition
 		conditionsList, err = NewConditionList(config.OR)
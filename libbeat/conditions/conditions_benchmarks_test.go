@@ -48,6 +48,29 @@ func BenchmarkSimpleCondition(b *testing.B) {
 	}
 }
 
+func BenchmarkSimpleExprCondition(b *testing.B) {
+	config := Config{
+		Expr: "afield != null",
+	}
+
+	cond, err := NewCondition(&config)
+	if err != nil {
+		panic(err)
+	}
+
+	event := &beat.Event{
+		Timestamp: time.Now(),
+		Fields: common.MapStr{
+			"@timestamp": "2015-06-11T09:51:23.642Z",
+			"afield":     "avalue",
+		},
+	}
+
+	for i := 0; i < b.N; i++ {
+		cond.Check(event)
+	}
+}
+
 func BenchmarkCombinedCondition(b *testing.B) {
 	config := Config{
 		OR: []Config{
@@ -112,3 +135,47 @@ func BenchmarkCombinedCondition(b *testing.B) {
 		cond.Check(event)
 	}
 }
+
+func BenchmarkCombinedExprCondition(b *testing.B) {
+	config := Config{
+		Expr: "(http.code >= 100 and http.code < 300) or (status == 200 and type == 'http')",
+	}
+
+	cond, err := NewCondition(&config)
+	if err != nil {
+		panic(err)
+	}
+
+	event := &beat.Event{
+		Timestamp: time.Now(),
+		Fields: common.MapStr{
+			"@timestamp":    "2015-06-11T09:51:23.642Z",
+			"bytes_in":      126,
+			"bytes_out":     28033,
+			"client_ip":     "127.0.0.1",
+			"client_port":   42840,
+			"client_proc":   "",
+			"client_server": "mar.local",
+			"http": common.MapStr{
+				"code":           200,
+				"content_length": 76985,
+				"phrase":         "OK",
+			},
+			"ip":           "127.0.0.1",
+			"method":       "GET",
+			"params":       "",
+			"path":         "/jszip.min.js",
+			"port":         8000,
+			"proc":         "",
+			"query":        "GET /jszip.min.js",
+			"responsetime": 30,
+			"server":       "mar.local",
+			"status":       "OK",
+			"type":         "http",
+		},
+	}
+
+	for i := 0; i < b.N; i++ {
+		cond.Check(event)
+	}
+}
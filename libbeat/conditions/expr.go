@@ -0,0 +1,239 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package conditions
+
+import (
+	"math"
+)
+
+// Expr is a condition defined by an expression, like
+// `http.response.status_code >= 500 and not cidrMatch(source.ip, 'private')`.
+// The expression is compiled once, when the condition is created.
+type Expr struct {
+	source string
+	root   operand
+}
+
+// operand is a compiled expression. Operands that do not depend on the event
+// are evaluated when compiled.
+type operand struct {
+	eval     func(event ValuesMap) interface{}
+	constant bool
+	value    interface{} // value of constant operands
+}
+
+// NewExprCondition compiles an expression into a condition.
+func NewExprCondition(expr string) (*Expr, error) {
+	root, err := parseExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &Expr{source: expr, root: root}, nil
+}
+
+// Check determines whether the expression evaluates to true for the event.
+func (c *Expr) Check(event ValuesMap) bool {
+	return isTrue(c.root.get(event))
+}
+
+func (c *Expr) String() string {
+	return "expr:(" + c.source + ")"
+}
+
+func (o operand) get(event ValuesMap) interface{} {
+	if o.constant {
+		return o.value
+	}
+	return o.eval(event)
+}
+
+func constantOperand(v interface{}) operand {
+	return operand{constant: true, value: v}
+}
+
+// fold evaluates operands depending only on constant operands.
+func fold(op operand, args ...operand) operand {
+	for _, arg := range args {
+		if !arg.constant {
+			return op
+		}
+	}
+	return constantOperand(op.eval(nil))
+}
+
+func newFieldOperand(name string) operand {
+	return operand{eval: func(event ValuesMap) interface{} {
+		v, err := event.GetValue(name)
+		if err != nil {
+			return nil
+		}
+		return v
+	}}
+}
+
+func newLogicalOperand(and bool, left, right operand) operand {
+	return fold(operand{eval: func(event ValuesMap) interface{} {
+		if isTrue(left.get(event)) != and {
+			return !and
+		}
+		return isTrue(right.get(event))
+	}}, left, right)
+}
+
+func newNotOperand(inner operand) operand {
+	return fold(operand{eval: func(event ValuesMap) interface{} {
+		return !isTrue(inner.get(event))
+	}}, inner)
+}
+
+func newNegateOperand(inner operand) operand {
+	return fold(operand{eval: func(event ValuesMap) interface{} {
+		if f, ok := toNumber(inner.get(event)); ok {
+			return -f
+		}
+		return nil
+	}}, inner)
+}
+
+type binaryFunc func(a, b interface{}) interface{}
+
+func newBinaryOperand(left, right operand, fn binaryFunc) operand {
+	return fold(operand{eval: func(event ValuesMap) interface{} {
+		return fn(left.get(event), right.get(event))
+	}}, left, right)
+}
+
+var comparisons = map[string]binaryFunc{
+	"==": func(a, b interface{}) interface{} { return valuesEqual(a, b) },
+	"!=": func(a, b interface{}) interface{} { return !valuesEqual(a, b) },
+	"<":  func(a, b interface{}) interface{} { c, ok := compareValues(a, b); return ok && c < 0 },
+	"<=": func(a, b interface{}) interface{} { c, ok := compareValues(a, b); return ok && c <= 0 },
+	">":  func(a, b interface{}) interface{} { c, ok := compareValues(a, b); return ok && c > 0 },
+	">=": func(a, b interface{}) interface{} { c, ok := compareValues(a, b); return ok && c >= 0 },
+}
+
+// arithmetics operate on numbers. Invalid operations, like a division by
+// zero or adding a string to a number, evaluate to null. Strings can be
+// concatenated with +.
+var arithmetics = map[string]binaryFunc{
+	"+": func(a, b interface{}) interface{} {
+		if sa, ok := a.(string); ok {
+			if sb, ok := b.(string); ok {
+				return sa + sb
+			}
+			return nil
+		}
+		return arithmetic(a, b, func(x, y float64) float64 { return x + y })
+	},
+	"-": func(a, b interface{}) interface{} {
+		return arithmetic(a, b, func(x, y float64) float64 { return x - y })
+	},
+	"*": func(a, b interface{}) interface{} {
+		return arithmetic(a, b, func(x, y float64) float64 { return x * y })
+	},
+	"/": func(a, b interface{}) interface{} {
+		return arithmetic(a, b, func(x, y float64) float64 { return x / y })
+	},
+	"%": func(a, b interface{}) interface{} {
+		return arithmetic(a, b, math.Mod)
+	},
+}
+
+func arithmetic(a, b interface{}, fn func(x, y float64) float64) interface{} {
+	x, ok := toNumber(a)
+	if !ok {
+		return nil
+	}
+	y, ok := toNumber(b)
+	if !ok {
+		return nil
+	}
+	r := fn(x, y)
+	if math.IsNaN(r) || math.IsInf(r, 0) {
+		return nil
+	}
+	return r
+}
+
+func isTrue(v interface{}) bool {
+	b, ok := v.(bool)
+	return ok && b
+}
+
+// toNumber converts numeric values to float64. Strings are not converted,
+// the number function must be used to parse them.
+func toNumber(v interface{}) (float64, bool) {
+	if _, isString := v.(string); isString || v == nil {
+		return 0, false
+	}
+	f, err := ExtractFloat(v)
+	return f, err == nil
+}
+
+// valuesEqual compares numbers by value, and other values when they have the
+// same type. Missing fields are only equal to null.
+func valuesEqual(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if x, ok := toNumber(a); ok {
+		y, ok := toNumber(b)
+		return ok && x == y
+	}
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		return ok && x == y
+	case bool:
+		y, ok := b.(bool)
+		return ok && x == y
+	}
+	return false
+}
+
+// compareValues orders two numbers or two strings. It returns false if the
+// values can not be ordered.
+func compareValues(a, b interface{}) (int, bool) {
+	if x, ok := toNumber(a); ok {
+		y, ok := toNumber(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+	if x, ok := a.(string); ok {
+		y, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,233 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package conditions
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/elastic/beats/v7/libbeat/common/match"
+)
+
+// exprFunc compiles a function call with its arguments.
+type exprFunc func(args []operand) (operand, error)
+
+// exprFuncs are the functions available in expressions. Their names follow
+// the expression language of the Elastic Agent.
+var exprFuncs = map[string]exprFunc{
+	"arrayContains":  arrayContainsFunc,
+	"cidrMatch":      cidrMatchFunc,
+	"endsWith":       stringFunc(strings.HasSuffix),
+	"length":         lengthFunc,
+	"match":          matchFunc,
+	"number":         numberFunc,
+	"startsWith":     stringFunc(strings.HasPrefix),
+	"string":         stringConvFunc,
+	"stringContains": stringFunc(strings.Contains),
+}
+
+func checkArgs(args []operand, min, max int) error {
+	if len(args) < min {
+		return fmt.Errorf("expected at least %d arguments, got %d", min, len(args))
+	}
+	if max >= 0 && len(args) > max {
+		return fmt.Errorf("expected at most %d arguments, got %d", max, len(args))
+	}
+	return nil
+}
+
+// constantStrings returns the values of arguments that must be string
+// literals, like regular expressions or networks.
+func constantStrings(args []operand) ([]string, error) {
+	values := make([]string, len(args))
+	for i, arg := range args {
+		s, ok := arg.value.(string)
+		if !arg.constant || !ok {
+			return nil, errors.New("patterns must be string literals")
+		}
+		values[i] = s
+	}
+	return values, nil
+}
+
+// arrayContains(array, value, ...) checks if the array contains any of the
+// values.
+func arrayContainsFunc(args []operand) (operand, error) {
+	if err := checkArgs(args, 2, -1); err != nil {
+		return operand{}, err
+	}
+	return fold(operand{eval: func(event ValuesMap) interface{} {
+		v := reflect.ValueOf(args[0].get(event))
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			return false
+		}
+		for i := 0; i < v.Len(); i++ {
+			elem := v.Index(i).Interface()
+			for _, arg := range args[1:] {
+				if valuesEqual(elem, arg.get(event)) {
+					return true
+				}
+			}
+		}
+		return false
+	}}, args...), nil
+}
+
+// cidrMatch(ip, network, ...) checks if the IP address is in any of the
+// networks. Networks are CIDRs or the named networks of the network condition.
+func cidrMatchFunc(args []operand) (operand, error) {
+	if err := checkArgs(args, 2, -1); err != nil {
+		return operand{}, err
+	}
+	networks, err := constantStrings(args[1:])
+	if err != nil {
+		return operand{}, err
+	}
+	var matchers multiNetworkMatcher
+	for _, network := range networks {
+		m, err := makeNetworkMatcher(network)
+		if err != nil {
+			return operand{}, err
+		}
+		matchers = append(matchers, m)
+	}
+
+	ip := args[0]
+	return fold(operand{eval: func(event ValuesMap) interface{} {
+		addr := extractIP(ip.get(event))
+		return addr != nil && matchers.Contains(addr)
+	}}, ip), nil
+}
+
+// length(value) returns the number of characters of a string, or the number of
+// elements of an array or object.
+func lengthFunc(args []operand) (operand, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return operand{}, err
+	}
+	return fold(operand{eval: func(event ValuesMap) interface{} {
+		switch v := args[0].get(event).(type) {
+		case nil:
+			return nil
+		case string:
+			return float64(utf8.RuneCountInString(v))
+		default:
+			rv := reflect.ValueOf(v)
+			switch rv.Kind() {
+			case reflect.Slice, reflect.Array, reflect.Map:
+				return float64(rv.Len())
+			}
+			return nil
+		}
+	}}, args...), nil
+}
+
+// match(string, regexp, ...) checks if the string matches any of the regular
+// expressions.
+func matchFunc(args []operand) (operand, error) {
+	if err := checkArgs(args, 2, -1); err != nil {
+		return operand{}, err
+	}
+	patterns, err := constantStrings(args[1:])
+	if err != nil {
+		return operand{}, err
+	}
+	matchers := make([]match.Matcher, len(patterns))
+	for i, pattern := range patterns {
+		if matchers[i], err = match.Compile(pattern); err != nil {
+			return operand{}, err
+		}
+	}
+
+	str := args[0]
+	return fold(operand{eval: func(event ValuesMap) interface{} {
+		s, ok := str.get(event).(string)
+		if !ok {
+			return false
+		}
+		for _, m := range matchers {
+			if m.MatchString(s) {
+				return true
+			}
+		}
+		return false
+	}}, str), nil
+}
+
+// number(value) converts a number or a string to a number.
+func numberFunc(args []operand) (operand, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return operand{}, err
+	}
+	return fold(operand{eval: func(event ValuesMap) interface{} {
+		v := args[0].get(event)
+		if v == nil {
+			return nil
+		}
+		f, err := ExtractFloat(v)
+		if err != nil {
+			return nil
+		}
+		return f
+	}}, args...), nil
+}
+
+// string(value) converts a number, a boolean or a string to a string.
+func stringConvFunc(args []operand) (operand, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return operand{}, err
+	}
+	return fold(operand{eval: func(event ValuesMap) interface{} {
+		switch v := args[0].get(event).(type) {
+		case string:
+			return v
+		case bool:
+			return fmt.Sprint(v)
+		default:
+			if f, ok := toNumber(v); ok {
+				return fmt.Sprint(f)
+			}
+			return nil
+		}
+	}}, args...), nil
+}
+
+// stringFunc builds functions like startsWith(string, prefix, ...), checking
+// a string against any of the other arguments.
+func stringFunc(fn func(s, arg string) bool) exprFunc {
+	return func(args []operand) (operand, error) {
+		if err := checkArgs(args, 2, -1); err != nil {
+			return operand{}, err
+		}
+		return fold(operand{eval: func(event ValuesMap) interface{} {
+			s, ok := args[0].get(event).(string)
+			if !ok {
+				return false
+			}
+			for _, arg := range args[1:] {
+				if a, ok := arg.get(event).(string); ok && fn(s, a) {
+					return true
+				}
+			}
+			return false
+		}}, args...), nil
+	}
+}
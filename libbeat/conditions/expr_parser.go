@@ -0,0 +1,390 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package conditions
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type exprTokenKind uint8
+
+const (
+	tokEOF exprTokenKind = iota
+	tokNumber
+	tokString
+	tokIdent // field name, keyword or function name
+	tokField // field name in ${...}
+	tokOperator
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type exprToken struct {
+	kind exprTokenKind
+	text string
+	pos  int
+}
+
+func (t exprToken) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("'%v'", t.text)
+}
+
+// exprParser parses an expression and compiles it into operands in a
+// single pass. Operators by increasing precedence:
+//
+//	or
+//	and
+//	not
+//	== != < <= > >=
+//	+ -
+//	* / %
+//	- (negation)
+type exprParser struct {
+	src    string
+	pos    int
+	tok    exprToken
+	lexErr error
+}
+
+type exprSyntaxError struct {
+	pos int
+	msg string
+}
+
+func (e *exprSyntaxError) Error() string {
+	return fmt.Sprintf("invalid expression at position %d: %v", e.pos+1, e.msg)
+}
+
+func parseExpr(src string) (operand, error) {
+	p := &exprParser{src: src}
+	p.next()
+
+	op, err := p.parseOr()
+	if err != nil {
+		return operand{}, err
+	}
+	if p.lexErr != nil {
+		return operand{}, p.lexErr
+	}
+	if p.tok.kind != tokEOF {
+		return operand{}, p.errorf("unexpected %v", p.tok)
+	}
+	return op, nil
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	if p.lexErr != nil {
+		return p.lexErr
+	}
+	return &exprSyntaxError{pos: p.tok.pos, msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *exprParser) parseOr() (operand, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return operand{}, err
+	}
+	for p.isKeyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return operand{}, err
+		}
+		left = newLogicalOperand(false, left, right)
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (operand, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return operand{}, err
+	}
+	for p.isKeyword("and") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return operand{}, err
+		}
+		left = newLogicalOperand(true, left, right)
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseNot() (operand, error) {
+	if !p.isKeyword("not") {
+		return p.parseComparison()
+	}
+	p.next()
+	inner, err := p.parseNot()
+	if err != nil {
+		return operand{}, err
+	}
+	return newNotOperand(inner), nil
+}
+
+func (p *exprParser) parseComparison() (operand, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return operand{}, err
+	}
+	if p.tok.kind != tokOperator || comparisons[p.tok.text] == nil {
+		return left, nil
+	}
+	cmp := comparisons[p.tok.text]
+	p.next()
+	right, err := p.parseAdditive()
+	if err != nil {
+		return operand{}, err
+	}
+	return newBinaryOperand(left, right, cmp), nil
+}
+
+func (p *exprParser) parseAdditive() (operand, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return operand{}, err
+	}
+	for p.isOperator("+") || p.isOperator("-") {
+		op := arithmetics[p.tok.text]
+		p.next()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return operand{}, err
+		}
+		left = newBinaryOperand(left, right, op)
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseMultiplicative() (operand, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return operand{}, err
+	}
+	for p.isOperator("*") || p.isOperator("/") || p.isOperator("%") {
+		op := arithmetics[p.tok.text]
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return operand{}, err
+		}
+		left = newBinaryOperand(left, right, op)
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (operand, error) {
+	if !p.isOperator("-") {
+		return p.parsePrimary()
+	}
+	p.next()
+	inner, err := p.parseUnary()
+	if err != nil {
+		return operand{}, err
+	}
+	return newNegateOperand(inner), nil
+}
+
+func (p *exprParser) parsePrimary() (operand, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokNumber:
+		p.next()
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return operand{}, &exprSyntaxError{pos: tok.pos, msg: fmt.Sprintf("invalid number '%v'", tok.text)}
+		}
+		return constantOperand(f), nil
+
+	case tokString:
+		p.next()
+		return constantOperand(tok.text), nil
+
+	case tokField:
+		p.next()
+		return newFieldOperand(tok.text), nil
+
+	case tokIdent:
+		p.next()
+		switch strings.ToLower(tok.text) {
+		case "true":
+			return constantOperand(true), nil
+		case "false":
+			return constantOperand(false), nil
+		case "null":
+			return constantOperand(nil), nil
+		}
+		if p.tok.kind == tokLParen {
+			return p.parseCall(tok)
+		}
+		return newFieldOperand(tok.text), nil
+
+	case tokLParen:
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return operand{}, err
+		}
+		if p.tok.kind != tokRParen {
+			return operand{}, p.errorf("expected ')' but found %v", p.tok)
+		}
+		p.next()
+		return inner, nil
+	}
+	return operand{}, p.errorf("unexpected %v", tok)
+}
+
+func (p *exprParser) parseCall(name exprToken) (operand, error) {
+	fn, found := exprFuncs[name.text]
+	if !found {
+		return operand{}, &exprSyntaxError{pos: name.pos, msg: fmt.Sprintf("unknown function '%v'", name.text)}
+	}
+
+	p.next() // (
+	var args []operand
+	for p.tok.kind != tokRParen {
+		if len(args) > 0 {
+			if p.tok.kind != tokComma {
+				return operand{}, p.errorf("expected ',' or ')' but found %v", p.tok)
+			}
+			p.next()
+		}
+		arg, err := p.parseOr()
+		if err != nil {
+			return operand{}, err
+		}
+		args = append(args, arg)
+	}
+	p.next() // )
+
+	op, err := fn(args)
+	if err != nil {
+		return operand{}, &exprSyntaxError{pos: name.pos, msg: fmt.Sprintf("%v: %v", name.text, err)}
+	}
+	return op, nil
+}
+
+func (p *exprParser) isKeyword(keyword string) bool {
+	return p.tok.kind == tokIdent && (p.tok.text == keyword || p.tok.text == strings.ToUpper(keyword))
+}
+
+func (p *exprParser) isOperator(op string) bool {
+	return p.tok.kind == tokOperator && p.tok.text == op
+}
+
+// next reads the next token. Lexing errors are reported by the parser
+// through errorf, once the EOF token returned on error can not be parsed.
+func (p *exprParser) next() {
+	src := p.src
+	for p.pos < len(src) && isExprSpace(src[p.pos]) {
+		p.pos++
+	}
+
+	start := p.pos
+	if start >= len(src) {
+		p.tok = exprToken{kind: tokEOF, pos: start}
+		return
+	}
+
+	c := src[start]
+	switch {
+	case c == '(':
+		p.pos++
+		p.tok = exprToken{kind: tokLParen, text: "(", pos: start}
+	case c == ')':
+		p.pos++
+		p.tok = exprToken{kind: tokRParen, text: ")", pos: start}
+	case c == ',':
+		p.pos++
+		p.tok = exprToken{kind: tokComma, text: ",", pos: start}
+	case c == '\'' || c == '"':
+		end := strings.IndexByte(src[start+1:], c)
+		if end < 0 {
+			p.fail(start, "unterminated string")
+			return
+		}
+		p.pos = start + 1 + end + 1
+		p.tok = exprToken{kind: tokString, text: src[start+1 : start+1+end], pos: start}
+	case c == '$' && strings.HasPrefix(src[start:], "${"):
+		end := strings.IndexByte(src[start:], '}')
+		if end < 0 {
+			p.fail(start, "unterminated field name")
+			return
+		}
+		p.pos = start + end + 1
+		name := strings.TrimSpace(src[start+2 : start+end])
+		if name == "" {
+			p.fail(start, "empty field name")
+			return
+		}
+		p.tok = exprToken{kind: tokField, text: name, pos: start}
+	case isExprDigit(c):
+		for p.pos < len(src) && (isExprDigit(src[p.pos]) || src[p.pos] == '.') {
+			p.pos++
+		}
+		p.tok = exprToken{kind: tokNumber, text: src[start:p.pos], pos: start}
+	case isExprIdentStart(c):
+		for p.pos < len(src) && isExprIdentPart(src[p.pos]) {
+			p.pos++
+		}
+		p.tok = exprToken{kind: tokIdent, text: src[start:p.pos], pos: start}
+	default:
+		for _, op := range exprOperators {
+			if strings.HasPrefix(src[start:], op) {
+				p.pos += len(op)
+				p.tok = exprToken{kind: tokOperator, text: op, pos: start}
+				return
+			}
+		}
+		p.fail(start, fmt.Sprintf("unexpected character '%c'", c))
+	}
+}
+
+func (p *exprParser) fail(pos int, msg string) {
+	if p.lexErr == nil {
+		p.lexErr = &exprSyntaxError{pos: pos, msg: msg}
+	}
+	p.pos = len(p.src)
+	p.tok = exprToken{kind: tokEOF, pos: pos}
+}
+
+// exprOperators lists the operators, longest first.
+var exprOperators = []string{"==", "!=", "<=", ">=", "<", ">", "+", "-", "*", "/", "%"}
+
+func isExprSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isExprDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isExprIdentStart(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || c == '_' || c == '@'
+}
+
+func isExprIdentPart(c byte) bool {
+	return isExprIdentStart(c) || isExprDigit(c) || c == '.'
+}
@@ -0,0 +1,149 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package conditions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+func TestExprCondition(t *testing.T) {
+	cases := map[string]bool{
+		// Comparisons.
+		`http.code == 200`:                     true,
+		`http.code == 200.0`:                   true,
+		`http.code != 200`:                     false,
+		`http.code >= 200 and http.code < 300`: true,
+		`http.code > 200`:                      false,
+		`http.code == '200'`:                   false,
+		`status == "OK"`:                       true,
+		`status < 'PK'`:                        true,
+		`status > 5`:                           false,
+		`${http.phrase} == 'OK'`:               true,
+		`@timestamp != null`:                   true,
+
+		// Missing fields.
+		`missing == 1`:      false,
+		`missing != 1`:      true,
+		`missing == null`:   true,
+		`http.code != null`: true,
+		`missing > 1`:       false,
+		`not (missing > 1)`: true,
+
+		// Logical operators and precedence.
+		`type == 'http' or missing`:                      true,
+		`type == 'dns' or status == 'OK' and port > 1`:   true,
+		`(type == 'dns' or status == 'OK') and port < 1`: false,
+		`not type == 'dns'`:                              true,
+		`NOT type == 'dns' AND true`:                     true,
+		`not not true`:                                   true,
+		`type`:                                           false,
+
+		// Arithmetic.
+		`bytes_in + bytes_out == 28159`: true,
+		`responsetime * 2 - 10 == 50`:   true,
+		`port % 1000 == 0`:              true,
+		`-port < 0`:                     true,
+		`bytes_out / 0 == null`:         true,
+		`method + ' ' + path == query`:  true,
+		`1 + 2 * 3 == 7`:                true,
+
+		// Functions.
+		`cidrMatch(client_ip, '10.0.0.0/8')`:                          false,
+		`cidrMatch(client_ip, '10.0.0.0/8', 'loopback')`:              true,
+		`cidrMatch(missing, 'loopback')`:                              false,
+		`startsWith(path, '/js', '/css')`:                             true,
+		`endsWith(path, '.css')`:                                      false,
+		`stringContains(query, 'zip')`:                                true,
+		`match(path, '^/[a-z]+\.min\.js$')`:                           true,
+		`length(path) == 13`:                                          true,
+		`length(tags) == 2`:                                           true,
+		`arrayContains(tags, 'b', 'c')`:                               true,
+		`arrayContains(tags, 'c')`:                                    false,
+		`number(version) > 6`:                                         true,
+		`string(http.code) == '200'`:                                  true,
+		`http.code >= 500 and not cidrMatch(client_ip, '10.0.0.0/8')`: false,
+	}
+
+	event := &beat.Event{Fields: httpResponseTestEvent.Fields.Clone()}
+	event.Fields.Put("tags", []interface{}{"a", "b"})
+	event.Fields.Put("version", "7.9")
+
+	for expr, expected := range cases {
+		t.Run(expr, func(t *testing.T) {
+			testConfig(t, expected, event, &Config{Expr: expr})
+		})
+	}
+}
+
+func TestExprConditionErrors(t *testing.T) {
+	cases := []string{
+		``,
+		`http.code ==`,
+		`http.code == 200 200`,
+		`(http.code == 200`,
+		`status == 'OK`,
+		`${http.code == 200`,
+		`${} == 200`,
+		`status == 'OK' #`,
+		`unknown(status)`,
+		`startsWith(status)`,
+		`length(status, path)`,
+		`match(status, path)`,
+		`match(status, '(')`,
+		`cidrMatch(client_ip, 'internal')`,
+		`1.2.3 == 1`,
+	}
+
+	for _, expr := range cases {
+		t.Run(expr, func(t *testing.T) {
+			_, err := NewExprCondition(expr)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestExprConfigUnpack(t *testing.T) {
+	c, err := common.NewConfigWithYAML([]byte(`
+or:
+  - expr: "http.code >= 500"
+  - expr: "cidrMatch(client_ip, 'loopback')"
+`), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var config Config
+	if err = c.Unpack(&config); err != nil {
+		t.Fatal(err)
+	}
+	testConfig(t, true, httpResponseTestEvent, &config)
+}
+
+func TestExprConstantFolding(t *testing.T) {
+	cond, err := NewExprCondition(`startsWith('abc', 'a') and 1 + 1 == 2`)
+	if assert.NoError(t, err) {
+		assert.True(t, cond.root.constant)
+		assert.Equal(t, true, cond.root.value)
+	}
+	assert.Equal(t, "expr:(startsWith('abc', 'a') and 1 + 1 == 2)", cond.String())
+}
@@ -103,18 +103,6 @@ func NewNetworkCondition(fields map[string]interface{}) (*Network, error) {
 		log:    logp.NewLogger(logName),
 	}
 
-	makeMatcher := func(network string) (networkMatcher, error) {
-		m := singleNetworkMatcher{name: network, netContainsFunc: namedNetworks[network]}
-		if m.netContainsFunc == nil {
-			subnet, err := parseCIDR(network)
-			if err != nil {
-				return nil, err
-			}
-			m.netContainsFunc = subnet.Contains
-		}
-		return m, nil
-	}
-
 	invalidTypeError := func(field string, value interface{}) error {
 		return fmt.Errorf("network condition attempted to set "+
 			"'%v' -> '%v' and encountered unexpected type '%T', only "+
@@ -124,7 +112,7 @@ func NewNetworkCondition(fields map[string]interface{}) (*Network, error) {
 	for field, value := range common.MapStr(fields).Flatten() {
 		switch v := value.(type) {
 		case string:
-			m, err := makeMatcher(v)
+			m, err := makeNetworkMatcher(v)
 			if err != nil {
 				return nil, err
 			}
@@ -136,7 +124,7 @@ func NewNetworkCondition(fields map[string]interface{}) (*Network, error) {
 				if !ok {
 					return nil, invalidTypeError(field, networkIfc)
 				}
-				m, err := makeMatcher(network)
+				m, err := makeNetworkMatcher(network)
 				if err != nil {
 					return nil, err
 				}
@@ -191,6 +179,19 @@ func (c *Network) String() string {
 	return sb.String()
 }
 
+// makeNetworkMatcher returns a matcher for a named network or a CIDR.
+func makeNetworkMatcher(network string) (networkMatcher, error) {
+	m := singleNetworkMatcher{name: network, netContainsFunc: namedNetworks[network]}
+	if m.netContainsFunc == nil {
+		subnet, err := parseCIDR(network)
+		if err != nil {
+			return nil, err
+		}
+		m.netContainsFunc = subnet.Contains
+	}
+	return m, nil
+}
+
 // parseCIDR parses a network CIDR.
 func parseCIDR(value string) (*net.IPNet, error) {
 	_, mask, err := net.ParseCIDR(value)
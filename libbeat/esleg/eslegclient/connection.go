@@ -112,15 +112,9 @@ func NewConnection(s ConnectionSettings) (*Connection, error) {
 		tlsDialer = transport.StatsDialer(tlsDialer, st)
 	}
 
-	var encoder BodyEncoder
-	compression := s.CompressionLevel
-	if compression == 0 {
-		encoder = NewJSONEncoder(nil, s.EscapeHTML)
-	} else {
-		encoder, err = NewGzipEncoder(compression, nil, s.EscapeHTML)
-		if err != nil {
-			return nil, err
-		}
+	encoder, err := NewBodyEncoder(s.CompressionLevel, s.EscapeHTML)
+	if err != nil {
+		return nil, err
 	}
 
 	var proxy func(*http.Request) (*url.URL, error)
@@ -366,6 +360,15 @@ func (conn *Connection) Request(
 	return conn.RequestURL(method, url, body)
 }
 
+// NewBodyEncoder creates the request body encoder for the compression level.
+// Level 0 disables compression.
+func NewBodyEncoder(compressionLevel int, escapeHTML bool) (BodyEncoder, error) {
+	if compressionLevel == 0 {
+		return NewJSONEncoder(nil, escapeHTML), nil
+	}
+	return NewGzipEncoder(compressionLevel, nil, escapeHTML)
+}
+
 // RequestURL sends a request with the connection object to an alternative url
 func (conn *Connection) RequestURL(
 	method, url string,
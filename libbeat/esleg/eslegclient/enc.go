@@ -49,6 +49,10 @@ type BulkWriter interface {
 	AddRaw(raw interface{}) error
 }
 
+// EncodedItem is one or more bulk lines that are already JSON encoded,
+// including the trailing newlines. Encoders write it as is.
+type EncodedItem []byte
+
 type jsonEncoder struct {
 	buf    *bytes.Buffer
 	folder *gotype.Iterator
@@ -110,6 +114,11 @@ func (b *jsonEncoder) Marshal(obj interface{}) error {
 }
 
 func (b *jsonEncoder) AddRaw(obj interface{}) error {
+	if item, ok := obj.(EncodedItem); ok {
+		_, err := b.buf.Write(item)
+		return err
+	}
+
 	var err error
 	switch v := obj.(type) {
 	case beat.Event:
@@ -193,6 +202,11 @@ func (b *gzipEncoder) Marshal(obj interface{}) error {
 var nl = []byte("\n")
 
 func (b *gzipEncoder) AddRaw(obj interface{}) error {
+	if item, ok := obj.(EncodedItem); ok {
+		_, err := b.gzip.Write(item)
+		return err
+	}
+
 	var err error
 	switch v := obj.(type) {
 	case beat.Event:
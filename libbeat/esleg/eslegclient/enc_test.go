@@ -18,10 +18,13 @@
 package eslegclient
 
 import (
+	"compress/gzip"
+	"io/ioutil"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/common"
@@ -61,3 +64,25 @@ func TestJSONEncoderMarshalMonitoringEvent(t *testing.T) {
 	assert.Equal(t, encoder.buf.String(), "{\"timestamp\":\"2017-11-07T12:00:00.000Z\",\"field1\":\"value1\"}\n",
 		"Unexpected marshaled format of report.Event")
 }
+
+func TestEncodersWriteEncodedItems(t *testing.T) {
+	item := EncodedItem("{\"index\":{}}\n{\"field1\":\"value1\"}\n")
+	meta := map[string]interface{}{"delete": map[string]interface{}{"_id": "1"}}
+	expected := string(item) + "{\"delete\":{\"_id\":\"1\"}}\n"
+
+	jsonEnc := NewJSONEncoder(nil, false)
+	require.NoError(t, jsonEnc.AddRaw(item))
+	require.NoError(t, jsonEnc.AddRaw(meta))
+	assert.Equal(t, expected, jsonEnc.buf.String())
+
+	gzipEnc, err := NewGzipEncoder(1, nil, false)
+	require.NoError(t, err)
+	require.NoError(t, gzipEnc.AddRaw(item))
+	require.NoError(t, gzipEnc.AddRaw(meta))
+
+	r, err := gzip.NewReader(gzipEnc.Reader())
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, expected, string(body))
+}
@@ -18,6 +18,9 @@
 package idxmgmt
 
 import (
+	"fmt"
+	"net/http"
+
 	"github.com/elastic/beats/v7/libbeat/common"
 	"github.com/elastic/beats/v7/libbeat/idxmgmt/ilm"
 	"github.com/elastic/beats/v7/libbeat/template"
@@ -27,13 +30,33 @@ import (
 type ClientHandler interface {
 	ilm.ClientHandler
 	template.Loader
+	DataStreamClientHandler
+}
+
+// DataStreamClientHandler defines the interface between a remote service and
+// the Manager for data streams.
+type DataStreamClientHandler interface {
+	HasDataStream(name string) (bool, error)
+	CreateDataStream(name string) error
 }
 
 type clientHandler struct {
 	ilm.ClientHandler
 	template.Loader
+	DataStreamClientHandler
+}
+
+// esDataStreamHandler creates data streams in Elasticsearch.
+type esDataStreamHandler struct {
+	client ESClient
 }
 
+// fileDataStreamHandler ignores data streams, as data streams are created
+// when writing the first event and not exported.
+type fileDataStreamHandler struct{}
+
+var esMinDataStreamVersion = common.MustNewVersion("7.9.0")
+
 // ESClient defines the minimal interface required for the index manager to
 // prepare an index.
 type ESClient interface {
@@ -49,18 +72,62 @@ type FileClient interface {
 }
 
 // NewClientHandler initializes and returns a new instance of ClientHandler
-func NewClientHandler(ilm ilm.ClientHandler, template template.Loader) ClientHandler {
-	return &clientHandler{ilm, template}
+func NewClientHandler(
+	ilm ilm.ClientHandler,
+	template template.Loader,
+	dataStreams DataStreamClientHandler,
+) ClientHandler {
+	return &clientHandler{ilm, template, dataStreams}
 }
 
 // NewESClientHandler returns a new ESLoader instance,
 // initialized with an ilm and template client handler based on the passed in client.
 func NewESClientHandler(c ESClient) ClientHandler {
-	return NewClientHandler(ilm.NewESClientHandler(c), template.NewESLoader(c))
+	return NewClientHandler(ilm.NewESClientHandler(c), template.NewESLoader(c), &esDataStreamHandler{c})
 }
 
 // NewFileClientHandler returns a new ESLoader instance,
 // initialized with an ilm and template client handler based on the passed in client.
 func NewFileClientHandler(c FileClient) ClientHandler {
-	return NewClientHandler(ilm.NewFileClientHandler(c), template.NewFileLoader(c))
+	return NewClientHandler(ilm.NewFileClientHandler(c), template.NewFileLoader(c), fileDataStreamHandler{})
+}
+
+// HasDataStream checks if a data stream exists.
+func (h *esDataStreamHandler) HasDataStream(name string) (bool, error) {
+	if err := h.checkVersion(); err != nil {
+		return false, err
+	}
+
+	status, _, err := h.client.Request("GET", "/_data_stream/"+name, "", nil, nil)
+	if status == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check for data stream %v: %v", name, err)
+	}
+	return true, nil
+}
+
+// CreateDataStream creates a data stream. A matching index template with
+// data streams enabled must exist.
+func (h *esDataStreamHandler) CreateDataStream(name string) error {
+	if err := h.checkVersion(); err != nil {
+		return err
+	}
+
+	_, _, err := h.client.Request("PUT", "/_data_stream/"+name, "", nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create data stream %v: %v", name, err)
+	}
+	return nil
+}
+
+func (h *esDataStreamHandler) checkVersion() error {
+	if ver := h.client.GetVersion(); ver.LessThan(esMinDataStreamVersion) {
+		return fmt.Errorf("Elasticsearch %v does not support data streams", ver.String())
+	}
+	return nil
 }
+
+func (fileDataStreamHandler) HasDataStream(_ string) (bool, error) { return true, nil }
+func (fileDataStreamHandler) CreateDataStream(_ string) error      { return nil }
@@ -0,0 +1,147 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package idxmgmt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// DataStreamConfig configures the data stream events are indexed to, if
+// events do not select a data stream using the `data_stream` fields.
+type DataStreamConfig struct {
+	Enabled   bool   `config:"enabled"`
+	Type      string `config:"type"`
+	Dataset   string `config:"dataset"`
+	Namespace string `config:"namespace"`
+}
+
+// dataStreamSelector selects the data stream named
+// `<type>-<dataset>-<namespace>` for an event.
+type dataStreamSelector struct {
+	typ, dataset, namespace string
+	beatInfo                beat.Info
+}
+
+var dataStreamTypes = map[string]bool{
+	"logs":       true,
+	"metrics":    true,
+	"traces":     true,
+	"synthetics": true,
+}
+
+// invalidDataStreamChars are characters not allowed in data stream names.
+// The `-` separates the name parts and is not allowed within a part.
+const invalidDataStreamChars = `\/*?"<>| ,#:-`
+
+func defaultDataStreamConfig(info beat.Info) DataStreamConfig {
+	dataset := info.IndexPrefix
+	if dataset == "" {
+		dataset = info.Beat
+	}
+	return DataStreamConfig{
+		Enabled:   false,
+		Type:      "logs",
+		Dataset:   dataset,
+		Namespace: "default",
+	}
+}
+
+func unpackDataStreamConfig(info beat.Info, cfg *common.Config) (config DataStreamConfig, err error) {
+	config = defaultDataStreamConfig(info)
+	if cfg != nil {
+		err = cfg.Unpack(&config)
+	}
+	return config, err
+}
+
+// Validate checks the data stream name parts.
+func (c *DataStreamConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	_, err := dataStreamName(c.Type, c.Dataset, c.Namespace)
+	return err
+}
+
+// Name returns the name of the default data stream.
+func (c *DataStreamConfig) Name() string {
+	return strings.ToLower(fmt.Sprintf("%s-%s-%s", c.Type, c.Dataset, c.Namespace))
+}
+
+func dataStreamName(typ, dataset, namespace string) (string, error) {
+	typ = strings.ToLower(typ)
+	if !dataStreamTypes[typ] {
+		return "", fmt.Errorf("invalid data stream type '%v'", typ)
+	}
+
+	dataset = strings.ToLower(dataset)
+	if err := checkDataStreamPart("dataset", dataset); err != nil {
+		return "", err
+	}
+
+	namespace = strings.ToLower(namespace)
+	if err := checkDataStreamPart("namespace", namespace); err != nil {
+		return "", err
+	}
+
+	return typ + "-" + dataset + "-" + namespace, nil
+}
+
+func checkDataStreamPart(name, value string) error {
+	if value == "" {
+		return fmt.Errorf("data stream %v must not be empty", name)
+	}
+	if strings.ContainsAny(value, invalidDataStreamChars) {
+		return fmt.Errorf("data stream %v '%v' contains invalid characters", name, value)
+	}
+	return nil
+}
+
+// Select returns the data stream of an event. The type, dataset, and
+// namespace are read from the `data_stream` fields of the event, using the
+// configured values as defaults. Index overwrites in the event metadata
+// take precedence.
+func (s *dataStreamSelector) Select(evt *beat.Event) (string, error) {
+	if idx := getEventCustomIndex(evt, s.beatInfo); idx != "" {
+		return idx, nil
+	}
+
+	return dataStreamName(
+		s.eventField(evt, "data_stream.type", s.typ),
+		s.eventField(evt, "data_stream.dataset", s.dataset),
+		s.eventField(evt, "data_stream.namespace", s.namespace),
+	)
+}
+
+// CreateOnly reports that data streams only accept the `create` operation.
+func (s *dataStreamSelector) CreateOnly() bool {
+	return true
+}
+
+func (s *dataStreamSelector) eventField(evt *beat.Event, key, def string) string {
+	if v, err := evt.Fields.GetValue(key); err == nil {
+		if str, ok := v.(string); ok && str != "" {
+			return str
+		}
+	}
+	return def
+}
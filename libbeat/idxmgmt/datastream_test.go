@@ -0,0 +1,297 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package idxmgmt
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/idxmgmt/ilm"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/template"
+)
+
+func TestDataStreamSelector(t *testing.T) {
+	cases := map[string]struct {
+		fields common.MapStr
+		want   string
+		err    bool
+	}{
+		"defaults": {
+			want: "logs-test-default",
+		},
+		"event fields": {
+			fields: common.MapStr{"data_stream": common.MapStr{
+				"type":      "metrics",
+				"dataset":   "nginx.stubstatus",
+				"namespace": "Prod",
+			}},
+			want: "metrics-nginx.stubstatus-prod",
+		},
+		"partial event fields": {
+			fields: common.MapStr{"data_stream.namespace": "staging"},
+			want:   "logs-test-staging",
+		},
+		"non string fields are ignored": {
+			fields: common.MapStr{"data_stream.dataset": 1},
+			want:   "logs-test-default",
+		},
+		"invalid type": {
+			fields: common.MapStr{"data_stream.type": "events"},
+			err:    true,
+		},
+		"invalid dataset": {
+			fields: common.MapStr{"data_stream.dataset": "a-b"},
+			err:    true,
+		},
+		"invalid namespace": {
+			fields: common.MapStr{"data_stream.namespace": "a*"},
+			err:    true,
+		},
+	}
+
+	for name, test := range cases {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			info := beat.Info{Beat: "test", Version: "9.9.9"}
+			im, err := MakeDefaultSupport(ilm.StdSupport)(nil, info, common.MustNewConfigFrom(map[string]interface{}{
+				"setup.data_stream.enabled": true,
+			}))
+			require.NoError(t, err)
+
+			sel, err := im.BuildSelector(common.NewConfig())
+			require.NoError(t, err)
+
+			createOnly, ok := sel.(outputs.CreateOnlySelector)
+			require.True(t, ok)
+			assert.True(t, createOnly.CreateOnly())
+
+			fields := test.fields
+			if fields == nil {
+				fields = common.MapStr{}
+			}
+			idx, err := sel.Select(&beat.Event{Fields: fields})
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, idx)
+		})
+	}
+}
+
+func TestDataStreamConfigInvalid(t *testing.T) {
+	cases := map[string]map[string]interface{}{
+		"unknown type":    {"type": "events"},
+		"empty dataset":   {"dataset": ""},
+		"dash in dataset": {"dataset": "my-app"},
+		"empty namespace": {"namespace": ""},
+	}
+
+	for name, cfg := range cases {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			cfg["enabled"] = true
+			info := beat.Info{Beat: "test", Version: "9.9.9"}
+			_, err := MakeDefaultSupport(ilm.StdSupport)(nil, info, common.MustNewConfigFrom(map[string]interface{}{
+				"setup.data_stream": cfg,
+			}))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestIndexManager_SetupDataStream(t *testing.T) {
+	cases := map[string]struct {
+		cfg                   common.MapStr
+		loadTemplate, loadILM LoadMode
+		existing              string
+
+		componentSettings map[string]interface{}
+		templateName      string
+		pattern           string
+		policy            string
+		dataStream        string
+		ops               []mockCreateOp
+	}{
+		"default": {
+			componentSettings: map[string]interface{}{"lifecycle": map[string]interface{}{"name": "test"}},
+			templateName:      "logs-test",
+			pattern:           "logs-test-*",
+			policy:            "test",
+			dataStream:        "logs-test-default",
+			ops:               []mockCreateOp{mockCreatePolicy, mockCreateTemplate, mockCreateTemplate, mockCreateDataStream},
+		},
+		"ilm disabled": {
+			cfg:          common.MapStr{"setup.ilm.enabled": false},
+			templateName: "logs-test",
+			pattern:      "logs-test-*",
+			dataStream:   "logs-test-default",
+			ops:          []mockCreateOp{mockCreateTemplate, mockCreateTemplate, mockCreateDataStream},
+		},
+		"custom data stream and template name": {
+			cfg: common.MapStr{
+				"setup.ilm.enabled":           false,
+				"setup.data_stream.type":      "metrics",
+				"setup.data_stream.dataset":   "app",
+				"setup.data_stream.namespace": "prod",
+				"setup.template.name":         "metrics-app-custom",
+				"setup.template.pattern":      "metrics-app*-*",
+			},
+			templateName: "metrics-app-custom",
+			pattern:      "metrics-app*-*",
+			dataStream:   "metrics-app-prod",
+			ops:          []mockCreateOp{mockCreateTemplate, mockCreateTemplate, mockCreateDataStream},
+		},
+		"template for all datasets": {
+			cfg: common.MapStr{
+				"setup.ilm.enabled":      false,
+				"setup.template.pattern": "logs-*-*",
+			},
+			templateName: "logs-test",
+			pattern:      "logs-*-*",
+			dataStream:   "logs-test-default",
+			ops:          []mockCreateOp{mockCreateTemplate, mockCreateTemplate, mockCreateDataStream},
+		},
+		"data stream exists": {
+			cfg:          common.MapStr{"setup.ilm.enabled": false},
+			existing:     "logs-test-default",
+			templateName: "logs-test",
+			pattern:      "logs-test-*",
+			dataStream:   "logs-test-default",
+			ops:          []mockCreateOp{mockCreateTemplate, mockCreateTemplate},
+		},
+		"template loading disabled": {
+			cfg:          common.MapStr{"setup.ilm.enabled": false},
+			loadTemplate: LoadModeDisabled,
+		},
+	}
+
+	for name, test := range cases {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			cfg := common.MustNewConfigFrom(map[string]interface{}{"setup.data_stream.enabled": true})
+			require.NoError(t, cfg.Merge(common.MustNewConfigFrom(test.cfg)))
+
+			info := beat.Info{Beat: "test", Version: "9.9.9"}
+			im, err := MakeDefaultSupport(ilm.StdSupport)(nil, info, cfg)
+			require.NoError(t, err)
+
+			clientHandler := newMockClientHandler()
+			clientHandler.dataStream = test.existing
+			manager := im.Manager(clientHandler, BeatsAssets([]byte("testbeat fields")))
+			require.NoError(t, manager.Setup(test.loadTemplate, test.loadILM))
+			clientHandler.assertInvariants(t)
+
+			assert.Equal(t, test.ops, clientHandler.operations)
+			assert.Equal(t, test.policy, clientHandler.policy)
+			assert.Equal(t, test.dataStream, clientHandler.dataStream)
+			assert.Equal(t, "", clientHandler.alias)
+			if test.templateName == "" {
+				assert.Empty(t, clientHandler.tmplCfgs)
+				return
+			}
+
+			require.Len(t, clientHandler.tmplCfgs, 2)
+			component, index := clientHandler.tmplCfgs[0], clientHandler.tmplCfgs[1]
+
+			assert.Equal(t, template.IndexTemplateComponent, component.Type)
+			assert.Equal(t, test.templateName+"-mappings", component.Name)
+			assert.Equal(t, test.componentSettings, component.Settings.Index)
+
+			assert.Equal(t, template.IndexTemplateIndex, index.Type)
+			assert.Equal(t, test.templateName, index.Name)
+			assert.Equal(t, test.pattern, index.Pattern)
+			assert.Equal(t, []string{test.templateName + "-mappings"}, index.ComposedOf)
+			assert.True(t, index.DataStream)
+		})
+	}
+}
+
+type mockESClient struct {
+	version  common.Version
+	status   map[string]int
+	requests []string
+}
+
+func (c *mockESClient) GetVersion() common.Version { return c.version }
+
+func (c *mockESClient) Request(method, path string, _ string, _ map[string]string, _ interface{}) (int, []byte, error) {
+	req := method + " " + path
+	c.requests = append(c.requests, req)
+	status, ok := c.status[req]
+	if !ok {
+		status = http.StatusOK
+	}
+	if status >= 300 {
+		return status, nil, errors.New(http.StatusText(status))
+	}
+	return status, nil, nil
+}
+
+func TestESDataStreamHandler(t *testing.T) {
+	t.Run("create", func(t *testing.T) {
+		client := &mockESClient{
+			version: *common.MustNewVersion("7.10.0"),
+			status:  map[string]int{"GET /_data_stream/logs-test-default": http.StatusNotFound},
+		}
+		h := NewESClientHandler(client)
+
+		exists, err := h.HasDataStream("logs-test-default")
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		require.NoError(t, h.CreateDataStream("logs-test-default"))
+		assert.Equal(t, []string{
+			"GET /_data_stream/logs-test-default",
+			"PUT /_data_stream/logs-test-default",
+		}, client.requests)
+	})
+
+	t.Run("exists", func(t *testing.T) {
+		h := NewESClientHandler(&mockESClient{version: *common.MustNewVersion("7.10.0")})
+		exists, err := h.HasDataStream("logs-test-default")
+		require.NoError(t, err)
+		assert.True(t, exists)
+	})
+
+	t.Run("request fails", func(t *testing.T) {
+		h := NewESClientHandler(&mockESClient{
+			version: *common.MustNewVersion("7.10.0"),
+			status:  map[string]int{"PUT /_data_stream/logs-test-default": http.StatusBadRequest},
+		})
+		assert.Error(t, h.CreateDataStream("logs-test-default"))
+	})
+
+	t.Run("unsupported version", func(t *testing.T) {
+		client := &mockESClient{version: *common.MustNewVersion("7.8.0")}
+		h := NewESClientHandler(client)
+
+		_, err := h.HasDataStream("logs-test-default")
+		assert.Error(t, err)
+		assert.Error(t, h.CreateDataStream("logs-test-default"))
+		assert.Empty(t, client.requests)
+	})
+}
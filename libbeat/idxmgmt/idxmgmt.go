@@ -108,10 +108,11 @@ func MakeDefaultSupport(ilmSupport ilm.SupportFactory) SupportFactory {
 		const logName = "index-management"
 
 		cfg := struct {
-			ILM       *common.Config         `config:"setup.ilm"`
-			Template  *common.Config         `config:"setup.template"`
-			Output    common.ConfigNamespace `config:"output"`
-			Migration *common.Config         `config:"migration.6_to_7"`
+			ILM        *common.Config         `config:"setup.ilm"`
+			Template   *common.Config         `config:"setup.template"`
+			DataStream *common.Config         `config:"setup.data_stream"`
+			Output     common.ConfigNamespace `config:"output"`
+			Migration  *common.Config         `config:"migration.6_to_7"`
 		}{}
 		if configRoot != nil {
 			if err := configRoot.Unpack(&cfg); err != nil {
@@ -125,11 +126,19 @@ func MakeDefaultSupport(ilmSupport ilm.SupportFactory) SupportFactory {
 			log = log.Named(logName)
 		}
 
-		if err := checkTemplateESSettings(cfg.Template, cfg.Output); err != nil {
+		dataStream, err := unpackDataStreamConfig(info, cfg.DataStream)
+		if err != nil {
 			return nil, err
 		}
 
-		return newIndexSupport(log, info, ilmSupport, cfg.Template, cfg.ILM, cfg.Migration.Enabled())
+		// The output index is not used with data streams.
+		if !dataStream.Enabled {
+			if err := checkTemplateESSettings(cfg.Template, cfg.Output); err != nil {
+				return nil, err
+			}
+		}
+
+		return newIndexSupport(log, info, ilmSupport, cfg.Template, cfg.ILM, dataStream, cfg.Migration.Enabled())
 	}
 }
 
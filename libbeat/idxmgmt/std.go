@@ -39,6 +39,7 @@ type indexSupport struct {
 	info         beat.Info
 	migration    bool
 	templateCfg  template.TemplateConfig
+	dataStream   DataStreamConfig
 	defaultIndex string
 
 	st indexState
@@ -101,6 +102,7 @@ func newIndexSupport(
 	ilmFactory ilm.SupportFactory,
 	tmplConfig *common.Config,
 	ilmConfig *common.Config,
+	dataStream DataStreamConfig,
 	migration bool,
 ) (*indexSupport, error) {
 	if ilmFactory == nil {
@@ -122,13 +124,14 @@ func newIndexSupport(
 		ilm:          ilmSupporter,
 		info:         info,
 		templateCfg:  tmplCfg,
+		dataStream:   dataStream,
 		migration:    migration,
 		defaultIndex: fmt.Sprintf("%v-%v-%%{+yyyy.MM.dd}", info.IndexPrefix, info.Version),
 	}, nil
 }
 
 func (s *indexSupport) Enabled() bool {
-	return s.enabled(componentTemplate) || s.enabled(componentILM)
+	return s.enabled(componentTemplate) || s.enabled(componentILM) || s.dataStream.Enabled
 }
 
 func (s *indexSupport) enabled(c componentType) bool {
@@ -157,6 +160,18 @@ func (s *indexSupport) BuildSelector(cfg *common.Config) (outputs.IndexSelector,
 	var err error
 	log := s.log
 
+	if s.dataStream.Enabled {
+		if cfg.HasField("index") || cfg.HasField("indices") {
+			log.Infof("Ignoring %v as data streams are enabled.", cfg.PathOf("index"))
+		}
+		return &dataStreamSelector{
+			typ:       s.dataStream.Type,
+			dataset:   s.dataStream.Dataset,
+			namespace: s.dataStream.Namespace,
+			beatInfo:  s.info,
+		}, nil
+	}
+
 	// we construct our own configuration object based on the available settings
 	// in cfg and defaultIndex. The configuration object provided must not be
 	// modified.
@@ -251,6 +266,10 @@ func (m *indexManager) VerifySetup(loadTemplate, loadILM LoadMode) (bool, string
 
 //
 func (m *indexManager) Setup(loadTemplate, loadILM LoadMode) error {
+	if m.support.dataStream.Enabled {
+		return m.setupDataStream(loadTemplate, loadILM)
+	}
+
 	log := m.support.log
 
 	withILM, err := m.setupWithILM()
@@ -313,6 +332,82 @@ func (m *indexManager) Setup(loadTemplate, loadILM LoadMode) error {
 	return nil
 }
 
+// setupDataStream installs the ILM policy, a component template with the
+// mappings and settings, and a data stream index template composed of it.
+// It then bootstraps the default data stream. Data streams selected by events
+// are created by Elasticsearch when indexing the first event.
+func (m *indexManager) setupDataStream(loadTemplate, loadILM LoadMode) error {
+	log := m.support.log
+
+	withILM, err := m.setupWithILM()
+	if err != nil {
+		return err
+	}
+
+	ilmComponent := newFeature(componentILM, withILM, m.support.ilm.Overwrite(), loadILM)
+	templateComponent := newFeature(componentTemplate, m.support.enabled(componentTemplate),
+		m.support.templateCfg.Overwrite, loadTemplate)
+
+	if ilmComponent.load {
+		policyCreated, err := m.ilm.EnsurePolicy(ilmComponent.overwrite)
+		if err != nil {
+			return err
+		}
+		log.Info("ILM policy successfully loaded.")
+
+		if policyCreated && templateComponent.enabled {
+			templateComponent.overwrite = true
+		}
+	}
+
+	if !templateComponent.load {
+		return nil
+	}
+
+	tmplCfg := m.support.templateCfg
+	tmplCfg.Overwrite, tmplCfg.Enabled = templateComponent.overwrite, templateComponent.enabled
+
+	var policy *ilm.Policy
+	if ilmComponent.enabled {
+		p := m.support.ilm.Policy()
+		policy = &p
+	}
+	componentCfg, indexCfg, err := dataStreamTemplates(tmplCfg, m.support.dataStream, policy)
+	if err != nil {
+		return err
+	}
+
+	fields := m.assets.Fields(m.support.info.Beat)
+	if !indexCfg.JSON.Enabled {
+		err = m.clientHandler.Load(componentCfg, m.support.info, fields, m.support.migration)
+		if err != nil {
+			return fmt.Errorf("error loading component template: %v", err)
+		}
+		log.Infof("Loaded component template %v.", componentCfg.Name)
+	}
+
+	err = m.clientHandler.Load(indexCfg, m.support.info, fields, m.support.migration)
+	if err != nil {
+		return fmt.Errorf("error loading index template: %v", err)
+	}
+	log.Infof("Loaded data stream index template %v.", indexCfg.Name)
+
+	name := m.support.dataStream.Name()
+	exists, err := m.clientHandler.HasDataStream(name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		log.Infof("Data stream %v exists already.", name)
+		return nil
+	}
+	if err := m.clientHandler.CreateDataStream(name); err != nil {
+		return err
+	}
+	log.Infof("Data stream %v successfully created.", name)
+	return nil
+}
+
 func (m *indexManager) setupWithILM() (bool, error) {
 	var err error
 	withILM := m.support.st.withILM.Load()
@@ -413,7 +508,81 @@ func applyILMSettings(
 	}
 
 	// rollover_alias and lifecycle.name can't be configured and will be overwritten
+	lifecycle, err := copyLifecycleSettings(&tmpl)
+	if err != nil {
+		return tmpl, err
+	}
 
+	// add rollover_alias and name to index.lifecycle settings
+	if _, exists := lifecycle["rollover_alias"]; !exists {
+		log.Infof("Set settings.index.lifecycle.rollover_alias in template to %s as ILM is enabled.", alias)
+		lifecycle["rollover_alias"] = alias.Name
+	}
+	if _, exists := lifecycle["name"]; !exists {
+		log.Infof("Set settings.index.lifecycle.name in template to %s as ILM is enabled.", policy)
+		lifecycle["name"] = policy.Name
+	}
+
+	return tmpl, nil
+}
+
+// dataStreamTemplates creates the configurations of the component template
+// holding the mappings and settings, and of the index template enabling data
+// streams for the configured data stream type and dataset. The templates are
+// named `<type>-<dataset>` and `<type>-<dataset>-mappings`, unless a
+// template name is configured.
+//
+// The default pattern only matches the configured dataset. Data streams of
+// other datasets selected by events rely on the templates installed in
+// Elasticsearch, like the built-in `logs-*-*` and `metrics-*-*` templates,
+// unless the pattern is configured to match them.
+func dataStreamTemplates(
+	tmpl template.TemplateConfig,
+	dataStream DataStreamConfig,
+	policy *ilm.Policy,
+) (component, index template.TemplateConfig, err error) {
+	name := tmpl.Name
+	if name == "" {
+		name = strings.ToLower(dataStream.Type + "-" + dataStream.Dataset)
+	}
+	pattern := tmpl.Pattern
+	if pattern == "" {
+		pattern = name + "-*"
+	}
+
+	component = tmpl
+	component.Type = template.IndexTemplateComponent
+	component.Name = name + "-mappings"
+	component.Pattern = pattern
+	if policy != nil {
+		if policy.Name == "" {
+			return component, index, errors.New("no ilm policy name configured")
+		}
+
+		lifecycle, err := copyLifecycleSettings(&component)
+		if err != nil {
+			return component, index, err
+		}
+		if _, exists := lifecycle["name"]; !exists {
+			lifecycle["name"] = policy.Name
+		}
+	}
+
+	index = tmpl
+	index.Type = template.IndexTemplateIndex
+	index.Name = name
+	index.Pattern = pattern
+	index.Fields = ""
+	index.AppendFields = nil
+	index.Settings = template.TemplateSettings{}
+	index.ComposedOf = []string{component.Name}
+	index.DataStream = true
+	return component, index, nil
+}
+
+// copyLifecycleSettings copies the index settings of a template config and
+// returns a copy of its index.lifecycle settings, that can be modified.
+func copyLifecycleSettings(tmpl *template.TemplateConfig) (map[string]interface{}, error) {
 	// init/copy index settings
 	idxSettings := tmpl.Settings.Index
 	if idxSettings == nil {
@@ -437,19 +606,8 @@ func applyILMSettings(
 			lifecycle[k] = v
 		}
 	} else {
-		return tmpl, errors.New("settings.index.lifecycle must be an object")
+		return nil, errors.New("settings.index.lifecycle must be an object")
 	}
 	idxSettings["lifecycle"] = lifecycle
-
-	// add rollover_alias and name to index.lifecycle settings
-	if _, exists := lifecycle["rollover_alias"]; !exists {
-		log.Infof("Set settings.index.lifecycle.rollover_alias in template to %s as ILM is enabled.", alias)
-		lifecycle["rollover_alias"] = alias.Name
-	}
-	if _, exists := lifecycle["name"]; !exists {
-		log.Infof("Set settings.index.lifecycle.name in template to %s as ILM is enabled.", policy)
-		lifecycle["name"] = policy.Name
-	}
-
-	return tmpl, nil
+	return lifecycle, nil
 }
@@ -37,8 +37,11 @@ type mockClientHandler struct {
 	expectsPolicy bool
 
 	tmplCfg   *template.TemplateConfig
+	tmplCfgs  []template.TemplateConfig
 	tmplForce bool
 
+	dataStream string
+
 	operations []mockCreateOp
 }
 
@@ -48,6 +51,7 @@ const (
 	mockCreatePolicy mockCreateOp = iota
 	mockCreateTemplate
 	mockCreateAlias
+	mockCreateDataStream
 )
 
 func TestDefaultSupport_Enabled(t *testing.T) {
@@ -220,6 +224,32 @@ func TestDefaultSupport_BuildSelector(t *testing.T) {
 			},
 			want: stable("myindex"),
 		},
+		"data stream": {
+			ilmCalls: noILM,
+			imCfg:    map[string]interface{}{"setup.data_stream.enabled": true},
+			cfg:      map[string]interface{}{"index": "test-%{[agent.version]}"},
+			want:     stable("logs-test-default"),
+		},
+		"data stream configured": {
+			ilmCalls: noILM,
+			imCfg: map[string]interface{}{
+				"setup.data_stream": map[string]interface{}{
+					"enabled":   true,
+					"type":      "metrics",
+					"dataset":   "system.cpu",
+					"namespace": "Prod",
+				},
+			},
+			want: stable("metrics-system.cpu-prod"),
+		},
+		"data stream event alias": {
+			ilmCalls: noILM,
+			imCfg:    map[string]interface{}{"setup.data_stream.enabled": true},
+			want:     stable("logs-other-default"),
+			meta: common.MapStr{
+				"alias": "logs-other-default",
+			},
+		},
 		"use indices settings must be lowercase": {
 			ilmCalls: ilmTemplateSettings("test-9.9.9", "test-9.9.9"),
 			cfg: map[string]interface{}{
@@ -494,7 +524,7 @@ func TestIndexManager_Setup(t *testing.T) {
 }
 
 func (op mockCreateOp) String() string {
-	names := []string{"create-policy", "create-template", "create-alias"}
+	names := []string{"create-policy", "create-template", "create-alias", "create-data-stream"}
 	if int(op) > len(names) {
 		return "unknown"
 	}
@@ -509,6 +539,17 @@ func (h *mockClientHandler) Load(config template.TemplateConfig, _ beat.Info, fi
 	h.recordOp(mockCreateTemplate)
 	h.tmplForce = config.Overwrite
 	h.tmplCfg = &config
+	h.tmplCfgs = append(h.tmplCfgs, config)
+	return nil
+}
+
+func (h *mockClientHandler) HasDataStream(name string) (bool, error) {
+	return h.dataStream == name, nil
+}
+
+func (h *mockClientHandler) CreateDataStream(name string) error {
+	h.recordOp(mockCreateDataStream)
+	h.dataStream = name
 	return nil
 }
 
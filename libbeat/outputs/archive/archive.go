@@ -0,0 +1,422 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+)
+
+func init() {
+	outputs.RegisterType("archive", makeArchive)
+}
+
+type archiveOutput struct {
+	log       *logp.Logger
+	beat      beat.Info
+	observer  outputs.Observer
+	codec     codec.Codec
+	partition *fmtstr.EventFormatString
+	manifest  *manifest
+
+	root          string
+	prefix        string
+	maxSize       int64
+	closeInactive time.Duration
+	checkInterval time.Duration
+	compression   string
+	retention     retentionConfig
+	perm          os.FileMode
+
+	mu     sync.Mutex
+	active map[string]*activeFile
+	seq    uint64
+	now    func() time.Time
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// makeArchive instantiates a new archive output instance.
+func makeArchive(
+	_ outputs.IndexManager,
+	beat beat.Info,
+	observer outputs.Observer,
+	cfg *common.Config,
+) (outputs.Group, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return outputs.Fail(err)
+	}
+
+	// disable bulk support in publisher pipeline
+	cfg.SetInt("bulk_max_size", -1, -1)
+
+	out, err := newArchiveOutput(beat, observer, config)
+	if err != nil {
+		return outputs.Fail(err)
+	}
+	out.start()
+
+	return outputs.Success(-1, 0, out)
+}
+
+func newArchiveOutput(beat beat.Info, observer outputs.Observer, c config) (*archiveOutput, error) {
+	enc, err := codec.CreateEncoder(beat, c.Codec)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := c.Prefix
+	if prefix == "" {
+		prefix = beat.Beat
+	}
+
+	out := &archiveOutput{
+		log:           logp.NewLogger("archive"),
+		beat:          beat,
+		observer:      observer,
+		codec:         enc,
+		partition:     c.Partition,
+		root:          c.Path,
+		prefix:        prefix,
+		maxSize:       int64(c.RotateEveryKb) * 1024,
+		closeInactive: c.CloseInactive,
+		checkInterval: c.CheckInterval,
+		compression:   c.Compression,
+		retention:     c.Retention,
+		perm:          os.FileMode(c.Permissions),
+		active:        map[string]*activeFile{},
+		now:           time.Now,
+		done:          make(chan struct{}),
+	}
+	out.manifest = newManifest(c.Path, out.perm)
+
+	if err := os.MkdirAll(c.Path, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory %v: %w", c.Path, err)
+	}
+	if err := out.recover(); err != nil {
+		return nil, fmt.Errorf("failed to recover partial archive files: %w", err)
+	}
+
+	out.log.Infof("Initialized archive output. "+
+		"path=%v max_size_bytes=%v compression=%v retention.max_age=%v retention.max_size=%v",
+		c.Path, out.maxSize, c.Compression, c.Retention.MaxAge, c.Retention.MaxSize)
+
+	return out, nil
+}
+
+// recover finalizes partial files left behind by a previous run that did not
+// shut down cleanly, and removes incomplete compression output.
+func (out *archiveOutput) recover() error {
+	var partials []string
+	err := filepath.Walk(out.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.IsDir():
+		case strings.HasSuffix(path, tmpExt):
+			return os.Remove(path)
+		case strings.HasSuffix(path, dataExt+partialExt):
+			partials = append(partials, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, path := range partials {
+		events, err := countLines(path)
+		if err != nil {
+			return err
+		}
+		if events == 0 {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			continue
+		}
+
+		partition, err := filepath.Rel(out.root, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		out.log.Infof("Recovering partial archive file %v with %d events", path, events)
+		if err := out.finalize(path, partition, events, time.Time{}, time.Time{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (out *archiveOutput) start() {
+	out.wg.Add(1)
+	go func() {
+		defer out.wg.Done()
+
+		ticker := time.NewTicker(out.checkInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-out.done:
+				return
+			case <-ticker.C:
+				out.maintain()
+			}
+		}
+	}()
+}
+
+// maintain closes inactive files and enforces the retention limits.
+func (out *archiveOutput) maintain() {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+
+	now := out.now()
+	for partition, f := range out.active {
+		if now.Sub(f.lastWrite) >= out.closeInactive {
+			out.closeFile(f)
+			delete(out.active, partition)
+		}
+	}
+
+	if err := out.enforceRetention(now); err != nil {
+		out.log.Errorf("Failed to enforce archive retention: %+v", err)
+	}
+}
+
+func (out *archiveOutput) enforceRetention(now time.Time) error {
+	if out.retention.MaxAge <= 0 && out.retention.MaxSize <= 0 {
+		return nil
+	}
+
+	files, err := listArchiveFiles(out.root)
+	if err != nil {
+		return err
+	}
+
+	removed := map[string]bool{}
+	for _, f := range expiredFiles(files, now, out.retention.MaxAge, int64(out.retention.MaxSize)) {
+		path := filepath.Join(out.root, filepath.FromSlash(f.rel))
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			out.log.Errorf("Failed to remove expired archive file %v: %+v", path, err)
+			continue
+		}
+		out.log.Debugf("Removed expired archive file %v", path)
+		removed[f.rel] = true
+		removeEmptyDirs(out.root, filepath.Dir(path))
+	}
+
+	return out.manifest.remove(removed)
+}
+
+func (out *archiveOutput) Close() error {
+	close(out.done)
+	out.wg.Wait()
+
+	out.mu.Lock()
+	defer out.mu.Unlock()
+
+	for partition, f := range out.active {
+		out.closeFile(f)
+		delete(out.active, partition)
+	}
+	return nil
+}
+
+func (out *archiveOutput) Publish(_ context.Context, batch publisher.Batch) error {
+	defer batch.ACK()
+
+	st := out.observer
+	events := batch.Events()
+	st.NewBatch(len(events))
+
+	out.mu.Lock()
+	defer out.mu.Unlock()
+
+	dropped := 0
+	for i := range events {
+		event := &events[i]
+
+		partition, err := out.partitionOf(&event.Content)
+		if err != nil {
+			out.logEventError(event, "Failed to select the archive partition", err)
+			dropped++
+			continue
+		}
+
+		serializedEvent, err := out.codec.Encode(out.beat.Beat, &event.Content)
+		if err != nil {
+			out.logEventError(event, "Failed to serialize the event", err)
+			out.log.Debugf("Failed event: %v", event)
+			dropped++
+			continue
+		}
+		line := append(serializedEvent, '\n')
+
+		if err := out.write(partition, line, event.Content.Timestamp); err != nil {
+			st.WriteError(err)
+			out.logEventError(event, "Writing event to archive failed", err)
+			dropped++
+			continue
+		}
+
+		st.WriteBytes(len(line))
+	}
+
+	st.Dropped(dropped)
+	st.Acked(len(events) - dropped)
+
+	return nil
+}
+
+func (out *archiveOutput) write(partition string, line []byte, ts time.Time) error {
+	f := out.active[partition]
+	if f != nil && f.events > 0 && f.size+int64(len(line)) > out.maxSize {
+		out.closeFile(f)
+		delete(out.active, partition)
+		f = nil
+	}
+
+	if f == nil {
+		var err error
+		if f, err = out.openFile(partition); err != nil {
+			return err
+		}
+		out.active[partition] = f
+	}
+
+	return f.write(line, ts, out.now())
+}
+
+func (out *archiveOutput) openFile(partition string) (*activeFile, error) {
+	stamp := out.now().UTC().Format("20060102T150405")
+	dir := filepath.Join(out.root, partition)
+
+	for {
+		out.seq++
+		name := fmt.Sprintf("%s-%s-%d", out.prefix, stamp, out.seq)
+
+		if _, err := os.Stat(filepath.Join(dir, name+dataExt+compressionExt(out.compression))); err == nil {
+			continue
+		}
+
+		f, err := createActiveFile(out.root, partition, name, out.perm)
+		if os.IsExist(err) {
+			continue
+		}
+		return f, err
+	}
+}
+
+// closeFile closes the active file and moves it into the archive. Errors are
+// logged, the partial file stays on disk and is recovered on the next start.
+func (out *archiveOutput) closeFile(f *activeFile) {
+	if err := f.close(); err != nil {
+		out.observer.WriteError(err)
+		out.log.Errorf("Failed to close archive file %v: %+v", f.path, err)
+		return
+	}
+
+	if err := out.finalize(f.path, f.partition, f.events, f.first, f.last); err != nil {
+		out.observer.WriteError(err)
+		out.log.Errorf("Failed to finalize archive file %v: %+v", f.path, err)
+	}
+}
+
+func (out *archiveOutput) finalize(path, partition string, events int, first, last time.Time) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	final, size, sum, err := finalizeFile(path, out.compression, out.perm)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(out.root, final)
+	if err != nil {
+		return err
+	}
+
+	entry := manifestEntry{
+		File:        filepath.ToSlash(rel),
+		Partition:   filepath.ToSlash(partition),
+		Events:      events,
+		Size:        size,
+		RawSize:     info.Size(),
+		SHA256:      sum,
+		Compression: out.compression,
+		Closed:      out.now().UTC(),
+	}
+	if !first.IsZero() {
+		first, last := first.UTC(), last.UTC()
+		entry.FirstEvent, entry.LastEvent = &first, &last
+	}
+	return out.manifest.append(entry)
+}
+
+// partitionOf returns the directory, relative to the archive root, the event
+// is written to. Partitions must stay within the archive root.
+func (out *archiveOutput) partitionOf(event *beat.Event) (string, error) {
+	s, err := out.partition.Run(event)
+	if err != nil {
+		return "", err
+	}
+
+	partition := filepath.Clean(filepath.FromSlash(strings.TrimSpace(s)))
+	switch {
+	case partition == "." || partition == "":
+		return "", errors.New("partition is empty")
+	case filepath.IsAbs(partition),
+		partition == "..",
+		strings.HasPrefix(partition, ".."+string(filepath.Separator)):
+		return "", fmt.Errorf("partition '%v' is outside of the archive path", s)
+	}
+	return partition, nil
+}
+
+func (out *archiveOutput) logEventError(event *publisher.Event, msg string, err error) {
+	if event.Guaranteed() {
+		out.log.Errorf("%s: %+v", msg, err)
+	} else {
+		out.log.Warnf("%s: %+v", msg, err)
+	}
+}
+
+func (out *archiveOutput) String() string {
+	return "archive(" + out.root + ")"
+}
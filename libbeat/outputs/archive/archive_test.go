@@ -0,0 +1,383 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// +build !integration
+
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	_ "github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+)
+
+var testTime = time.Date(2020, 10, 18, 12, 30, 0, 0, time.UTC)
+
+func TestPublishPartitions(t *testing.T) {
+	for _, compression := range []string{compressionNone, compressionGzip, compressionZstd} {
+		compression := compression
+		t.Run(compression, func(t *testing.T) {
+			dir := tempDir(t)
+			out := newTestOutput(t, map[string]interface{}{
+				"path":        dir,
+				"partition":   "%{[dataset]:unknown}/%{+yyyy.MM.dd}",
+				"compression": compression,
+			})
+
+			batch := outest.NewBatch(
+				testEvent(testTime, common.MapStr{"dataset": "nginx.access", "n": 1}),
+				testEvent(testTime.Add(time.Second), common.MapStr{"dataset": "nginx.access", "n": 2}),
+				testEvent(testTime.Add(24*time.Hour), common.MapStr{"dataset": "nginx.access", "n": 3}),
+				testEvent(testTime, common.MapStr{"n": 4}),
+			)
+			require.NoError(t, out.Publish(context.Background(), batch))
+			require.NoError(t, out.Close())
+
+			entries, err := out.manifest.read()
+			require.NoError(t, err)
+			require.Len(t, entries, 3)
+
+			events := map[string]int{}
+			for _, entry := range entries {
+				events[entry.Partition] = entry.Events
+				assert.Equal(t, compression, entry.Compression)
+				assert.Equal(t, entry.Partition, filepath.ToSlash(filepath.Dir(entry.File)))
+				assert.True(t, strings.HasSuffix(entry.File, dataExt+compressionExt(compression)))
+
+				path := filepath.Join(dir, filepath.FromSlash(entry.File))
+				size, sum, err := hashFile(path)
+				require.NoError(t, err)
+				assert.Equal(t, size, entry.Size)
+				assert.Equal(t, sum, entry.SHA256)
+
+				lines := readLines(t, path, compression)
+				assert.Len(t, lines, entry.Events)
+				assert.Equal(t, entry.RawSize, int64(len(strings.Join(lines, "\n"))+1))
+			}
+			assert.Equal(t, map[string]int{
+				"nginx.access/2020.10.18": 2,
+				"nginx.access/2020.10.19": 1,
+				"unknown/2020.10.18":      1,
+			}, events)
+
+			for _, entry := range entries {
+				if entry.Partition == "nginx.access/2020.10.18" {
+					assert.Equal(t, testTime, *entry.FirstEvent)
+					assert.Equal(t, testTime.Add(time.Second), *entry.LastEvent)
+				}
+			}
+		})
+	}
+}
+
+func TestPublishRotatesBySize(t *testing.T) {
+	dir := tempDir(t)
+	out := newTestOutput(t, map[string]interface{}{
+		"path":            dir,
+		"rotate_every_kb": 1,
+	})
+
+	var events []beat.Event
+	for i := 0; i < 100; i++ {
+		events = append(events, testEvent(testTime, common.MapStr{"message": strings.Repeat("x", 100)}))
+	}
+	require.NoError(t, out.Publish(context.Background(), outest.NewBatch(events...)))
+	require.NoError(t, out.Close())
+
+	entries, err := out.manifest.read()
+	require.NoError(t, err)
+	require.True(t, len(entries) > 1)
+
+	total := 0
+	for _, entry := range entries {
+		assert.True(t, entry.RawSize <= 1024, "file %v exceeds the size limit", entry.File)
+		total += entry.Events
+	}
+	assert.Equal(t, 100, total)
+}
+
+func TestPublishDropsInvalidPartitions(t *testing.T) {
+	dir := tempDir(t)
+	out := newTestOutput(t, map[string]interface{}{
+		"path":      dir,
+		"partition": "%{[dataset]}",
+	})
+
+	batch := outest.NewBatch(
+		testEvent(testTime, common.MapStr{"dataset": "../escape"}),
+		testEvent(testTime, common.MapStr{"dataset": "/absolute"}),
+		testEvent(testTime, common.MapStr{}),
+		testEvent(testTime, common.MapStr{"dataset": "ok"}),
+	)
+	require.NoError(t, out.Publish(context.Background(), batch))
+	require.NoError(t, out.Close())
+
+	assert.Equal(t, []outest.BatchSignal{{Tag: outest.BatchACK}}, batch.Signals)
+
+	entries, err := out.manifest.read()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "ok", entries[0].Partition)
+	assert.Equal(t, 1, entries[0].Events)
+}
+
+func TestCloseInactive(t *testing.T) {
+	dir := tempDir(t)
+	out := newTestOutput(t, map[string]interface{}{
+		"path":           dir,
+		"close_inactive": "1m",
+	})
+	defer out.Close()
+
+	now := testTime
+	out.now = func() time.Time { return now }
+
+	require.NoError(t, out.Publish(context.Background(), outest.NewBatch(testEvent(testTime, nil))))
+
+	now = now.Add(30 * time.Second)
+	out.maintain()
+	assert.Len(t, out.active, 1)
+
+	now = now.Add(time.Minute)
+	out.maintain()
+	assert.Len(t, out.active, 0)
+
+	entries, err := out.manifest.read()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, now, entries[0].Closed)
+}
+
+func TestRecoverPartialFiles(t *testing.T) {
+	dir := tempDir(t)
+	partition := filepath.Join(dir, "2020.10.18")
+	require.NoError(t, os.MkdirAll(partition, 0750))
+
+	partial := filepath.Join(partition, "test-20201018T123000-1"+dataExt+partialExt)
+	require.NoError(t, ioutil.WriteFile(partial, []byte("{\"n\":1}\n{\"n\":2}\n"), 0600))
+	empty := filepath.Join(partition, "test-20201018T123000-2"+dataExt+partialExt)
+	require.NoError(t, ioutil.WriteFile(empty, nil, 0600))
+	tmp := filepath.Join(partition, "test-20201018T120000-1"+dataExt+".gz"+tmpExt)
+	require.NoError(t, ioutil.WriteFile(tmp, []byte("garbage"), 0600))
+
+	out := newTestOutput(t, map[string]interface{}{"path": dir})
+	require.NoError(t, out.Close())
+
+	for _, path := range []string{partial, empty, tmp} {
+		_, err := os.Stat(path)
+		assert.True(t, os.IsNotExist(err), "%v should have been removed", path)
+	}
+
+	entries, err := out.manifest.read()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "2020.10.18/test-20201018T123000-1.ndjson.gz", entries[0].File)
+	assert.Equal(t, 2, entries[0].Events)
+	assert.Nil(t, entries[0].FirstEvent)
+	assert.Equal(t, []string{`{"n":1}`, `{"n":2}`},
+		readLines(t, filepath.Join(dir, filepath.FromSlash(entries[0].File)), compressionGzip))
+}
+
+func TestOpenFileDoesNotOverwrite(t *testing.T) {
+	dir := tempDir(t)
+	out := newTestOutput(t, map[string]interface{}{"path": dir, "prefix": "test"})
+	defer out.Close()
+	out.now = func() time.Time { return testTime }
+
+	existing := filepath.Join(dir, "p", "test-20201018T123000-1"+dataExt+".gz")
+	require.NoError(t, os.MkdirAll(filepath.Dir(existing), 0750))
+	require.NoError(t, ioutil.WriteFile(existing, nil, 0600))
+
+	f, err := out.openFile("p")
+	require.NoError(t, err)
+	defer f.close()
+	assert.Equal(t, "test-20201018T123000-2", f.name)
+}
+
+func TestRetention(t *testing.T) {
+	tests := map[string]struct {
+		retention map[string]interface{}
+		remaining []string
+	}{
+		"disabled": {
+			remaining: []string{"a/1.ndjson.gz", "a/2.ndjson.gz", "b/3.ndjson.gz"},
+		},
+		"max_age": {
+			retention: map[string]interface{}{"max_age": "36h"},
+			remaining: []string{"a/2.ndjson.gz", "b/3.ndjson.gz"},
+		},
+		"max_size": {
+			retention: map[string]interface{}{"max_size": "2KiB"},
+			remaining: []string{"a/2.ndjson.gz", "b/3.ndjson.gz"},
+		},
+		"max_age and max_size": {
+			retention: map[string]interface{}{"max_age": "36h", "max_size": "1KiB"},
+			remaining: []string{"b/3.ndjson.gz"},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			dir := tempDir(t)
+			cfg := map[string]interface{}{"path": dir}
+			if test.retention != nil {
+				cfg["retention"] = test.retention
+			}
+			out := newTestOutput(t, cfg)
+			defer out.Close()
+
+			ages := map[string]time.Duration{
+				"a/1.ndjson.gz": 48 * time.Hour,
+				"a/2.ndjson.gz": 24 * time.Hour,
+				"b/3.ndjson.gz": time.Hour,
+			}
+			for file, age := range ages {
+				path := filepath.Join(dir, filepath.FromSlash(file))
+				require.NoError(t, os.MkdirAll(filepath.Dir(path), 0750))
+				require.NoError(t, ioutil.WriteFile(path, make([]byte, 1024), 0600))
+				require.NoError(t, os.Chtimes(path, testTime.Add(-age), testTime.Add(-age)))
+				require.NoError(t, out.manifest.append(manifestEntry{File: file, Size: 1024}))
+			}
+
+			require.NoError(t, out.enforceRetention(testTime))
+
+			files, err := listArchiveFiles(dir)
+			require.NoError(t, err)
+			var remaining []string
+			for _, f := range files {
+				remaining = append(remaining, f.rel)
+			}
+			assert.Equal(t, test.remaining, remaining)
+
+			entries, err := out.manifest.read()
+			require.NoError(t, err)
+			var listed []string
+			for _, entry := range entries {
+				listed = append(listed, entry.File)
+			}
+			assert.ElementsMatch(t, test.remaining, listed)
+
+			if len(remaining) == 1 {
+				_, err := os.Stat(filepath.Join(dir, "a"))
+				assert.True(t, os.IsNotExist(err), "empty partition directory should be removed")
+			}
+		})
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	tests := map[string]map[string]interface{}{
+		"missing path":        {},
+		"invalid compression": {"path": "x", "compression": "lz4"},
+		"zero close_inactive": {"path": "x", "close_inactive": 0},
+	}
+
+	for name, settings := range tests {
+		settings := settings
+		t.Run(name, func(t *testing.T) {
+			config := defaultConfig()
+			err := common.MustNewConfigFrom(settings).Unpack(&config)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	dir := tempDir(t)
+	path := filepath.Join(dir, "f")
+	require.NoError(t, ioutil.WriteFile(path, []byte("hello"), 0600))
+
+	size, sum, err := hashFile(path)
+	require.NoError(t, err)
+	expected := sha256.Sum256([]byte("hello"))
+	assert.Equal(t, int64(5), size)
+	assert.Equal(t, hex.EncodeToString(expected[:]), sum)
+}
+
+func newTestOutput(t *testing.T, settings map[string]interface{}) *archiveOutput {
+	t.Helper()
+
+	config := defaultConfig()
+	require.NoError(t, common.MustNewConfigFrom(settings).Unpack(&config))
+
+	out, err := newArchiveOutput(beat.Info{Beat: "test"}, outputs.NewNilObserver(), config)
+	require.NoError(t, err)
+	return out
+}
+
+func testEvent(ts time.Time, fields common.MapStr) beat.Event {
+	return beat.Event{Timestamp: ts, Fields: fields}
+}
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "archive-test")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func readLines(t *testing.T, path, compression string) []string {
+	t.Helper()
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var r io.Reader = f
+	switch compression {
+	case compressionGzip:
+		gz, err := gzip.NewReader(f)
+		require.NoError(t, err)
+		defer gz.Close()
+		r = gz
+	case compressionZstd:
+		dec, err := zstd.NewReader(f)
+		require.NoError(t, err)
+		defer dec.Close()
+		r = dec
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	require.NoError(t, scanner.Err())
+	return lines
+}
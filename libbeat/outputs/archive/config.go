@@ -0,0 +1,71 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package archive
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+)
+
+type config struct {
+	Path          string                    `config:"path"            validate:"required"`
+	Partition     *fmtstr.EventFormatString `config:"partition"`
+	Prefix        string                    `config:"prefix"`
+	RotateEveryKb uint                      `config:"rotate_every_kb" validate:"min=1"`
+	CloseInactive time.Duration             `config:"close_inactive"  validate:"positive,nonzero"`
+	CheckInterval time.Duration             `config:"check_interval"  validate:"positive,nonzero"`
+	Compression   string                    `config:"compression"`
+	Retention     retentionConfig           `config:"retention"`
+	Permissions   uint32                    `config:"permissions"`
+	Codec         codec.Config              `config:"codec"`
+}
+
+type retentionConfig struct {
+	MaxAge  time.Duration    `config:"max_age"  validate:"min=0"`
+	MaxSize cfgtype.ByteSize `config:"max_size"`
+}
+
+const (
+	compressionNone = "none"
+	compressionGzip = "gzip"
+	compressionZstd = "zstd"
+)
+
+func defaultConfig() config {
+	return config{
+		Partition:     fmtstr.MustCompileEvent("%{+yyyy.MM.dd}"),
+		RotateEveryKb: 10 * 1024,
+		CloseInactive: 5 * time.Minute,
+		CheckInterval: time.Minute,
+		Compression:   compressionGzip,
+		Permissions:   0600,
+	}
+}
+
+func (c *config) Validate() error {
+	switch c.Compression {
+	case compressionNone, compressionGzip, compressionZstd:
+	default:
+		return fmt.Errorf("unsupported compression '%v', must be one of none, gzip or zstd", c.Compression)
+	}
+	return nil
+}
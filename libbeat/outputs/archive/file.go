@@ -0,0 +1,259 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	dataExt    = ".ndjson"
+	partialExt = ".part"
+	tmpExt     = ".tmp"
+)
+
+// activeFile is an uncompressed NDJSON file that is still receiving events.
+// Once closed it is compressed into its final name and added to the manifest.
+type activeFile struct {
+	partition string
+	name      string
+	path      string
+
+	file *os.File
+	buf  *bufio.Writer
+
+	size      int64
+	events    int
+	first     time.Time
+	last      time.Time
+	lastWrite time.Time
+}
+
+func createActiveFile(root, partition, name string, perm os.FileMode) (*activeFile, error) {
+	dir := filepath.Join(root, partition)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create partition directory %v: %w", dir, err)
+	}
+
+	path := filepath.Join(dir, name+dataExt+partialExt)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	return &activeFile{
+		partition: partition,
+		name:      name,
+		path:      path,
+		file:      f,
+		buf:       bufio.NewWriter(f),
+	}, nil
+}
+
+func (f *activeFile) write(line []byte, ts, now time.Time) error {
+	if _, err := f.buf.Write(line); err != nil {
+		return err
+	}
+
+	f.size += int64(len(line))
+	f.events++
+	if f.first.IsZero() || ts.Before(f.first) {
+		f.first = ts
+	}
+	if ts.After(f.last) {
+		f.last = ts
+	}
+	f.lastWrite = now
+	return nil
+}
+
+// close flushes and closes the underlying file. The partial file is left on
+// disk to be finalized.
+func (f *activeFile) close() error {
+	err := f.buf.Flush()
+	if syncErr := f.file.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// finalizeFile compresses the partial file at src into its final location,
+// removes the partial file and returns the final path, its size on disk and
+// the hex encoded SHA-256 of its contents.
+func finalizeFile(src, compression string, perm os.FileMode) (string, int64, string, error) {
+	dst := strings.TrimSuffix(src, partialExt) + compressionExt(compression)
+
+	if compression == compressionNone {
+		size, sum, err := hashFile(src)
+		if err != nil {
+			return "", 0, "", err
+		}
+		if err := os.Rename(src, dst); err != nil {
+			return "", 0, "", err
+		}
+		return dst, size, sum, nil
+	}
+
+	size, sum, err := compressFile(src, dst+tmpExt, compression, perm)
+	if err != nil {
+		os.Remove(dst + tmpExt)
+		return "", 0, "", err
+	}
+	if err := os.Rename(dst+tmpExt, dst); err != nil {
+		return "", 0, "", err
+	}
+	if err := os.Remove(src); err != nil {
+		return "", 0, "", err
+	}
+	return dst, size, sum, nil
+}
+
+func compressFile(src, dst, compression string, perm os.FileMode) (int64, string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, "", err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return 0, "", err
+	}
+	defer out.Close()
+
+	hash := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(out, hash)}
+
+	var enc io.WriteCloser
+	switch compression {
+	case compressionGzip:
+		enc = gzip.NewWriter(counter)
+	case compressionZstd:
+		enc, err = zstd.NewWriter(counter)
+		if err != nil {
+			return 0, "", err
+		}
+	default:
+		return 0, "", fmt.Errorf("unsupported compression '%v'", compression)
+	}
+
+	if _, err := io.Copy(enc, in); err != nil {
+		enc.Close()
+		return 0, "", err
+	}
+	if err := enc.Close(); err != nil {
+		return 0, "", err
+	}
+	if err := out.Sync(); err != nil {
+		return 0, "", err
+	}
+	return counter.n, hex.EncodeToString(hash.Sum(nil)), out.Close()
+}
+
+func hashFile(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(hash, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// countLines returns the number of newline terminated lines in the file.
+func countLines(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var (
+		lines int
+		buf   = make([]byte, 32*1024)
+	)
+	for {
+		n, err := f.Read(buf)
+		for _, b := range buf[:n] {
+			if b == '\n' {
+				lines++
+			}
+		}
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return lines, err
+		}
+	}
+}
+
+func compressionExt(compression string) string {
+	switch compression {
+	case compressionGzip:
+		return ".gz"
+	case compressionZstd:
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+// isArchiveFile reports whether name is a closed data file written by the
+// archive output.
+func isArchiveFile(name string) bool {
+	if name == manifestName {
+		return false
+	}
+	for _, ext := range []string{"", ".gz", ".zst"} {
+		if strings.HasSuffix(name, dataExt+ext) {
+			return true
+		}
+	}
+	return false
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,145 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package archive
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const manifestName = "manifest.ndjson"
+
+// manifestEntry describes a closed archive file. One entry is written per
+// line to the manifest in the root of the archive.
+type manifestEntry struct {
+	File        string     `json:"file"`
+	Partition   string     `json:"partition"`
+	Events      int        `json:"events"`
+	Size        int64      `json:"size"`
+	RawSize     int64      `json:"raw_size"`
+	SHA256      string     `json:"sha256"`
+	Compression string     `json:"compression"`
+	FirstEvent  *time.Time `json:"first_event,omitempty"`
+	LastEvent   *time.Time `json:"last_event,omitempty"`
+	Closed      time.Time  `json:"closed"`
+}
+
+type manifest struct {
+	path string
+	perm os.FileMode
+}
+
+func newManifest(root string, perm os.FileMode) *manifest {
+	return &manifest{path: filepath.Join(root, manifestName), perm: perm}
+}
+
+func (m *manifest) append(entry manifestEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(m.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, m.perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (m *manifest) read() ([]manifestEntry, error) {
+	f, err := os.Open(m.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []manifestEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var entry manifestEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// Skip lines torn by a crash while appending.
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// remove drops the entries for the given files (relative to the archive
+// root). The manifest is rewritten to a temporary file and renamed into
+// place so readers never observe a partial manifest.
+func (m *manifest) remove(files map[string]bool) error {
+	if len(files) == 0 {
+		return nil
+	}
+
+	entries, err := m.read()
+	if err != nil {
+		return err
+	}
+
+	tmp := m.path + tmpExt
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, m.perm)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, entry := range entries {
+		if files[entry.File] {
+			continue
+		}
+		if err := enc.Encode(entry); err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, m.path)
+}
@@ -0,0 +1,99 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+type archivedFile struct {
+	rel     string
+	size    int64
+	modTime time.Time
+}
+
+// listArchiveFiles returns all closed archive files below root, oldest first.
+func listArchiveFiles(root string) ([]archivedFile, error) {
+	var files []archivedFile
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !isArchiveFile(info.Name()) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, archivedFile{
+			rel:     filepath.ToSlash(rel),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	return files, nil
+}
+
+// expiredFiles selects the files to delete: every file older than maxAge,
+// then the oldest remaining files until the total size is at most maxSize.
+// A zero limit disables the check.
+func expiredFiles(files []archivedFile, now time.Time, maxAge time.Duration, maxSize int64) []archivedFile {
+	var (
+		expired []archivedFile
+		total   int64
+	)
+	for _, f := range files {
+		total += f.size
+	}
+
+	for _, f := range files {
+		switch {
+		case maxAge > 0 && now.Sub(f.modTime) > maxAge:
+		case maxSize > 0 && total > maxSize:
+		default:
+			continue
+		}
+		expired = append(expired, f)
+		total -= f.size
+	}
+	return expired
+}
+
+// removeEmptyDirs removes dir and its parents up to, but excluding, root as
+// long as they are empty.
+func removeEmptyDirs(root, dir string) {
+	root = filepath.Clean(root)
+	for dir = filepath.Clean(dir); dir != root && len(dir) > len(root); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+	}
+}
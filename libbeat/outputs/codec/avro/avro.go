@@ -0,0 +1,253 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package avro
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	avroschema "github.com/elastic/beats/v7/libbeat/common/avro"
+	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/paths"
+)
+
+// magicByte is the first byte of the schema registry wire format, followed by
+// the 4 byte big endian schema ID.
+const magicByte = 0
+
+// Encoder for serializing a beat.Event to an Avro record.
+type Encoder struct {
+	buf     []byte
+	schemas schemaSource
+	mapping map[string]string
+	version string
+	wire    bool
+}
+
+// schemaSource provides the record schema used to encode events and its ID
+// in the schema registry.
+type schemaSource interface {
+	Schema() (*avroschema.Schema, int32, error)
+}
+
+// staticSchema is a schema source for a local schema that is not registered.
+type staticSchema struct {
+	schema *avroschema.Schema
+}
+
+// Config is used to pass encoding parameters to the codec.
+type Config struct {
+	Schema   string            `config:"schema"`
+	Mapping  map[string]string `config:"mapping"`
+	Registry RegistryConfig    `config:"schema_registry"`
+}
+
+// RegistryConfig configures the schema registry the schema is fetched from
+// or registered with.
+type RegistryConfig struct {
+	URL          string            `config:"url"`
+	Subject      string            `config:"subject"`
+	Version      string            `config:"version"`
+	Username     string            `config:"username"`
+	Password     string            `config:"password"`
+	AutoRegister bool              `config:"auto_register"`
+	CacheTTL     time.Duration     `config:"cache_ttl" validate:"positive,nonzero"`
+	Timeout      time.Duration     `config:"timeout" validate:"positive,nonzero"`
+	TLS          *tlscommon.Config `config:"ssl"`
+}
+
+var defaultConfig = Config{
+	Registry: RegistryConfig{
+		Version:  "latest",
+		CacheTTL: 5 * time.Minute,
+		Timeout:  10 * time.Second,
+	},
+}
+
+func init() {
+	codec.RegisterType("avro", func(info beat.Info, cfg *common.Config) (codec.Codec, error) {
+		if cfg == nil {
+			return nil, errors.New("avro codec requires a schema or schema_registry")
+		}
+
+		config := defaultConfig
+		if err := cfg.Unpack(&config); err != nil {
+			return nil, err
+		}
+
+		var schema []byte
+		if config.Schema != "" {
+			var err error
+			schema, err = ioutil.ReadFile(paths.Resolve(paths.Config, config.Schema))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read avro schema: %v", err)
+			}
+		}
+
+		if config.Registry.URL == "" {
+			return New(info.Version, schema, config.Mapping)
+		}
+
+		registry, err := newRegistry(config.Registry, schema, config.Mapping)
+		if err != nil {
+			return nil, err
+		}
+		return newWithRegistry(info.Version, registry, config.Mapping), nil
+	})
+}
+
+// Validate checks that a schema source is configured.
+func (c *Config) Validate() error {
+	if c.Schema == "" && c.Registry.URL == "" {
+		return errors.New("one of schema or schema_registry.url must be set")
+	}
+	if c.Registry.URL != "" && c.Registry.Subject == "" {
+		return errors.New("schema_registry.subject must be set")
+	}
+	if c.Registry.URL == "" && c.Registry.AutoRegister {
+		return errors.New("schema_registry.auto_register requires schema_registry.url")
+	}
+	if c.Registry.AutoRegister && c.Schema == "" {
+		return errors.New("schema_registry.auto_register requires a local schema")
+	}
+	return nil
+}
+
+// New creates a new avro Encoder using a local schema. Events are encoded
+// without the schema registry wire format header. The mapping maps record
+// field names to event fields. Record fields without mapping are read from
+// the event field with the same name.
+func New(version string, schema []byte, mapping map[string]string) (*Encoder, error) {
+	s, err := parseRecordSchema(schema, mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Encoder{
+		schemas: staticSchema{s},
+		mapping: mapping,
+		version: version,
+	}, nil
+}
+
+// newWithRegistry creates a new avro Encoder that gets its schema from a
+// schema registry. Encoded events are prefixed with the magic byte and the
+// schema ID.
+func newWithRegistry(version string, schemas schemaSource, mapping map[string]string) *Encoder {
+	return &Encoder{
+		schemas: schemas,
+		mapping: mapping,
+		version: version,
+		wire:    true,
+	}
+}
+
+// parseRecordSchema parses a schema and checks that it is a record with all
+// mapped fields.
+func parseRecordSchema(schema []byte, mapping map[string]string) (*avroschema.Schema, error) {
+	s, err := avroschema.ParseSchema(schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid avro schema: %v", err)
+	}
+	if s.Type != avroschema.TypeRecord {
+		return nil, fmt.Errorf("avro schema must be a record, found %v", s.Type)
+	}
+
+	for name := range mapping {
+		found := false
+		for _, f := range s.Fields {
+			if f.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("record %v has no field %v", s.Name, name)
+		}
+	}
+	return s, nil
+}
+
+func (s staticSchema) Schema() (*avroschema.Schema, int32, error) {
+	return s.schema, 0, nil
+}
+
+// Connect resolves the schema, so outputs can retry connecting until the
+// schema registry is available instead of failing to encode the events.
+func (e *Encoder) Connect() error {
+	_, _, err := e.schemas.Schema()
+	return err
+}
+
+// Encode serializes a beat event to an Avro record. Event fields are looked
+// up like in processors, with `@timestamp` and `@metadata` providing the
+// same values as in the json codec. Missing fields are encoded using the
+// field default or as null.
+func (e *Encoder) Encode(index string, event *beat.Event) ([]byte, error) {
+	schema, id, err := e.schemas.Schema()
+	if err != nil {
+		return nil, err
+	}
+
+	record := make(common.MapStr, len(schema.Fields))
+	for _, f := range schema.Fields {
+		key, ok := e.mapping[f.Name]
+		if !ok {
+			key = f.Name
+		}
+
+		v, err := e.getValue(index, event, key)
+		if err != nil || v == nil {
+			continue
+		}
+		record[f.Name] = v
+	}
+
+	buf := e.buf[:0]
+	if e.wire {
+		var header [5]byte
+		header[0] = magicByte
+		binary.BigEndian.PutUint32(header[1:], uint32(id))
+		buf = append(buf, header[:]...)
+	}
+
+	buf, err = avroschema.AppendEncode(buf, schema, record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event: %v", err)
+	}
+	e.buf = buf
+	return buf, nil
+}
+
+func (e *Encoder) getValue(index string, event *beat.Event, key string) (interface{}, error) {
+	switch key {
+	case "@metadata.beat":
+		return index, nil
+	case "@metadata.type":
+		return "_doc", nil
+	case "@metadata.version":
+		return e.version, nil
+	}
+	return event.GetValue(key)
+}
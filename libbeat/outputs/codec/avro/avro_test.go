@@ -0,0 +1,366 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package avro
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	avroschema "github.com/elastic/beats/v7/libbeat/common/avro"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+)
+
+const testSchema = `{
+	"type": "record",
+	"name": "Event",
+	"namespace": "test",
+	"fields": [
+		{"name": "timestamp", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+		{"name": "message", "type": "string"},
+		{"name": "host", "type": ["null", {
+			"type": "record",
+			"name": "Host",
+			"fields": [{"name": "name", "type": "string"}]
+		}]},
+		{"name": "level", "type": "string", "default": "info"},
+		{"name": "beat", "type": "string"}
+	]
+}`
+
+var testMapping = map[string]string{
+	"timestamp": "@timestamp",
+	"beat":      "@metadata.beat",
+}
+
+func testEvent() *beat.Event {
+	return &beat.Event{
+		Timestamp: time.Date(2020, 5, 1, 10, 20, 30, 0, time.UTC),
+		Fields: common.MapStr{
+			"message": "hello",
+			"host":    common.MapStr{"name": "localhost"},
+		},
+	}
+}
+
+func decodeRecord(t *testing.T, data []byte) interface{} {
+	s, err := avroschema.ParseSchema([]byte(testSchema))
+	require.NoError(t, err)
+
+	v, err := avroschema.Decode(s, data)
+	require.NoError(t, err)
+	return v
+}
+
+func TestEncodeLocalSchema(t *testing.T) {
+	enc, err := New("1.2.3", []byte(testSchema), testMapping)
+	require.NoError(t, err)
+
+	data, err := enc.Encode("test", testEvent())
+	require.NoError(t, err)
+
+	assert.Equal(t, common.MapStr{
+		"timestamp": int64(1588328430000),
+		"message":   "hello",
+		"host":      common.MapStr{"name": "localhost"},
+		"level":     "info",
+		"beat":      "test",
+	}, decodeRecord(t, data))
+
+	_, err = enc.Encode("test", &beat.Event{Fields: common.MapStr{"message": 1}})
+	assert.Error(t, err)
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := map[string]struct {
+		schema  string
+		mapping map[string]string
+	}{
+		"invalid schema": {
+			schema: `{`,
+		},
+		"not a record": {
+			schema: `"string"`,
+		},
+		"unknown mapped field": {
+			schema:  testSchema,
+			mapping: map[string]string{"unknown": "message"},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			_, err := New("1.2.3", []byte(test.schema), test.mapping)
+			assert.Error(t, err)
+		})
+	}
+}
+
+// testRegistry is a minimal stand-in for a schema registry serving a single
+// subject.
+type testRegistry struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	id       int32
+	schema   string
+	requests []string
+	fail     bool
+}
+
+func newTestRegistry(t *testing.T, id int32, schema string) *testRegistry {
+	r := &testRegistry{id: id, schema: schema}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		r.requests = append(r.requests, req.Method+" "+req.URL.Path)
+		if r.fail {
+			http.Error(w, `{"error_code":50001,"message":"unavailable"}`, http.StatusInternalServerError)
+			return
+		}
+
+		if req.Method == "POST" {
+			assert.Equal(t, registryContentType, req.Header.Get("Content-Type"))
+
+			var body struct{ Schema string }
+			require.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+			assert.JSONEq(t, r.schema, body.Schema)
+		}
+
+		w.Header().Set("Content-Type", registryContentType)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"subject": "events-value",
+			"version": 1,
+			"id":      r.id,
+			"schema":  r.schema,
+		})
+	}))
+	return r
+}
+
+func (r *testRegistry) Requests() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.requests...)
+}
+
+func (r *testRegistry) SetFail(fail bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fail = fail
+}
+
+func TestEncodeRegistry(t *testing.T) {
+	tests := map[string]struct {
+		local        bool
+		autoRegister bool
+		request      string
+	}{
+		"fetch latest": {
+			request: "GET /subjects/events-value/versions/latest",
+		},
+		"lookup local": {
+			local:   true,
+			request: "POST /subjects/events-value",
+		},
+		"register local": {
+			local:        true,
+			autoRegister: true,
+			request:      "POST /subjects/events-value/versions",
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			server := newTestRegistry(t, 42, testSchema)
+			defer server.Close()
+
+			config := defaultConfig.Registry
+			config.URL = server.URL
+			config.Subject = "events-value"
+			config.AutoRegister = test.autoRegister
+
+			var local []byte
+			if test.local {
+				local = []byte(testSchema)
+			}
+			r, err := newRegistry(config, local, testMapping)
+			require.NoError(t, err)
+			enc := newWithRegistry("1.2.3", r, testMapping)
+
+			for i := 0; i < 3; i++ {
+				data, err := enc.Encode("test", testEvent())
+				require.NoError(t, err)
+
+				require.True(t, len(data) > 5)
+				assert.Equal(t, byte(magicByte), data[0])
+				assert.Equal(t, uint32(42), binary.BigEndian.Uint32(data[1:5]))
+				assert.Equal(t, "hello", decodeRecord(t, data[5:]).(common.MapStr)["message"])
+			}
+
+			// the schema ID is cached
+			assert.Equal(t, []string{test.request}, server.Requests())
+		})
+	}
+}
+
+func TestRegistryRefresh(t *testing.T) {
+	server := newTestRegistry(t, 1, testSchema)
+	defer server.Close()
+
+	config := defaultConfig.Registry
+	config.URL = server.URL
+	config.Subject = "events-value"
+	config.CacheTTL = time.Millisecond
+
+	r, err := newRegistry(config, nil, testMapping)
+	require.NoError(t, err)
+	enc := newWithRegistry("1.2.3", r, testMapping)
+
+	data, err := enc.Encode("test", testEvent())
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), binary.BigEndian.Uint32(data[1:5]))
+
+	// the cached schema is used if the registry is unavailable
+	server.SetFail(true)
+	time.Sleep(5 * time.Millisecond)
+	data, err = enc.Encode("test", testEvent())
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), binary.BigEndian.Uint32(data[1:5]))
+
+	// new schema IDs are picked up after the TTL
+	server.SetFail(false)
+	server.mu.Lock()
+	server.id = 2
+	server.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	data, err = enc.Encode("test", testEvent())
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), binary.BigEndian.Uint32(data[1:5]))
+	assert.Len(t, server.Requests(), 3)
+}
+
+func TestRegistryUnavailable(t *testing.T) {
+	server := newTestRegistry(t, 1, testSchema)
+	server.SetFail(true)
+	defer server.Close()
+
+	config := defaultConfig.Registry
+	config.URL = server.URL
+	config.Subject = "events-value"
+
+	r, err := newRegistry(config, nil, testMapping)
+	require.NoError(t, err)
+	enc := newWithRegistry("1.2.3", r, testMapping)
+
+	assert.Error(t, enc.Connect())
+	_, err = enc.Encode("test", testEvent())
+	assert.Error(t, err)
+
+	// failed lookups are not retried before the backoff
+	assert.Len(t, server.Requests(), 1)
+
+	server.SetFail(false)
+	r.mu.Lock()
+	r.retry = time.Time{}
+	r.mu.Unlock()
+	assert.NoError(t, enc.Connect())
+	_, err = enc.Encode("test", testEvent())
+	assert.NoError(t, err)
+	assert.Len(t, server.Requests(), 2)
+}
+
+func TestCreateEncoder(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "avro")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	path := filepath.Join(tmp, "event.avsc")
+	require.NoError(t, ioutil.WriteFile(path, []byte(testSchema), 0644))
+
+	server := newTestRegistry(t, 7, testSchema)
+	defer server.Close()
+
+	tests := map[string]struct {
+		config map[string]interface{}
+		err    bool
+	}{
+		"local schema": {
+			config: map[string]interface{}{"schema": path, "mapping": testMapping},
+		},
+		"registry": {
+			config: map[string]interface{}{
+				"mapping":         testMapping,
+				"schema_registry": map[string]interface{}{"url": server.URL, "subject": "events-value"},
+			},
+		},
+		"no schema": {
+			config: map[string]interface{}{},
+			err:    true,
+		},
+		"missing schema file": {
+			config: map[string]interface{}{"schema": filepath.Join(tmp, "missing")},
+			err:    true,
+		},
+		"missing subject": {
+			config: map[string]interface{}{"schema_registry.url": server.URL},
+			err:    true,
+		},
+		"auto_register without schema": {
+			config: map[string]interface{}{
+				"schema_registry": map[string]interface{}{"url": server.URL, "subject": "s", "auto_register": true},
+			},
+			err: true,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			var config codec.Config
+			cfg := common.MustNewConfigFrom(map[string]interface{}{"avro": test.config})
+			require.NoError(t, cfg.Unpack(&config))
+
+			enc, err := codec.CreateEncoder(beat.Info{Version: "1.2.3"}, config)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			data, err := enc.Encode("test", testEvent())
+			require.NoError(t, err)
+			assert.NotEmpty(t, data)
+		})
+	}
+}
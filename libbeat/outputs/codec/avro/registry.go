@@ -0,0 +1,223 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package avro
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	avroschema "github.com/elastic/beats/v7/libbeat/common/avro"
+	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+const registryContentType = "application/vnd.schemaregistry.v1+json"
+
+// lookupBackoff is how long a failed lookup is cached while no schema is
+// known, so events are not blocked on the registry one by one.
+const lookupBackoff = 5 * time.Second
+
+// registry resolves the schema of a subject and its ID using a schema
+// registry. Schema IDs are cached for the configured TTL. If the registry
+// can not be reached after the TTL expired, the last known schema is used
+// until the next refresh.
+type registry struct {
+	log    *logp.Logger
+	client *http.Client
+	config RegistryConfig
+
+	// local is the local schema to lookup or register. If not set the schema
+	// of the configured subject version is fetched from the registry.
+	local   []byte
+	mapping map[string]string
+
+	mu      sync.Mutex
+	id      int32
+	current *avroschema.Schema
+	expires time.Time
+	schemas map[int32]*avroschema.Schema
+
+	// err is the error of the last failed lookup, returned until retry if no
+	// schema has been resolved yet.
+	err   error
+	retry time.Time
+}
+
+// registryResponse holds the fields used from the registry API responses.
+type registryResponse struct {
+	ID     int32  `json:"id"`
+	Schema string `json:"schema"`
+}
+
+func newRegistry(config RegistryConfig, local []byte, mapping map[string]string) (*registry, error) {
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema registry url: %v", err)
+	}
+
+	tlsConfig, err := tlscommon.LoadTLSConfig(config.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig.BuildModuleConfig(u.Hostname())
+	}
+
+	r := &registry{
+		log: logp.NewLogger("avro"),
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   config.Timeout,
+		},
+		config:  config,
+		mapping: mapping,
+		schemas: map[int32]*avroschema.Schema{},
+	}
+
+	if local != nil {
+		s, err := parseRecordSchema(local, mapping)
+		if err != nil {
+			return nil, err
+		}
+		r.local = local
+		r.current = s
+	}
+	return r, nil
+}
+
+// Schema returns the current schema and its ID, refreshing it from the
+// registry if the cached ID has expired. While no schema is known, failed
+// lookups are retried after a backoff.
+func (r *registry) Schema() (*avroschema.Schema, int32, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(r.expires) {
+		return r.current, r.id, nil
+	}
+	if r.expires.IsZero() && now.Before(r.retry) {
+		return nil, 0, r.err
+	}
+
+	id, schema, err := r.fetch()
+	if err != nil {
+		if r.expires.IsZero() {
+			r.err = fmt.Errorf("failed to get schema of subject %v: %v", r.config.Subject, err)
+			r.retry = now.Add(lookupBackoff)
+			return nil, 0, r.err
+		}
+		r.log.Errorf("Failed to refresh schema of subject %v, using cached schema ID %v: %v", r.config.Subject, r.id, err)
+	} else {
+		r.id, r.current = id, schema
+	}
+	r.expires = now.Add(r.config.CacheTTL)
+	return r.current, r.id, nil
+}
+
+func (r *registry) fetch() (int32, *avroschema.Schema, error) {
+	subject := url.PathEscape(r.config.Subject)
+
+	if r.local == nil {
+		version := url.PathEscape(r.config.Version)
+		resp, err := r.request("GET", "/subjects/"+subject+"/versions/"+version, nil)
+		if err != nil {
+			return 0, nil, err
+		}
+		schema, err := r.parse(resp.ID, resp.Schema)
+		return resp.ID, schema, err
+	}
+
+	path := "/subjects/" + subject
+	if r.config.AutoRegister {
+		path += "/versions"
+	}
+	body, err := json.Marshal(map[string]string{"schema": string(r.local)})
+	if err != nil {
+		return 0, nil, err
+	}
+	resp, err := r.request("POST", path, body)
+	if err != nil {
+		return 0, nil, err
+	}
+	return resp.ID, r.current, nil
+}
+
+// parse returns the schema for an ID, parsing it only if the ID is not known
+// yet.
+func (r *registry) parse(id int32, schema string) (*avroschema.Schema, error) {
+	if s, ok := r.schemas[id]; ok {
+		return s, nil
+	}
+
+	s, err := parseRecordSchema([]byte(schema), r.mapping)
+	if err != nil {
+		return nil, fmt.Errorf("schema %v: %v", id, err)
+	}
+	r.schemas[id] = s
+	return s, nil
+}
+
+func (r *registry) request(method, path string, body []byte) (*registryResponse, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(r.config.URL, "/")+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", registryContentType)
+	if body != nil {
+		req.Header.Set("Content-Type", registryContentType)
+	}
+	if r.config.Username != "" || r.config.Password != "" {
+		req.SetBasicAuth(r.config.Username, r.config.Password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%v %v returned %v: %s", method, path, resp.Status, bytes.TrimSpace(data))
+	}
+
+	var result registryResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse schema registry response: %v", err)
+	}
+	return &result, nil
+}
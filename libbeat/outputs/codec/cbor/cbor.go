@@ -0,0 +1,107 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cbor
+
+import (
+	"bytes"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	structform "github.com/elastic/go-structform"
+	"github.com/elastic/go-structform/cborl"
+	"github.com/elastic/go-structform/gotype"
+)
+
+// Encoder for serializing a beat.Event to CBOR.
+type Encoder struct {
+	buf    bytes.Buffer
+	folder *gotype.Iterator
+
+	version string
+	config  Config
+}
+
+// Config is used to pass encoding parameters to New.
+type Config struct {
+	LocalTime bool `config:"local_time"`
+}
+
+var defaultConfig = Config{
+	LocalTime: false,
+}
+
+func init() {
+	codec.RegisterType("cbor", func(info beat.Info, cfg *common.Config) (codec.Codec, error) {
+		config := defaultConfig
+		if cfg != nil {
+			if err := cfg.Unpack(&config); err != nil {
+				return nil, err
+			}
+		}
+
+		return New(info.Version, config), nil
+	})
+}
+
+// indefiniteObjects encodes objects with indefinite length. The object length
+// reported by the iterator does not account for inline fields.
+type indefiniteObjects struct {
+	*cborl.Visitor
+}
+
+func (v indefiniteObjects) OnObjectStart(_ int, baseType structform.BaseType) error {
+	return v.Visitor.OnObjectStart(-1, baseType)
+}
+
+// New creates a new CBOR Encoder.
+func New(version string, config Config) *Encoder {
+	e := &Encoder{version: version, config: config}
+	e.reset()
+	return e
+}
+
+func (e *Encoder) reset() {
+	visitor := indefiniteObjects{cborl.NewVisitor(&e.buf)}
+
+	var err error
+
+	// create new encoder with custom time.Time encoding
+	e.folder, err = gotype.NewIterator(visitor,
+		gotype.Folders(
+			codec.MakeUTCOrLocalTimestampEncoder(e.config.LocalTime),
+			codec.MakeBCTimestampEncoder(),
+		),
+	)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Encode serializes a beat event to CBOR. The event is encoded like in the
+// json codec, with timestamps encoded as RFC3339 strings and additional
+// metadata in the `@metadata` namespace.
+func (e *Encoder) Encode(index string, event *beat.Event) ([]byte, error) {
+	e.buf.Reset()
+	err := e.folder.Fold(codec.MakeEvent(index, e.version, event))
+	if err != nil {
+		e.reset()
+		return nil, err
+	}
+	return e.buf.Bytes(), nil
+}
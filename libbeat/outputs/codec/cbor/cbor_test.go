@@ -0,0 +1,96 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cbor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/go-structform/cborl"
+	"github.com/elastic/go-structform/gotype"
+)
+
+func TestEncoder(t *testing.T) {
+	ts := time.Date(2020, 11, 5, 10, 15, 20, 123000000, time.UTC)
+
+	tests := map[string]struct {
+		config   Config
+		event    beat.Event
+		expected map[string]interface{}
+	}{
+		"metadata and timestamp": {
+			event: beat.Event{
+				Timestamp: ts,
+				Meta:      common.MapStr{"pipeline": "p1"},
+				Fields:    common.MapStr{"message": "hello", "count": 3},
+			},
+			expected: map[string]interface{}{
+				"@timestamp": "2020-11-05T10:15:20.123Z",
+				"@metadata": map[string]interface{}{
+					"beat":     "test",
+					"type":     "_doc",
+					"version":  "1.2.3",
+					"pipeline": "p1",
+				},
+				"message": "hello",
+				"count":   uint8(3),
+			},
+		},
+		"nested fields": {
+			event: beat.Event{
+				Timestamp: ts,
+				Fields: common.MapStr{
+					"host": common.MapStr{"name": "h1", "ip": []string{"10.0.0.1"}},
+					"temp": -1.5,
+				},
+			},
+			expected: map[string]interface{}{
+				"@timestamp": "2020-11-05T10:15:20.123Z",
+				"@metadata": map[string]interface{}{
+					"beat":    "test",
+					"type":    "_doc",
+					"version": "1.2.3",
+				},
+				"host": map[string]interface{}{
+					"name": "h1",
+					"ip":   []interface{}{"10.0.0.1"},
+				},
+				"temp": -1.5,
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			encoder := New("1.2.3", test.config)
+			data, err := encoder.Encode("test", &test.event)
+			require.NoError(t, err)
+
+			var decoded map[string]interface{}
+			unfolder, err := gotype.NewUnfolder(&decoded)
+			require.NoError(t, err)
+			require.NoError(t, cborl.Parse(data, unfolder))
+			assert.Equal(t, test.expected, decoded)
+		})
+	}
+}
@@ -22,3 +22,10 @@ import "github.com/elastic/beats/v7/libbeat/beat"
 type Codec interface {
 	Encode(index string, event *beat.Event) ([]byte, error)
 }
+
+// Connector is implemented by codecs that depend on external services, like a
+// schema registry. Outputs call Connect when connecting, so the codec can not
+// fail on every event while the service is unavailable.
+type Connector interface {
+	Connect() error
+}
@@ -15,7 +15,7 @@
 // specific language governing permissions and limitations
 // under the License.
 
-package json
+package codec
 
 import (
 	"time"
@@ -24,26 +24,28 @@ import (
 	"github.com/elastic/beats/v7/libbeat/common"
 )
 
-// Event describes the event structure for events
-// (in-)directly send to logstash
-type event struct {
+// Event describes the event structure encoded by the structured codecs. The
+// timestamp and metadata are reported as @timestamp and @metadata fields.
+type Event struct {
 	Timestamp time.Time     `struct:"@timestamp"`
-	Meta      meta          `struct:"@metadata"`
+	Meta      Meta          `struct:"@metadata"`
 	Fields    common.MapStr `struct:",inline"`
 }
 
 // Meta defines common event metadata to be stored in '@metadata'
-type meta struct {
+type Meta struct {
 	Beat    string                 `struct:"beat"`
 	Type    string                 `struct:"type"`
 	Version string                 `struct:"version"`
 	Fields  map[string]interface{} `struct:",inline"`
 }
 
-func makeEvent(index, version string, in *beat.Event) event {
-	return event{
+// MakeEvent creates the encoded structure of a beat.Event. The index is
+// reported as @metadata.beat.
+func MakeEvent(index, version string, in *beat.Event) Event {
+	return Event{
 		Timestamp: in.Timestamp,
-		Meta: meta{
+		Meta: Meta{
 			Beat:    index,
 			Version: version,
 			Type:    "_doc",
@@ -0,0 +1,214 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package msgpack
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+func TestEncoder(t *testing.T) {
+	ts := time.Date(2020, 11, 5, 10, 15, 20, 123000000, time.UTC)
+	longString := strings.Repeat("x", 300)
+
+	tests := map[string]struct {
+		event    beat.Event
+		expected map[string]interface{}
+	}{
+		"metadata and timestamp": {
+			event: beat.Event{
+				Timestamp: ts,
+				Meta:      common.MapStr{"pipeline": "p1"},
+				Fields:    common.MapStr{"message": "hello"},
+			},
+			expected: map[string]interface{}{
+				"@timestamp": "2020-11-05T10:15:20.123Z",
+				"@metadata": map[string]interface{}{
+					"beat":     "test",
+					"type":     "_doc",
+					"version":  "1.2.3",
+					"pipeline": "p1",
+				},
+				"message": "hello",
+			},
+		},
+		"value types": {
+			event: beat.Event{
+				Timestamp: ts,
+				Fields: common.MapStr{
+					"ints":   []interface{}{0, 127, 128, 300, 70000, 1 << 40, -1, -33, -200, -40000, -(1 << 40)},
+					"floats": []interface{}{float32(1.5), 2.25},
+					"bool":   true,
+					"nil":    nil,
+					"long":   longString,
+					"nested": common.MapStr{"a": common.MapStr{"b": []string{"x", "y"}}},
+				},
+			},
+			expected: map[string]interface{}{
+				"@timestamp": "2020-11-05T10:15:20.123Z",
+				"@metadata": map[string]interface{}{
+					"beat":    "test",
+					"type":    "_doc",
+					"version": "1.2.3",
+				},
+				"ints": []interface{}{
+					uint64(0), uint64(127), uint64(128), uint64(300), uint64(70000), uint64(1 << 40),
+					int64(-1), int64(-33), int64(-200), int64(-40000), int64(-(1 << 40)),
+				},
+				"floats": []interface{}{1.5, 2.25},
+				"bool":   true,
+				"nil":    nil,
+				"long":   longString,
+				"nested": map[string]interface{}{
+					"a": map[string]interface{}{"b": []interface{}{"x", "y"}},
+				},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			encoder := New("1.2.3", Config{})
+			data, err := encoder.Encode("test", &test.event)
+			require.NoError(t, err)
+
+			decoded, rest, err := decode(data)
+			require.NoError(t, err)
+			assert.Empty(t, rest)
+			assert.Equal(t, test.expected, decoded)
+		})
+	}
+}
+
+func TestEncoderLargeObject(t *testing.T) {
+	fields := common.MapStr{}
+	for i := 0; i < 70000; i++ {
+		fields[fmt.Sprintf("f%d", i)] = i
+	}
+
+	data, err := New("1.2.3", Config{}).Encode("test", &beat.Event{Fields: fields})
+	require.NoError(t, err)
+
+	decoded, _, err := decode(data)
+	require.NoError(t, err)
+	assert.Len(t, decoded, 70002)
+	assert.Equal(t, uint64(69999), decoded.(map[string]interface{})["f69999"])
+}
+
+// decode is a minimal MessagePack decoder for the types written by the visitor.
+func decode(b []byte) (interface{}, []byte, error) {
+	if len(b) == 0 {
+		return nil, nil, fmt.Errorf("unexpected end of input")
+	}
+	code, b := b[0], b[1:]
+	switch {
+	case code < 0x80:
+		return uint64(code), b, nil
+	case code >= 0xe0:
+		return int64(int8(code)), b, nil
+	case code&0xf0 == fixMap:
+		return decodeMap(b, int(code&0x0f))
+	case code&0xf0 == fixArr:
+		return decodeArr(b, int(code&0x0f))
+	case code&0xe0 == fixStr:
+		return decodeStr(b, int(code&0x1f))
+	}
+
+	switch code {
+	case codeNil:
+		return nil, b, nil
+	case codeFalse:
+		return false, b, nil
+	case codeTrue:
+		return true, b, nil
+	case codeFloat32:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), b[4:], nil
+	case codeFloat64:
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), b[8:], nil
+	case codeUint8:
+		return uint64(b[0]), b[1:], nil
+	case codeUint16:
+		return uint64(binary.BigEndian.Uint16(b)), b[2:], nil
+	case codeUint32:
+		return uint64(binary.BigEndian.Uint32(b)), b[4:], nil
+	case codeUint64:
+		return binary.BigEndian.Uint64(b), b[8:], nil
+	case codeInt8:
+		return int64(int8(b[0])), b[1:], nil
+	case codeInt16:
+		return int64(int16(binary.BigEndian.Uint16(b))), b[2:], nil
+	case codeInt32:
+		return int64(int32(binary.BigEndian.Uint32(b))), b[4:], nil
+	case codeInt64:
+		return int64(binary.BigEndian.Uint64(b)), b[8:], nil
+	case codeStr8:
+		return decodeStr(b[1:], int(b[0]))
+	case codeStr16:
+		return decodeStr(b[2:], int(binary.BigEndian.Uint16(b)))
+	case codeStr32:
+		return decodeStr(b[4:], int(binary.BigEndian.Uint32(b)))
+	case codeArr16:
+		return decodeArr(b[2:], int(binary.BigEndian.Uint16(b)))
+	case codeArr32:
+		return decodeArr(b[4:], int(binary.BigEndian.Uint32(b)))
+	case codeMap16:
+		return decodeMap(b[2:], int(binary.BigEndian.Uint16(b)))
+	case codeMap32:
+		return decodeMap(b[4:], int(binary.BigEndian.Uint32(b)))
+	}
+	return nil, nil, fmt.Errorf("unsupported code 0x%x", code)
+}
+
+func decodeStr(b []byte, l int) (interface{}, []byte, error) {
+	return string(b[:l]), b[l:], nil
+}
+
+func decodeArr(b []byte, l int) (interface{}, []byte, error) {
+	arr := make([]interface{}, l)
+	for i := range arr {
+		var err error
+		if arr[i], b, err = decode(b); err != nil {
+			return nil, nil, err
+		}
+	}
+	return arr, b, nil
+}
+
+func decodeMap(b []byte, l int) (interface{}, []byte, error) {
+	m := make(map[string]interface{}, l)
+	for i := 0; i < l; i++ {
+		k, rest, err := decode(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		if m[k.(string)], b, err = decode(rest); err != nil {
+			return nil, nil, err
+		}
+	}
+	return m, b, nil
+}
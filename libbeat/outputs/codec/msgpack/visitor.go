@@ -0,0 +1,275 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package msgpack
+
+import (
+	"math"
+
+	structform "github.com/elastic/go-structform"
+)
+
+// visitor writes the structform events in the MessagePack format.
+// MessagePack requires the number of elements in the header of maps and
+// arrays. The lengths reported by the iterator do not account for all
+// fields (e.g. inline maps), so the elements are counted, and the header is
+// written once the container is finished. Until then a 32bit header is
+// reserved, which is replaced by the smallest header for the final count.
+type visitor struct {
+	buf     []byte
+	stack   []container
+	scratch [5]byte
+}
+
+type container struct {
+	isMap bool
+	pos   int // offset of the reserved header in buf
+	count int
+}
+
+const (
+	codeNil     = 0xc0
+	codeFalse   = 0xc2
+	codeTrue    = 0xc3
+	codeFloat32 = 0xca
+	codeFloat64 = 0xcb
+	codeUint8   = 0xcc
+	codeUint16  = 0xcd
+	codeUint32  = 0xce
+	codeUint64  = 0xcf
+	codeInt8    = 0xd0
+	codeInt16   = 0xd1
+	codeInt32   = 0xd2
+	codeInt64   = 0xd3
+	codeStr8    = 0xd9
+	codeStr16   = 0xda
+	codeStr32   = 0xdb
+	codeArr16   = 0xdc
+	codeArr32   = 0xdd
+	codeMap16   = 0xde
+	codeMap32   = 0xdf
+
+	fixMap = 0x80
+	fixArr = 0x90
+	fixStr = 0xa0
+)
+
+func newVisitor() *visitor {
+	return &visitor{}
+}
+
+func (v *visitor) reset() {
+	v.buf = v.buf[:0]
+	v.stack = v.stack[:0]
+}
+
+// value updates the element count of the active array.
+func (v *visitor) value() {
+	if n := len(v.stack); n > 0 && !v.stack[n-1].isMap {
+		v.stack[n-1].count++
+	}
+}
+
+func (v *visitor) OnObjectStart(_ int, _ structform.BaseType) error {
+	v.push(true)
+	return nil
+}
+
+func (v *visitor) OnObjectFinished() error {
+	v.pop(fixMap, codeMap16, codeMap32)
+	return nil
+}
+
+func (v *visitor) OnKey(s string) error {
+	v.stack[len(v.stack)-1].count++
+	v.str(len(s))
+	v.buf = append(v.buf, s...)
+	return nil
+}
+
+func (v *visitor) OnKeyRef(s []byte) error {
+	v.stack[len(v.stack)-1].count++
+	v.str(len(s))
+	v.buf = append(v.buf, s...)
+	return nil
+}
+
+func (v *visitor) OnArrayStart(_ int, _ structform.BaseType) error {
+	v.push(false)
+	return nil
+}
+
+func (v *visitor) OnArrayFinished() error {
+	v.pop(fixArr, codeArr16, codeArr32)
+	return nil
+}
+
+func (v *visitor) push(isMap bool) {
+	v.value()
+	v.stack = append(v.stack, container{isMap: isMap, pos: len(v.buf)})
+	v.buf = append(v.buf, 0, 0, 0, 0, 0)
+}
+
+func (v *visitor) pop(fix, code16, code32 byte) {
+	c := v.stack[len(v.stack)-1]
+	v.stack = v.stack[:len(v.stack)-1]
+
+	var header []byte
+	switch {
+	case c.count < 16:
+		header = append(v.scratch[:0], fix|byte(c.count))
+	case c.count <= math.MaxUint16:
+		header = appendUint16(append(v.scratch[:0], code16), uint16(c.count))
+	default:
+		header = appendUint32(append(v.scratch[:0], code32), uint32(c.count))
+	}
+
+	// move the elements next to the final header
+	content := c.pos + 5
+	n := copy(v.buf[c.pos:], header)
+	if n < 5 {
+		copy(v.buf[c.pos+n:], v.buf[content:])
+		v.buf = v.buf[:len(v.buf)-(5-n)]
+	}
+}
+
+func (v *visitor) OnNil() error {
+	v.value()
+	v.buf = append(v.buf, codeNil)
+	return nil
+}
+
+func (v *visitor) OnBool(b bool) error {
+	v.value()
+	if b {
+		v.buf = append(v.buf, codeTrue)
+	} else {
+		v.buf = append(v.buf, codeFalse)
+	}
+	return nil
+}
+
+func (v *visitor) OnString(s string) error {
+	v.value()
+	v.str(len(s))
+	v.buf = append(v.buf, s...)
+	return nil
+}
+
+func (v *visitor) OnStringRef(s []byte) error {
+	v.value()
+	v.str(len(s))
+	v.buf = append(v.buf, s...)
+	return nil
+}
+
+func (v *visitor) str(l int) {
+	switch {
+	case l < 32:
+		v.buf = append(v.buf, fixStr|byte(l))
+	case l <= math.MaxUint8:
+		v.buf = append(v.buf, codeStr8, byte(l))
+	case l <= math.MaxUint16:
+		v.buf = append(v.buf, codeStr16)
+		v.buf = appendUint16(v.buf, uint16(l))
+	default:
+		v.buf = append(v.buf, codeStr32)
+		v.buf = appendUint32(v.buf, uint32(l))
+	}
+}
+
+func (v *visitor) OnInt8(i int8) error   { return v.OnInt64(int64(i)) }
+func (v *visitor) OnInt16(i int16) error { return v.OnInt64(int64(i)) }
+func (v *visitor) OnInt32(i int32) error { return v.OnInt64(int64(i)) }
+func (v *visitor) OnInt(i int) error     { return v.OnInt64(int64(i)) }
+
+func (v *visitor) OnInt64(i int64) error {
+	if i >= 0 {
+		return v.OnUint64(uint64(i))
+	}
+
+	v.value()
+	switch {
+	case i >= -32:
+		v.buf = append(v.buf, byte(i))
+	case i >= math.MinInt8:
+		v.buf = append(v.buf, codeInt8, byte(i))
+	case i >= math.MinInt16:
+		v.buf = append(v.buf, codeInt16)
+		v.buf = appendUint16(v.buf, uint16(i))
+	case i >= math.MinInt32:
+		v.buf = append(v.buf, codeInt32)
+		v.buf = appendUint32(v.buf, uint32(i))
+	default:
+		v.buf = append(v.buf, codeInt64)
+		v.buf = appendUint64(v.buf, uint64(i))
+	}
+	return nil
+}
+
+func (v *visitor) OnByte(b byte) error     { return v.OnUint64(uint64(b)) }
+func (v *visitor) OnUint8(u uint8) error   { return v.OnUint64(uint64(u)) }
+func (v *visitor) OnUint16(u uint16) error { return v.OnUint64(uint64(u)) }
+func (v *visitor) OnUint32(u uint32) error { return v.OnUint64(uint64(u)) }
+func (v *visitor) OnUint(u uint) error     { return v.OnUint64(uint64(u)) }
+
+func (v *visitor) OnUint64(u uint64) error {
+	v.value()
+	switch {
+	case u < 128:
+		v.buf = append(v.buf, byte(u))
+	case u <= math.MaxUint8:
+		v.buf = append(v.buf, codeUint8, byte(u))
+	case u <= math.MaxUint16:
+		v.buf = append(v.buf, codeUint16)
+		v.buf = appendUint16(v.buf, uint16(u))
+	case u <= math.MaxUint32:
+		v.buf = append(v.buf, codeUint32)
+		v.buf = appendUint32(v.buf, uint32(u))
+	default:
+		v.buf = append(v.buf, codeUint64)
+		v.buf = appendUint64(v.buf, u)
+	}
+	return nil
+}
+
+func (v *visitor) OnFloat32(f float32) error {
+	v.value()
+	v.buf = append(v.buf, codeFloat32)
+	v.buf = appendUint32(v.buf, math.Float32bits(f))
+	return nil
+}
+
+func (v *visitor) OnFloat64(f float64) error {
+	v.value()
+	v.buf = append(v.buf, codeFloat64)
+	v.buf = appendUint64(v.buf, math.Float64bits(f))
+	return nil
+}
+
+func appendUint16(b []byte, u uint16) []byte {
+	return append(b, byte(u>>8), byte(u))
+}
+
+func appendUint32(b []byte, u uint32) []byte {
+	return append(b, byte(u>>24), byte(u>>16), byte(u>>8), byte(u))
+}
+
+func appendUint64(b []byte, u uint64) []byte {
+	return append(b, byte(u>>56), byte(u>>48), byte(u>>40), byte(u>>32),
+		byte(u>>24), byte(u>>16), byte(u>>8), byte(u))
+}
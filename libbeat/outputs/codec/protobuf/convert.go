@@ -0,0 +1,264 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package protobuf
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+const timestampMessage = "google.protobuf.Timestamp"
+
+// setField converts an event value to the type of the message field, and sets
+// the field.
+func setField(msg protoreflect.Message, fd protoreflect.FieldDescriptor, v interface{}) error {
+	switch {
+	case fd.IsList():
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return fmt.Errorf("expected an array for repeated field, got %T", v)
+		}
+		list := msg.Mutable(fd).List()
+		for i := 0; i < rv.Len(); i++ {
+			elem, err := convertValue(list.NewElement, fd, rv.Index(i).Interface())
+			if err != nil {
+				return err
+			}
+			list.Append(elem)
+		}
+		return nil
+
+	case fd.IsMap():
+		m, ok := toMap(v)
+		if !ok {
+			return fmt.Errorf("expected an object for map field, got %T", v)
+		}
+		if fd.MapKey().Kind() != protoreflect.StringKind {
+			return fmt.Errorf("only map fields with string keys are supported")
+		}
+		pm := msg.Mutable(fd).Map()
+		for k, elem := range m {
+			val, err := convertValue(pm.NewValue, fd.MapValue(), elem)
+			if err != nil {
+				return fmt.Errorf("key %v: %v", k, err)
+			}
+			pm.Set(protoreflect.ValueOfString(k).MapKey(), val)
+		}
+		return nil
+
+	default:
+		val, err := convertValue(func() protoreflect.Value { return msg.NewField(fd) }, fd, v)
+		if err != nil {
+			return err
+		}
+		msg.Set(fd, val)
+		return nil
+	}
+}
+
+// convertValue converts a single value. newMessage creates an empty message
+// value, if the field is of message type.
+func convertValue(newMessage func() protoreflect.Value, fd protoreflect.FieldDescriptor, v interface{}) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		if b, ok := v.(bool); ok {
+			return protoreflect.ValueOfBool(b), nil
+		}
+
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		if i, ok := toInt64(v); ok && i >= math.MinInt32 && i <= math.MaxInt32 {
+			return protoreflect.ValueOfInt32(int32(i)), nil
+		}
+
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		if i, ok := toInt64(v); ok {
+			return protoreflect.ValueOfInt64(i), nil
+		}
+
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		if u, ok := toUint64(v); ok && u <= math.MaxUint32 {
+			return protoreflect.ValueOfUint32(uint32(u)), nil
+		}
+
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if u, ok := toUint64(v); ok {
+			return protoreflect.ValueOfUint64(u), nil
+		}
+
+	case protoreflect.FloatKind:
+		if f, ok := toFloat64(v); ok {
+			return protoreflect.ValueOfFloat32(float32(f)), nil
+		}
+
+	case protoreflect.DoubleKind:
+		if f, ok := toFloat64(v); ok {
+			return protoreflect.ValueOfFloat64(f), nil
+		}
+
+	case protoreflect.StringKind:
+		switch s := v.(type) {
+		case string:
+			return protoreflect.ValueOfString(s), nil
+		case []byte:
+			return protoreflect.ValueOfString(string(s)), nil
+		case time.Time:
+			return protoreflect.ValueOfString(formatTimestamp(s)), nil
+		case common.Time:
+			return protoreflect.ValueOfString(formatTimestamp(time.Time(s))), nil
+		}
+
+	case protoreflect.BytesKind:
+		switch b := v.(type) {
+		case []byte:
+			return protoreflect.ValueOfBytes(b), nil
+		case string:
+			return protoreflect.ValueOfBytes([]byte(b)), nil
+		}
+
+	case protoreflect.EnumKind:
+		if s, ok := v.(string); ok {
+			if ev := fd.Enum().Values().ByName(protoreflect.Name(s)); ev != nil {
+				return protoreflect.ValueOfEnum(ev.Number()), nil
+			}
+			return protoreflect.Value{}, fmt.Errorf("unknown value %v of enum %v", s, fd.Enum().FullName())
+		}
+		if i, ok := toInt64(v); ok && i >= math.MinInt32 && i <= math.MaxInt32 {
+			return protoreflect.ValueOfEnum(protoreflect.EnumNumber(i)), nil
+		}
+
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		val := newMessage()
+		if err := setMessage(val.Message(), v); err != nil {
+			return protoreflect.Value{}, err
+		}
+		return val, nil
+	}
+
+	return protoreflect.Value{}, fmt.Errorf("can not convert %T to %v", v, fd.Kind())
+}
+
+// setMessage sets the fields of a nested message. Timestamps are converted to
+// google.protobuf.Timestamp messages, objects are mapped to messages by field
+// name.
+func setMessage(msg protoreflect.Message, v interface{}) error {
+	desc := msg.Descriptor()
+	if desc.FullName() == timestampMessage {
+		var ts time.Time
+		switch t := v.(type) {
+		case time.Time:
+			ts = t
+		case common.Time:
+			ts = time.Time(t)
+		default:
+			return fmt.Errorf("can not convert %T to %v", v, timestampMessage)
+		}
+		msg.Set(desc.Fields().ByName("seconds"), protoreflect.ValueOfInt64(ts.Unix()))
+		msg.Set(desc.Fields().ByName("nanos"), protoreflect.ValueOfInt32(int32(ts.Nanosecond())))
+		return nil
+	}
+
+	m, ok := toMap(v)
+	if !ok {
+		return fmt.Errorf("can not convert %T to message %v", v, desc.FullName())
+	}
+	for k, elem := range m {
+		fd := desc.Fields().ByName(protoreflect.Name(k))
+		if fd == nil || elem == nil {
+			continue
+		}
+		if err := setField(msg, fd, elem); err != nil {
+			return fmt.Errorf("%v: %v", k, err)
+		}
+	}
+	return nil
+}
+
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+func toMap(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case common.MapStr:
+		return m, true
+	case map[string]interface{}:
+		return m, true
+	}
+	return nil, false
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint, uint8, uint16, uint32, uint64:
+		u, _ := toUint64(v)
+		return int64(u), u <= math.MaxInt64
+	case float32, float64:
+		f, _ := toFloat64(v)
+		return int64(f), f == math.Trunc(f) && f >= math.MinInt64 && f <= math.MaxInt64
+	}
+	return 0, false
+}
+
+func toUint64(v interface{}) (uint64, bool) {
+	switch n := v.(type) {
+	case uint:
+		return uint64(n), true
+	case uint8:
+		return uint64(n), true
+	case uint16:
+		return uint64(n), true
+	case uint32:
+		return uint64(n), true
+	case uint64:
+		return n, true
+	}
+	i, ok := toInt64(v)
+	return uint64(i), ok && i >= 0
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	if i, ok := toInt64(v); ok {
+		return float64(i), true
+	}
+	if u, ok := toUint64(v); ok {
+		return float64(u), true
+	}
+	return 0, false
+}
@@ -0,0 +1,171 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package protobuf
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/paths"
+)
+
+// Encoder for serializing a beat.Event to a protobuf message.
+type Encoder struct {
+	buf     []byte
+	msg     *dynamicpb.Message
+	desc    protoreflect.MessageDescriptor
+	fields  []fieldMapping
+	version string
+}
+
+// fieldMapping maps a top-level field of the message to an event field.
+type fieldMapping struct {
+	desc protoreflect.FieldDescriptor
+	key  string
+}
+
+// Config is used to pass encoding parameters to the codec.
+type Config struct {
+	DescriptorSet string            `config:"descriptor_set" validate:"required"`
+	Message       string            `config:"message" validate:"required"`
+	Mapping       map[string]string `config:"mapping"`
+}
+
+func init() {
+	codec.RegisterType("protobuf", func(info beat.Info, cfg *common.Config) (codec.Codec, error) {
+		if cfg == nil {
+			return nil, errors.New("protobuf codec requires a descriptor_set and message")
+		}
+
+		var config Config
+		if err := cfg.Unpack(&config); err != nil {
+			return nil, err
+		}
+
+		desc, err := loadMessageDescriptor(paths.Resolve(paths.Config, config.DescriptorSet), config.Message)
+		if err != nil {
+			return nil, err
+		}
+		return New(info.Version, desc, config.Mapping)
+	})
+}
+
+// loadMessageDescriptor reads a serialized FileDescriptorSet, as written by
+// `protoc --include_imports --descriptor_set_out`, and returns the descriptor
+// of the message.
+func loadMessageDescriptor(path, message string) (protoreflect.MessageDescriptor, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read descriptor set: %v", err)
+	}
+
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(contents, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse descriptor set %v: %v", path, err)
+	}
+
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor set %v: %v", path, err)
+	}
+
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(message))
+	if err != nil {
+		return nil, fmt.Errorf("message %v not found in %v: %v", message, path, err)
+	}
+	msgDesc, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%v is not a message", message)
+	}
+	return msgDesc, nil
+}
+
+// New creates a new protobuf Encoder. The mapping maps message field names to
+// event fields. Message fields without mapping are read from the event field
+// with the same name.
+func New(version string, desc protoreflect.MessageDescriptor, mapping map[string]string) (*Encoder, error) {
+	for name := range mapping {
+		if desc.Fields().ByName(protoreflect.Name(name)) == nil {
+			return nil, fmt.Errorf("message %v has no field %v", desc.FullName(), name)
+		}
+	}
+
+	fields := make([]fieldMapping, desc.Fields().Len())
+	for i := range fields {
+		fd := desc.Fields().Get(i)
+		key, ok := mapping[string(fd.Name())]
+		if !ok {
+			key = string(fd.Name())
+		}
+		fields[i] = fieldMapping{desc: fd, key: key}
+	}
+
+	return &Encoder{
+		msg:     dynamicpb.NewMessage(desc),
+		desc:    desc,
+		fields:  fields,
+		version: version,
+	}, nil
+}
+
+// Encode serializes a beat event to a protobuf message. Event fields are
+// looked up like in processors, with `@timestamp` and `@metadata` providing
+// the same values as in the json codec. Missing fields are not set.
+func (e *Encoder) Encode(index string, event *beat.Event) ([]byte, error) {
+	msg := e.msg
+	proto.Reset(msg)
+	for _, field := range e.fields {
+		v, err := e.getValue(index, event, field.key)
+		if err != nil || v == nil {
+			continue
+		}
+
+		if err := setField(msg, field.desc, v); err != nil {
+			return nil, fmt.Errorf("failed to encode field %v: %v", field.key, err)
+		}
+	}
+
+	var err error
+	e.buf, err = proto.MarshalOptions{}.MarshalAppend(e.buf[:0], msg)
+	if err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+func (e *Encoder) getValue(index string, event *beat.Event, key string) (interface{}, error) {
+	switch key {
+	case "@metadata.beat":
+		return index, nil
+	case "@metadata.type":
+		return "_doc", nil
+	case "@metadata.version":
+		return e.version, nil
+	}
+	return event.GetValue(key)
+}
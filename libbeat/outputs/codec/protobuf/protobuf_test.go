@@ -0,0 +1,251 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package protobuf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+)
+
+func testFileDescriptor() *descriptorpb.FileDescriptorProto {
+	field := func(name string, num int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string, repeated bool) *descriptorpb.FieldDescriptorProto {
+		label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+		if repeated {
+			label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+		}
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(num),
+			Type:     typ.Enum(),
+			Label:    label.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+
+	return &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("test/event.proto"),
+		Package:    proto.String("test"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto"},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Level"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("UNKNOWN"), Number: proto.Int32(0)},
+				{Name: proto.String("INFO"), Number: proto.Int32(1)},
+				{Name: proto.String("ERROR"), Number: proto.Int32(2)},
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Host"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, "", false),
+					field("ip", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, "", true),
+				},
+			},
+			{
+				Name: proto.String("Event"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("timestamp", 1, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Timestamp", false),
+					field("message", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, "", false),
+					field("beat", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING, "", false),
+					field("count", 4, descriptorpb.FieldDescriptorProto_TYPE_INT64, "", false),
+					field("ratio", 5, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, "", false),
+					field("level", 6, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".test.Level", false),
+					field("host", 7, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".test.Host", false),
+					field("tags", 8, descriptorpb.FieldDescriptorProto_TYPE_STRING, "", true),
+					field("created", 9, descriptorpb.FieldDescriptorProto_TYPE_STRING, "", false),
+				},
+			},
+		},
+	}
+}
+
+func testMessageDescriptor(t testing.TB) protoreflect.MessageDescriptor {
+	fd, err := protodesc.NewFile(testFileDescriptor(), protoregistry.GlobalFiles)
+	require.NoError(t, err)
+	return fd.Messages().ByName("Event")
+}
+
+var testMapping = map[string]string{
+	"timestamp": "@timestamp",
+	"beat":      "@metadata.beat",
+	"count":     "event.count",
+	"created":   "event.created",
+}
+
+func TestEncoder(t *testing.T) {
+	ts := time.Date(2020, 11, 5, 10, 15, 20, 123000000, time.UTC)
+
+	tests := map[string]struct {
+		fields   common.MapStr
+		expected string
+		err      bool
+	}{
+		"mapped fields": {
+			fields: common.MapStr{
+				"message": "hello",
+				"event":   common.MapStr{"count": 3, "created": ts},
+				"ratio":   0.5,
+				"level":   "ERROR",
+				"host":    common.MapStr{"name": "h1", "ip": []string{"10.0.0.1", "10.0.0.2"}, "os": "linux"},
+				"tags":    []interface{}{"a", "b"},
+			},
+			expected: `{
+				"timestamp": "2020-11-05T10:15:20.123Z",
+				"message": "hello",
+				"beat": "test",
+				"count": "3",
+				"ratio": 0.5,
+				"level": "ERROR",
+				"host": {"name": "h1", "ip": ["10.0.0.1", "10.0.0.2"]},
+				"tags": ["a", "b"],
+				"created": "2020-11-05T10:15:20.123Z"
+			}`,
+		},
+		"missing fields are not set": {
+			fields: common.MapStr{"message": "hello", "level": 1},
+			expected: `{
+				"timestamp": "2020-11-05T10:15:20.123Z",
+				"message": "hello",
+				"beat": "test",
+				"level": "INFO"
+			}`,
+		},
+		"invalid type": {
+			fields: common.MapStr{"message": common.MapStr{"a": 1}},
+			err:    true,
+		},
+		"fractional number for integer": {
+			fields: common.MapStr{"event": common.MapStr{"count": 1.5}},
+			err:    true,
+		},
+		"unknown enum value": {
+			fields: common.MapStr{"level": "DEBUG"},
+			err:    true,
+		},
+	}
+
+	// the encoder is shared to check it does not keep fields of previous events
+	desc := testMessageDescriptor(t)
+	encoder, err := New("1.2.3", desc, testMapping)
+	require.NoError(t, err)
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			data, err := encoder.Encode("test", &beat.Event{Timestamp: ts, Fields: test.fields})
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			msg := dynamicpb.NewMessage(desc)
+			require.NoError(t, proto.Unmarshal(data, msg))
+			actual, err := protojson.Marshal(msg)
+			require.NoError(t, err)
+			assert.JSONEq(t, test.expected, string(actual))
+		})
+	}
+}
+
+func TestNewInvalidMapping(t *testing.T) {
+	_, err := New("1.2.3", testMessageDescriptor(t), map[string]string{"unknown": "message"})
+	assert.Error(t, err)
+}
+
+func TestCodecConfig(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "protobuf")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(timestamppb.File_google_protobuf_timestamp_proto),
+		testFileDescriptor(),
+	}}
+	contents, err := proto.Marshal(set)
+	require.NoError(t, err)
+	path := filepath.Join(tmp, "event.desc")
+	require.NoError(t, ioutil.WriteFile(path, contents, 0600))
+
+	tests := map[string]struct {
+		config map[string]interface{}
+		err    bool
+	}{
+		"valid": {
+			config: map[string]interface{}{"descriptor_set": path, "message": "test.Event"},
+		},
+		"unknown message": {
+			config: map[string]interface{}{"descriptor_set": path, "message": "test.Unknown"},
+			err:    true,
+		},
+		"not a message": {
+			config: map[string]interface{}{"descriptor_set": path, "message": "test.Level"},
+			err:    true,
+		},
+		"missing descriptor set": {
+			config: map[string]interface{}{"descriptor_set": filepath.Join(tmp, "missing"), "message": "test.Event"},
+			err:    true,
+		},
+		"missing message": {
+			config: map[string]interface{}{"descriptor_set": path},
+			err:    true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var config codec.Config
+			cfg := common.MustNewConfigFrom(map[string]interface{}{"protobuf": test.config})
+			require.NoError(t, cfg.Unpack(&config))
+
+			enc, err := codec.CreateEncoder(beat.Info{Version: "1.2.3"}, config)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			data, err := enc.Encode("test", &beat.Event{Fields: common.MapStr{"message": "hello"}})
+			require.NoError(t, err)
+			assert.NotEmpty(t, data)
+		})
+	}
+}
@@ -0,0 +1,309 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.elastic.co/apm"
+
+	"github.com/elastic/beats/v7/libbeat/beat/events"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/esleg/eslegclient"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/outil"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+)
+
+// chunkEncoder encodes the bulk items of a batch once, so the batch can be
+// split into requests by number of events and encoded size.
+type chunkEncoder struct {
+	buf bytes.Buffer
+	enc eslegclient.BulkWriter
+}
+
+// bulkChunk is a range of the encoded items sent in one bulk request.
+type bulkChunk struct {
+	start, end   int
+	bytes        int
+	bytesLimited bool
+}
+
+type chunkResult struct {
+	failed  []publisher.Event
+	stats   bulkResultStats
+	status  int
+	err     error
+	latency time.Duration
+}
+
+func newChunkEncoder(escapeHTML bool) *chunkEncoder {
+	c := &chunkEncoder{}
+	c.enc = eslegclient.NewJSONEncoder(&c.buf, escapeHTML)
+	return c
+}
+
+// encode returns the events that could be encoded and their bulk items.
+// Events larger than maxBytes are dropped. The items are only valid until the
+// next call.
+func (c *chunkEncoder) encode(
+	log *logp.Logger,
+	version common.Version,
+	index outputs.IndexSelector,
+	pipeline *outil.Selector,
+	data []publisher.Event,
+	maxBytes int,
+) ([]publisher.Event, []eslegclient.EncodedItem) {
+	c.buf.Reset()
+
+	okEvents := data[:0]
+	ends := make([]int, 0, len(data))
+	for i := range data {
+		event := &data[i].Content
+		meta, err := createEventBulkMeta(log, version, index, pipeline, event)
+		if err != nil {
+			log.Errorf("Failed to encode event meta data: %+v", err)
+			continue
+		}
+
+		start := c.buf.Len()
+		err = c.enc.AddRaw(meta)
+		if err == nil && events.GetOpType(*event) != events.OpTypeDelete {
+			err = c.enc.AddRaw(event)
+		}
+		if err != nil {
+			c.buf.Truncate(start)
+			log.Errorf("Failed to encode event: %+v", err)
+			continue
+		}
+
+		if size := c.buf.Len() - start; maxBytes > 0 && size > maxBytes {
+			c.buf.Truncate(start)
+			log.Errorf("Dropping event of %d bytes, exceeding bulk_max_bytes of %d bytes", size, maxBytes)
+			continue
+		}
+
+		ends = append(ends, c.buf.Len())
+		okEvents = append(okEvents, data[i])
+	}
+
+	raw := c.buf.Bytes()
+	items := make([]eslegclient.EncodedItem, len(ends))
+	start := 0
+	for i, end := range ends {
+		items[i] = raw[start:end]
+		start = end
+	}
+	return okEvents, items
+}
+
+// splitChunks splits the items into requests of at most maxEvents events and
+// maxBytes bytes. A limit of 0 disables the check.
+func splitChunks(items []eslegclient.EncodedItem, maxEvents, maxBytes int) []bulkChunk {
+	var chunks []bulkChunk
+	current := bulkChunk{}
+	for i, item := range items {
+		n := i - current.start
+		if n > 0 {
+			eventsFull := maxEvents > 0 && n >= maxEvents
+			bytesFull := maxBytes > 0 && current.bytes+len(item) > maxBytes
+			if eventsFull || bytesFull {
+				current.end = i
+				current.bytesLimited = !eventsFull
+				chunks = append(chunks, current)
+				current = bulkChunk{start: i}
+			}
+		}
+		current.bytes += len(item)
+	}
+
+	current.end = len(items)
+	if current.end > current.start {
+		chunks = append(chunks, current)
+	}
+	return chunks
+}
+
+// publishChunks sends the events in multiple bulk requests, limited by the
+// adaptive bulk size and bulk_max_bytes. Up to the adaptive concurrency
+// requests are sent in parallel, each using its own copy of the connection.
+// All events not published are returned.
+func (client *Client) publishChunks(ctx context.Context, data []publisher.Event) ([]publisher.Event, error) {
+	span, ctx := client.startPublish(ctx, data)
+	defer span.End()
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	origCount := len(data)
+	data, items := client.chunks.encode(client.log, client.conn.GetVersion(), client.index, client.pipeline, data, client.maxBulkBytes)
+	newCount := len(data)
+	client.reportEncoded(span, origCount, newCount)
+	if newCount == 0 {
+		return nil, nil
+	}
+
+	limit, concurrency, generation := 0, 1, uint64(0)
+	if client.sizer != nil {
+		limit, concurrency, generation = client.sizer.current()
+	}
+
+	chunks := splitChunks(items, limit, client.maxBulkBytes)
+	if concurrency > len(chunks) {
+		concurrency = len(chunks)
+	}
+	lanes, err := client.bulkLanes(concurrency)
+	if err != nil {
+		return data, err
+	}
+
+	results := make([]chunkResult, len(chunks))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for _, lane := range lanes {
+		lane := lane
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				chunk := chunks[i]
+				result := client.publishChunk(ctx, lane, data[chunk.start:chunk.end], items[chunk.start:chunk.end])
+				results[i] = result
+
+				if client.sizer != nil {
+					client.sizer.observe(bulkOutcome{
+						generation:   generation,
+						events:       chunk.end - chunk.start,
+						limit:        limit,
+						bytesLimited: chunk.bytesLimited,
+						latency:      result.latency,
+						tooMany:      result.status == 429 || result.stats.tooMany > 0,
+						failed:       result.err != nil || (result.status != 200 && result.status != 429),
+					})
+				}
+			}
+		}()
+	}
+	for i := range chunks {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	var (
+		failedEvents []publisher.Event
+		stats        bulkResultStats
+		sendErr      error
+	)
+	for _, result := range results {
+		failedEvents = append(failedEvents, result.failed...)
+		stats.add(result.stats)
+		if sendErr == nil {
+			sendErr = result.err
+		}
+	}
+
+	span.Context.SetLabel("events_published", newCount-len(failedEvents))
+	return client.reportPublished(span, newCount, failedEvents, stats, sendErr)
+}
+
+func (client *Client) publishChunk(
+	ctx context.Context,
+	conn *eslegclient.Connection,
+	data []publisher.Event,
+	items []eslegclient.EncodedItem,
+) chunkResult {
+	body := make([]interface{}, len(items))
+	for i, item := range items {
+		body[i] = item
+	}
+
+	begin := time.Now()
+	status, response, err := conn.Bulk(ctx, "", "", nil, body)
+	result := chunkResult{status: status, latency: time.Since(begin)}
+
+	switch {
+	case err != nil:
+		err := apm.CaptureError(ctx, fmt.Errorf("failed to perform any bulk index operations: %w", err))
+		err.Send()
+		client.log.Error(err)
+		result.err = err
+		result.failed = data
+		result.stats.fails = len(data)
+	case status != 200:
+		result.failed = data
+		result.stats.fails = len(data)
+		if status == 429 {
+			result.stats.tooMany = len(data)
+		}
+	default:
+		result.failed, result.stats = bulkCollectPublishFails(client.log, response, data, client.nonIndexable)
+	}
+
+	client.log.Debugf("PublishEvents: %d events have been sent to elasticsearch in %v (status=%v).",
+		len(data), result.latency, status)
+	return result
+}
+
+// bulkLanes returns n connections for sending concurrent bulk requests. The
+// first is the connection of the client, the others are copies with their
+// own body encoder.
+func (client *Client) bulkLanes(n int) ([]*eslegclient.Connection, error) {
+	if len(client.lanes) == 0 {
+		client.lanes = []*eslegclient.Connection{&client.conn}
+	}
+	for len(client.lanes) < n {
+		lane := client.conn
+		enc, err := eslegclient.NewBodyEncoder(lane.CompressionLevel, lane.EscapeHTML)
+		if err != nil {
+			return nil, err
+		}
+		lane.Encoder = enc
+		client.lanes = append(client.lanes, &lane)
+	}
+	return client.lanes[:n], nil
+}
+
+// closeLanes closes the copies of the connection used for concurrent bulk
+// requests. The connection of the client is not closed.
+func (client *Client) closeLanes() {
+	for _, lane := range client.lanes {
+		if lane == &client.conn {
+			continue
+		}
+		if err := lane.Close(); err != nil {
+			client.log.Errorf("Failed to close bulk connection: %v", err)
+		}
+	}
+	client.lanes = nil
+}
+
+func (s *bulkResultStats) add(o bulkResultStats) {
+	s.acked += o.acked
+	s.duplicates += o.duplicates
+	s.fails += o.fails
+	s.nonIndexable += o.nonIndexable
+	s.deadLetter += o.deadLetter
+	s.tooMany += o.tooMany
+}
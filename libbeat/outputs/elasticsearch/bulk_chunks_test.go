@@ -0,0 +1,292 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// +build !integration
+
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/esleg/eslegclient"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/beats/v7/libbeat/outputs/outil"
+)
+
+func TestSplitChunks(t *testing.T) {
+	items := []eslegclient.EncodedItem{
+		bytes.Repeat([]byte("a"), 10),
+		bytes.Repeat([]byte("b"), 10),
+		bytes.Repeat([]byte("c"), 30),
+		bytes.Repeat([]byte("d"), 10),
+		bytes.Repeat([]byte("e"), 10),
+	}
+
+	tests := map[string]struct {
+		maxEvents, maxBytes int
+		expected            []bulkChunk
+	}{
+		"unlimited": {
+			expected: []bulkChunk{{start: 0, end: 5, bytes: 70}},
+		},
+		"events": {
+			maxEvents: 2,
+			expected: []bulkChunk{
+				{start: 0, end: 2, bytes: 20},
+				{start: 2, end: 4, bytes: 40},
+				{start: 4, end: 5, bytes: 10},
+			},
+		},
+		"bytes": {
+			maxBytes: 30,
+			expected: []bulkChunk{
+				{start: 0, end: 2, bytes: 20, bytesLimited: true},
+				{start: 2, end: 3, bytes: 30, bytesLimited: true},
+				{start: 3, end: 5, bytes: 20},
+			},
+		},
+		"events and bytes": {
+			maxEvents: 3,
+			maxBytes:  45,
+			expected: []bulkChunk{
+				{start: 0, end: 2, bytes: 20, bytesLimited: true},
+				{start: 2, end: 4, bytes: 40, bytesLimited: true},
+				{start: 4, end: 5, bytes: 10},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.expected, splitChunks(items, test.maxEvents, test.maxBytes))
+		})
+	}
+}
+
+func TestPublishChunksMaxBytes(t *testing.T) {
+	es := newBulkServer(t, nil)
+	defer es.Close()
+
+	client := newChunkedClient(t, es.URL, nil, 1024)
+
+	var events []beat.Event
+	for i := 0; i < 20; i++ {
+		events = append(events, testChunkEvent(100))
+	}
+	events = append(events, testChunkEvent(2048))
+
+	batch := outest.NewBatch(events...)
+	require.NoError(t, client.Publish(context.Background(), batch))
+	assert.Equal(t, []outest.BatchSignal{{Tag: outest.BatchACK}}, batch.Signals)
+
+	requests := es.bulkRequests()
+	assert.True(t, len(requests) > 1)
+	total := 0
+	for _, req := range requests {
+		assert.True(t, len(req) <= 1024, "request of %d bytes exceeds the limit", len(req))
+		total += strings.Count(req, "\n") / 2
+	}
+	assert.Equal(t, 20, total, "oversized event must be dropped")
+}
+
+func TestPublishChunksAdaptive(t *testing.T) {
+	var tooMany bool
+	es := newBulkServer(t, func() int {
+		if tooMany {
+			return http.StatusTooManyRequests
+		}
+		return http.StatusOK
+	})
+	defer es.Close()
+
+	config := adaptiveConfig{
+		MinSize:        2,
+		MaxSize:        8,
+		Step:           2,
+		DecreaseFactor: 0.5,
+		TargetLatency:  time.Minute,
+		MaxConcurrency: 2,
+	}
+	sizer := newBulkSizer(config, 4, nil)
+	client := newChunkedClient(t, es.URL, sizer, 0)
+
+	publish := func(n int) *outest.Batch {
+		var events []beat.Event
+		for i := 0; i < n; i++ {
+			events = append(events, testChunkEvent(10))
+		}
+		batch := outest.NewBatch(events...)
+		client.Publish(context.Background(), batch)
+		return batch
+	}
+
+	// Full requests grow the size to the maximum, then the concurrency.
+	publish(4)
+	size, concurrency, _ := sizer.current()
+	assert.Equal(t, 6, size)
+	assert.Equal(t, 1, concurrency)
+
+	publish(6)
+	publish(8)
+	size, concurrency, _ = sizer.current()
+	assert.Equal(t, 8, size)
+	assert.Equal(t, 2, concurrency)
+
+	// Both concurrent requests are rejected, the size is decreased once.
+	tooMany = true
+	batch := publish(16)
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchRetryEvents, batch.Signals[0].Tag)
+	assert.Len(t, batch.Signals[0].Events, 16)
+
+	size, concurrency, _ = sizer.current()
+	assert.Equal(t, 4, size)
+	assert.Equal(t, 1, concurrency)
+	assert.Equal(t, 2, es.maxInFlight())
+}
+
+func TestConnectClosesBulkLanes(t *testing.T) {
+	es := newBulkServer(t, nil)
+	defer es.Close()
+
+	client := newChunkedClient(t, es.URL, nil, 1024)
+	lanes, err := client.bulkLanes(2)
+	require.NoError(t, err)
+	require.Len(t, lanes, 2)
+
+	httpClient := &closeCountingHTTPClient{esHTTPClient: lanes[1].HTTP}
+	lanes[1].HTTP = httpClient
+
+	require.NoError(t, client.Connect())
+	assert.Equal(t, 1, httpClient.closed)
+	assert.Empty(t, client.lanes)
+}
+
+type esHTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+	CloseIdleConnections()
+}
+
+type closeCountingHTTPClient struct {
+	esHTTPClient
+	closed int
+}
+
+func (c *closeCountingHTTPClient) CloseIdleConnections() {
+	c.closed++
+	c.esHTTPClient.CloseIdleConnections()
+}
+
+type bulkServer struct {
+	*httptest.Server
+
+	status func() int
+
+	mu       sync.Mutex
+	requests []string
+	inFlight int
+	peak     int
+}
+
+func newBulkServer(t *testing.T, status func() int) *bulkServer {
+	s := &bulkServer{status: status}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprintln(w, `{ "version": { "number": "7.9.0" } }`)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		s.mu.Lock()
+		s.requests = append(s.requests, string(body))
+		s.inFlight++
+		if s.inFlight > s.peak {
+			s.peak = s.inFlight
+		}
+		s.mu.Unlock()
+
+		// give concurrent requests the chance to overlap
+		time.Sleep(20 * time.Millisecond)
+
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+
+		if s.status != nil {
+			if code := s.status(); code != http.StatusOK {
+				w.WriteHeader(code)
+				return
+			}
+		}
+
+		items := make([]string, strings.Count(string(body), "\n")/2)
+		for i := range items {
+			items[i] = `{"create":{"status":201}}`
+		}
+		fmt.Fprintf(w, `{"items":[%s]}`, strings.Join(items, ","))
+	}))
+	return s
+}
+
+func (s *bulkServer) bulkRequests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func (s *bulkServer) maxInFlight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.peak
+}
+
+func newChunkedClient(t *testing.T, url string, sizer *bulkSizer, maxBytes int) *Client {
+	client, err := NewClient(ClientSettings{
+		ConnectionSettings: eslegclient.ConnectionSettings{URL: url},
+		Index:              outil.MakeSelector(outil.ConstSelectorExpr("test", outil.SelectorLowerCase)),
+
+		bulkSizer:    sizer,
+		maxBulkBytes: maxBytes,
+	}, nil)
+	require.NoError(t, err)
+	require.NoError(t, client.Connect())
+	return client
+}
+
+func testChunkEvent(size int) beat.Event {
+	return beat.Event{
+		Timestamp: time.Now(),
+		Fields:    common.MapStr{"message": strings.Repeat("x", size)},
+	}
+}
@@ -0,0 +1,149 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+)
+
+// bulkSizer adapts the number of events per bulk request and the number of
+// concurrent bulk requests to the load Elasticsearch can handle (AIMD).
+// Requests that fill the current size grow it by a constant step, until the
+// maximum size or the byte limit is reached, at which point the concurrency
+// grows instead. 429 responses and failed requests shrink both by the
+// decrease factor. Requests slower than the target latency first reduce the
+// concurrency, then the size.
+//
+// The sizer is shared by all clients of the output, as they all load the
+// same cluster.
+type bulkSizer struct {
+	log      *logp.Logger
+	config   adaptiveConfig
+	observer outputs.BulkSizeObserver
+
+	mu          sync.Mutex
+	size        int
+	concurrency int
+
+	// generation is incremented on every decrease. Outcomes of requests sent
+	// before the last decrease are ignored when they would decrease again, so
+	// that concurrent requests failing together shrink the size only once.
+	generation uint64
+}
+
+// bulkOutcome describes the result of a bulk request.
+type bulkOutcome struct {
+	generation   uint64        // generation of the sizer when the request was created
+	events       int           // number of events in the request
+	limit        int           // events per request limit when the request was created
+	bytesLimited bool          // the request was cut short by bulk_max_bytes
+	latency      time.Duration // duration of the request
+	tooMany      bool          // Elasticsearch replied with 429 for the request or any item
+	failed       bool          // the request failed or returned an unexpected status
+}
+
+func newBulkSizer(config adaptiveConfig, initial int, observer outputs.Observer) *bulkSizer {
+	s := &bulkSizer{
+		log:         logp.NewLogger(logSelector),
+		config:      config,
+		size:        clampInt(initial, config.MinSize, config.MaxSize),
+		concurrency: 1,
+	}
+	if obs, ok := observer.(outputs.BulkSizeObserver); ok {
+		s.observer = obs
+	}
+	s.report()
+	return s
+}
+
+// current returns the events per request, the number of concurrent requests
+// and the generation to record in the outcome of the requests.
+func (s *bulkSizer) current() (size, concurrency int, generation uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size, s.concurrency, s.generation
+}
+
+func (s *bulkSizer) observe(o bulkOutcome) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size, concurrency := s.size, s.concurrency
+	switch {
+	case o.tooMany || o.failed:
+		if o.generation != s.generation {
+			return
+		}
+		s.size = s.decrease(s.size, s.config.MinSize)
+		s.concurrency = s.decrease(s.concurrency, 1)
+		s.generation++
+
+	case o.latency > s.config.TargetLatency:
+		if o.generation != s.generation {
+			return
+		}
+		if s.concurrency > 1 {
+			s.concurrency--
+		} else {
+			s.size = s.decrease(s.size, s.config.MinSize)
+		}
+		s.generation++
+
+	case o.bytesLimited:
+		if s.concurrency < s.config.MaxConcurrency {
+			s.concurrency++
+		}
+
+	case o.events >= o.limit:
+		if s.size < s.config.MaxSize {
+			s.size = clampInt(s.size+s.config.Step, s.config.MinSize, s.config.MaxSize)
+		} else if s.concurrency < s.config.MaxConcurrency {
+			s.concurrency++
+		}
+	}
+
+	if s.size != size || s.concurrency != concurrency {
+		s.log.Debugf("Adapted bulk size to %d events with %d concurrent requests (was %d events, %d requests)",
+			s.size, s.concurrency, size, concurrency)
+		s.report()
+	}
+}
+
+func (s *bulkSizer) decrease(v, min int) int {
+	return clampInt(int(float64(v)*s.config.DecreaseFactor), min, v)
+}
+
+func (s *bulkSizer) report() {
+	if s.observer != nil {
+		s.observer.BulkSize(s.size, s.concurrency)
+	}
+}
+
+func clampInt(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
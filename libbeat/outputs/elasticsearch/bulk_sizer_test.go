@@ -0,0 +1,141 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// +build !integration
+
+package elasticsearch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+)
+
+func TestBulkSizer(t *testing.T) {
+	config := adaptiveConfig{
+		MinSize:        10,
+		MaxSize:        200,
+		Step:           50,
+		DecreaseFactor: 0.5,
+		TargetLatency:  time.Second,
+		MaxConcurrency: 3,
+	}
+
+	type state struct{ size, concurrency int }
+	tests := map[string]struct {
+		initial  int
+		outcomes []bulkOutcome
+		expected []state
+	}{
+		"initial size is clamped": {
+			initial:  1000,
+			expected: []state{},
+		},
+		"grows size then concurrency on full requests": {
+			initial: 100,
+			outcomes: []bulkOutcome{
+				{events: 100, limit: 100},
+				{events: 150, limit: 150},
+				{events: 200, limit: 200},
+				{events: 200, limit: 200},
+				{events: 200, limit: 200},
+			},
+			expected: []state{{150, 1}, {200, 1}, {200, 2}, {200, 3}, {200, 3}},
+		},
+		"does not grow on partial requests": {
+			initial:  100,
+			outcomes: []bulkOutcome{{events: 20, limit: 100}},
+			expected: []state{{100, 1}},
+		},
+		"grows concurrency when limited by bytes": {
+			initial:  100,
+			outcomes: []bulkOutcome{{events: 20, limit: 100, bytesLimited: true}},
+			expected: []state{{100, 2}},
+		},
+		"decreases on too many requests": {
+			initial: 200,
+			outcomes: []bulkOutcome{
+				{events: 200, limit: 200},
+				{events: 200, limit: 200},
+				{generation: 0, tooMany: true},
+				{generation: 1, failed: true},
+				{generation: 2, failed: true},
+				{generation: 3, failed: true},
+			},
+			expected: []state{{200, 2}, {200, 3}, {100, 1}, {50, 1}, {25, 1}, {12, 1}},
+		},
+		"ignores decreases of older generations": {
+			initial: 200,
+			outcomes: []bulkOutcome{
+				{generation: 0, tooMany: true},
+				{generation: 0, tooMany: true},
+				{generation: 0, latency: 2 * time.Second},
+			},
+			expected: []state{{100, 1}, {100, 1}, {100, 1}},
+		},
+		"high latency reduces concurrency first": {
+			initial: 200,
+			outcomes: []bulkOutcome{
+				{events: 200, limit: 200},
+				{generation: 0, latency: 2 * time.Second},
+				{generation: 1, latency: 2 * time.Second},
+			},
+			expected: []state{{200, 2}, {200, 1}, {100, 1}},
+		},
+		"never below min size": {
+			initial: 15,
+			outcomes: []bulkOutcome{
+				{generation: 0, tooMany: true},
+				{generation: 1, tooMany: true},
+			},
+			expected: []state{{10, 1}, {10, 1}},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			sizer := newBulkSizer(config, test.initial, nil)
+			size, concurrency, _ := sizer.current()
+			assert.True(t, size >= config.MinSize && size <= config.MaxSize)
+			assert.Equal(t, 1, concurrency)
+
+			for i, outcome := range test.outcomes {
+				sizer.observe(outcome)
+				size, concurrency, _ := sizer.current()
+				assert.Equal(t, test.expected[i], state{size, concurrency}, "after outcome %d", i)
+			}
+		})
+	}
+}
+
+func TestBulkSizerReportsMetrics(t *testing.T) {
+	reg := monitoring.NewRegistry()
+	stats := outputs.NewStats(reg)
+
+	config := defaultConfig.BulkAdaptive
+	sizer := newBulkSizer(config, 50, stats)
+	assert.Equal(t, int64(50), reg.Get("bulk.size").(*monitoring.Int).Get())
+	assert.Equal(t, int64(1), reg.Get("bulk.concurrency").(*monitoring.Int).Get())
+
+	sizer.observe(bulkOutcome{events: 50, limit: 50})
+	assert.Equal(t, int64(50+config.Step), reg.Get("bulk.size").(*monitoring.Int).Get())
+}
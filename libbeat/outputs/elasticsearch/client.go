@@ -47,6 +47,15 @@ type Client struct {
 
 	observer outputs.Observer
 
+	nonIndexable nonIndexablePolicy
+
+	// sizer adapts the events per bulk request, if enabled. Together with
+	// maxBulkBytes it makes the client split batches into multiple requests.
+	sizer        *bulkSizer
+	maxBulkBytes int
+	chunks       *chunkEncoder
+	lanes        []*eslegclient.Connection
+
 	log *logp.Logger
 }
 
@@ -56,6 +65,18 @@ type ClientSettings struct {
 	Index    outputs.IndexSelector
 	Pipeline *outil.Selector
 	Observer outputs.Observer
+
+	// nonIndexablePolicy handles events rejected by Elasticsearch. Events
+	// are dropped if not set.
+	nonIndexablePolicy nonIndexablePolicy
+
+	// bulkSizer adapts the bulk size at runtime. It is shared by all clients
+	// of an output. The bulk size is fixed if not set.
+	bulkSizer *bulkSizer
+
+	// maxBulkBytes limits the size of the uncompressed bulk request body.
+	// Unlimited if 0.
+	maxBulkBytes int
 }
 
 type bulkResultStats struct {
@@ -63,6 +84,7 @@ type bulkResultStats struct {
 	duplicates   int // number of events failed with `create` due to ID already being indexed
 	fails        int // number of failed events (can be retried)
 	nonIndexable int // number of failed events (not indexable -> must be dropped)
+	deadLetter   int // number of failed events (not indexable -> sent again as dead letter record)
 	tooMany      int // number of events receiving HTTP 429 Too Many Requests
 }
 
@@ -125,6 +147,12 @@ func NewClient(
 		return nil
 	}
 
+	log := logp.NewLogger("elasticsearch")
+	nonIndexable := s.nonIndexablePolicy
+	if nonIndexable == nil {
+		nonIndexable = &dropPolicy{log: log}
+	}
+
 	client := &Client{
 		conn:     *conn,
 		index:    s.Index,
@@ -132,7 +160,13 @@ func NewClient(
 
 		observer: s.Observer,
 
-		log: logp.NewLogger("elasticsearch"),
+		nonIndexable: nonIndexable,
+
+		sizer:        s.bulkSizer,
+		maxBulkBytes: s.maxBulkBytes,
+		chunks:       newChunkEncoder(s.EscapeHTML),
+
+		log: log,
 	}
 
 	return client, nil
@@ -169,6 +203,8 @@ func (client *Client) Clone() *Client {
 			},
 			Index:    client.index,
 			Pipeline: client.pipeline,
+
+			nonIndexablePolicy: client.nonIndexable,
 		},
 		nil, // XXX: do not pass connection callback?
 	)
@@ -177,10 +213,20 @@ func (client *Client) Clone() *Client {
 
 func (client *Client) Publish(ctx context.Context, batch publisher.Batch) error {
 	events := batch.Events()
-	rest, err := client.publishEvents(ctx, events)
-	if len(rest) == 0 {
+	publish := client.publishEvents
+	if client.sizer != nil || client.maxBulkBytes > 0 {
+		publish = client.publishChunks
+	}
+
+	rest, err := publish(ctx, events)
+	switch {
+	case len(rest) == 0:
 		batch.ACK()
-	} else {
+	case err == nil:
+		// Only dead letter records are left. They are sent again without
+		// reducing the retries of the events.
+		batch.CancelledEvents(rest)
+	default:
 		batch.RetryEvents(rest)
 	}
 	return err
@@ -190,14 +236,9 @@ func (client *Client) Publish(ctx context.Context, batch publisher.Batch) error
 // events not published or confirmed to be processed by elasticsearch will be
 // returned. The input slice backing memory will be reused by return the value.
 func (client *Client) publishEvents(ctx context.Context, data []publisher.Event) ([]publisher.Event, error) {
-	span, ctx := apm.StartSpan(ctx, "publishEvents", "output")
+	span, ctx := client.startPublish(ctx, data)
 	defer span.End()
 	begin := time.Now()
-	st := client.observer
-
-	if st != nil {
-		st.NewBatch(len(data))
-	}
 
 	if len(data) == 0 {
 		return nil, nil
@@ -206,13 +247,9 @@ func (client *Client) publishEvents(ctx context.Context, data []publisher.Event)
 	// encode events into bulk request buffer, dropping failed elements from
 	// events slice
 	origCount := len(data)
-	span.Context.SetLabel("events_original", origCount)
 	data, bulkItems := bulkEncodePublishRequest(client.log, client.conn.GetVersion(), client.index, client.pipeline, data)
 	newCount := len(data)
-	span.Context.SetLabel("events_encoded", newCount)
-	if st != nil && origCount > newCount {
-		st.Dropped(origCount - newCount)
-	}
+	client.reportEncoded(span, origCount, newCount)
 	if newCount == 0 {
 		return nil, nil
 	}
@@ -238,30 +275,70 @@ func (client *Client) publishEvents(ctx context.Context, data []publisher.Event)
 		failedEvents = data
 		stats.fails = len(failedEvents)
 	} else {
-		failedEvents, stats = bulkCollectPublishFails(client.log, result, data)
+		failedEvents, stats = bulkCollectPublishFails(client.log, result, data, client.nonIndexable)
 	}
 
-	failed := len(failedEvents)
+	return client.reportPublished(span, len(data), failedEvents, stats, nil)
+}
+
+// startPublish starts the APM span of a publish operation and reports the new
+// batch to the observer.
+func (client *Client) startPublish(ctx context.Context, data []publisher.Event) (*apm.Span, context.Context) {
+	span, ctx := apm.StartSpan(ctx, "publishEvents", "output")
+	if st := client.observer; st != nil {
+		st.NewBatch(len(data))
+	}
+	return span, ctx
+}
+
+// reportEncoded reports the events dropped because they could not be
+// encoded.
+func (client *Client) reportEncoded(span *apm.Span, origCount, newCount int) {
+	span.Context.SetLabel("events_original", origCount)
+	span.Context.SetLabel("events_encoded", newCount)
+	if st := client.observer; st != nil && origCount > newCount {
+		st.Dropped(origCount - newCount)
+	}
+}
+
+// reportPublished reports the outcome of publishing count encoded events. It
+// returns the events that must be sent again, including stats.deadLetter dead
+// letter records. sendErr or ErrTempBulkFailure is only returned if events
+// failed, dead letter records alone are not an error.
+func (client *Client) reportPublished(
+	span *apm.Span,
+	count int,
+	failedEvents []publisher.Event,
+	stats bulkResultStats,
+	sendErr error,
+) ([]publisher.Event, error) {
+	deadLetter := stats.deadLetter
+	failed := len(failedEvents) - deadLetter
 	span.Context.SetLabel("events_failed", failed)
 	if st := client.observer; st != nil {
 		dropped := stats.nonIndexable
 		duplicates := stats.duplicates
-		acked := len(data) - failed - dropped - duplicates
+		acked := count - failed - dropped - duplicates - deadLetter
 
 		st.Acked(acked)
 		st.Failed(failed)
 		st.Dropped(dropped)
 		st.Duplicate(duplicates)
 		st.ErrTooMany(stats.tooMany)
+		if dl, ok := st.(outputs.DeadLetterObserver); ok {
+			dl.DeadLetter(deadLetter)
+		} else {
+			st.Cancelled(deadLetter)
+		}
 	}
 
-	if failed > 0 {
-		if sendErr == nil {
-			sendErr = eslegclient.ErrTempBulkFailure
-		}
-		return failedEvents, sendErr
+	if len(failedEvents) == 0 {
+		return nil, nil
+	}
+	if failed > 0 && sendErr == nil {
+		sendErr = eslegclient.ErrTempBulkFailure
 	}
-	return nil, nil
+	return failedEvents, sendErr
 }
 
 // bulkEncodePublishRequest encodes all bulk requests and returns slice of events
@@ -306,6 +383,16 @@ func createEventBulkMeta(
 		eventType = defaultEventType
 	}
 
+	if index, err := events.GetMetaStringValue(*event, deadLetterIndexField); err == nil {
+		// Dead letter records are created without pipeline.
+		meta := eslegclient.BulkMeta{Index: index, DocType: eventType}
+		if isCreateOnly(indexSel) {
+			// the dead letter index can be a data stream as well
+			return eslegclient.BulkCreateAction{Create: meta}, nil
+		}
+		return eslegclient.BulkIndexAction{Index: meta}, nil
+	}
+
 	pipeline, err := getPipeline(event, pipelineSel)
 	if err != nil {
 		err := fmt.Errorf("failed to select pipeline: %v", err)
@@ -335,6 +422,10 @@ func createEventBulkMeta(
 			return nil, fmt.Errorf("%s %s requires _id", events.FieldMetaOpType, events.OpTypeDelete)
 		}
 	}
+	if isCreateOnly(indexSel) {
+		// data streams reject the index operation
+		return eslegclient.BulkCreateAction{Create: meta}, nil
+	}
 	if id != "" || version.Major > 7 || (version.Major == 7 && version.Minor >= 5) {
 		if opType == events.OpTypeIndex {
 			return eslegclient.BulkIndexAction{Index: meta}, nil
@@ -344,6 +435,11 @@ func createEventBulkMeta(
 	return eslegclient.BulkIndexAction{Index: meta}, nil
 }
 
+func isCreateOnly(indexSel outputs.IndexSelector) bool {
+	sel, ok := indexSel.(outputs.CreateOnlySelector)
+	return ok && sel.CreateOnly()
+}
+
 func getPipeline(event *beat.Event, pipelineSel *outil.Selector) (string, error) {
 	if event.Meta != nil {
 		pipeline, err := events.GetMetaStringValue(*event, events.FieldMetaPipeline)
@@ -366,11 +462,13 @@ func getPipeline(event *beat.Event, pipelineSel *outil.Selector) (string, error)
 // bulkCollectPublishFails checks per item errors returning all events
 // to be tried again due to error code returned for that items. If indexing an
 // event failed due to some error in the event itself (e.g. does not respect mapping),
-// the event will be dropped.
+// the event is passed to the non-indexable policy, dropping it or replacing it by
+// a dead letter record. Dead letter records are returned after the failed events.
 func bulkCollectPublishFails(
 	log *logp.Logger,
 	result eslegclient.BulkResult,
 	data []publisher.Event,
+	nonIndexable nonIndexablePolicy,
 ) ([]publisher.Event, bulkResultStats) {
 	reader := newJSONReader(result)
 	if err := bulkReadToItems(reader); err != nil {
@@ -380,6 +478,7 @@ func bulkCollectPublishFails(
 
 	count := len(data)
 	failed := data[:0]
+	var deadLetter []publisher.Event
 	stats := bulkResultStats{}
 	for i := 0; i < count; i++ {
 		status, msg, err := bulkReadItemStatus(log, reader)
@@ -404,8 +503,12 @@ func bulkCollectPublishFails(
 			if status == http.StatusTooManyRequests {
 				stats.tooMany++
 			} else {
-				// hard failure, don't collect
-				log.Warnf("Cannot index event %#v (status=%v): %s", data[i], status, msg)
+				// hard failure, only collect dead letter records
+				if nonIndexable.handle(&data[i], status, msg) {
+					stats.deadLetter++
+					deadLetter = append(deadLetter, data[i])
+					continue
+				}
 				stats.nonIndexable++
 				continue
 			}
@@ -416,14 +519,21 @@ func bulkCollectPublishFails(
 		failed = append(failed, data[i])
 	}
 
-	return failed, stats
+	// all events have been read, the records only overwrite processed events
+	return append(failed, deadLetter...), stats
 }
 
 func (client *Client) Connect() error {
+	// lanes copy the connection state, they are recreated after reconnecting
+	client.closeLanes()
 	return client.conn.Connect()
 }
 
 func (client *Client) Close() error {
+	if err := client.nonIndexable.Close(); err != nil {
+		client.log.Errorf("Failed to close the non-indexable event policy: %v", err)
+	}
+	client.closeLanes()
 	return client.conn.Close()
 }
 
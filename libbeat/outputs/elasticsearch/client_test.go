@@ -54,7 +54,7 @@ func TestCollectPublishFailsNone(t *testing.T) {
 		events[i] = publisher.Event{Content: beat.Event{Fields: event}}
 	}
 
-	res, _ := bulkCollectPublishFails(logp.L(), response, events)
+	res, _ := bulkCollectPublishFails(logp.L(), response, events, &dropPolicy{log: logp.L()})
 	assert.Equal(t, 0, len(res))
 }
 
@@ -71,7 +71,7 @@ func TestCollectPublishFailMiddle(t *testing.T) {
 	eventFail := publisher.Event{Content: beat.Event{Fields: common.MapStr{"field": 2}}}
 	events := []publisher.Event{event, eventFail, event}
 
-	res, stats := bulkCollectPublishFails(logp.L(), response, events)
+	res, stats := bulkCollectPublishFails(logp.L(), response, events, &dropPolicy{log: logp.L()})
 	assert.Equal(t, 1, len(res))
 	if len(res) == 1 {
 		assert.Equal(t, eventFail, res[0])
@@ -91,7 +91,7 @@ func TestCollectPublishFailAll(t *testing.T) {
 	event := publisher.Event{Content: beat.Event{Fields: common.MapStr{"field": 2}}}
 	events := []publisher.Event{event, event, event}
 
-	res, stats := bulkCollectPublishFails(logp.L(), response, events)
+	res, stats := bulkCollectPublishFails(logp.L(), response, events, &dropPolicy{log: logp.L()})
 	assert.Equal(t, 3, len(res))
 	assert.Equal(t, events, res)
 	assert.Equal(t, stats, bulkResultStats{fails: 3, tooMany: 3})
@@ -132,7 +132,7 @@ func TestCollectPipelinePublishFail(t *testing.T) {
 	event := publisher.Event{Content: beat.Event{Fields: common.MapStr{"field": 2}}}
 	events := []publisher.Event{event}
 
-	res, _ := bulkCollectPublishFails(logp.L(), response, events)
+	res, _ := bulkCollectPublishFails(logp.L(), response, events, &dropPolicy{log: logp.L()})
 	assert.Equal(t, 1, len(res))
 	assert.Equal(t, events, res)
 }
@@ -150,7 +150,7 @@ func BenchmarkCollectPublishFailsNone(b *testing.B) {
 	events := []publisher.Event{event, event, event}
 
 	for i := 0; i < b.N; i++ {
-		res, _ := bulkCollectPublishFails(logp.L(), response, events)
+		res, _ := bulkCollectPublishFails(logp.L(), response, events, &dropPolicy{log: logp.L()})
 		if len(res) != 0 {
 			b.Fail()
 		}
@@ -171,7 +171,7 @@ func BenchmarkCollectPublishFailMiddle(b *testing.B) {
 	events := []publisher.Event{event, eventFail, event}
 
 	for i := 0; i < b.N; i++ {
-		res, _ := bulkCollectPublishFails(logp.L(), response, events)
+		res, _ := bulkCollectPublishFails(logp.L(), response, events, &dropPolicy{log: logp.L()})
 		if len(res) != 1 {
 			b.Fail()
 		}
@@ -191,7 +191,7 @@ func BenchmarkCollectPublishFailAll(b *testing.B) {
 	events := []publisher.Event{event, event, event}
 
 	for i := 0; i < b.N; i++ {
-		res, _ := bulkCollectPublishFails(logp.L(), response, events)
+		res, _ := bulkCollectPublishFails(logp.L(), response, events, &dropPolicy{log: logp.L()})
 		if len(res) != 3 {
 			b.Fail()
 		}
@@ -387,6 +387,46 @@ func TestBulkEncodeEventsWithOpType(t *testing.T) {
 
 }
 
+func TestBulkEncodeEventsDataStream(t *testing.T) {
+	info := beat.Info{
+		IndexPrefix: "test",
+		Version:     version.GetDefaultVersion(),
+	}
+
+	im, err := idxmgmt.DefaultSupport(nil, info, common.MustNewConfigFrom(common.MapStr{
+		"setup.data_stream.enabled": true,
+	}))
+	require.NoError(t, err)
+
+	index, pipeline, err := buildSelectors(im, info, common.NewConfig())
+	require.NoError(t, err)
+
+	events := []publisher.Event{
+		{Content: beat.Event{
+			Meta:   common.MapStr{e.FieldMetaOpType: e.OpTypeIndex},
+			Fields: common.MapStr{"message": "test 1"},
+		}},
+		{Content: beat.Event{
+			Fields: common.MapStr{
+				"message":     "test 2",
+				"data_stream": common.MapStr{"dataset": "other"},
+			},
+		}},
+		{Content: beat.Event{
+			Meta:   common.MapStr{deadLetterIndexField: "logs-deadletter-default"},
+			Fields: common.MapStr{"message": "{}"},
+		}},
+	}
+
+	// ES versions before 7.5 use the index operation by default
+	encoded, bulkItems := bulkEncodePublishRequest(logp.L(), *common.MustNewVersion("7.4.0"), index, pipeline, events)
+	require.Len(t, encoded, 3)
+	require.Len(t, bulkItems, 6)
+	assert.Equal(t, eslegclient.BulkCreateAction{Create: eslegclient.BulkMeta{Index: "logs-test-default"}}, bulkItems[0])
+	assert.Equal(t, eslegclient.BulkCreateAction{Create: eslegclient.BulkMeta{Index: "logs-other-default"}}, bulkItems[2])
+	assert.Equal(t, eslegclient.BulkCreateAction{Create: eslegclient.BulkMeta{Index: "logs-deadletter-default"}}, bulkItems[4])
+}
+
 func TestClientWithAPIKey(t *testing.T) {
 	var headers http.Header
 
@@ -22,8 +22,10 @@ import (
 	"time"
 
 	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
 	"github.com/elastic/beats/v7/libbeat/common/transport/kerberos"
 	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
+	"github.com/elastic/beats/v7/libbeat/outputs"
 )
 
 type elasticsearchConfig struct {
@@ -42,9 +44,14 @@ type elasticsearchConfig struct {
 	TLS              *tlscommon.Config `config:"ssl"`
 	Kerberos         *kerberos.Config  `config:"kerberos"`
 	BulkMaxSize      int               `config:"bulk_max_size"`
+	BulkMaxBytes     cfgtype.ByteSize  `config:"bulk_max_bytes"`
+	BulkAdaptive     adaptiveConfig    `config:"bulk_adaptive"`
 	MaxRetries       int               `config:"max_retries"`
 	Timeout          time.Duration     `config:"timeout"`
 	Backoff          Backoff           `config:"backoff"`
+
+	NonIndexablePolicy *common.ConfigNamespace `config:"non_indexable_policy"`
+	Failover           outputs.FailoverConfig  `config:"failover"`
 }
 
 type Backoff struct {
@@ -52,6 +59,20 @@ type Backoff struct {
 	Max  time.Duration
 }
 
+// adaptiveConfig configures the adaptive bulk sizing. The number of events
+// per bulk request and the number of concurrent requests are increased
+// additively while Elasticsearch keeps up, and decreased multiplicatively on
+// 429 responses, failed requests or high latency.
+type adaptiveConfig struct {
+	Enabled        bool          `config:"enabled"`
+	MinSize        int           `config:"min_size"        validate:"min=1"`
+	MaxSize        int           `config:"max_size"        validate:"min=1"`
+	Step           int           `config:"step"            validate:"min=1"`
+	DecreaseFactor float64       `config:"decrease_factor"`
+	TargetLatency  time.Duration `config:"target_latency"  validate:"positive,nonzero"`
+	MaxConcurrency int           `config:"max_concurrency" validate:"min=1"`
+}
+
 const (
 	defaultBulkSize = 50
 )
@@ -77,6 +98,16 @@ var (
 			Init: 1 * time.Second,
 			Max:  60 * time.Second,
 		},
+		BulkAdaptive: adaptiveConfig{
+			Enabled:        false,
+			MinSize:        10,
+			MaxSize:        3200,
+			Step:           50,
+			DecreaseFactor: 0.5,
+			TargetLatency:  2 * time.Second,
+			MaxConcurrency: 4,
+		},
+		Failover: outputs.DefaultFailoverConfig(),
 	}
 )
 
@@ -93,3 +124,13 @@ func (c *elasticsearchConfig) Validate() error {
 
 	return nil
 }
+
+func (c *adaptiveConfig) Validate() error {
+	if c.MinSize > c.MaxSize {
+		return fmt.Errorf("bulk_adaptive.min_size (%v) must not be larger than max_size (%v)", c.MinSize, c.MaxSize)
+	}
+	if c.DecreaseFactor <= 0 || c.DecreaseFactor >= 1 {
+		return fmt.Errorf("bulk_adaptive.decrease_factor must be between 0 and 1, got %v", c.DecreaseFactor)
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/file"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/paths"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+)
+
+// deadLetterIndexField is the metadata field holding the dead letter index of
+// events that could not be indexed.
+const deadLetterIndexField = "dead_letter_index"
+
+// nonIndexablePolicy handles events rejected by Elasticsearch with a
+// non-retryable error, like a mapping conflict.
+type nonIndexablePolicy interface {
+	// handle is called with the bulk item status and error of the event. It
+	// returns true if the event has been updated and must be retried.
+	handle(event *publisher.Event, status int, msg []byte) bool
+	Close() error
+}
+
+type deadLetterIndexConfig struct {
+	Index string `config:"index" validate:"required"`
+}
+
+type deadLetterFileConfig struct {
+	Path          string `config:"path"`
+	Filename      string `config:"filename"`
+	RotateEveryKb uint   `config:"rotate_every_kb" validate:"min=1"`
+	NumberOfFiles uint   `config:"number_of_files"`
+	Permissions   uint32 `config:"permissions"`
+}
+
+func defaultDeadLetterFileConfig() deadLetterFileConfig {
+	return deadLetterFileConfig{
+		Path:          "dead_letter",
+		RotateEveryKb: 10 * 1024,
+		NumberOfFiles: 7,
+		Permissions:   0600,
+	}
+}
+
+func (c *deadLetterFileConfig) Validate() error {
+	if c.NumberOfFiles < 2 || c.NumberOfFiles > file.MaxBackupsLimit {
+		return fmt.Errorf("the number_of_files to keep should be between 2 and %v",
+			file.MaxBackupsLimit)
+	}
+	return nil
+}
+
+// newNonIndexablePolicy creates the policy configured in the
+// non_indexable_policy namespace. Events are dropped by default.
+func newNonIndexablePolicy(beat beat.Info, ns *common.ConfigNamespace) (nonIndexablePolicy, error) {
+	log := logp.NewLogger(logSelector)
+	if ns == nil || !ns.IsSet() {
+		return &dropPolicy{log: log}, nil
+	}
+
+	switch ns.Name() {
+	case "drop":
+		return &dropPolicy{log: log}, nil
+
+	case "dead_letter_index":
+		var config deadLetterIndexConfig
+		if err := ns.Config().Unpack(&config); err != nil {
+			return nil, err
+		}
+		return &deadLetterIndexPolicy{log: log, index: config.Index}, nil
+
+	case "dead_letter_file":
+		config := defaultDeadLetterFileConfig()
+		if err := ns.Config().Unpack(&config); err != nil {
+			return nil, err
+		}
+		return newDeadLetterFilePolicy(log, beat, config)
+	}
+	return nil, fmt.Errorf("unknown non_indexable_policy '%v' (valid values are: drop, dead_letter_index, dead_letter_file)", ns.Name())
+}
+
+// dropPolicy drops the events that can not be indexed.
+type dropPolicy struct {
+	log *logp.Logger
+}
+
+func (p *dropPolicy) handle(event *publisher.Event, status int, msg []byte) bool {
+	p.log.Warnf("Cannot index event %#v (status=%v): %s", *event, status, msg)
+	return false
+}
+
+func (p *dropPolicy) Close() error { return nil }
+
+// deadLetterIndexPolicy replaces the events that can not be indexed by a
+// dead letter record, sent to a dedicated index. Records rejected by the dead
+// letter index are dropped.
+type deadLetterIndexPolicy struct {
+	log   *logp.Logger
+	index string
+}
+
+func (p *deadLetterIndexPolicy) handle(event *publisher.Event, status int, msg []byte) bool {
+	content := &event.Content
+	if _, err := content.Meta.GetValue(deadLetterIndexField); err == nil {
+		p.log.Warnf("Cannot index event in the dead letter index %v (status=%v): %s", p.index, status, msg)
+		return false
+	}
+
+	p.log.Debugf("Sending event to the dead letter index %v (status=%v): %s", p.index, status, msg)
+	content.Fields = deadLetterRecord(content, status, msg)
+	content.Meta = common.MapStr{deadLetterIndexField: p.index}
+	return true
+}
+
+func (p *deadLetterIndexPolicy) Close() error { return nil }
+
+// deadLetterFilePolicy writes dead letter records of the events that can not
+// be indexed to rotated files. The policy is shared by the clients of an
+// output, closing it only closes the current file.
+type deadLetterFilePolicy struct {
+	log     *logp.Logger
+	rotator *file.Rotator
+}
+
+func newDeadLetterFilePolicy(log *logp.Logger, beat beat.Info, config deadLetterFileConfig) (*deadLetterFilePolicy, error) {
+	filename := config.Filename
+	if filename == "" {
+		filename = beat.Beat
+	}
+	path := filepath.Join(paths.Resolve(paths.Data, config.Path), filename)
+
+	rotator, err := file.NewFileRotator(
+		path,
+		file.MaxSizeBytes(config.RotateEveryKb*1024),
+		file.MaxBackups(config.NumberOfFiles),
+		file.Permissions(os.FileMode(config.Permissions)),
+		file.RotateOnStartup(false),
+		file.WithLogger(logp.NewLogger("rotator").With(logp.Namespace("rotator"))),
+	)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Writing events that can not be indexed to %v", path)
+	return &deadLetterFilePolicy{log: log, rotator: rotator}, nil
+}
+
+func (p *deadLetterFilePolicy) handle(event *publisher.Event, status int, msg []byte) bool {
+	record := deadLetterRecord(&event.Content, status, msg)
+	record.Put("@timestamp", event.Content.Timestamp)
+
+	line, err := json.Marshal(record)
+	if err == nil {
+		_, err = p.rotator.Write(append(line, '\n'))
+	}
+	if err != nil {
+		p.log.Errorf("Failed to write event to the dead letter file: %v", err)
+		p.log.Warnf("Cannot index event %#v (status=%v): %s", *event, status, msg)
+	}
+	return false
+}
+
+func (p *deadLetterFilePolicy) Close() error {
+	return p.rotator.Close()
+}
+
+// deadLetterRecord creates the fields of a dead letter record. The record
+// contains the original event encoded as JSON in the message field, and the
+// error returned by Elasticsearch.
+func deadLetterRecord(event *beat.Event, status int, msg []byte) common.MapStr {
+	original := event.Fields.Clone()
+	original["@timestamp"] = event.Timestamp
+	encoded, err := json.Marshal(original)
+	if err != nil {
+		encoded = []byte(event.Fields.String())
+	}
+
+	var itemErr struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	}
+	errFields := common.MapStr{"code": strconv.Itoa(status)}
+	if err := json.Unmarshal(msg, &itemErr); err == nil && itemErr.Type != "" {
+		errFields["type"] = itemErr.Type
+		errFields["message"] = itemErr.Reason
+	} else {
+		errFields["message"] = string(msg)
+	}
+
+	return common.MapStr{
+		"message": string(encoded),
+		"error":   errFields,
+	}
+}
@@ -0,0 +1,235 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// +build !integration
+
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/esleg/eslegclient"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/beats/v7/libbeat/outputs/outil"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+)
+
+var deadLetterResponse = []byte(`
+    { "items": [
+      {"create": {"status": 200}},
+      {"create": {"status": 400, "error": {"type": "mapper_parsing_exception", "reason": "failed to parse field [field]"}}}
+    ]}
+  `)
+
+func TestCollectPublishFailDeadLetterIndex(t *testing.T) {
+	ts := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	event := publisher.Event{Content: beat.Event{Fields: common.MapStr{"field": 1}}}
+	eventFail := publisher.Event{Content: beat.Event{
+		Timestamp: ts,
+		Meta:      common.MapStr{"pipeline": "test"},
+		Fields:    common.MapStr{"field": "a"},
+	}}
+	events := []publisher.Event{event, eventFail}
+
+	policy := &deadLetterIndexPolicy{log: logp.L(), index: "failed"}
+	res, stats := bulkCollectPublishFails(logp.L(), deadLetterResponse, events, policy)
+	assert.Equal(t, bulkResultStats{acked: 1, deadLetter: 1}, stats)
+	require.Len(t, res, 1)
+
+	record := res[0].Content
+	assert.Equal(t, ts, record.Timestamp)
+	assert.Equal(t, common.MapStr{deadLetterIndexField: "failed"}, record.Meta)
+	assert.Equal(t, common.MapStr{
+		"message": `{"@timestamp":"2020-01-01T10:00:00Z","field":"a"}`,
+		"error": common.MapStr{
+			"code":    "400",
+			"type":    "mapper_parsing_exception",
+			"message": "failed to parse field [field]",
+		},
+	}, record.Fields)
+
+	// Records rejected by the dead letter index are dropped.
+	res, stats = bulkCollectPublishFails(logp.L(), deadLetterResponse, []publisher.Event{event, res[0]}, policy)
+	assert.Equal(t, bulkResultStats{acked: 1, nonIndexable: 1}, stats)
+	assert.Len(t, res, 0)
+}
+
+func TestPublishDeadLetterWithBackoff(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprintln(w, `{ "version": { "number": "7.9.0" } }`)
+			return
+		}
+		w.Write(deadLetterResponse)
+	}))
+	defer ts.Close()
+
+	reg := monitoring.NewRegistry()
+	client, err := NewClient(ClientSettings{
+		ConnectionSettings: eslegclient.ConnectionSettings{URL: ts.URL},
+		Index:              outil.MakeSelector(outil.ConstSelectorExpr("test", outil.SelectorLowerCase)),
+		Observer:           outputs.NewStats(reg),
+		nonIndexablePolicy: &deadLetterIndexPolicy{log: logp.L(), index: "failed"},
+	}, nil)
+	require.NoError(t, err)
+
+	// a backoff would block the test
+	backoffClient := outputs.WithBackoff(client, time.Hour, time.Hour)
+	require.NoError(t, backoffClient.Connect())
+	defer backoffClient.Close()
+
+	batch := outest.NewBatch(
+		beat.Event{Fields: common.MapStr{"field": 1}},
+		beat.Event{Fields: common.MapStr{"field": "a"}},
+	)
+	done := make(chan error, 1)
+	go func() { done <- backoffClient.Publish(context.Background(), batch) }()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("publishing dead letter records waits on the backoff")
+	}
+
+	// the record is sent again without reducing the retries of the event
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchCancelledEvents, batch.Signals[0].Tag)
+	require.Len(t, batch.Signals[0].Events, 1)
+	assert.Equal(t, common.MapStr{deadLetterIndexField: "failed"}, batch.Signals[0].Events[0].Content.Meta)
+
+	snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, false)
+	assert.Equal(t, int64(1), snapshot.Ints["events.acked"])
+	assert.Equal(t, int64(0), snapshot.Ints["events.failed"])
+	assert.Equal(t, int64(1), snapshot.Ints["events.dead_letter"])
+	assert.Equal(t, int64(0), snapshot.Ints["events.active"])
+}
+
+func TestDeadLetterBulkMeta(t *testing.T) {
+	index := outil.MakeSelector(outil.ConstSelectorExpr("test", outil.SelectorLowerCase))
+	pipeline := outil.MakeSelector(outil.ConstSelectorExpr("pipeline", outil.SelectorLowerCase))
+	event := beat.Event{
+		Meta:   common.MapStr{deadLetterIndexField: "failed"},
+		Fields: common.MapStr{"message": "{}"},
+	}
+
+	meta, err := createEventBulkMeta(logp.L(), common.Version{Major: 7, Minor: 10}, &index, &pipeline, &event)
+	require.NoError(t, err)
+	assert.Equal(t, eslegclient.BulkIndexAction{Index: eslegclient.BulkMeta{Index: "failed"}}, meta)
+}
+
+func TestDeadLetterFilePolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dead_letter")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := defaultConfig
+	require.NoError(t, common.MustNewConfigFrom(common.MapStr{
+		"non_indexable_policy.dead_letter_file": common.MapStr{"path": dir, "filename": "failed.ndjson"},
+	}).Unpack(&config))
+
+	policy, err := newNonIndexablePolicy(beat.Info{Beat: "test"}, config.NonIndexablePolicy)
+	require.NoError(t, err)
+	require.IsType(t, &deadLetterFilePolicy{}, policy)
+
+	events := []publisher.Event{
+		{Content: beat.Event{Fields: common.MapStr{"field": 1}}},
+		{Content: beat.Event{Fields: common.MapStr{"field": "a"}}},
+	}
+	res, stats := bulkCollectPublishFails(logp.L(), deadLetterResponse, events, policy)
+	assert.Equal(t, bulkResultStats{acked: 1, nonIndexable: 1}, stats)
+	assert.Len(t, res, 0)
+	require.NoError(t, policy.Close())
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "failed.ndjson"))
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	require.Len(t, lines, 1)
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	assert.Equal(t, `{"@timestamp":"0001-01-01T00:00:00Z","field":"a"}`, record["message"])
+	assert.Equal(t, map[string]interface{}{
+		"code":    "400",
+		"type":    "mapper_parsing_exception",
+		"message": "failed to parse field [field]",
+	}, record["error"])
+}
+
+func TestNewNonIndexablePolicy(t *testing.T) {
+	cases := map[string]struct {
+		config   common.MapStr
+		expected nonIndexablePolicy
+		err      bool
+	}{
+		"default": {
+			config:   common.MapStr{},
+			expected: &dropPolicy{},
+		},
+		"drop": {
+			config:   common.MapStr{"non_indexable_policy.drop": common.MapStr{}},
+			expected: &dropPolicy{},
+		},
+		"dead letter index": {
+			config:   common.MapStr{"non_indexable_policy.dead_letter_index.index": "failed"},
+			expected: &deadLetterIndexPolicy{index: "failed"},
+		},
+		"dead letter index without index": {
+			config: common.MapStr{"non_indexable_policy.dead_letter_index": common.MapStr{}},
+			err:    true,
+		},
+		"unknown": {
+			config: common.MapStr{"non_indexable_policy.retry": common.MapStr{}},
+			err:    true,
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			config := defaultConfig
+			require.NoError(t, common.MustNewConfigFrom(test.config).Unpack(&config))
+
+			policy, err := newNonIndexablePolicy(beat.Info{Beat: "test"}, config.NonIndexablePolicy)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.IsType(t, test.expected, policy)
+			if expected, ok := test.expected.(*deadLetterIndexPolicy); ok {
+				assert.Equal(t, expected.index, policy.(*deadLetterIndexPolicy).index)
+			}
+		})
+	}
+}
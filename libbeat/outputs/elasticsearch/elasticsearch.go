@@ -18,6 +18,7 @@
 package elasticsearch
 
 import (
+	"fmt"
 	"net/url"
 
 	"github.com/elastic/beats/v7/libbeat/beat"
@@ -82,7 +83,24 @@ func makeES(
 		params = nil
 	}
 
+	nonIndexable, err := newNonIndexablePolicy(beat, config.NonIndexablePolicy)
+	if err != nil {
+		return outputs.Fail(err)
+	}
+
+	// With adaptive bulk sizing, the batches of the pipeline must be large
+	// enough to fill the maximum number of concurrent requests. The clients
+	// split them into requests of the adaptive size.
+	var sizer *bulkSizer
+	batchSize := config.BulkMaxSize
+	if config.BulkAdaptive.Enabled {
+		sizer = newBulkSizer(config.BulkAdaptive, config.BulkMaxSize, observer)
+		batchSize = config.BulkAdaptive.MaxSize * config.BulkAdaptive.MaxConcurrency
+	}
+
+	priorityFailover := !config.LoadBalance && config.Failover.IsPriority()
 	clients := make([]outputs.NetworkClient, len(hosts))
+	probes := make([]outputs.Probe, len(hosts))
 	for i, host := range hosts {
 		esURL, err := common.MakeURL(config.Protocol, config.Path, host, 9200)
 		if err != nil {
@@ -90,37 +108,74 @@ func makeES(
 			return outputs.Fail(err)
 		}
 
+		connSettings := eslegclient.ConnectionSettings{
+			URL:              esURL,
+			Proxy:            proxyURL,
+			ProxyDisable:     config.ProxyDisable,
+			TLS:              tlsConfig,
+			Kerberos:         config.Kerberos,
+			Username:         config.Username,
+			Password:         config.Password,
+			APIKey:           config.APIKey,
+			Parameters:       params,
+			Headers:          config.Headers,
+			Timeout:          config.Timeout,
+			CompressionLevel: config.CompressionLevel,
+			Observer:         observer,
+			EscapeHTML:       config.EscapeHTML,
+		}
+
 		var client outputs.NetworkClient
 		client, err = NewClient(ClientSettings{
-			ConnectionSettings: eslegclient.ConnectionSettings{
-				URL:              esURL,
-				Proxy:            proxyURL,
-				ProxyDisable:     config.ProxyDisable,
-				TLS:              tlsConfig,
-				Kerberos:         config.Kerberos,
-				Username:         config.Username,
-				Password:         config.Password,
-				APIKey:           config.APIKey,
-				Parameters:       params,
-				Headers:          config.Headers,
-				Timeout:          config.Timeout,
-				CompressionLevel: config.CompressionLevel,
-				Observer:         observer,
-				EscapeHTML:       config.EscapeHTML,
-			},
-			Index:    index,
-			Pipeline: pipeline,
-			Observer: observer,
+			ConnectionSettings: connSettings,
+			Index:              index,
+			Pipeline:           pipeline,
+			Observer:           observer,
+
+			nonIndexablePolicy: nonIndexable,
+			bulkSizer:          sizer,
+			maxBulkBytes:       int(config.BulkMaxBytes),
 		}, &connectCallbackRegistry)
 		if err != nil {
 			return outputs.Fail(err)
 		}
 
-		client = outputs.WithBackoff(client, config.Backoff.Init, config.Backoff.Max)
+		if priorityFailover {
+			probes[i] = makeProbe(connSettings)
+		} else {
+			client = outputs.WithBackoff(client, config.Backoff.Init, config.Backoff.Max)
+		}
 		clients[i] = client
 	}
 
-	return outputs.SuccessNet(config.LoadBalance, config.BulkMaxSize, config.MaxRetries, clients)
+	if priorityFailover {
+		client := outputs.NewPriorityFailoverClient(clients, probes, config.Failover,
+			config.Backoff.Init, config.Backoff.Max, observer)
+		return outputs.Success(batchSize, config.MaxRetries, client)
+	}
+	return outputs.SuccessNet(config.LoadBalance, batchSize, config.MaxRetries, clients)
+}
+
+// makeProbe returns a probe sending a request to the root endpoint of
+// Elasticsearch, using a new connection.
+func makeProbe(s eslegclient.ConnectionSettings) outputs.Probe {
+	s.Observer = nil
+	return func() error {
+		conn, err := eslegclient.NewConnection(s)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		status, _, err := conn.RequestURL("GET", conn.URL, nil)
+		if err != nil {
+			return err
+		}
+		if status >= 300 {
+			return fmt.Errorf("probe failed with status code %d", status)
+		}
+		return nil
+	}
 }
 
 func buildSelectors(
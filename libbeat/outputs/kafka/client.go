@@ -43,6 +43,7 @@ type client struct {
 	hosts    []string
 	topic    outil.Selector
 	key      *fmtstr.EventFormatString
+	headers  []header
 	index    string
 	codec    codec.Codec
 	config   sarama.Config
@@ -72,6 +73,7 @@ func newKafkaClient(
 	hosts []string,
 	index string,
 	key *fmtstr.EventFormatString,
+	headers []header,
 	topic outil.Selector,
 	writer codec.Codec,
 	cfg *sarama.Config,
@@ -82,6 +84,7 @@ func newKafkaClient(
 		hosts:    hosts,
 		topic:    topic,
 		key:      key,
+		headers:  headers,
 		index:    strings.ToLower(index),
 		codec:    writer,
 		config:   *cfg,
@@ -95,6 +98,13 @@ func (c *client) Connect() error {
 
 	c.log.Debugf("connect: %v", c.hosts)
 
+	if conn, ok := c.codec.(codec.Connector); ok {
+		if err := conn.Connect(); err != nil {
+			c.log.Errorf("Kafka codec connect fails with: %+v", err)
+			return err
+		}
+	}
+
 	// try to connect
 	producer, err := sarama.NewAsyncProducer(c.hosts, &c.config)
 	if err != nil {
@@ -200,7 +210,13 @@ func (c *client) getEventMessage(data *publisher.Event) (*message, error) {
 		}
 	}
 
-	serializedEvent, err := c.codec.Encode(c.index, event)
+	headers, body, err := buildHeaders(c.headers, event)
+	if err != nil {
+		return nil, err
+	}
+	msg.headers = headers
+
+	serializedEvent, err := c.codec.Encode(c.index, body)
 	if err != nil {
 		if c.log.IsDebug() {
 			c.log.Debugf("failed event: %v", event)
@@ -51,6 +51,7 @@ type kafkaConfig struct {
 	Timeout            time.Duration             `config:"timeout"             validate:"min=1"`
 	Metadata           metaConfig                `config:"metadata"`
 	Key                *fmtstr.EventFormatString `config:"key"`
+	Headers            []headerConfig            `config:"headers"`
 	Partition          map[string]*common.Config `config:"partition"`
 	KeepAlive          time.Duration             `config:"keep_alive"          validate:"min=0"`
 	MaxMessageBytes    *int                      `config:"max_message_bytes"   validate:"min=1"`
@@ -192,6 +193,12 @@ func (c *kafkaConfig) Validate() error {
 		return fmt.Errorf("password must be set when username is configured")
 	}
 
+	if len(c.Headers) > 0 {
+		if version, ok := c.Version.Get(); ok && !version.IsAtLeast(sarama.V0_11_0_0) {
+			return fmt.Errorf("headers require kafka version 0.11 or newer, found %v", c.Version)
+		}
+	}
+
 	if c.Compression == "gzip" {
 		lvl := c.CompressionLevel
 		if lvl != sarama.CompressionLevelDefault && !(0 <= lvl && lvl <= 9) {
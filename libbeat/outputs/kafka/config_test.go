@@ -40,6 +40,12 @@ func TestConfigAcceptValid(t *testing.T) {
 			"compression": "lz4",
 			"version":     "1.0.0",
 		},
+		"headers": common.MapStr{
+			"headers": []common.MapStr{
+				{"key": "tenant", "value": "%{[tenant.id]}"},
+				{"key": "trace_id", "field": "trace.id"},
+			},
+		},
 		"Kerberos with keytab": common.MapStr{
 			"kerberos": common.MapStr{
 				"auth_type":    "keytab",
@@ -80,6 +86,19 @@ func TestConfigAcceptValid(t *testing.T) {
 
 func TestConfigInvalid(t *testing.T) {
 	tests := map[string]common.MapStr{
+		"header without value": common.MapStr{
+			"headers": []common.MapStr{{"key": "tenant"}},
+		},
+		"header with value and field": common.MapStr{
+			"headers": []common.MapStr{{"key": "tenant", "value": "a", "field": "tenant"}},
+		},
+		"header without key": common.MapStr{
+			"headers": []common.MapStr{{"value": "a"}},
+		},
+		"headers with 0.10": common.MapStr{
+			"headers": []common.MapStr{{"key": "tenant", "value": "a"}},
+			"version": "0.10.2",
+		},
 		"Kerberos with invalid auth_type": common.MapStr{
 			"kerberos": common.MapStr{
 				"auth_type":    "invalid_auth_type",
@@ -0,0 +1,126 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+)
+
+// headerConfig configures a record header. The header value is either
+// formatted from the event, or moved from an event field.
+type headerConfig struct {
+	Key   string                    `config:"key"   validate:"required"`
+	Value *fmtstr.EventFormatString `config:"value"`
+	Field string                    `config:"field"`
+}
+
+// header sets a record header for each event.
+type header struct {
+	key   []byte
+	value *fmtstr.EventFormatString
+	field string
+}
+
+func (c *headerConfig) Validate() error {
+	if (c.Value == nil) == (c.Field == "") {
+		return errors.New("header requires exactly one of value or field")
+	}
+	return nil
+}
+
+func makeHeaders(configs []headerConfig) []header {
+	if len(configs) == 0 {
+		return nil
+	}
+
+	headers := make([]header, len(configs))
+	for i, cfg := range configs {
+		headers[i] = header{
+			key:   []byte(cfg.Key),
+			value: cfg.Value,
+			field: cfg.Field,
+		}
+	}
+	return headers
+}
+
+// buildHeaders computes the record headers of an event. Headers whose value
+// can not be formatted or whose field is missing are not set. If fields are
+// moved into headers, the event returned is a copy without these fields, to
+// be encoded as the record body. The original event is not modified.
+func buildHeaders(headers []header, event *beat.Event) ([]sarama.RecordHeader, *beat.Event, error) {
+	if len(headers) == 0 {
+		return nil, event, nil
+	}
+
+	body := event
+	recordHeaders := make([]sarama.RecordHeader, 0, len(headers))
+	for _, h := range headers {
+		if h.value != nil {
+			value, err := h.value.RunBytes(event)
+			if err != nil {
+				continue
+			}
+			recordHeaders = append(recordHeaders, sarama.RecordHeader{Key: h.key, Value: value})
+			continue
+		}
+
+		v, err := event.GetValue(h.field)
+		if err != nil {
+			continue
+		}
+		value, err := headerValue(v)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to set header %s from field %v: %v", h.key, h.field, err)
+		}
+		recordHeaders = append(recordHeaders, sarama.RecordHeader{Key: h.key, Value: value})
+
+		if body == event {
+			body = &beat.Event{
+				Timestamp:  event.Timestamp,
+				Fields:     event.Fields.Clone(),
+				Private:    event.Private,
+				TimeSeries: event.TimeSeries,
+			}
+			if event.Meta != nil {
+				body.Meta = event.Meta.Clone()
+			}
+		}
+		body.Delete(h.field)
+	}
+	return recordHeaders, body, nil
+}
+
+// headerValue serializes a field value. Strings and byte slices are used as
+// is, other values are JSON encoded.
+func headerValue(v interface{}) ([]byte, error) {
+	switch value := v.(type) {
+	case string:
+		return []byte(value), nil
+	case []byte:
+		return value, nil
+	}
+	return json.Marshal(v)
+}
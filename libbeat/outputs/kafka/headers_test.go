@@ -0,0 +1,128 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+)
+
+func TestBuildHeaders(t *testing.T) {
+	cases := map[string]struct {
+		headers []map[string]interface{}
+		event   beat.Event
+		want    []sarama.RecordHeader
+		body    common.MapStr
+	}{
+		"no headers": {
+			event: beat.Event{Fields: common.MapStr{"message": "hello"}},
+			body:  common.MapStr{"message": "hello"},
+		},
+		"format string": {
+			headers: []map[string]interface{}{
+				{"key": "tenant", "value": "tenant-%{[tenant.id]}"},
+				{"key": "static", "value": "value"},
+			},
+			event: beat.Event{Fields: common.MapStr{"tenant": common.MapStr{"id": "a"}}},
+			want: []sarama.RecordHeader{
+				{Key: []byte("tenant"), Value: []byte("tenant-a")},
+				{Key: []byte("static"), Value: []byte("value")},
+			},
+			body: common.MapStr{"tenant": common.MapStr{"id": "a"}},
+		},
+		"move fields": {
+			headers: []map[string]interface{}{
+				{"key": "trace_id", "field": "trace.id"},
+				{"key": "labels", "field": "labels"},
+			},
+			event: beat.Event{Fields: common.MapStr{
+				"message": "hello",
+				"trace":   common.MapStr{"id": "abc", "name": "x"},
+				"labels":  common.MapStr{"env": "prod"},
+			}},
+			want: []sarama.RecordHeader{
+				{Key: []byte("trace_id"), Value: []byte("abc")},
+				{Key: []byte("labels"), Value: []byte(`{"env":"prod"}`)},
+			},
+			body: common.MapStr{"message": "hello", "trace": common.MapStr{"name": "x"}},
+		},
+		"missing values are skipped": {
+			headers: []map[string]interface{}{
+				{"key": "tenant", "value": "%{[tenant.id]}"},
+				{"key": "trace_id", "field": "trace.id"},
+			},
+			event: beat.Event{Fields: common.MapStr{"message": "hello"}},
+			want:  []sarama.RecordHeader{},
+			body:  common.MapStr{"message": "hello"},
+		},
+	}
+
+	for name, test := range cases {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			headers := readHeaders(t, map[string]interface{}{"headers": test.headers})
+
+			original := test.event.Fields.Clone()
+			recordHeaders, body, err := buildHeaders(headers, &test.event)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, recordHeaders)
+			assert.Equal(t, test.body, body.Fields)
+			assert.Equal(t, original, test.event.Fields)
+		})
+	}
+}
+
+func TestEventMessageHeaders(t *testing.T) {
+	headers := readHeaders(t, map[string]interface{}{
+		"headers": []map[string]interface{}{
+			{"key": "tenant", "field": "tenant"},
+		},
+	})
+
+	topic, err := buildTopicSelector(common.MustNewConfigFrom(map[string]interface{}{"topic": "test"}))
+	require.NoError(t, err)
+
+	c, err := newKafkaClient(nil, nil, "test", nil, headers, topic, json.New("1.2.3", json.Config{}), sarama.NewConfig())
+	require.NoError(t, err)
+
+	event := publisher.Event{Content: beat.Event{Fields: common.MapStr{"tenant": "a", "message": "hello"}}}
+	msg, err := c.getEventMessage(&event)
+	require.NoError(t, err)
+
+	msg.initProducerMessage()
+	assert.Equal(t, []sarama.RecordHeader{{Key: []byte("tenant"), Value: []byte("a")}}, msg.msg.Headers)
+	assert.NotContains(t, string(msg.value), "tenant")
+	assert.Contains(t, string(msg.value), "hello")
+	assert.Equal(t, "a", event.Content.Fields["tenant"])
+}
+
+func readHeaders(t *testing.T, cfg map[string]interface{}) []header {
+	var config struct {
+		Headers []headerConfig `config:"headers"`
+	}
+	require.NoError(t, common.MustNewConfigFrom(cfg).Unpack(&config))
+	return makeHeaders(config.Headers)
+}
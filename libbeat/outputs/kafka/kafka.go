@@ -86,7 +86,7 @@ func makeKafka(
 		return outputs.Fail(err)
 	}
 
-	client, err := newKafkaClient(observer, hosts, beat.IndexPrefix, config.Key, topic, codec, libCfg)
+	client, err := newKafkaClient(observer, hosts, beat.IndexPrefix, config.Key, makeHeaders(config.Headers), topic, codec, libCfg)
 	if err != nil {
 		return outputs.Fail(err)
 	}
@@ -27,6 +27,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/common/cfgwarn"
 	"github.com/elastic/beats/v7/libbeat/common/transport"
 	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
+	"github.com/elastic/beats/v7/libbeat/outputs"
 )
 
 type Config struct {
@@ -43,6 +44,8 @@ type Config struct {
 	Proxy            transport.ProxyConfig `config:",inline"`
 	Backoff          Backoff               `config:"backoff"`
 	EscapeHTML       bool                  `config:"escape_html"`
+
+	Failover outputs.FailoverConfig `config:"failover"`
 }
 
 type Backoff struct {
@@ -65,6 +68,7 @@ func defaultConfig() Config {
 			Max:  60 * time.Second,
 		},
 		EscapeHTML: false,
+		Failover:   outputs.DefaultFailoverConfig(),
 	}
 }
 
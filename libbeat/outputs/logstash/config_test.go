@@ -23,6 +23,7 @@ import (
 
 	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/outputs"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -52,6 +53,7 @@ func TestConfig(t *testing.T) {
 				},
 				EscapeHTML: false,
 				Index:      "bar",
+				Failover:   outputs.DefaultFailoverConfig(),
 			},
 		},
 		"config given": {
@@ -76,8 +78,43 @@ func TestConfig(t *testing.T) {
 				},
 				EscapeHTML: false,
 				Index:      "beat-index",
+				Failover:   outputs.DefaultFailoverConfig(),
 			},
 		},
+		"priority failover": {
+			config: common.MustNewConfigFrom(common.MapStr{
+				"failover.mode":           "priority",
+				"failover.probe_interval": "30s",
+			}),
+			expectedConfig: &Config{
+				LoadBalance:      false,
+				Pipelining:       2,
+				BulkMaxSize:      2048,
+				SlowStart:        false,
+				CompressionLevel: 3,
+				Timeout:          30 * time.Second,
+				MaxRetries:       3,
+				TTL:              0 * time.Second,
+				Backoff: Backoff{
+					Init: 1 * time.Second,
+					Max:  60 * time.Second,
+				},
+				EscapeHTML: false,
+				Index:      "bar",
+				Failover: outputs.FailoverConfig{
+					Mode:          outputs.FailoverPriority,
+					ProbeInterval: 30 * time.Second,
+					FailbackAfter: 3,
+				},
+			},
+		},
+		"invalid failover mode": {
+			config: common.MustNewConfigFrom(common.MapStr{
+				"failover.mode": "round_robin",
+			}),
+			expectedConfig: nil,
+			err:            true,
+		},
 		"removed config setting": {
 			config: common.MustNewConfigFrom(common.MapStr{
 				"port": "8080",
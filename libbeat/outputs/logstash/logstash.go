@@ -63,7 +63,9 @@ func makeLogstash(
 		Stats:   observer,
 	}
 
+	priorityFailover := !config.LoadBalance && config.Failover.IsPriority()
 	clients := make([]outputs.NetworkClient, len(hosts))
+	probes := make([]outputs.Probe, len(hosts))
 	for i, host := range hosts {
 		var client outputs.NetworkClient
 
@@ -81,9 +83,18 @@ func makeLogstash(
 			return outputs.Fail(err)
 		}
 
-		client = outputs.WithBackoff(client, config.Backoff.Init, config.Backoff.Max)
+		if priorityFailover {
+			probes[i] = outputs.DialProbe(transp, host, defaultPort)
+		} else {
+			client = outputs.WithBackoff(client, config.Backoff.Init, config.Backoff.Max)
+		}
 		clients[i] = client
 	}
 
+	if priorityFailover {
+		client := outputs.NewPriorityFailoverClient(clients, probes, config.Failover,
+			config.Backoff.Init, config.Backoff.Max, observer)
+		return outputs.Success(config.BulkMaxSize, config.MaxRetries, client)
+	}
 	return outputs.SuccessNet(config.LoadBalance, config.BulkMaxSize, config.MaxRetries, clients)
 }
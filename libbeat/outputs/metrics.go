@@ -17,7 +17,11 @@
 
 package outputs
 
-import "github.com/elastic/beats/v7/libbeat/monitoring"
+import (
+	"sync"
+
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+)
 
 // Stats implements the Observer interface, for collecting metrics on common
 // outputs events.
@@ -43,6 +47,28 @@ type Stats struct {
 
 	readBytes  *monitoring.Uint // total amount of bytes read
 	readErrors *monitoring.Uint // total number of errors while waiting for response on output
+
+	//
+	// Failover stats, only registered by outputs using priority failover
+	//
+	reg              *monitoring.Registry
+	failoverOnce     sync.Once
+	failoverActive   *monitoring.String // host of the active failover client
+	failoverSwitches *monitoring.Uint   // total number of active host changes
+	failoverLast     string             // last connected host
+
+	//
+	// Dead letter stats, only registered by outputs sending dead letter records
+	//
+	deadLetterOnce sync.Once
+	deadLetter     *monitoring.Uint // total number of events replaced by dead letter records
+
+	//
+	// Adaptive bulk stats, only registered by outputs adapting their bulk size
+	//
+	bulkOnce        sync.Once
+	bulkSize        *monitoring.Int // current number of events per bulk request
+	bulkConcurrency *monitoring.Int // current number of concurrent bulk requests
 }
 
 // NewStats creates a new Stats instance using a backing monitoring registry.
@@ -64,6 +90,8 @@ func NewStats(reg *monitoring.Registry) *Stats {
 
 		readBytes:  monitoring.NewUint(reg, "read.bytes"),
 		readErrors: monitoring.NewUint(reg, "read.errors"),
+
+		reg: reg,
 	}
 }
 
@@ -119,6 +147,20 @@ func (s *Stats) Cancelled(n int) {
 	}
 }
 
+// DeadLetter updates the active event metrics and the number of events that
+// could not be indexed, and are sent again as dead letter records.
+func (s *Stats) DeadLetter(n int) {
+	if s == nil || n == 0 {
+		return
+	}
+
+	s.deadLetterOnce.Do(func() {
+		s.deadLetter = monitoring.NewUint(s.reg, "events.dead_letter")
+	})
+	s.active.Sub(uint64(n))
+	s.deadLetter.Add(uint64(n))
+}
+
 // ErrTooMany updates the number of Too Many Requests responses reported by the output.
 func (s *Stats) ErrTooMany(n int) {
 	if s != nil {
@@ -153,3 +195,38 @@ func (s *Stats) ReadBytes(n int) {
 		s.readBytes.Add(uint64(n))
 	}
 }
+
+// FailoverActive reports the host of the active failover client. An empty
+// host is reported while no client is connected.
+func (s *Stats) FailoverActive(host string) {
+	if s == nil {
+		return
+	}
+
+	s.failoverOnce.Do(func() {
+		s.failoverActive = monitoring.NewString(s.reg, "failover.active")
+		s.failoverSwitches = monitoring.NewUint(s.reg, "failover.switches")
+	})
+	if host != "" && host != s.failoverLast {
+		if s.failoverLast != "" {
+			s.failoverSwitches.Inc()
+		}
+		s.failoverLast = host
+	}
+	s.failoverActive.Set(host)
+}
+
+// BulkSize reports the current number of events per bulk request and the
+// number of concurrent bulk requests.
+func (s *Stats) BulkSize(events, concurrency int) {
+	if s == nil {
+		return
+	}
+
+	s.bulkOnce.Do(func() {
+		s.bulkSize = monitoring.NewInt(s.reg, "bulk.size")
+		s.bulkConcurrency = monitoring.NewInt(s.reg, "bulk.concurrency")
+	})
+	s.bulkSize.Set(int64(events))
+	s.bulkConcurrency.Set(int64(concurrency))
+}
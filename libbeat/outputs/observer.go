@@ -33,6 +33,18 @@ type Observer interface {
 	ErrTooMany(int)   // report too many requests response
 }
 
+// BulkSizeObserver is implemented by Observers reporting the bulk size of
+// outputs adapting it at runtime.
+type BulkSizeObserver interface {
+	BulkSize(events, concurrency int) // report current events per request and number of concurrent requests
+}
+
+// DeadLetterObserver is implemented by Observers reporting the events that
+// could not be indexed, and are sent again as dead letter records.
+type DeadLetterObserver interface {
+	DeadLetter(int) // report number of events replaced by dead letter records
+}
+
 type emptyObserver struct{}
 
 var nilObserver = (*emptyObserver)(nil)
@@ -0,0 +1,104 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"context"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+)
+
+type client struct {
+	log       *logp.Logger
+	observer  outputs.Observer
+	transport transport
+	encoder   *encoder
+}
+
+func newClient(t transport, enc *encoder, observer outputs.Observer) *client {
+	return &client{
+		log:       logp.NewLogger("otlp"),
+		observer:  observer,
+		transport: t,
+		encoder:   enc,
+	}
+}
+
+func (c *client) Connect() error {
+	return c.transport.Connect()
+}
+
+func (c *client) Close() error {
+	return c.transport.Close()
+}
+
+// Publish sends the log records and metrics of the batch in separate export
+// requests. Events of a request that failed with a retryable error are
+// retried, events rejected permanently by the collector are dropped.
+func (c *client) Publish(ctx context.Context, batch publisher.Batch) error {
+	st := c.observer
+	events := batch.Events()
+	st.NewBatch(len(events))
+
+	var (
+		failed  []publisher.Event
+		lastErr error
+		dropped int
+	)
+	for _, req := range c.encoder.encode(events, time.Now()) {
+		partial, err := c.transport.Export(ctx, req.signal, req.body)
+		if err != nil {
+			st.WriteError(err)
+			if !isRetryable(err) {
+				c.log.Errorf("Dropping %d events, the %v export was rejected: %+v", len(req.events), req.signal, err)
+				dropped += len(req.events)
+				continue
+			}
+
+			c.log.Errorf("Failed to export %v: %+v", req.signal, err)
+			failed = append(failed, req.events...)
+			lastErr = err
+			continue
+		}
+
+		st.WriteBytes(len(req.body))
+		if partial.rejected > 0 || partial.message != "" {
+			c.log.Warnf("Collector partially rejected the %v export (%d rejected): %v",
+				req.signal, partial.rejected, partial.message)
+		}
+	}
+
+	st.Dropped(dropped)
+	st.Acked(len(events) - dropped - len(failed))
+
+	if len(failed) > 0 {
+		st.Failed(len(failed))
+		batch.RetryEvents(failed)
+		return lastErr
+	}
+
+	batch.ACK()
+	return nil
+}
+
+func (c *client) String() string {
+	return c.transport.String()
+}
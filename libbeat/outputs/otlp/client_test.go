@@ -0,0 +1,247 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// +build !integration
+
+package otlp
+
+import (
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+)
+
+func TestHTTPPublish(t *testing.T) {
+	tests := map[string]struct {
+		status int
+		signal outest.BatchSignalTag
+		err    bool
+	}{
+		"accepted":    {status: http.StatusOK, signal: outest.BatchACK},
+		"unavailable": {status: http.StatusServiceUnavailable, signal: outest.BatchRetryEvents, err: true},
+		"rejected":    {status: http.StatusBadRequest, signal: outest.BatchACK},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			var (
+				mu       sync.Mutex
+				requests = map[string][]byte{}
+			)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+				assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+				assert.Equal(t, "secret", r.Header.Get("Authorization"))
+
+				gz, err := gzip.NewReader(r.Body)
+				require.NoError(t, err)
+				body, err := ioutil.ReadAll(gz)
+				require.NoError(t, err)
+
+				mu.Lock()
+				requests[r.URL.Path] = body
+				mu.Unlock()
+
+				w.Header().Set("Content-Type", "application/x-protobuf")
+				w.WriteHeader(test.status)
+			}))
+			defer server.Close()
+
+			client := newTestClient(t, newHTTPTransport(server.URL, nil,
+				map[string]string{"Authorization": "secret"}, compressionGzip, time.Second))
+			defer client.Close()
+
+			batch := testBatch()
+			err := client.Publish(context.Background(), batch)
+			if test.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			require.Len(t, batch.Signals, 1)
+			assert.Equal(t, test.signal, batch.Signals[0].Tag)
+			if test.signal == outest.BatchRetryEvents {
+				assert.Len(t, batch.Signals[0].Events, 3)
+			}
+
+			assert.Len(t, requests, 2)
+			assert.NotEmpty(t, requests[httpLogsPath])
+			assert.NotEmpty(t, requests[httpMetricsPath])
+		})
+	}
+}
+
+func TestGRPCPublish(t *testing.T) {
+	tests := map[string]struct {
+		err    error
+		signal outest.BatchSignalTag
+	}{
+		"accepted":    {signal: outest.BatchACK},
+		"unavailable": {err: status.Error(codes.Unavailable, "busy"), signal: outest.BatchRetryEvents},
+		"rejected":    {err: status.Error(codes.InvalidArgument, "bad data"), signal: outest.BatchACK},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			var (
+				mu      sync.Mutex
+				methods = map[string][]byte{}
+			)
+			handler := func(_ interface{}, stream grpc.ServerStream) error {
+				method, _ := grpc.MethodFromServerStream(stream)
+				md, _ := metadata.FromIncomingContext(stream.Context())
+				assert.Equal(t, []string{"secret"}, md.Get("authorization"))
+
+				var req rawMessage
+				if err := stream.RecvMsg(&req); err != nil {
+					return err
+				}
+
+				mu.Lock()
+				methods[method] = req.data
+				mu.Unlock()
+
+				if test.err != nil {
+					return test.err
+				}
+				return stream.SendMsg(&rawMessage{})
+			}
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			server := grpc.NewServer(grpc.CustomCodec(serverCodec{}), grpc.UnknownServiceHandler(handler))
+			go server.Serve(listener)
+			defer server.Stop()
+
+			client := newTestClient(t, newGRPCTransport(listener.Addr().String(), nil,
+				map[string]string{"Authorization": "secret"}, compressionGzip, 5*time.Second))
+			defer client.Close()
+
+			batch := testBatch()
+			err = client.Publish(context.Background(), batch)
+			if test.signal == outest.BatchRetryEvents {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			require.Len(t, batch.Signals, 1)
+			assert.Equal(t, test.signal, batch.Signals[0].Tag)
+
+			assert.Len(t, methods, 2)
+			assert.NotEmpty(t, methods[grpcLogsMethod])
+			assert.NotEmpty(t, methods[grpcMetricsMethod])
+		})
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	tests := map[string]struct {
+		host     string
+		protocol string
+		expected string
+		tls      bool
+	}{
+		"grpc default port":  {host: "collector", protocol: protocolGRPC, expected: "otlp(grpc://collector:4317)"},
+		"grpc https":         {host: "https://collector:1234", protocol: protocolGRPC, expected: "otlp(grpc://collector:1234)", tls: true},
+		"http default port":  {host: "collector", protocol: protocolHTTP, expected: "otlp(http://collector:4318)"},
+		"http path prefix":   {host: "https://collector/otlp/", protocol: protocolHTTP, expected: "otlp(https://collector:4318/otlp)", tls: true},
+		"http explicit port": {host: "http://collector:80", protocol: protocolHTTP, expected: "otlp(http://collector:80)"},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			config := defaultConfig
+			config.Protocol = test.protocol
+
+			tr, err := newTransport(test.host, nil, &config)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, tr.String())
+
+			switch tr := tr.(type) {
+			case *grpcTransport:
+				assert.Equal(t, test.tls, tr.tls != nil)
+			case *httpTransport:
+				assert.Equal(t, test.tls, tr.tls != nil)
+			}
+		})
+	}
+}
+
+func TestMakeOTLP(t *testing.T) {
+	cfg := common.MustNewConfigFrom(map[string]interface{}{
+		"hosts":       []string{"collector-1", "collector-2"},
+		"protocol":    "http",
+		"loadbalance": true,
+		"metrics":     map[string]interface{}{"gauges": []string{"system.load.*"}},
+	})
+
+	group, err := makeOTLP(nil, testInfo, outputs.NewNilObserver(), cfg)
+	require.NoError(t, err)
+	assert.Len(t, group.Clients, 2)
+
+	cfg = common.MustNewConfigFrom(map[string]interface{}{
+		"hosts":    []string{"collector"},
+		"protocol": "thrift",
+	})
+	_, err = makeOTLP(nil, testInfo, outputs.NewNilObserver(), cfg)
+	assert.Error(t, err)
+}
+
+// serverCodec makes rawCodec usable as a server codec.
+type serverCodec struct{ rawCodec }
+
+func (serverCodec) String() string { return "proto" }
+
+func newTestClient(t *testing.T, tr transport) *client {
+	t.Helper()
+
+	enc := newEncoder(testInfo, metricsConfig{Gauges: []string{"system.load.*"}})
+	c := newClient(tr, enc, outputs.NewNilObserver())
+	require.NoError(t, c.Connect())
+	return c
+}
+
+func testBatch() *outest.Batch {
+	return outest.NewBatch(
+		beat.Event{Timestamp: testTime, Fields: common.MapStr{"message": "hello"}},
+		beat.Event{Timestamp: testTime, Fields: common.MapStr{"message": "world"}},
+		beat.Event{Timestamp: testTime, Fields: common.MapStr{"system": common.MapStr{"load": common.MapStr{"1": 0.5}}}},
+	)
+}
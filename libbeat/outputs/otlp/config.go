@@ -0,0 +1,100 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
+)
+
+type otlpConfig struct {
+	Protocol    string            `config:"protocol"`
+	Headers     map[string]string `config:"headers"`
+	Compression string            `config:"compression"`
+	LoadBalance bool              `config:"loadbalance"`
+	Timeout     time.Duration     `config:"timeout"`
+	BulkMaxSize int               `config:"bulk_max_size"`
+	MaxRetries  int               `config:"max_retries"`
+	TLS         *tlscommon.Config `config:"ssl"`
+	Backoff     backoff           `config:"backoff"`
+	Metrics     metricsConfig     `config:"metrics"`
+}
+
+type backoff struct {
+	Init time.Duration
+	Max  time.Duration
+}
+
+// metricsConfig selects the numeric event fields that are exported as OTLP
+// metrics instead of log records.
+type metricsConfig struct {
+	Gauges     []string `config:"gauges"`
+	Sums       []string `config:"sums"`
+	Attributes []string `config:"attributes"`
+}
+
+const (
+	protocolGRPC = "grpc"
+	protocolHTTP = "http"
+
+	compressionNone = "none"
+	compressionGzip = "gzip"
+
+	defaultGRPCPort = 4317
+	defaultHTTPPort = 4318
+)
+
+var (
+	defaultConfig = otlpConfig{
+		Protocol:    protocolGRPC,
+		Compression: compressionGzip,
+		LoadBalance: false,
+		Timeout:     30 * time.Second,
+		BulkMaxSize: 1024,
+		MaxRetries:  3,
+		Backoff: backoff{
+			Init: 1 * time.Second,
+			Max:  60 * time.Second,
+		},
+	}
+)
+
+func (c *otlpConfig) Validate() error {
+	switch c.Protocol {
+	case protocolGRPC, protocolHTTP:
+	default:
+		return fmt.Errorf("unsupported otlp protocol '%v', must be grpc or http", c.Protocol)
+	}
+
+	switch c.Compression {
+	case compressionNone, compressionGzip:
+	default:
+		return fmt.Errorf("unsupported compression '%v', must be none or gzip", c.Compression)
+	}
+
+	for _, pattern := range append(append([]string{}, c.Metrics.Gauges...), c.Metrics.Sums...) {
+		if pattern == "" || strings.HasPrefix(pattern, ".") || strings.HasSuffix(pattern, ".") {
+			return fmt.Errorf("invalid metric field pattern '%v'", pattern)
+		}
+	}
+
+	return nil
+}
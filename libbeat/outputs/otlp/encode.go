@@ -0,0 +1,393 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"encoding/hex"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+)
+
+type signal uint8
+
+const (
+	signalLogs signal = iota
+	signalMetrics
+)
+
+func (s signal) String() string {
+	if s == signalMetrics {
+		return "metrics"
+	}
+	return "logs"
+}
+
+// exportRequest is a serialized ExportLogsServiceRequest or
+// ExportMetricsServiceRequest together with the events it contains.
+type exportRequest struct {
+	signal signal
+	body   []byte
+	events []publisher.Event
+}
+
+// encoder maps events to OTLP requests. Events with numeric fields matching
+// the configured metric patterns are exported as metrics, all other events
+// as log records. ECS host, service and cloud fields become resource
+// attributes.
+type encoder struct {
+	beat       beat.Info
+	gauges     []string
+	sums       []string
+	attributes []string
+}
+
+// resourceRenames maps ECS fields to the OpenTelemetry semantic conventions
+// where the names differ.
+var resourceRenames = map[string]string{
+	"host.architecture":   "host.arch",
+	"service.environment": "deployment.environment",
+	"service.id":          "service.instance.id",
+}
+
+var resourcePrefixes = []string{"host.", "service.", "cloud."}
+
+func newEncoder(info beat.Info, config metricsConfig) *encoder {
+	return &encoder{
+		beat:       info,
+		gauges:     config.Gauges,
+		sums:       config.Sums,
+		attributes: config.Attributes,
+	}
+}
+
+type resourceGroup struct {
+	attributes []byte
+
+	logs      [][]byte
+	logEvents []publisher.Event
+
+	metrics      []*metric
+	metricIdx    map[string]*metric
+	metricEvents []publisher.Event
+}
+
+type metric struct {
+	name   string
+	sum    bool
+	points [][]byte
+}
+
+// encode converts the events into at most one logs and one metrics request.
+func (e *encoder) encode(events []publisher.Event, now time.Time) []exportRequest {
+	var groups []*resourceGroup
+	index := map[string]*resourceGroup{}
+
+	for i := range events {
+		event := &events[i]
+		fields := event.Content.Fields.Flatten()
+
+		resource := appendKeyValues(nil, 1, extractResource(fields))
+		group := index[string(resource)]
+		if group == nil {
+			group = &resourceGroup{attributes: resource, metricIdx: map[string]*metric{}}
+			index[string(resource)] = group
+			groups = append(groups, group)
+		}
+
+		if e.addMetrics(group, &event.Content, fields) {
+			group.metricEvents = append(group.metricEvents, *event)
+			continue
+		}
+		group.logs = append(group.logs, e.encodeLogRecord(&event.Content, fields, now))
+		group.logEvents = append(group.logEvents, *event)
+	}
+
+	var logs, metrics exportRequest
+	logs.signal, metrics.signal = signalLogs, signalMetrics
+	for _, group := range groups {
+		group := group
+		if len(group.logs) > 0 {
+			logs.events = append(logs.events, group.logEvents...)
+			logs.body = appendMessage(logs.body, 1, func(b []byte) []byte {
+				b = appendBytes(b, 1, group.attributes)
+				return appendMessage(b, 2, func(b []byte) []byte {
+					b = appendBytes(b, 1, e.encodeScope())
+					for _, record := range group.logs {
+						b = appendBytes(b, 2, record)
+					}
+					return b
+				})
+			})
+		}
+		if len(group.metrics) > 0 {
+			metrics.events = append(metrics.events, group.metricEvents...)
+			metrics.body = appendMessage(metrics.body, 1, func(b []byte) []byte {
+				b = appendBytes(b, 1, group.attributes)
+				return appendMessage(b, 2, func(b []byte) []byte {
+					b = appendBytes(b, 1, e.encodeScope())
+					for _, m := range group.metrics {
+						b = appendBytes(b, 2, encodeMetric(m))
+					}
+					return b
+				})
+			})
+		}
+	}
+
+	var requests []exportRequest
+	if len(logs.events) > 0 {
+		requests = append(requests, logs)
+	}
+	if len(metrics.events) > 0 {
+		requests = append(requests, metrics)
+	}
+	return requests
+}
+
+func (e *encoder) encodeScope() []byte {
+	b := appendString(nil, 1, e.beat.Beat)
+	return appendString(b, 2, e.beat.Version)
+}
+
+// extractResource removes the resource fields from the flattened event
+// fields and returns them as resource attributes.
+func extractResource(fields common.MapStr) []keyValue {
+	var attrs []keyValue
+	for k, v := range fields {
+		if !isResourceField(k) {
+			continue
+		}
+		delete(fields, k)
+
+		key := k
+		if renamed, ok := resourceRenames[k]; ok {
+			key = renamed
+		} else if strings.HasPrefix(k, "host.os.") {
+			key = strings.TrimPrefix(k, "host.")
+		}
+		attrs = append(attrs, keyValue{key: key, value: v})
+	}
+	sortKeyValues(attrs)
+	return attrs
+}
+
+func isResourceField(key string) bool {
+	for _, prefix := range resourcePrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// addMetrics adds a data point for every numeric field matching a metric
+// pattern and reports whether the event contained any metric.
+func (e *encoder) addMetrics(group *resourceGroup, event *beat.Event, fields common.MapStr) bool {
+	if len(e.gauges) == 0 && len(e.sums) == 0 {
+		return false
+	}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var attrs []keyValue
+	for _, k := range e.attributes {
+		if v, ok := fields[k]; ok {
+			attrs = append(attrs, keyValue{key: k, value: v})
+		}
+	}
+	sortKeyValues(attrs)
+
+	found := false
+	for _, k := range keys {
+		v := fields[k]
+		sum := matchAny(e.sums, k)
+		if !sum && !matchAny(e.gauges, k) {
+			continue
+		}
+
+		point, ok := encodeDataPoint(v, attrs, event.Timestamp)
+		if !ok {
+			continue
+		}
+		found = true
+
+		id := k
+		if sum {
+			id = "sum:" + k
+		}
+		m := group.metricIdx[id]
+		if m == nil {
+			m = &metric{name: k, sum: sum}
+			group.metricIdx[id] = m
+			group.metrics = append(group.metrics, m)
+		}
+		m.points = append(m.points, point)
+	}
+	return found
+}
+
+// encodeDataPoint encodes a NumberDataPoint. Values that are not numbers are
+// skipped.
+func encodeDataPoint(v interface{}, attrs []keyValue, ts time.Time) ([]byte, bool) {
+	b := appendKeyValues(nil, 7, attrs)
+	b = appendTime(b, 3, ts)
+
+	if i, ok := toInt64(v); ok {
+		b = protowire.AppendTag(b, 6, protowire.Fixed64Type)
+		return protowire.AppendFixed64(b, uint64(i)), true
+	}
+	if f, ok := toFloat64(v); ok {
+		b = protowire.AppendTag(b, 4, protowire.Fixed64Type)
+		return protowire.AppendFixed64(b, math.Float64bits(f)), true
+	}
+	return nil, false
+}
+
+func encodeMetric(m *metric) []byte {
+	b := appendString(nil, 1, m.name)
+	if !m.sum {
+		return appendMessage(b, 5, func(b []byte) []byte {
+			for _, point := range m.points {
+				b = appendBytes(b, 1, point)
+			}
+			return b
+		})
+	}
+
+	return appendMessage(b, 7, func(b []byte) []byte {
+		for _, point := range m.points {
+			b = appendBytes(b, 1, point)
+		}
+		b = appendVarint(b, 2, aggregationTemporalityCumulative)
+		return appendVarint(b, 3, protowire.EncodeBool(true))
+	})
+}
+
+const aggregationTemporalityCumulative = 2
+
+// encodeLogRecord encodes a LogRecord. The message becomes the body, the log
+// level the severity and all remaining fields the attributes.
+func (e *encoder) encodeLogRecord(event *beat.Event, fields common.MapStr, now time.Time) []byte {
+	b := appendTime(nil, 1, event.Timestamp)
+	b = appendTime(b, 11, now)
+
+	if level, ok := fields["log.level"].(string); ok {
+		delete(fields, "log.level")
+		b = appendVarint(b, 2, uint64(severityNumber(level)))
+		b = appendString(b, 3, level)
+	}
+
+	if msg, ok := fields["message"]; ok {
+		delete(fields, "message")
+		b = appendMessage(b, 5, func(b []byte) []byte {
+			return appendAnyValue(b, msg)
+		})
+	}
+
+	traceID := extractID(fields, "trace.id", 16)
+	spanID := extractID(fields, "span.id", 8)
+
+	b = appendKeyValues(b, 6, mapToKeyValues(fields))
+	if traceID != nil {
+		b = appendBytes(b, 9, traceID)
+	}
+	if spanID != nil {
+		b = appendBytes(b, 10, spanID)
+	}
+	return b
+}
+
+// extractID removes a hex encoded trace or span ID of the given size from
+// the fields. IDs that are not valid are kept as attributes.
+func extractID(fields common.MapStr, key string, size int) []byte {
+	s, ok := fields[key].(string)
+	if !ok {
+		return nil
+	}
+	id, err := hex.DecodeString(s)
+	if err != nil || len(id) != size {
+		return nil
+	}
+	delete(fields, key)
+	return id
+}
+
+// severityNumber maps common log level names to OTLP severity numbers.
+func severityNumber(level string) int {
+	switch strings.ToLower(level) {
+	case "trace":
+		return 1
+	case "debug":
+		return 5
+	case "info", "informational", "notice":
+		return 9
+	case "warn", "warning":
+		return 13
+	case "error", "err":
+		return 17
+	case "fatal", "critical", "crit", "alert", "emergency", "emerg":
+		return 21
+	default:
+		return 0
+	}
+}
+
+func matchAny(patterns []string, field string) bool {
+	for _, pattern := range patterns {
+		if matchField(pattern, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchField matches a dotted field name against a pattern where `*` matches
+// exactly one path segment.
+func matchField(pattern, field string) bool {
+	for {
+		pi := strings.IndexByte(pattern, '.')
+		fi := strings.IndexByte(field, '.')
+		if (pi < 0) != (fi < 0) {
+			return false
+		}
+
+		p, f := pattern, field
+		if pi >= 0 {
+			p, f = pattern[:pi], field[:fi]
+		}
+		if p != "*" && p != f {
+			return false
+		}
+		if pi < 0 {
+			return true
+		}
+		pattern, field = pattern[pi+1:], field[fi+1:]
+	}
+}
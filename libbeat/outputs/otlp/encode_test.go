@@ -0,0 +1,332 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// +build !integration
+
+package otlp
+
+import (
+	"encoding/hex"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+)
+
+var (
+	testInfo = beat.Info{Beat: "testbeat", Version: "7.10.0"}
+	testTime = time.Date(2020, 10, 18, 12, 30, 0, 0, time.UTC)
+)
+
+func TestEncodeLogs(t *testing.T) {
+	enc := newEncoder(testInfo, metricsConfig{})
+	events := testEvents(
+		common.MapStr{
+			"message":   "hello world",
+			"log.level": "WARN",
+			"trace":     common.MapStr{"id": "0102030405060708090a0b0c0d0e0f10"},
+			"span":      common.MapStr{"id": "not-hex"},
+			"host":      common.MapStr{"name": "web-1", "architecture": "x86_64", "os": common.MapStr{"type": "linux"}},
+			"service":   common.MapStr{"name": "nginx", "environment": "production"},
+			"event":     common.MapStr{"dataset": "nginx.access"},
+			"tags":      []string{"a", "b"},
+		},
+		common.MapStr{
+			"message": "second",
+			"host":    common.MapStr{"name": "web-1", "architecture": "x86_64", "os": common.MapStr{"type": "linux"}},
+			"service": common.MapStr{"name": "nginx", "environment": "production"},
+		},
+		common.MapStr{
+			"message": "other host",
+			"host":    common.MapStr{"name": "web-2"},
+		},
+	)
+
+	requests := enc.encode(events, testTime.Add(time.Second))
+	require.Len(t, requests, 1)
+	assert.Equal(t, signalLogs, requests[0].signal)
+	assert.Len(t, requests[0].events, 3)
+
+	resourceLogs := messages(t, requests[0].body, 1)
+	require.Len(t, resourceLogs, 2)
+
+	resource := messages(t, resourceLogs[0], 1)[0]
+	assert.Equal(t, map[string]interface{}{
+		"host.name":              "web-1",
+		"host.arch":              "x86_64",
+		"os.type":                "linux",
+		"service.name":           "nginx",
+		"deployment.environment": "production",
+	}, attributes(t, resource, 1))
+
+	scopeLogs := messages(t, resourceLogs[0], 2)
+	require.Len(t, scopeLogs, 1)
+	scope := messages(t, scopeLogs[0], 1)[0]
+	assert.Equal(t, "testbeat", str(t, scope, 1))
+	assert.Equal(t, "7.10.0", str(t, scope, 2))
+
+	records := messages(t, scopeLogs[0], 2)
+	require.Len(t, records, 2)
+
+	record := records[0]
+	assert.Equal(t, uint64(testTime.UnixNano()), scalar(t, record, 1))
+	assert.Equal(t, uint64(testTime.Add(time.Second).UnixNano()), scalar(t, record, 11))
+	assert.Equal(t, uint64(13), scalar(t, record, 2))
+	assert.Equal(t, "WARN", str(t, record, 3))
+	assert.Equal(t, "hello world", anyValue(t, messages(t, record, 5)[0]))
+	assert.Equal(t, map[string]interface{}{
+		"event.dataset": "nginx.access",
+		"span.id":       "not-hex",
+		"tags":          []interface{}{"a", "b"},
+	}, attributes(t, record, 6))
+
+	traceID, _ := hex.DecodeString("0102030405060708090a0b0c0d0e0f10")
+	assert.Equal(t, traceID, messages(t, record, 9)[0])
+	assert.Empty(t, messages(t, record, 10))
+
+	otherResource := messages(t, resourceLogs[1], 1)[0]
+	assert.Equal(t, map[string]interface{}{"host.name": "web-2"}, attributes(t, otherResource, 1))
+}
+
+func TestEncodeMetrics(t *testing.T) {
+	enc := newEncoder(testInfo, metricsConfig{
+		Gauges:     []string{"system.cpu.*.pct"},
+		Sums:       []string{"system.network.in.bytes"},
+		Attributes: []string{"metricset.name"},
+	})
+	events := testEvents(
+		common.MapStr{
+			"host":      common.MapStr{"name": "web-1"},
+			"metricset": common.MapStr{"name": "cpu"},
+			"system": common.MapStr{
+				"cpu":     common.MapStr{"user": common.MapStr{"pct": 0.25}, "system": common.MapStr{"pct": 0}},
+				"network": common.MapStr{"in": common.MapStr{"bytes": uint64(1024)}},
+				"other":   42,
+			},
+		},
+		common.MapStr{
+			"host":    common.MapStr{"name": "web-1"},
+			"message": "not a metric",
+		},
+	)
+
+	requests := enc.encode(events, testTime)
+	require.Len(t, requests, 2)
+	assert.Equal(t, signalLogs, requests[0].signal)
+	assert.Len(t, requests[0].events, 1)
+	assert.Equal(t, signalMetrics, requests[1].signal)
+	assert.Len(t, requests[1].events, 1)
+
+	resourceMetrics := messages(t, requests[1].body, 1)
+	require.Len(t, resourceMetrics, 1)
+	resource := messages(t, resourceMetrics[0], 1)[0]
+	assert.Equal(t, map[string]interface{}{"host.name": "web-1"}, attributes(t, resource, 1))
+
+	scopeMetrics := messages(t, resourceMetrics[0], 2)
+	require.Len(t, scopeMetrics, 1)
+	metrics := messages(t, scopeMetrics[0], 2)
+	require.Len(t, metrics, 3)
+
+	names := map[string][]byte{}
+	for _, m := range metrics {
+		names[str(t, m, 1)] = m
+	}
+	require.Contains(t, names, "system.cpu.user.pct")
+	require.Contains(t, names, "system.cpu.system.pct")
+	require.Contains(t, names, "system.network.in.bytes")
+
+	gauge := messages(t, names["system.cpu.user.pct"], 5)
+	require.Len(t, gauge, 1)
+	point := messages(t, gauge[0], 1)[0]
+	assert.Equal(t, uint64(testTime.UnixNano()), scalar(t, point, 3))
+	assert.Equal(t, 0.25, math.Float64frombits(scalar(t, point, 4)))
+	assert.Equal(t, map[string]interface{}{"metricset.name": "cpu"}, attributes(t, point, 7))
+
+	zero := messages(t, messages(t, names["system.cpu.system.pct"], 5)[0], 1)[0]
+	assert.Equal(t, uint64(0), scalar(t, zero, 6))
+
+	sum := messages(t, names["system.network.in.bytes"], 7)
+	require.Len(t, sum, 1)
+	assert.Equal(t, uint64(aggregationTemporalityCumulative), scalar(t, sum[0], 2))
+	assert.Equal(t, uint64(1), scalar(t, sum[0], 3))
+	point = messages(t, sum[0], 1)[0]
+	assert.Equal(t, uint64(1024), scalar(t, point, 6))
+}
+
+func TestMatchField(t *testing.T) {
+	tests := map[string]struct {
+		pattern, field string
+		match          bool
+	}{
+		"exact":            {"system.load.1", "system.load.1", true},
+		"wildcard":         {"system.cpu.*.pct", "system.cpu.user.pct", true},
+		"trailing":         {"system.memory.*", "system.memory.free", true},
+		"different":        {"system.load.1", "system.load.5", false},
+		"shorter field":    {"system.cpu.*.pct", "system.cpu.pct", false},
+		"longer field":     {"system.memory.*", "system.memory.swap.free", false},
+		"wildcard segment": {"*", "field", true},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.match, matchField(test.pattern, test.field))
+		})
+	}
+}
+
+func TestSeverityNumber(t *testing.T) {
+	tests := map[string]int{
+		"trace":   1,
+		"DEBUG":   5,
+		"info":    9,
+		"warning": 13,
+		"error":   17,
+		"fatal":   21,
+		"custom":  0,
+	}
+
+	for level, number := range tests {
+		assert.Equal(t, number, severityNumber(level), level)
+	}
+}
+
+func TestDecodePartialSuccess(t *testing.T) {
+	body := appendMessage(nil, 1, func(b []byte) []byte {
+		b = appendVarint(b, 1, 3)
+		return appendString(b, 2, "3 records rejected")
+	})
+
+	ps, err := decodePartialSuccess(body)
+	require.NoError(t, err)
+	assert.Equal(t, partialSuccess{rejected: 3, message: "3 records rejected"}, ps)
+
+	ps, err = decodePartialSuccess(nil)
+	require.NoError(t, err)
+	assert.Equal(t, partialSuccess{}, ps)
+
+	_, err = decodePartialSuccess([]byte{0x0a, 0x05})
+	assert.Error(t, err)
+}
+
+func testEvents(fields ...common.MapStr) []publisher.Event {
+	events := make([]publisher.Event, len(fields))
+	for i, f := range fields {
+		events[i] = publisher.Event{Content: beat.Event{Timestamp: testTime, Fields: f}}
+	}
+	return events
+}
+
+// fields decodes the top level fields of a protobuf message.
+func fields(t *testing.T, b []byte) map[protowire.Number][]interface{} {
+	t.Helper()
+
+	out := map[protowire.Number][]interface{}{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		require.True(t, n > 0, "invalid tag")
+		b = b[n:]
+
+		var v interface{}
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			v, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		default:
+			t.Fatalf("unexpected wire type %v", typ)
+		}
+		require.True(t, n >= 0, "invalid value")
+		b = b[n:]
+		out[num] = append(out[num], v)
+	}
+	return out
+}
+
+func messages(t *testing.T, b []byte, num protowire.Number) [][]byte {
+	t.Helper()
+
+	var out [][]byte
+	for _, v := range fields(t, b)[num] {
+		out = append(out, v.([]byte))
+	}
+	return out
+}
+
+func str(t *testing.T, b []byte, num protowire.Number) string {
+	t.Helper()
+
+	values := messages(t, b, num)
+	require.Len(t, values, 1)
+	return string(values[0])
+}
+
+func scalar(t *testing.T, b []byte, num protowire.Number) uint64 {
+	t.Helper()
+
+	values := fields(t, b)[num]
+	require.Len(t, values, 1)
+	return values[0].(uint64)
+}
+
+func attributes(t *testing.T, b []byte, num protowire.Number) map[string]interface{} {
+	t.Helper()
+
+	out := map[string]interface{}{}
+	for _, kv := range messages(t, b, num) {
+		out[str(t, kv, 1)] = anyValue(t, messages(t, kv, 2)[0])
+	}
+	return out
+}
+
+func anyValue(t *testing.T, b []byte) interface{} {
+	t.Helper()
+
+	for num, values := range fields(t, b) {
+		v := values[0]
+		switch num {
+		case anyValueString:
+			return string(v.([]byte))
+		case anyValueBool:
+			return v.(uint64) != 0
+		case anyValueInt:
+			return int64(v.(uint64))
+		case anyValueDouble:
+			return math.Float64frombits(v.(uint64))
+		case anyValueArray:
+			var elems []interface{}
+			for _, elem := range messages(t, v.([]byte), 1) {
+				elems = append(elems, anyValue(t, elem))
+			}
+			return elems
+		case anyValueKVList:
+			return attributes(t, v.([]byte), 1)
+		case anyValueBytes:
+			return v.([]byte)
+		}
+	}
+	return nil
+}
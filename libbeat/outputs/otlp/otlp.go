@@ -0,0 +1,108 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/url"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+)
+
+func init() {
+	outputs.RegisterType("otlp", makeOTLP)
+}
+
+func makeOTLP(
+	_ outputs.IndexManager,
+	beat beat.Info,
+	observer outputs.Observer,
+	cfg *common.Config,
+) (outputs.Group, error) {
+	config := defaultConfig
+	if err := cfg.Unpack(&config); err != nil {
+		return outputs.Fail(err)
+	}
+
+	hosts, err := outputs.ReadHostList(cfg)
+	if err != nil {
+		return outputs.Fail(err)
+	}
+
+	tlsConfig, err := tlscommon.LoadTLSConfig(config.TLS)
+	if err != nil {
+		return outputs.Fail(err)
+	}
+
+	enc := newEncoder(beat, config.Metrics)
+	clients := make([]outputs.NetworkClient, len(hosts))
+	for i, host := range hosts {
+		t, err := newTransport(host, tlsConfig, &config)
+		if err != nil {
+			return outputs.Fail(err)
+		}
+
+		client := newClient(t, enc, observer)
+		clients[i] = outputs.WithBackoff(client, config.Backoff.Init, config.Backoff.Max)
+	}
+
+	return outputs.SuccessNet(config.LoadBalance, config.BulkMaxSize, config.MaxRetries, clients)
+}
+
+// newTransport creates the transport for a host. Hosts without a scheme use
+// TLS if the ssl settings are configured. An explicit `http` scheme disables
+// TLS and an explicit `https` scheme enables it with the system defaults if
+// no ssl settings are configured.
+func newTransport(host string, tlsConfig *tlscommon.TLSConfig, config *otlpConfig) (transport, error) {
+	port := defaultGRPCPort
+	if config.Protocol == protocolHTTP {
+		port = defaultHTTPPort
+	}
+
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+
+	rawURL, err := common.MakeURL(scheme, "", host, port)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var hostTLS *tls.Config
+	switch u.Scheme {
+	case "http":
+	case "https":
+		hostTLS = tlsConfig.BuildModuleConfig(u.Hostname())
+	default:
+		return nil, fmt.Errorf("invalid otlp url scheme %v", u.Scheme)
+	}
+
+	if config.Protocol == protocolHTTP {
+		return newHTTPTransport(rawURL, hostTLS, config.Headers, config.Compression, config.Timeout), nil
+	}
+	return newGRPCTransport(u.Host, hostTLS, config.Headers, config.Compression, config.Timeout), nil
+}
@@ -0,0 +1,313 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	_ "google.golang.org/grpc/encoding/gzip" // register the gzip compressor
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// transport sends serialized export requests to a collector.
+type transport interface {
+	Connect() error
+	Close() error
+	Export(ctx context.Context, s signal, body []byte) (partialSuccess, error)
+	String() string
+}
+
+// exportError is returned by transports when a request was not accepted.
+// Only retryable errors cause the events to be sent again.
+type exportError struct {
+	err       error
+	retryable bool
+}
+
+func (e *exportError) Error() string { return e.err.Error() }
+func (e *exportError) Unwrap() error { return e.err }
+
+func isRetryable(err error) bool {
+	var exportErr *exportError
+	if errors.As(err, &exportErr) {
+		return exportErr.retryable
+	}
+	return true
+}
+
+const (
+	grpcLogsMethod    = "/opentelemetry.proto.collector.logs.v1.LogsService/Export"
+	grpcMetricsMethod = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+
+	httpLogsPath    = "/v1/logs"
+	httpMetricsPath = "/v1/metrics"
+)
+
+// rawMessage holds an already serialized protobuf message.
+type rawMessage struct {
+	data []byte
+}
+
+// rawCodec passes serialized messages through to gRPC. It is registered under
+// the proto name so the collector sees a regular protobuf request.
+type rawCodec struct{}
+
+func (rawCodec) Name() string { return "proto" }
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	msg, ok := v.(*rawMessage)
+	if !ok {
+		return nil, fmt.Errorf("unexpected message type %T", v)
+	}
+	return msg.data, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	msg, ok := v.(*rawMessage)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", v)
+	}
+	msg.data = append(msg.data[:0], data...)
+	return nil
+}
+
+type grpcTransport struct {
+	target      string
+	tls         *tls.Config
+	headers     metadata.MD
+	compression string
+	timeout     time.Duration
+
+	conn *grpc.ClientConn
+}
+
+func newGRPCTransport(target string, tlsConfig *tls.Config, headers map[string]string, compression string, timeout time.Duration) *grpcTransport {
+	return &grpcTransport{
+		target:      target,
+		tls:         tlsConfig,
+		headers:     metadata.New(headers),
+		compression: compression,
+		timeout:     timeout,
+	}
+}
+
+func (t *grpcTransport) Connect() error {
+	creds := grpc.WithInsecure()
+	if t.tls != nil {
+		creds = grpc.WithTransportCredentials(credentials.NewTLS(t.tls))
+	}
+
+	conn, err := grpc.Dial(t.target, creds)
+	if err != nil {
+		return err
+	}
+	t.conn = conn
+	return nil
+}
+
+func (t *grpcTransport) Close() error {
+	if t.conn == nil {
+		return nil
+	}
+	err := t.conn.Close()
+	t.conn = nil
+	return err
+}
+
+func (t *grpcTransport) Export(ctx context.Context, s signal, body []byte) (partialSuccess, error) {
+	if t.conn == nil {
+		return partialSuccess{}, errors.New("not connected")
+	}
+
+	method := grpcLogsMethod
+	if s == signalMetrics {
+		method = grpcMetricsMethod
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	if len(t.headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, t.headers)
+	}
+
+	opts := []grpc.CallOption{grpc.ForceCodec(rawCodec{})}
+	if t.compression == compressionGzip {
+		opts = append(opts, grpc.UseCompressor(compressionGzip))
+	}
+
+	var resp rawMessage
+	if err := t.conn.Invoke(ctx, method, &rawMessage{data: body}, &resp, opts...); err != nil {
+		return partialSuccess{}, &exportError{err: err, retryable: retryableCode(status.Code(err))}
+	}
+	return acceptedResponse(resp.data), nil
+}
+
+// retryableCode reports whether the gRPC status code allows retrying the
+// request, as defined by the OTLP specification.
+func retryableCode(code codes.Code) bool {
+	switch code {
+	case codes.Canceled, codes.DeadlineExceeded, codes.ResourceExhausted,
+		codes.Aborted, codes.OutOfRange, codes.Unavailable, codes.DataLoss:
+		return true
+	default:
+		return false
+	}
+}
+
+func (t *grpcTransport) String() string {
+	return "otlp(grpc://" + t.target + ")"
+}
+
+type httpTransport struct {
+	url         string
+	tls         *tls.Config
+	headers     map[string]string
+	compression string
+	timeout     time.Duration
+
+	client *http.Client
+}
+
+func newHTTPTransport(url string, tlsConfig *tls.Config, headers map[string]string, compression string, timeout time.Duration) *httpTransport {
+	return &httpTransport{
+		url:         strings.TrimSuffix(url, "/"),
+		tls:         tlsConfig,
+		headers:     headers,
+		compression: compression,
+		timeout:     timeout,
+	}
+}
+
+func (t *httpTransport) Connect() error {
+	t.client = &http.Client{
+		Timeout: t.timeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: t.tls,
+		},
+	}
+	return nil
+}
+
+func (t *httpTransport) Close() error {
+	if t.client != nil {
+		t.client.CloseIdleConnections()
+		t.client = nil
+	}
+	return nil
+}
+
+func (t *httpTransport) Export(ctx context.Context, s signal, body []byte) (partialSuccess, error) {
+	if t.client == nil {
+		return partialSuccess{}, errors.New("not connected")
+	}
+
+	path := httpLogsPath
+	if s == signalMetrics {
+		path = httpMetricsPath
+	}
+
+	var reader io.Reader = bytes.NewReader(body)
+	if t.compression == compressionGzip {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(body); err != nil {
+			return partialSuccess{}, err
+		}
+		if err := w.Close(); err != nil {
+			return partialSuccess{}, err
+		}
+		reader = &buf
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url+path, reader)
+	if err != nil {
+		return partialSuccess{}, &exportError{err: err}
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	if t.compression == compressionGzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return partialSuccess{}, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return partialSuccess{}, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return partialSuccess{}, &exportError{
+			err:       fmt.Errorf("%v %v: %v", resp.Status, t.url+path, strings.TrimSpace(string(respBody))),
+			retryable: retryableStatus(resp.StatusCode),
+		}
+	}
+
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/x-protobuf") {
+		return partialSuccess{}, nil
+	}
+	return acceptedResponse(respBody), nil
+}
+
+// acceptedResponse decodes the response of an accepted request. The request
+// must not be sent again, so a response that can not be decoded is treated
+// as a full success.
+func acceptedResponse(body []byte) partialSuccess {
+	ps, err := decodePartialSuccess(body)
+	if err != nil {
+		return partialSuccess{}
+	}
+	return ps
+}
+
+// retryableStatus reports whether the HTTP status code allows retrying the
+// request, as defined by the OTLP specification.
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+func (t *httpTransport) String() string {
+	return "otlp(" + t.url + ")"
+}
@@ -0,0 +1,299 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// The OTLP messages are encoded directly in the protobuf wire format. The
+// field numbers follow opentelemetry-proto v0.19 and later, which are
+// compatible with all collectors accepting the stable OTLP 1.0 protocol.
+
+// Field numbers of AnyValue.
+const (
+	anyValueString protowire.Number = 1
+	anyValueBool   protowire.Number = 2
+	anyValueInt    protowire.Number = 3
+	anyValueDouble protowire.Number = 4
+	anyValueArray  protowire.Number = 5
+	anyValueKVList protowire.Number = 6
+	anyValueBytes  protowire.Number = 7
+)
+
+// keyValue is an OTLP attribute.
+type keyValue struct {
+	key   string
+	value interface{}
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendFixed64(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, v)
+}
+
+func appendTime(b []byte, num protowire.Number, ts time.Time) []byte {
+	if ts.IsZero() {
+		return b
+	}
+	return appendFixed64(b, num, uint64(ts.UnixNano()))
+}
+
+// appendMessage appends the embedded message produced by fn.
+func appendMessage(b []byte, num protowire.Number, fn func([]byte) []byte) []byte {
+	return appendBytes(b, num, fn(nil))
+}
+
+func appendKeyValues(b []byte, num protowire.Number, kvs []keyValue) []byte {
+	for _, kv := range kvs {
+		kv := kv
+		b = appendMessage(b, num, func(b []byte) []byte {
+			b = appendString(b, 1, kv.key)
+			return appendMessage(b, 2, func(b []byte) []byte {
+				return appendAnyValue(b, kv.value)
+			})
+		})
+	}
+	return b
+}
+
+// appendAnyValue encodes the fields of an AnyValue message. Maps become key
+// value lists with sorted keys, slices become arrays and any other type not
+// known to OTLP is encoded as its string representation.
+func appendAnyValue(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return b
+	case string:
+		b = protowire.AppendTag(b, anyValueString, protowire.BytesType)
+		return protowire.AppendString(b, v)
+	case bool:
+		b = protowire.AppendTag(b, anyValueBool, protowire.VarintType)
+		return protowire.AppendVarint(b, protowire.EncodeBool(v))
+	case []byte:
+		return appendBytes(b, anyValueBytes, v)
+	case time.Time:
+		return appendAnyValue(b, v.UTC().Format(time.RFC3339Nano))
+	case common.Time:
+		return appendAnyValue(b, time.Time(v))
+	case common.MapStr:
+		return appendMessage(b, anyValueKVList, func(b []byte) []byte {
+			return appendKeyValues(b, 1, mapToKeyValues(v))
+		})
+	case map[string]interface{}:
+		return appendAnyValue(b, common.MapStr(v))
+	case []interface{}:
+		return appendMessage(b, anyValueArray, func(b []byte) []byte {
+			for _, elem := range v {
+				elem := elem
+				b = appendMessage(b, 1, func(b []byte) []byte {
+					return appendAnyValue(b, elem)
+				})
+			}
+			return b
+		})
+	case fmt.Stringer:
+		return appendAnyValue(b, v.String())
+	}
+
+	if i, ok := toInt64(v); ok {
+		b = protowire.AppendTag(b, anyValueInt, protowire.VarintType)
+		return protowire.AppendVarint(b, uint64(i))
+	}
+	if f, ok := toFloat64(v); ok {
+		b = protowire.AppendTag(b, anyValueDouble, protowire.Fixed64Type)
+		return protowire.AppendFixed64(b, math.Float64bits(f))
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		elems := make([]interface{}, rv.Len())
+		for i := range elems {
+			elems[i] = rv.Index(i).Interface()
+		}
+		return appendAnyValue(b, elems)
+	case reflect.Map:
+		if rv.Type().Key().Kind() == reflect.String {
+			m := make(common.MapStr, rv.Len())
+			for _, key := range rv.MapKeys() {
+				m[key.String()] = rv.MapIndex(key).Interface()
+			}
+			return appendAnyValue(b, m)
+		}
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return b
+		}
+		return appendAnyValue(b, rv.Elem().Interface())
+	}
+	return appendAnyValue(b, fmt.Sprint(v))
+}
+
+func mapToKeyValues(m common.MapStr) []keyValue {
+	kvs := make([]keyValue, 0, len(m))
+	for k, v := range m {
+		kvs = append(kvs, keyValue{key: k, value: v})
+	}
+	sortKeyValues(kvs)
+	return kvs
+}
+
+func sortKeyValues(kvs []keyValue) {
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].key < kvs[j].key })
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(v), true
+	}
+	return 0, false
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case uint64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// partialSuccess is the partial_success field of the export responses.
+type partialSuccess struct {
+	rejected int64
+	message  string
+}
+
+// decodePartialSuccess reads the partial_success field of an
+// ExportLogsServiceResponse or ExportMetricsServiceResponse. Both messages
+// share the same layout.
+func decodePartialSuccess(b []byte) (partialSuccess, error) {
+	var ps partialSuccess
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return ps, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if num != 1 || typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return ps, protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+
+		msg, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return ps, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		for len(msg) > 0 {
+			num, typ, n := protowire.ConsumeTag(msg)
+			if n < 0 {
+				return ps, protowire.ParseError(n)
+			}
+			msg = msg[n:]
+
+			switch {
+			case num == 1 && typ == protowire.VarintType:
+				v, n := protowire.ConsumeVarint(msg)
+				if n < 0 {
+					return ps, protowire.ParseError(n)
+				}
+				ps.rejected = int64(v)
+				msg = msg[n:]
+			case num == 2 && typ == protowire.BytesType:
+				v, n := protowire.ConsumeString(msg)
+				if n < 0 {
+					return ps, protowire.ParseError(n)
+				}
+				ps.message = v
+				msg = msg[n:]
+			default:
+				n = protowire.ConsumeFieldValue(num, typ, msg)
+				if n < 0 {
+					return ps, protowire.ParseError(n)
+				}
+				msg = msg[n:]
+			}
+		}
+	}
+	return ps, nil
+}
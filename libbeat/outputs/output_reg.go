@@ -47,6 +47,14 @@ type IndexSelector interface {
 	Select(event *beat.Event) (string, error)
 }
 
+// CreateOnlySelector is implemented by index selectors whose targets only
+// accept new documents, like Elasticsearch data streams. Events selected by
+// such a selector must be indexed using the `create` operation.
+type CreateOnlySelector interface {
+	IndexSelector
+	CreateOnly() bool
+}
+
 // Group configures and combines multiple clients into load-balanced group of clients
 // being managed by the publisher pipeline.
 type Group struct {
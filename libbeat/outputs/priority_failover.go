@@ -0,0 +1,302 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package outputs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/common/backoff"
+	"github.com/elastic/beats/v7/libbeat/common/transport"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/testing"
+)
+
+const (
+	// FailoverRandom connects to a random host if the active host fails.
+	FailoverRandom = "random"
+
+	// FailoverPriority connects to the hosts in the configured order, and
+	// fails back to a host of higher priority once it is healthy again.
+	FailoverPriority = "priority"
+)
+
+// FailoverConfig configures how the active host is selected if load
+// balancing is disabled.
+type FailoverConfig struct {
+	Mode          string        `config:"mode"`
+	ProbeInterval time.Duration `config:"probe_interval" validate:"positive,nonzero"`
+	FailbackAfter int           `config:"failback_after" validate:"min=1"`
+}
+
+// FailoverObserver is implemented by Observers reporting the active host of
+// failover clients.
+type FailoverObserver interface {
+	FailoverActive(host string)
+}
+
+// Probe checks the health of a host without using the connection of its
+// client.
+type Probe func() error
+
+// DialProbe returns a Probe opening and closing a connection to host.
+func DialProbe(config transport.Config, host string, defaultPort int) Probe {
+	config.Stats = nil
+	return func() error {
+		conn, err := transport.NewClient(config, "tcp", host, defaultPort)
+		if err != nil {
+			return err
+		}
+		if err := conn.Connect(); err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// DefaultFailoverConfig returns the default failover settings.
+func DefaultFailoverConfig() FailoverConfig {
+	return FailoverConfig{
+		Mode:          FailoverRandom,
+		ProbeInterval: 10 * time.Second,
+		FailbackAfter: 3,
+	}
+}
+
+// Validate checks the failover mode.
+func (c *FailoverConfig) Validate() error {
+	switch c.Mode {
+	case FailoverRandom, FailoverPriority:
+		return nil
+	default:
+		return fmt.Errorf("unknown failover mode '%v'", c.Mode)
+	}
+}
+
+// IsPriority returns true if the priority failover mode is configured.
+func (c *FailoverConfig) IsPriority() bool {
+	return c.Mode == FailoverPriority
+}
+
+type priorityFailoverClient struct {
+	log      *logp.Logger
+	clients  []NetworkClient
+	probes   []Probe
+	config   FailoverConfig
+	observer Observer
+
+	// active is only used by the output worker, the prober reads activeIdx.
+	active    int
+	activeIdx atomic.Int
+	failback  atomic.Int
+
+	done      chan struct{}
+	backoff   backoff.Backoff
+	startOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewPriorityFailoverClient combines a set of NetworkClients into one
+// NetworkClient, using the first client that can connect in the order of the
+// clients list. While a client of lower priority is active, the hosts of higher
+// priority are checked every probe interval. Once a host passed the configured
+// number of consecutive probes, the client fails back to that host.
+// The clients must not be wrapped with backoff, as the failover client backs
+// off after all clients failed to connect, or the active client failed to publish.
+func NewPriorityFailoverClient(
+	clients []NetworkClient,
+	probes []Probe,
+	config FailoverConfig,
+	init, max time.Duration,
+	observer Observer,
+) NetworkClient {
+	done := make(chan struct{})
+	f := &priorityFailoverClient{
+		log:      logp.NewLogger("failover"),
+		clients:  clients,
+		probes:   probes,
+		config:   config,
+		observer: observer,
+		active:   -1,
+		done:     done,
+		backoff:  backoff.NewEqualJitterBackoff(done, init, max),
+	}
+	f.activeIdx.Store(-1)
+	f.failback.Store(-1)
+	return f
+}
+
+func (f *priorityFailoverClient) Connect() error {
+	if len(f.clients) == 0 {
+		return ErrNoConnectionConfigured
+	}
+	f.startOnce.Do(func() {
+		f.wg.Add(1)
+		go f.probeLoop()
+	})
+
+	var errs []string
+	for i, client := range f.clients {
+		err := client.Connect()
+		if err == nil {
+			f.setActive(i)
+			f.backoff.Reset()
+			return nil
+		}
+		errs = append(errs, fmt.Sprintf("%v: %v", client, err))
+	}
+
+	f.backoff.Wait()
+	return fmt.Errorf("failed to connect to any host: %v", strings.Join(errs, "; "))
+}
+
+func (f *priorityFailoverClient) Close() error {
+	select {
+	case <-f.done:
+		return nil
+	default:
+	}
+	close(f.done)
+	f.wg.Wait()
+
+	if f.active < 0 {
+		return errNoActiveConnection
+	}
+	return f.clients[f.active].Close()
+}
+
+func (f *priorityFailoverClient) Publish(ctx context.Context, batch publisher.Batch) error {
+	if f.active < 0 {
+		batch.Retry()
+		return errNoActiveConnection
+	}
+
+	if next := f.failback.Swap(-1); next >= 0 && next < f.active {
+		f.tryFailback(next)
+	}
+
+	client := f.clients[f.active]
+	err := client.Publish(ctx, batch)
+	if err != nil {
+		client.Close()
+		f.setActive(-1)
+		f.backoff.Wait()
+		return err
+	}
+	f.backoff.Reset()
+	return nil
+}
+
+// tryFailback switches to the client of higher priority if it can connect.
+// The active client is only closed after the connection succeeded.
+func (f *priorityFailoverClient) tryFailback(next int) {
+	if err := f.clients[next].Connect(); err != nil {
+		f.log.Warnf("Failed to fail back to %v: %v", f.clients[next], err)
+		return
+	}
+
+	f.log.Infof("Failing back from %v to %v", f.clients[f.active], f.clients[next])
+	if err := f.clients[f.active].Close(); err != nil {
+		f.log.Debugf("Failed to close connection to %v: %v", f.clients[f.active], err)
+	}
+	f.setActive(next)
+}
+
+func (f *priorityFailoverClient) setActive(i int) {
+	f.active = i
+	f.activeIdx.Store(i)
+
+	if obs, ok := f.observer.(FailoverObserver); ok {
+		host := ""
+		if i >= 0 {
+			host = f.clients[i].String()
+		}
+		obs.FailoverActive(host)
+	}
+}
+
+// probeLoop probes the hosts with higher priority than the active host, and
+// signals a fail back once a host passed FailbackAfter consecutive probes.
+func (f *priorityFailoverClient) probeLoop() {
+	defer f.wg.Done()
+
+	ticker := time.NewTicker(f.config.ProbeInterval)
+	defer ticker.Stop()
+
+	passed := make([]int, len(f.clients))
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-ticker.C:
+		}
+
+		active := f.activeIdx.Load()
+		if active <= 0 {
+			for i := range passed {
+				passed[i] = 0
+			}
+			continue
+		}
+
+		for i := 0; i < active; i++ {
+			if i >= len(f.probes) || f.probes[i] == nil {
+				continue
+			}
+			if err := f.probes[i](); err != nil {
+				f.log.Debugf("Probe of %v failed: %v", f.clients[i], err)
+				passed[i] = 0
+			} else {
+				passed[i]++
+			}
+		}
+
+		for i := 0; i < active; i++ {
+			if passed[i] >= f.config.FailbackAfter {
+				f.failback.Store(i)
+				break
+			}
+		}
+	}
+}
+
+func (f *priorityFailoverClient) Test(d testing.Driver) {
+	for i, client := range f.clients {
+		c, ok := client.(testing.Testable)
+		d.Run(fmt.Sprintf("Client %d", i), func(d testing.Driver) {
+			if !ok {
+				d.Fatal("output", errors.New("client doesn't support testing"))
+			}
+			c.Test(d)
+		})
+	}
+}
+
+func (f *priorityFailoverClient) String() string {
+	names := make([]string, len(f.clients))
+	for i, client := range f.clients {
+		names[i] = client.String()
+	}
+	return "priority_failover(" + strings.Join(names, ",") + ")"
+}
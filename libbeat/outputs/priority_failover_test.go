@@ -0,0 +1,133 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package outputs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+)
+
+type mockNetworkClient struct {
+	name      string
+	down      atomic.Bool
+	connected atomic.Bool
+	published atomic.Int
+}
+
+func (c *mockNetworkClient) Connect() error {
+	if c.down.Load() {
+		return errors.New("connection refused")
+	}
+	c.connected.Store(true)
+	return nil
+}
+
+func (c *mockNetworkClient) Close() error {
+	c.connected.Store(false)
+	return nil
+}
+
+func (c *mockNetworkClient) Publish(_ context.Context, batch publisher.Batch) error {
+	if c.down.Load() || !c.connected.Load() {
+		return errors.New("connection reset")
+	}
+	c.published.Inc()
+	batch.ACK()
+	return nil
+}
+
+func (c *mockNetworkClient) String() string { return c.name }
+
+func (c *mockNetworkClient) probe() error {
+	if c.down.Load() {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func TestPriorityFailoverClient(t *testing.T) {
+	primary := &mockNetworkClient{name: "primary"}
+	secondary := &mockNetworkClient{name: "secondary"}
+	primary.down.Store(true)
+
+	reg := monitoring.NewRegistry()
+	client := NewPriorityFailoverClient(
+		[]NetworkClient{primary, secondary},
+		[]Probe{primary.probe, secondary.probe},
+		FailoverConfig{Mode: FailoverPriority, ProbeInterval: 10 * time.Millisecond, FailbackAfter: 2},
+		time.Millisecond, 10*time.Millisecond,
+		NewStats(reg),
+	)
+	defer client.Close()
+
+	publish := func() error {
+		return client.Publish(context.Background(), outest.NewBatch())
+	}
+
+	// primary is down, use secondary
+	require.NoError(t, client.Connect())
+	require.NoError(t, publish())
+	assert.Equal(t, 1, secondary.published.Load())
+	assert.Equal(t, "secondary", reg.Get("failover.active").(*monitoring.String).Get())
+
+	// fail back once the primary passed the probes
+	primary.down.Store(false)
+	require.Eventually(t, func() bool {
+		require.NoError(t, publish())
+		return primary.published.Load() > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.False(t, secondary.connected.Load())
+	assert.Equal(t, "primary", reg.Get("failover.active").(*monitoring.String).Get())
+	assert.Equal(t, uint64(1), reg.Get("failover.switches").(*monitoring.Uint).Get())
+
+	// the primary fails, reconnect to the secondary
+	primary.down.Store(true)
+	assert.Error(t, publish())
+	assert.Equal(t, "", reg.Get("failover.active").(*monitoring.String).Get())
+	require.NoError(t, client.Connect())
+	assert.Equal(t, "secondary", reg.Get("failover.active").(*monitoring.String).Get())
+	assert.Equal(t, uint64(2), reg.Get("failover.switches").(*monitoring.Uint).Get())
+
+	// all hosts are down
+	secondary.down.Store(true)
+	assert.Error(t, publish())
+	assert.Error(t, client.Connect())
+}
+
+func TestFailoverConfig(t *testing.T) {
+	config := DefaultFailoverConfig()
+	assert.NoError(t, config.Validate())
+	assert.False(t, config.IsPriority())
+
+	config.Mode = FailoverPriority
+	assert.NoError(t, config.Validate())
+	assert.True(t, config.IsPriority())
+
+	config.Mode = "round_robin"
+	assert.Error(t, config.Validate())
+}
@@ -23,6 +23,7 @@ import (
 
 	"github.com/elastic/beats/v7/libbeat/common/transport"
 	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
+	"github.com/elastic/beats/v7/libbeat/outputs"
 	"github.com/elastic/beats/v7/libbeat/outputs/codec"
 )
 
@@ -40,6 +41,8 @@ type redisConfig struct {
 	Db          int                   `config:"db"`
 	DataType    string                `config:"datatype"`
 	Backoff     backoff               `config:"backoff"`
+
+	Failover outputs.FailoverConfig `config:"failover"`
 }
 
 type backoff struct {
@@ -60,6 +63,7 @@ var (
 			Init: 1 * time.Second,
 			Max:  60 * time.Second,
 		},
+		Failover: outputs.DefaultFailoverConfig(),
 	}
 )
 
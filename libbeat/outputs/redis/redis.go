@@ -107,7 +107,9 @@ func makeRedis(
 		return outputs.Fail(err)
 	}
 
+	priorityFailover := !config.LoadBalance && config.Failover.IsPriority()
 	clients := make([]outputs.NetworkClient, len(hosts))
+	probes := make([]outputs.Probe, len(hosts))
 	for i, h := range hosts {
 		hasScheme := true
 		if parts := strings.SplitN(h, "://", 2); len(parts) != 2 {
@@ -164,9 +166,19 @@ func makeRedis(
 
 		client := newClient(conn, observer, config.Timeout,
 			pass, config.Db, key, dataType, config.Index, enc)
-		clients[i] = newBackoffClient(client, config.Backoff.Init, config.Backoff.Max)
+		if priorityFailover {
+			clients[i] = client
+			probes[i] = outputs.DialProbe(transp, hostUrl.Host, defaultPort)
+		} else {
+			clients[i] = newBackoffClient(client, config.Backoff.Init, config.Backoff.Max)
+		}
 	}
 
+	if priorityFailover {
+		client := outputs.NewPriorityFailoverClient(clients, probes, config.Failover,
+			config.Backoff.Init, config.Backoff.Max, observer)
+		return outputs.Success(config.BulkMaxSize, config.MaxRetries, client)
+	}
 	return outputs.SuccessNet(config.LoadBalance, config.BulkMaxSize, config.MaxRetries, clients)
 }
 
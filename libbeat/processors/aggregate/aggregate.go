@@ -0,0 +1,345 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package aggregate
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/beats/v7/libbeat/processors"
+)
+
+const (
+	processorName = "aggregate"
+	logName       = "processor." + processorName
+)
+
+// instanceID is used to assign each instance a unique monitoring namespace.
+var instanceID = atomic.MakeUint32(0)
+
+func init() {
+	processors.RegisterPlugin(processorName, New)
+}
+
+// aggregate groups events over tumbling windows, and emits one summary event
+// per group and window through the registered EmitFuncs.
+type aggregate struct {
+	config config
+	log    *logp.Logger
+
+	// clock returns the current time, it is replaced in tests.
+	clock func() time.Time
+
+	mu      sync.Mutex
+	windows map[time.Time]*window
+	rnd     *rand.Rand
+
+	// emitMu protects the emit targets. It is held for reading while
+	// summaries are emitted, so unregistering waits for in-flight emits.
+	emitMu  sync.RWMutex
+	targets []*emitTarget
+	stop    chan struct{}
+	done    chan struct{}
+
+	// emitting is set while targets are registered. It is checked by Run
+	// without taking emitMu.
+	emitting atomic.Bool
+
+	events           *monitoring.Int
+	groupsDropped    *monitoring.Int
+	summaries        *monitoring.Int
+	summariesDropped *monitoring.Int
+}
+
+type emitTarget struct {
+	emit processors.EmitFunc
+}
+
+type window struct {
+	start  time.Time
+	groups map[string]*group
+}
+
+type group struct {
+	values  []interface{}
+	count   int64
+	metrics []*metricStats
+}
+
+// New constructs a new aggregate processor.
+func New(cfg *common.Config) (processors.Processor, error) {
+	c := defaultConfig()
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, errors.Wrap(err, "fail to unpack the aggregate configuration")
+	}
+
+	// Logging and metrics (each processor instance has a unique ID).
+	var (
+		id      = int(instanceID.Inc())
+		log     = logp.NewLogger(logName).With("instance_id", id)
+		metrics = monitoring.Default.NewRegistry(logName+"."+strconv.Itoa(id), monitoring.DoNotReport)
+	)
+
+	return &aggregate{
+		config:           c,
+		log:              log,
+		clock:            time.Now,
+		windows:          map[time.Time]*window{},
+		rnd:              rand.New(rand.NewSource(time.Now().UnixNano())),
+		events:           monitoring.NewInt(metrics, "events"),
+		groupsDropped:    monitoring.NewInt(metrics, "groups_dropped"),
+		summaries:        monitoring.NewInt(metrics, "summaries"),
+		summariesDropped: monitoring.NewInt(metrics, "summaries_dropped"),
+	}, nil
+}
+
+// Run adds the event to the group of the current window.
+func (p *aggregate) Run(event *beat.Event) (*beat.Event, error) {
+	now := p.clock()
+	start := now.Truncate(p.config.Window)
+
+	values := make([]interface{}, len(p.config.GroupBy))
+	for i, field := range p.config.GroupBy {
+		if v, err := event.GetValue(field); err == nil {
+			values[i] = v
+		}
+	}
+	key := groupKey(values)
+
+	p.mu.Lock()
+	p.dropExpiredWindows(start)
+	w, ok := p.windows[start]
+	if !ok {
+		w = &window{start: start, groups: map[string]*group{}}
+		p.windows[start] = w
+	}
+	g, ok := w.groups[key]
+	if !ok && len(w.groups) < p.config.MaxGroups {
+		g = &group{values: values, metrics: make([]*metricStats, len(p.config.Metrics))}
+		for i := range g.metrics {
+			g.metrics[i] = newMetricStats(p.config.PercentileSampleSize)
+		}
+		w.groups[key] = g
+	}
+	if g != nil {
+		p.add(g, event)
+	}
+	p.mu.Unlock()
+
+	if g == nil {
+		p.groupsDropped.Inc()
+	} else {
+		p.events.Inc()
+	}
+
+	if p.config.RawEvents == rawEventsDrop {
+		return nil, nil
+	}
+	return event, nil
+}
+
+func (p *aggregate) add(g *group, event *beat.Event) {
+	g.count++
+	for i, m := range p.config.Metrics {
+		v, err := event.GetValue(m.Field)
+		if err != nil {
+			continue
+		}
+		if f, ok := toFloat(v); ok {
+			g.metrics[i].add(f, p.rnd)
+		}
+	}
+}
+
+// dropExpiredWindows removes the windows that ended, if no EmitFunc is
+// registered to emit them. It must be called with p.mu held.
+func (p *aggregate) dropExpiredWindows(current time.Time) {
+	if p.emitting.Load() {
+		return
+	}
+
+	for start, w := range p.windows {
+		if start.Before(current) {
+			p.log.Warnf("Dropping %v summaries of window %v, the processor is not connected to a publisher pipeline", len(w.groups), start)
+			p.summariesDropped.Add(int64(len(w.groups)))
+			delete(p.windows, start)
+		}
+	}
+}
+
+// RegisterEmitFunc adds a target for summary events. Summaries are emitted
+// through the oldest registered target. The window loop runs while at least
+// one target is registered.
+func (p *aggregate) RegisterEmitFunc(emit processors.EmitFunc) func() {
+	target := &emitTarget{emit: emit}
+
+	p.emitMu.Lock()
+	p.targets = append(p.targets, target)
+	if len(p.targets) == 1 {
+		p.emitting.Store(true)
+		p.stop = make(chan struct{})
+		p.done = make(chan struct{})
+		go p.run(p.stop, p.done)
+	}
+	p.emitMu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { p.unregister(target) })
+	}
+}
+
+// unregister removes a target. When the last target is removed, the window
+// loop is stopped and all pending summaries, including the ones of the
+// current window, are emitted through it.
+func (p *aggregate) unregister(target *emitTarget) {
+	p.emitMu.Lock()
+	last := len(p.targets) == 1 && p.targets[0] == target
+	if !last {
+		for i, t := range p.targets {
+			if t == target {
+				p.targets = append(p.targets[:i:i], p.targets[i+1:]...)
+				break
+			}
+		}
+		p.emitMu.Unlock()
+		return
+	}
+	stop, done := p.stop, p.done
+	p.emitMu.Unlock()
+
+	// The loop emits through the targets, it must be stopped before the
+	// last target is removed.
+	close(stop)
+	<-done
+
+	p.emitMu.Lock()
+	defer p.emitMu.Unlock()
+	for _, e := range p.collect(time.Time{}, true) {
+		target.emit(e)
+		p.summaries.Inc()
+	}
+	p.targets = nil
+	p.emitting.Store(false)
+}
+
+func (p *aggregate) run(stop, done chan struct{}) {
+	defer close(done)
+
+	for {
+		now := time.Now()
+		next := now.Truncate(p.config.Window).Add(p.config.Window)
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+			p.flush(p.clock())
+		}
+	}
+}
+
+// flush emits the summaries of the windows ended at now.
+func (p *aggregate) flush(now time.Time) {
+	p.emitMu.RLock()
+	defer p.emitMu.RUnlock()
+
+	summaries := p.collect(now, false)
+	if len(p.targets) == 0 {
+		p.summariesDropped.Add(int64(len(summaries)))
+		return
+	}
+	for _, e := range summaries {
+		p.targets[0].emit(e)
+		p.summaries.Inc()
+	}
+}
+
+// collect removes the ended windows, or all windows, and returns their
+// summaries ordered by window.
+func (p *aggregate) collect(now time.Time, all bool) []beat.Event {
+	p.mu.Lock()
+	var windows []*window
+	for start, w := range p.windows {
+		if all || !start.Add(p.config.Window).After(now) {
+			windows = append(windows, w)
+			delete(p.windows, start)
+		}
+	}
+	p.mu.Unlock()
+
+	sort.Slice(windows, func(i, j int) bool { return windows[i].start.Before(windows[j].start) })
+
+	var events []beat.Event
+	for _, w := range windows {
+		for _, g := range w.groups {
+			events = append(events, p.summary(w, g))
+		}
+	}
+	return events
+}
+
+func (p *aggregate) summary(w *window, g *group) beat.Event {
+	fields := common.MapStr{
+		"event": common.MapStr{
+			"kind":  "metric",
+			"start": w.start,
+			"end":   w.start.Add(p.config.Window),
+		},
+	}
+	for i, field := range p.config.GroupBy {
+		if g.values[i] != nil {
+			fields.Put(field, g.values[i])
+		}
+	}
+
+	fields.Put(p.config.Target+".count", g.count)
+	for i, m := range p.config.Metrics {
+		if stats := g.metrics[i].summary(m); stats != nil {
+			fields.Put(p.config.Target+"."+m.Field, stats)
+		}
+	}
+	return beat.Event{Timestamp: w.start, Fields: fields}
+}
+
+// groupKey builds a unique key for the values of the group_by fields.
+func groupKey(values []interface{}) string {
+	var b strings.Builder
+	for _, v := range values {
+		fmt.Fprintf(&b, "%T:%v\x00", v, v)
+	}
+	return b.String()
+}
+
+func (p *aggregate) String() string {
+	return fmt.Sprintf("%v=[window=%v, group_by=%v, target=%v, raw_events=%v]",
+		processorName, p.config.Window, p.config.GroupBy, p.config.Target, p.config.RawEvents)
+}
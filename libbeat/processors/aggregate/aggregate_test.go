@@ -0,0 +1,305 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package aggregate
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+var testStart = time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+func TestNew(t *testing.T) {
+	cases := map[string]struct {
+		config common.MapStr
+		err    bool
+	}{
+		"window only": {
+			config: common.MapStr{"window": "1m"},
+		},
+		"metrics": {
+			config: common.MapStr{
+				"window":   "1m",
+				"group_by": []string{"http.response.status_code"},
+				"metrics":  []common.MapStr{{"field": "event.duration", "stats": []string{"avg"}, "percentiles": []float64{50, 99.9}}},
+			},
+		},
+		"missing window": {
+			config: common.MapStr{},
+			err:    true,
+		},
+		"negative window": {
+			config: common.MapStr{"window": "-1m"},
+			err:    true,
+		},
+		"invalid stat": {
+			config: common.MapStr{"window": "1m", "metrics": []common.MapStr{{"field": "x", "stats": []string{"median"}}}},
+			err:    true,
+		},
+		"invalid percentile": {
+			config: common.MapStr{"window": "1m", "metrics": []common.MapStr{{"field": "x", "percentiles": []float64{101}}}},
+			err:    true,
+		},
+		"invalid raw_events": {
+			config: common.MapStr{"window": "1m", "raw_events": "keep"},
+			err:    true,
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(common.MustNewConfigFrom(test.config))
+			if test.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	p, now := newTestAggregate(t, common.MapStr{
+		"window":   "1m",
+		"group_by": []string{"http.response.status_code"},
+		"metrics": []common.MapStr{
+			{"field": "http.response.body.bytes"},
+			{"field": "event.duration", "stats": []string{"max"}, "percentiles": []float64{50, 90}},
+		},
+	})
+	emitted := &collector{}
+	unregister := p.RegisterEmitFunc(emitted.emit)
+
+	events := []struct {
+		offset   time.Duration
+		status   int
+		bytes    interface{}
+		duration int64
+	}{
+		{0, 200, 100, 10},
+		{10 * time.Second, 200, 300, 20},
+		{20 * time.Second, 404, 50, 30},
+		{30 * time.Second, 200, "not a number", 40},
+		{50 * time.Second, 200, uint64(200), 50},
+		{70 * time.Second, 500, 10, 60},
+	}
+	for _, e := range events {
+		*now = testStart.Add(e.offset)
+		out, err := p.Run(&beat.Event{Fields: common.MapStr{
+			"http":  common.MapStr{"response": common.MapStr{"status_code": e.status, "body": common.MapStr{"bytes": e.bytes}}},
+			"event": common.MapStr{"duration": e.duration},
+		}})
+		require.NoError(t, err)
+		assert.NotNil(t, out, "raw events are forwarded by default")
+	}
+
+	// Only the first window has ended.
+	p.flush(testStart.Add(time.Minute))
+	summaries := emitted.take()
+	require.Len(t, summaries, 2)
+
+	windowFields := common.MapStr{
+		"kind":  "metric",
+		"start": testStart,
+		"end":   testStart.Add(time.Minute),
+	}
+	assert.Equal(t, testStart, summaries[0].Timestamp)
+	assert.Equal(t, common.MapStr{
+		"event": windowFields,
+		"http":  common.MapStr{"response": common.MapStr{"status_code": 200}},
+		"aggregate": common.MapStr{
+			"count": int64(4),
+			"http": common.MapStr{"response": common.MapStr{"body": common.MapStr{"bytes": common.MapStr{
+				"count": int64(3),
+				"sum":   600.0,
+				"min":   100.0,
+				"max":   300.0,
+				"avg":   200.0,
+			}}}},
+			"event": common.MapStr{"duration": common.MapStr{
+				"max": 50.0,
+				"p50": 30.0,
+				"p90": 47.0,
+			}},
+		},
+	}, summaries[0].Fields)
+	assert.Equal(t, common.MapStr{
+		"event": windowFields,
+		"http":  common.MapStr{"response": common.MapStr{"status_code": 404}},
+		"aggregate": common.MapStr{
+			"count": int64(1),
+			"http": common.MapStr{"response": common.MapStr{"body": common.MapStr{"bytes": common.MapStr{
+				"count": int64(1),
+				"sum":   50.0,
+				"min":   50.0,
+				"max":   50.0,
+				"avg":   50.0,
+			}}}},
+			"event": common.MapStr{"duration": common.MapStr{
+				"max": 30.0,
+				"p50": 30.0,
+				"p90": 30.0,
+			}},
+		},
+	}, summaries[1].Fields)
+
+	// Unregistering the last target emits the pending windows.
+	unregister()
+	summaries = emitted.take()
+	require.Len(t, summaries, 1)
+	status, _ := summaries[0].GetValue("http.response.status_code")
+	assert.Equal(t, 500, status)
+	assert.Equal(t, testStart.Add(time.Minute), summaries[0].Timestamp)
+	assert.Equal(t, int64(3), p.summaries.Get())
+}
+
+func TestAggregateDropRawEvents(t *testing.T) {
+	p, _ := newTestAggregate(t, common.MapStr{"window": "1m", "raw_events": "drop"})
+	emitted := &collector{}
+	unregister := p.RegisterEmitFunc(emitted.emit)
+
+	for i := 0; i < 3; i++ {
+		out, err := p.Run(&beat.Event{Fields: common.MapStr{"message": "hello"}})
+		require.NoError(t, err)
+		assert.Nil(t, out)
+	}
+
+	unregister()
+	summaries := emitted.take()
+	require.Len(t, summaries, 1)
+	count, _ := summaries[0].GetValue("aggregate.count")
+	assert.Equal(t, int64(3), count)
+}
+
+func TestAggregateMaxGroups(t *testing.T) {
+	p, _ := newTestAggregate(t, common.MapStr{
+		"window":     "1m",
+		"group_by":   []string{"user.name"},
+		"max_groups": 2,
+		"target":     "stats",
+	})
+	emitted := &collector{}
+	unregister := p.RegisterEmitFunc(emitted.emit)
+
+	for _, user := range []string{"a", "b", "c", "a"} {
+		_, err := p.Run(&beat.Event{Fields: common.MapStr{"user": common.MapStr{"name": user}}})
+		require.NoError(t, err)
+	}
+
+	unregister()
+	counts := map[interface{}]interface{}{}
+	for _, e := range emitted.take() {
+		user, _ := e.GetValue("user.name")
+		counts[user], _ = e.GetValue("stats.count")
+	}
+	assert.Equal(t, map[interface{}]interface{}{"a": int64(2), "b": int64(1)}, counts)
+	assert.Equal(t, int64(1), p.groupsDropped.Get())
+}
+
+func TestAggregateWithoutEmitter(t *testing.T) {
+	p, now := newTestAggregate(t, common.MapStr{"window": "1m"})
+
+	_, err := p.Run(&beat.Event{Fields: common.MapStr{}})
+	require.NoError(t, err)
+
+	// The ended window can not be emitted and is dropped.
+	*now = testStart.Add(time.Minute)
+	_, err = p.Run(&beat.Event{Fields: common.MapStr{}})
+	require.NoError(t, err)
+	assert.Len(t, p.windows, 1)
+	assert.Equal(t, int64(1), p.summariesDropped.Get())
+}
+
+func TestAggregateEmitTargets(t *testing.T) {
+	p, _ := newTestAggregate(t, common.MapStr{"window": "1m"})
+	first, second := &collector{}, &collector{}
+	unregisterFirst := p.RegisterEmitFunc(first.emit)
+	unregisterSecond := p.RegisterEmitFunc(second.emit)
+
+	_, err := p.Run(&beat.Event{Fields: common.MapStr{}})
+	require.NoError(t, err)
+	p.flush(testStart.Add(time.Minute))
+	assert.Len(t, first.take(), 1)
+
+	// Summaries go to the remaining target once the first is unregistered.
+	unregisterFirst()
+	_, err = p.Run(&beat.Event{Fields: common.MapStr{}})
+	require.NoError(t, err)
+	unregisterSecond()
+	assert.Len(t, first.take(), 0)
+	assert.Len(t, second.take(), 1)
+}
+
+func TestPercentile(t *testing.T) {
+	values := []float64{1, 2, 3, 4, 5}
+	assert.Equal(t, 1.0, percentile(values, 0))
+	assert.Equal(t, 3.0, percentile(values, 50))
+	assert.Equal(t, 4.6, percentile(values, 90))
+	assert.Equal(t, 5.0, percentile(values, 100))
+	assert.Equal(t, 7.0, percentile([]float64{7}, 99))
+	assert.Equal(t, "p99_9", percentileName(99.9))
+}
+
+func newTestAggregate(t *testing.T, config common.MapStr) (*aggregate, *time.Time) {
+	p, err := New(common.MustNewConfigFrom(config))
+	require.NoError(t, err)
+
+	a := p.(*aggregate)
+	now := testStart
+	a.clock = func() time.Time { return now }
+	return a, &now
+}
+
+type collector struct {
+	mu     sync.Mutex
+	events []beat.Event
+}
+
+func (c *collector) emit(e beat.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, e)
+}
+
+// take returns the collected events ordered by their timestamp and group,
+// and resets the collector.
+func (c *collector) take() []beat.Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	events := c.events
+	c.events = nil
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].Timestamp.Equal(events[j].Timestamp) {
+			return events[i].Timestamp.Before(events[j].Timestamp)
+		}
+		a, _ := events[i].GetValue("http.response.status_code")
+		b, _ := events[j].GetValue("http.response.status_code")
+		ai, _ := a.(int)
+		bi, _ := b.(int)
+		return ai < bi
+	})
+	return events
+}
@@ -0,0 +1,120 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package aggregate
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type config struct {
+	Window               time.Duration   `config:"window" validate:"required,positive"`
+	GroupBy              []string        `config:"group_by"`
+	Metrics              []metricConfig  `config:"metrics"`
+	Target               string          `config:"target"`
+	RawEvents            rawEventsAction `config:"raw_events"`
+	MaxGroups            int             `config:"max_groups" validate:"min=1"`
+	PercentileSampleSize int             `config:"percentile_sample_size" validate:"min=1"`
+}
+
+type metricConfig struct {
+	Field       string    `config:"field" validate:"required"`
+	Stats       []string  `config:"stats"`
+	Percentiles []float64 `config:"percentiles"`
+}
+
+type rawEventsAction uint8
+
+const (
+	rawEventsForward rawEventsAction = iota
+	rawEventsDrop
+)
+
+var rawEventsActionNames = map[rawEventsAction]string{
+	rawEventsForward: "forward",
+	rawEventsDrop:    "drop",
+}
+
+var statNames = []string{"count", "sum", "min", "max", "avg"}
+
+func defaultConfig() config {
+	return config{
+		Target:               "aggregate",
+		RawEvents:            rawEventsForward,
+		MaxGroups:            10000,
+		PercentileSampleSize: 1000,
+	}
+}
+
+// Validate checks the metric statistics and percentiles.
+func (c *config) Validate() error {
+	if c.Target == "" {
+		return errors.New("target must not be empty")
+	}
+	for i := range c.Metrics {
+		m := &c.Metrics[i]
+		if len(m.Stats) == 0 && len(m.Percentiles) == 0 {
+			m.Stats = statNames
+		}
+		for _, stat := range m.Stats {
+			if !isStat(stat) {
+				return fmt.Errorf("invalid statistic '%v' for field %v, expected one of %v",
+					stat, m.Field, strings.Join(statNames, ", "))
+			}
+		}
+		for _, p := range m.Percentiles {
+			if p <= 0 || p > 100 {
+				return fmt.Errorf("invalid percentile %v for field %v, must be greater than 0 and at most 100", p, m.Field)
+			}
+		}
+	}
+	return nil
+}
+
+func isStat(name string) bool {
+	for _, stat := range statNames {
+		if stat == name {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the action name.
+func (a rawEventsAction) String() string {
+	if name, found := rawEventsActionNames[a]; found {
+		return name
+	}
+	return "unknown"
+}
+
+// Unpack unpacks a string to a rawEventsAction.
+func (a *rawEventsAction) Unpack(v string) error {
+	switch strings.ToLower(v) {
+	case "", "forward":
+		*a = rawEventsForward
+	case "drop":
+		*a = rawEventsDrop
+	default:
+		return errors.Errorf("invalid raw_events value '%v' (valid values are: forward, drop)", v)
+	}
+	return nil
+}
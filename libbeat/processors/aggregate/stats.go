@@ -0,0 +1,148 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package aggregate
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// metricStats accumulates the values of a numeric field.
+type metricStats struct {
+	count    int64
+	sum      float64
+	min, max float64
+
+	// samples is a uniform sample of the values, used to compute the
+	// percentiles.
+	samples    []float64
+	sampleSize int
+}
+
+func newMetricStats(sampleSize int) *metricStats {
+	return &metricStats{sampleSize: sampleSize}
+}
+
+func (s *metricStats) add(v float64, rnd *rand.Rand) {
+	s.count++
+	s.sum += v
+	if s.count == 1 || v < s.min {
+		s.min = v
+	}
+	if s.count == 1 || v > s.max {
+		s.max = v
+	}
+
+	// Reservoir sampling, every value has the same probability to be part
+	// of the sample.
+	if len(s.samples) < s.sampleSize {
+		s.samples = append(s.samples, v)
+	} else if i := rnd.Int63n(s.count); i < int64(s.sampleSize) {
+		s.samples[i] = v
+	}
+}
+
+// summary returns the configured statistics, or nil if no value has been
+// added.
+func (s *metricStats) summary(m metricConfig) common.MapStr {
+	if s.count == 0 {
+		return nil
+	}
+
+	out := common.MapStr{}
+	for _, stat := range m.Stats {
+		switch stat {
+		case "count":
+			out[stat] = s.count
+		case "sum":
+			out[stat] = s.sum
+		case "min":
+			out[stat] = s.min
+		case "max":
+			out[stat] = s.max
+		case "avg":
+			out[stat] = s.sum / float64(s.count)
+		}
+	}
+
+	if len(m.Percentiles) > 0 {
+		sort.Float64s(s.samples)
+		for _, p := range m.Percentiles {
+			out[percentileName(p)] = percentile(s.samples, p)
+		}
+	}
+	return out
+}
+
+// percentile interpolates linearly between the closest ranks of the sorted
+// values.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	if lower >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	frac := rank - float64(lower)
+	return sorted[lower] + frac*(sorted[lower+1]-sorted[lower])
+}
+
+// percentileName returns the field name of a percentile, like p95 or p99_9.
+func percentileName(p float64) string {
+	return "p" + strings.Replace(strconv.FormatFloat(p, 'f', -1, 64), ".", "_", 1)
+}
+
+// toFloat converts numeric values. Other values are ignored.
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case common.Float:
+		return float64(v), true
+	}
+	return 0, false
+}
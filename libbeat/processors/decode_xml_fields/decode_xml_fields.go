@@ -0,0 +1,169 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package decode_xml_fields
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/beat/events"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/encoding/xml"
+	"github.com/elastic/beats/v7/libbeat/common/jsontransform"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/checks"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor"
+)
+
+const processorName = "decode_xml_fields"
+
+type decodeXMLFields struct {
+	config  xmlConfig
+	decoder xml.Decoder
+	log     *logp.Logger
+}
+
+type xmlConfig struct {
+	Fields          []string `config:"fields"`
+	Target          *string  `config:"target"`
+	OverwriteKeys   bool     `config:"overwrite_keys"`
+	AddErrorKey     bool     `config:"add_error_key"`
+	DocumentID      string   `config:"document_id"`
+	IgnoreMissing   bool     `config:"ignore_missing"`
+	ToLower         bool     `config:"to_lower"`
+	AttributePrefix string   `config:"attribute_prefix"`
+	ArrayElements   []string `config:"array_elements"`
+}
+
+var defaultXMLConfig = xmlConfig{
+	ToLower: true,
+}
+
+func init() {
+	processors.RegisterPlugin(processorName,
+		checks.ConfigChecked(NewDecodeXMLFields,
+			checks.RequireFields("fields"),
+			checks.AllowedFields("fields", "target", "overwrite_keys", "add_error_key", "document_id",
+				"ignore_missing", "to_lower", "attribute_prefix", "array_elements", "when")))
+
+	jsprocessor.RegisterPlugin("DecodeXMLFields", NewDecodeXMLFields)
+}
+
+// NewDecodeXMLFields construct a new decode_xml_fields processor.
+func NewDecodeXMLFields(c *common.Config) (processors.Processor, error) {
+	config := defaultXMLConfig
+
+	err := c.Unpack(&config)
+	if err != nil {
+		return nil, fmt.Errorf("fail to unpack the %s configuration: %s", processorName, err)
+	}
+	if len(config.Fields) == 0 {
+		return nil, errors.New("no fields to decode configured")
+	}
+
+	return &decodeXMLFields{
+		config: config,
+		decoder: xml.Decoder{
+			LowercaseKeys:   config.ToLower,
+			AttributePrefix: config.AttributePrefix,
+			ArrayElements:   config.ArrayElements,
+		},
+		log: logp.NewLogger(processorName),
+	}, nil
+}
+
+// Run applies the decode_xml_fields processor to an event.
+func (x *decodeXMLFields) Run(event *beat.Event) (*beat.Event, error) {
+	var errs []string
+
+	for _, field := range x.config.Fields {
+		if err := x.decodeField(field, event); err != nil {
+			x.log.Debugf("Failed to decode XML in field %s: %v", field, err)
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		msg := strings.Join(errs, ", ")
+		event.SetErrorWithOption(common.MapStr{"message": msg, "type": "xml"}, x.config.AddErrorKey)
+		return event, errors.New(msg)
+	}
+	return event, nil
+}
+
+func (x *decodeXMLFields) decodeField(field string, event *beat.Event) error {
+	data, err := event.GetValue(field)
+	if err != nil {
+		if x.config.IgnoreMissing && errors.Cause(err) == common.ErrKeyNotFound {
+			return nil
+		}
+		return errors.Wrapf(err, "could not fetch value for field %s", field)
+	}
+
+	text, ok := data.(string)
+	if !ok {
+		return errors.Errorf("field %s is not of string type", field)
+	}
+
+	output, err := x.decoder.DecodeString(text)
+	if err != nil {
+		return errors.Wrapf(err, "error decoding XML field %s", field)
+	}
+
+	var id string
+	if key := x.config.DocumentID; key != "" {
+		if tmp, err := output.GetValue(key); err == nil {
+			if v, ok := tmp.(string); ok {
+				id = v
+				output.Delete(key)
+			}
+		}
+	}
+
+	target := field
+	if x.config.Target != nil {
+		target = *x.config.Target
+	}
+
+	if target != "" {
+		if _, err := event.PutValue(target, output); err != nil {
+			return errors.Wrapf(err, "failed setting field %s", target)
+		}
+	} else {
+		jsontransform.WriteJSONKeys(event, output, x.config.OverwriteKeys, x.config.AddErrorKey)
+	}
+
+	if id != "" {
+		if event.Meta == nil {
+			event.Meta = common.MapStr{}
+		}
+		event.Meta[events.FieldMetaID] = id
+	}
+	return nil
+}
+
+// String returns a string representation of this processor.
+func (x *decodeXMLFields) String() string {
+	json, _ := json.Marshal(x.config)
+	return processorName + "=" + string(json)
+}
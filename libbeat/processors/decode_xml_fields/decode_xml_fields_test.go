@@ -0,0 +1,154 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package decode_xml_fields
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+func TestDecodeXMLFields(t *testing.T) {
+	tests := map[string]struct {
+		config   common.MapStr
+		input    common.MapStr
+		expected common.MapStr
+		meta     common.MapStr
+		fail     bool
+	}{
+		"in place": {
+			config: common.MapStr{
+				"fields": []string{"message"},
+			},
+			input: common.MapStr{
+				"message": `<Event><System><EventID>4624</EventID></System></Event>`,
+			},
+			expected: common.MapStr{
+				"message": common.MapStr{
+					"event": common.MapStr{"system": common.MapStr{"eventid": "4624"}},
+				},
+			},
+		},
+		"target with attribute prefix": {
+			config: common.MapStr{
+				"fields":           []string{"message"},
+				"target":           "xml",
+				"to_lower":         false,
+				"attribute_prefix": "_",
+			},
+			input: common.MapStr{
+				"message": `<Data Name="User">admin</Data>`,
+			},
+			expected: common.MapStr{
+				"message": `<Data Name="User">admin</Data>`,
+				"xml": common.MapStr{
+					"Data": common.MapStr{"_Name": "User", "#text": "admin"},
+				},
+			},
+		},
+		"root target": {
+			config: common.MapStr{
+				"fields":         []string{"message"},
+				"target":         "",
+				"overwrite_keys": true,
+			},
+			input: common.MapStr{
+				"message": `<order><item>a</item><item>b</item></order>`,
+			},
+			expected: common.MapStr{
+				"message": `<order><item>a</item><item>b</item></order>`,
+				"order":   common.MapStr{"item": []interface{}{"a", "b"}},
+			},
+		},
+		"document id": {
+			config: common.MapStr{
+				"fields":      []string{"message"},
+				"target":      "xml",
+				"document_id": "doc.id",
+			},
+			input: common.MapStr{
+				"message": `<doc><id>42</id><value>v</value></doc>`,
+			},
+			expected: common.MapStr{
+				"message": `<doc><id>42</id><value>v</value></doc>`,
+				"xml":     common.MapStr{"doc": common.MapStr{"value": "v"}},
+			},
+			meta: common.MapStr{"_id": "42"},
+		},
+		"invalid xml with error key": {
+			config: common.MapStr{
+				"fields":        []string{"message"},
+				"add_error_key": true,
+			},
+			input: common.MapStr{
+				"message": `<a><b></a>`,
+			},
+			expected: common.MapStr{
+				"message": `<a><b></a>`,
+				"error": common.MapStr{
+					"message": "error decoding XML field message: XML syntax error on line 1: element <b> closed by </a>",
+					"type":    "xml",
+				},
+			},
+			fail: true,
+		},
+		"missing field": {
+			config: common.MapStr{
+				"fields": []string{"message"},
+			},
+			input:    common.MapStr{"other": "value"},
+			expected: common.MapStr{"other": "value"},
+			fail:     true,
+		},
+		"ignore missing": {
+			config: common.MapStr{
+				"fields":         []string{"message"},
+				"ignore_missing": true,
+			},
+			input:    common.MapStr{"other": "value"},
+			expected: common.MapStr{"other": "value"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := NewDecodeXMLFields(common.MustNewConfigFrom(test.config))
+			require.NoError(t, err)
+
+			event, err := p.Run(&beat.Event{Fields: test.input})
+			if test.fail {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.expected, event.Fields)
+			if test.meta != nil {
+				assert.Equal(t, test.meta, event.Meta)
+			}
+		})
+	}
+}
+
+func TestDecodeXMLFieldsConfig(t *testing.T) {
+	_, err := NewDecodeXMLFields(common.MustNewConfigFrom(common.MapStr{"fields": []string{}}))
+	assert.Error(t, err)
+}
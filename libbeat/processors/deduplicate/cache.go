@@ -0,0 +1,103 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deduplicate
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type seenEntry struct {
+	key     string
+	expires time.Time
+}
+
+// seenCache is a bounded set of recently seen keys. When full, the least
+// recently seen key is evicted.
+type seenCache struct {
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	lru        *list.List // front is the most recently seen key
+	maxEntries int
+}
+
+func newSeenCache(maxEntries int) *seenCache {
+	return &seenCache{
+		entries:    map[string]*list.Element{},
+		lru:        list.New(),
+		maxEntries: maxEntries,
+	}
+}
+
+// seen reports whether key has been seen before and did not expire yet.
+// Otherwise the key is recorded as seen until expires. The keys removed
+// from the cache to make room for the new key are returned.
+func (c *seenCache) seen(now time.Time, key string, expires time.Time) (found bool, removed []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, exists := c.entries[key]; exists {
+		entry := elem.Value.(*seenEntry)
+		if now.Before(entry.expires) {
+			c.lru.MoveToFront(elem)
+			return true, nil
+		}
+		entry.expires = expires
+		c.lru.MoveToFront(elem)
+		return false, nil
+	}
+
+	c.entries[key] = c.lru.PushFront(&seenEntry{key: key, expires: expires})
+	return false, c.evict(now)
+}
+
+// add records a key without checking it. Keys added last are the most recent.
+func (c *seenCache) add(key string, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, exists := c.entries[key]; exists {
+		elem.Value.(*seenEntry).expires = expires
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&seenEntry{key: key, expires: expires})
+}
+
+// evict removes the least recently seen keys while the cache is over
+// capacity or they are expired.
+func (c *seenCache) evict(now time.Time) []string {
+	var removed []string
+	for elem := c.lru.Back(); elem != nil; elem = c.lru.Back() {
+		entry := elem.Value.(*seenEntry)
+		if c.lru.Len() <= c.maxEntries && now.Before(entry.expires) {
+			break
+		}
+		c.lru.Remove(elem)
+		delete(c.entries, entry.key)
+		removed = append(removed, entry.key)
+	}
+	return removed
+}
+
+func (c *seenCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
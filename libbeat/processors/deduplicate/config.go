@@ -0,0 +1,64 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deduplicate
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type config struct {
+	Fields        []string      `config:"fields" validate:"required"`
+	Method        string        `config:"method"`
+	IgnoreMissing bool          `config:"ignore_missing"`
+	TargetField   string        `config:"target_field"`
+	TTL           time.Duration `config:"ttl" validate:"positive,nonzero"`
+	MaxEntries    int           `config:"max_entries" validate:"min=1"`
+	Persist       persistConfig `config:"persist"`
+}
+
+type persistConfig struct {
+	Enabled       bool          `config:"enabled"`
+	ID            string        `config:"id"`
+	Path          string        `config:"path"`
+	FlushInterval time.Duration `config:"flush_interval" validate:"min=0"`
+}
+
+func defaultConfig() config {
+	return config{
+		Method:     "xxhash",
+		TTL:        24 * time.Hour,
+		MaxEntries: 100000,
+		Persist: persistConfig{
+			Path:          "deduplicate",
+			FlushInterval: time.Second,
+		},
+	}
+}
+
+// Validate checks that persisted caches are identified.
+func (c *config) Validate() error {
+	if c.Persist.Enabled && c.Persist.ID == "" {
+		return errors.New("persist.id is required when persist is enabled")
+	}
+	if c.Persist.Enabled && c.Persist.Path == "" {
+		return errors.New("persist.path must not be empty")
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deduplicate
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/fingerprint"
+)
+
+const (
+	processorName = "deduplicate"
+	logName       = "processor." + processorName
+
+	// keyField is where the fingerprint processor writes the key. It is only
+	// set in a copy of the event metadata.
+	keyField = "@metadata.deduplicate_key"
+)
+
+// timeNow is the clock of new processors, it is replaced in tests.
+var timeNow = time.Now
+
+// instanceID is used to assign each instance a unique monitoring namespace.
+var instanceID = atomic.MakeUint32(0)
+
+func init() {
+	processors.RegisterPlugin(processorName, New)
+}
+
+type deduplicate struct {
+	config      config
+	fingerprint processors.Processor
+	cache       *seenCache
+	store       *storeWriter // nil when persistence is disabled
+	log         *logp.Logger
+	clock       func() time.Time
+
+	dropped *monitoring.Int
+	evicted *monitoring.Int
+}
+
+// New constructs a new deduplicate processor.
+func New(cfg *common.Config) (processors.Processor, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, errors.Wrapf(err, "fail to unpack the %v configuration", processorName)
+	}
+
+	fpConfig, err := common.NewConfigFrom(common.MapStr{
+		"fields":         config.Fields,
+		"method":         config.Method,
+		"ignore_missing": config.IgnoreMissing,
+		"target_field":   keyField,
+	})
+	if err != nil {
+		return nil, err
+	}
+	fp, err := fingerprint.New(fpConfig)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid %v key configuration", processorName)
+	}
+
+	// Logging and metrics (each processor instance has a unique ID).
+	var (
+		id      = int(instanceID.Inc())
+		log     = logp.NewLogger(logName).With("instance_id", id)
+		metrics = monitoring.Default.NewRegistry(logName+"."+strconv.Itoa(id), monitoring.DoNotReport)
+	)
+
+	p := &deduplicate{
+		config:      config,
+		fingerprint: fp,
+		cache:       newSeenCache(config.MaxEntries),
+		log:         log,
+		clock:       timeNow,
+		dropped:     monitoring.NewInt(metrics, "dropped"),
+		evicted:     monitoring.NewInt(metrics, "evicted"),
+	}
+
+	if config.Persist.Enabled {
+		store, err := openStore(config.Persist)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to open the %v store", processorName)
+		}
+		if err := loadStore(store, p.cache, p.clock()); err != nil {
+			return nil, errors.Wrapf(err, "failed to load the %v store", processorName)
+		}
+		p.store = newStoreWriter(store, config.Persist.FlushInterval, log)
+		log.Debugf("Loaded %d keys from the store", p.cache.len())
+	}
+	return p, nil
+}
+
+// Run drops the event if its key has been seen within the TTL.
+func (p *deduplicate) Run(event *beat.Event) (*beat.Event, error) {
+	if p.config.IgnoreMissing && !p.hasAnyField(event) {
+		return event, nil
+	}
+
+	key, err := p.key(event)
+	if err != nil {
+		return event, err
+	}
+
+	now := p.clock()
+	expires := now.Add(p.config.TTL)
+	found, removed := p.cache.seen(now, key, expires)
+	p.evicted.Add(int64(len(removed)))
+	if found {
+		p.dropped.Inc()
+		return nil, nil
+	}
+	if p.store != nil {
+		p.store.update(key, expires, removed)
+	}
+
+	if p.config.TargetField != "" {
+		if _, err := event.PutValue(p.config.TargetField, key); err != nil {
+			return event, errors.Wrapf(err, "failed to set %v", p.config.TargetField)
+		}
+	}
+	return event, nil
+}
+
+// key computes the fingerprint of the event without modifying it.
+func (p *deduplicate) key(event *beat.Event) (string, error) {
+	tmp := &beat.Event{Fields: event.Fields}
+	if _, err := p.fingerprint.Run(tmp); err != nil {
+		return "", err
+	}
+	key, err := tmp.GetValue(keyField)
+	if err != nil {
+		return "", err
+	}
+	return key.(string), nil
+}
+
+// hasAnyField reports whether the event contains any of the key fields. Events
+// without key fields would otherwise all share the same key.
+func (p *deduplicate) hasAnyField(event *beat.Event) bool {
+	for _, field := range p.config.Fields {
+		if _, err := event.GetValue(field); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *deduplicate) String() string {
+	return fmt.Sprintf("%v=[fields=%v, ttl=%v, max_entries=%v, persist=%v]",
+		processorName, p.config.Fields, p.config.TTL, p.config.MaxEntries, p.config.Persist.Enabled)
+}
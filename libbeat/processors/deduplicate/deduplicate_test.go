@@ -0,0 +1,265 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deduplicate
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/statestore"
+)
+
+var testStart = time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+func TestNew(t *testing.T) {
+	cases := map[string]struct {
+		config common.MapStr
+		err    bool
+	}{
+		"fields": {
+			config: common.MapStr{"fields": []string{"event.id"}},
+		},
+		"missing fields": {
+			config: common.MapStr{},
+			err:    true,
+		},
+		"invalid method": {
+			config: common.MapStr{"fields": []string{"event.id"}, "method": "crc32"},
+			err:    true,
+		},
+		"invalid ttl": {
+			config: common.MapStr{"fields": []string{"event.id"}, "ttl": "0s"},
+			err:    true,
+		},
+		"invalid max_entries": {
+			config: common.MapStr{"fields": []string{"event.id"}, "max_entries": 0},
+			err:    true,
+		},
+		"persist without id": {
+			config: common.MapStr{"fields": []string{"event.id"}, "persist.enabled": true},
+			err:    true,
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(common.MustNewConfigFrom(test.config))
+			if test.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestDeduplicate(t *testing.T) {
+	p, now := newTestDeduplicate(t, common.MapStr{
+		"fields": []string{"event.id", "event.provider"},
+		"ttl":    "1h",
+	})
+
+	assert.True(t, runEvent(t, p, "1", "a"))
+	assert.True(t, runEvent(t, p, "2", "a"))
+	assert.True(t, runEvent(t, p, "1", "b"))
+	assert.False(t, runEvent(t, p, "1", "a"))
+	assert.False(t, runEvent(t, p, "2", "a"))
+
+	// Duplicates do not extend the TTL.
+	*now = testStart.Add(time.Hour)
+	assert.True(t, runEvent(t, p, "1", "a"))
+	assert.False(t, runEvent(t, p, "1", "a"))
+
+	assert.Equal(t, int64(3), p.dropped.Get())
+}
+
+func TestDeduplicateMaxEntries(t *testing.T) {
+	p, _ := newTestDeduplicate(t, common.MapStr{
+		"fields":      []string{"event.id"},
+		"max_entries": 2,
+	})
+
+	assert.True(t, runEvent(t, p, "1", ""))
+	assert.True(t, runEvent(t, p, "2", ""))
+	assert.False(t, runEvent(t, p, "1", ""))
+
+	// 2 is the least recently seen key, and is evicted.
+	assert.True(t, runEvent(t, p, "3", ""))
+	assert.False(t, runEvent(t, p, "1", ""))
+	assert.True(t, runEvent(t, p, "2", ""))
+	assert.Equal(t, int64(2), p.evicted.Get())
+}
+
+func TestDeduplicateTargetField(t *testing.T) {
+	p, _ := newTestDeduplicate(t, common.MapStr{
+		"fields":       []string{"event.id"},
+		"method":       "sha1",
+		"target_field": "@metadata._id",
+	})
+
+	event := &beat.Event{Fields: common.MapStr{"event": common.MapStr{"id": "1"}}}
+	out, err := p.Run(event)
+	require.NoError(t, err)
+	require.NotNil(t, out)
+	assert.Equal(t, common.MapStr{"_id": "087de0ce80ba1452ea7e88c0d01d0ac589c5d7a2"}, out.Meta)
+	assert.Equal(t, common.MapStr{"event": common.MapStr{"id": "1"}}, out.Fields)
+}
+
+func TestDeduplicateMissingFields(t *testing.T) {
+	p, _ := newTestDeduplicate(t, common.MapStr{"fields": []string{"event.id"}})
+	event := &beat.Event{Fields: common.MapStr{"message": "hello"}}
+	out, err := p.Run(event)
+	assert.Error(t, err)
+	assert.Equal(t, event, out)
+
+	p, _ = newTestDeduplicate(t, common.MapStr{"fields": []string{"event.id"}, "ignore_missing": true})
+	for i := 0; i < 2; i++ {
+		out, err := p.Run(&beat.Event{Fields: common.MapStr{"message": "hello"}})
+		assert.NoError(t, err)
+		assert.NotNil(t, out, "events without key fields are never duplicates")
+	}
+}
+
+func TestDeduplicatePersist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deduplicate")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := common.MapStr{
+		"fields":      []string{"event.id"},
+		"ttl":         "1h",
+		"max_entries": 2,
+		"persist":     common.MapStr{"enabled": true, "id": "test", "path": dir, "flush_interval": 0},
+	}
+
+	p, now := newTestDeduplicate(t, config)
+	assert.True(t, runEvent(t, p, "1", ""))
+	*now = testStart.Add(30 * time.Minute)
+	assert.True(t, runEvent(t, p, "2", ""))
+	assert.True(t, runEvent(t, p, "3", ""))
+
+	// A new instance loads the keys still in the cache.
+	p, _ = newTestDeduplicate(t, config)
+	assert.Equal(t, 2, p.cache.len())
+	p.clock = func() time.Time { return testStart.Add(45 * time.Minute) }
+	assert.False(t, runEvent(t, p, "2", ""))
+	assert.False(t, runEvent(t, p, "3", ""))
+	assert.True(t, runEvent(t, p, "1", ""))
+
+	// Expired keys are not loaded.
+	p, err = newDeduplicateAt(config, testStart.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 0, p.cache.len())
+}
+
+func TestDeduplicatePersistBatches(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deduplicate")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := common.MapStr{
+		"fields":  []string{"event.id"},
+		"persist": common.MapStr{"enabled": true, "id": "test", "path": dir, "flush_interval": "1m"},
+	}
+
+	p, _ := newTestDeduplicate(t, config)
+	assert.True(t, runEvent(t, p, "1", ""))
+	assert.True(t, runEvent(t, p, "2", ""))
+
+	// Processors recreated on reload share the open store.
+	store, err := openStore(persistConfig{ID: "test", Path: dir})
+	require.NoError(t, err)
+	assert.Same(t, store, p.store.store)
+	assert.Equal(t, 0, countKeys(t, p))
+
+	// Too many pending changes are written before the flush interval elapsed.
+	for i := 0; i < maxPendingWrites; i++ {
+		assert.True(t, runEvent(t, p, fmt.Sprintf("batch-%d", i), ""))
+	}
+	assert.Equal(t, maxPendingWrites, countKeys(t, p))
+}
+
+func TestDeduplicatePersistFlushInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deduplicate")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := common.MapStr{
+		"fields":  []string{"event.id"},
+		"persist": common.MapStr{"enabled": true, "id": "test", "path": dir, "flush_interval": "10ms"},
+	}
+
+	p, _ := newTestDeduplicate(t, config)
+	assert.True(t, runEvent(t, p, "1", ""))
+
+	// The key is written once the flush interval elapsed, without further events.
+	require.Eventually(t, func() bool {
+		return countKeys(t, p) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func countKeys(t *testing.T, p *deduplicate) int {
+	t.Helper()
+	n := 0
+	err := p.store.store.Each(func(string, statestore.ValueDecoder) (bool, error) {
+		n++
+		return true, nil
+	})
+	require.NoError(t, err)
+	return n
+}
+
+func runEvent(t *testing.T, p *deduplicate, id, provider string) bool {
+	t.Helper()
+	fields := common.MapStr{"event": common.MapStr{"id": id}}
+	if provider != "" {
+		fields.Put("event.provider", provider)
+	}
+	out, err := p.Run(&beat.Event{Fields: fields})
+	require.NoError(t, err)
+	return out != nil
+}
+
+func newTestDeduplicate(t *testing.T, config common.MapStr) (*deduplicate, *time.Time) {
+	now := testStart
+	p, err := newDeduplicateAt(config, now)
+	require.NoError(t, err)
+	p.clock = func() time.Time { return now }
+	return p, &now
+}
+
+// newDeduplicateAt creates a processor, loading the persisted keys at now.
+func newDeduplicateAt(config common.MapStr, now time.Time) (*deduplicate, error) {
+	clock := timeNow
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = clock }()
+
+	p, err := New(common.MustNewConfigFrom(config))
+	if err != nil {
+		return nil, err
+	}
+	return p.(*deduplicate), nil
+}
@@ -0,0 +1,197 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deduplicate
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/paths"
+	"github.com/elastic/beats/v7/libbeat/statestore"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend/memlog"
+)
+
+// storedEntry is the value persisted for each seen key.
+type storedEntry struct {
+	Expires time.Time `struct:"expires"`
+}
+
+// maxPendingWrites is the number of pending changes that triggers a write to
+// the store before the flush interval elapsed.
+const maxPendingWrites = 1024
+
+var (
+	registriesMu sync.Mutex
+	// registries holds one registry per persist.path. Registries and their
+	// stores are shared by all processors, so processors recreated on config
+	// reload use the same files.
+	registries = map[string]*statestore.Registry{}
+	// stores holds the open stores by path and ID. Processors can not be
+	// closed, so a store is opened once and reused by the processors created
+	// on config reload, instead of leaking a reference on every reload.
+	stores = map[storeID]*statestore.Store{}
+)
+
+type storeID struct {
+	root, id string
+}
+
+// openStore opens the store with the seen keys of a processor.
+func openStore(cfg persistConfig) (*statestore.Store, error) {
+	root := paths.Resolve(paths.Data, cfg.Path)
+
+	registriesMu.Lock()
+	defer registriesMu.Unlock()
+
+	if store := stores[storeID{root, cfg.ID}]; store != nil {
+		return store, nil
+	}
+
+	registry := registries[root]
+	if registry == nil {
+		backend, err := memlog.New(logp.NewLogger(logName), memlog.Settings{Root: root})
+		if err != nil {
+			return nil, err
+		}
+		registry = statestore.NewRegistry(backend)
+		registries[root] = registry
+	}
+	store, err := registry.Get(cfg.ID)
+	if err != nil {
+		return nil, err
+	}
+	stores[storeID{root, cfg.ID}] = store
+	return store, nil
+}
+
+// storeWriter collects the changes to the seen keys, and writes them to the
+// store in batches instead of on every event.
+type storeWriter struct {
+	store    *statestore.Store
+	interval time.Duration
+	log      *logp.Logger
+
+	mu     sync.Mutex
+	set    map[string]time.Time
+	remove map[string]struct{}
+	// timer flushes the pending changes once the flush interval elapsed. It
+	// is only armed while changes are pending, so no go-routine is left
+	// behind when the processor is replaced on config reload.
+	timer *time.Timer
+}
+
+func newStoreWriter(store *statestore.Store, interval time.Duration, log *logp.Logger) *storeWriter {
+	return &storeWriter{
+		store:    store,
+		interval: interval,
+		log:      log,
+		set:      map[string]time.Time{},
+		remove:   map[string]struct{}{},
+	}
+}
+
+// update records a new key and the keys removed from the cache. The pending
+// changes are written in the background once the flush interval elapsed, or
+// right away when too many changes are pending. Failures are logged, the
+// cache keeps working in memory.
+func (w *storeWriter) update(key string, expires time.Time, removed []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.set[key] = expires
+	delete(w.remove, key)
+	for _, k := range removed {
+		delete(w.set, k)
+		w.remove[k] = struct{}{}
+	}
+
+	if w.interval <= 0 || len(w.set)+len(w.remove) >= maxPendingWrites {
+		w.flush()
+		return
+	}
+	if w.timer == nil {
+		w.timer = time.AfterFunc(w.interval, w.flushPending)
+	}
+}
+
+// flushPending writes the changes collected since the timer was armed.
+func (w *storeWriter) flushPending() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.timer = nil
+	w.flush()
+}
+
+func (w *storeWriter) flush() {
+	for k := range w.remove {
+		if err := w.store.Remove(k); err != nil {
+			w.log.Errorf("Failed to remove key from the store: %v", err)
+		}
+	}
+	for k, expires := range w.set {
+		if err := w.store.Set(k, storedEntry{Expires: expires}); err != nil {
+			w.log.Errorf("Failed to persist key: %v", err)
+		}
+	}
+	w.set = map[string]time.Time{}
+	w.remove = map[string]struct{}{}
+}
+
+// loadStore adds the keys persisted in store to the cache. Expired keys,
+// and the keys that do not fit in the cache, are removed from the store.
+func loadStore(store *statestore.Store, cache *seenCache, now time.Time) error {
+	var entries []seenEntry
+	var remove []string
+	err := store.Each(func(key string, dec statestore.ValueDecoder) (bool, error) {
+		var st storedEntry
+		if err := dec.Decode(&st); err != nil || !now.Before(st.Expires) {
+			remove = append(remove, key)
+			return true, nil
+		}
+		entries = append(entries, seenEntry{key: key, expires: st.Expires})
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Keep the keys that expire last, adding the oldest first so they are
+	// the first ones to be evicted.
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].expires.After(entries[j].expires)
+	})
+	if len(entries) > cache.maxEntries {
+		for _, e := range entries[cache.maxEntries:] {
+			remove = append(remove, e.key)
+		}
+		entries = entries[:cache.maxEntries]
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		cache.add(entries[i].key, entries[i].expires)
+	}
+
+	for _, key := range remove {
+		if err := store.Remove(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package processors
+
+import (
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+// EmitFunc publishes an event created by a processor.
+type EmitFunc func(beat.Event)
+
+// Emitter is implemented by processors creating events asynchronously, for
+// example at the end of a time window, independent of the events passed to
+// Run.
+//
+// The publisher pipeline registers an EmitFunc for each client running the
+// processor. Events passed to the EmitFunc are processed by the processors
+// following the emitter and are published by the client. The EmitFunc must
+// not be called from within Run, and it must not be called anymore once the
+// returned unregister function returns. Unregister is called when the
+// client is closed, before it stops accepting events, so pending events can
+// still be emitted.
+type Emitter interface {
+	Processor
+	RegisterEmitFunc(emit EmitFunc) (unregister func())
+}
+
+// processorList is implemented by processors containing a list of
+// processors, like Processors.
+type processorList interface {
+	All() []beat.Processor
+}
+
+// RegisterEmitters registers an EmitFunc with every Emitter found in the
+// list of processors, including nested lists. Events emitted by a processor
+// are run through the processors following it, then through the processors
+// following the enclosing lists, and are passed to publish. The returned
+// function unregisters all EmitFuncs.
+func RegisterEmitters(list []beat.Processor, publish EmitFunc) (unregister func()) {
+	log := logp.NewLogger(logName)
+
+	var unregisters []func()
+	var walk func(list []beat.Processor, next EmitFunc)
+	walk = func(list []beat.Processor, next EmitFunc) {
+		for i, p := range list {
+			rest := continuation(log, list[i+1:], next)
+			switch p := p.(type) {
+			case Emitter:
+				unregisters = append(unregisters, p.RegisterEmitFunc(rest))
+			case processorList:
+				walk(p.All(), rest)
+			}
+		}
+	}
+	walk(list, publish)
+
+	return func() {
+		for _, unregister := range unregisters {
+			unregister()
+		}
+	}
+}
+
+// continuation returns an EmitFunc running the processors before passing
+// the event to next. Like the processors of a publisher pipeline client,
+// processing continues if a processor fails, as long as it returns an event.
+func continuation(log *logp.Logger, list []beat.Processor, next EmitFunc) EmitFunc {
+	if len(list) == 0 {
+		return next
+	}
+
+	return func(e beat.Event) {
+		event := &e
+		for _, p := range list {
+			var err error
+			event, err = p.Run(event)
+			if err != nil {
+				log.Debugf("Fail to apply processor %s to emitted event: %s", p, err)
+			}
+			if event == nil {
+				return
+			}
+		}
+		next(*event)
+	}
+}
@@ -0,0 +1,90 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package processors_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/actions"
+)
+
+type testEmitter struct {
+	emit []processors.EmitFunc
+}
+
+func (e *testEmitter) Run(event *beat.Event) (*beat.Event, error) { return event, nil }
+func (e *testEmitter) String() string                             { return "test_emitter" }
+
+func (e *testEmitter) RegisterEmitFunc(emit processors.EmitFunc) func() {
+	e.emit = append(e.emit, emit)
+	return func() { e.emit = nil }
+}
+
+type dropAll struct{}
+
+func (dropAll) Run(*beat.Event) (*beat.Event, error) { return nil, nil }
+func (dropAll) String() string                       { return "drop_all" }
+
+func TestRegisterEmitters(t *testing.T) {
+	emitter := &testEmitter{}
+
+	inner := processors.NewList(nil)
+	inner.AddProcessor(actions.NewAddFields(common.MapStr{"before": true}, true, true))
+	inner.AddProcessor(emitter)
+	inner.AddProcessor(actions.NewAddFields(common.MapStr{"inner": true}, true, true))
+
+	outer := processors.NewList(nil)
+	outer.AddProcessor(inner)
+	outer.AddProcessor(actions.NewAddFields(common.MapStr{"outer": true}, true, true))
+
+	var published []common.MapStr
+	unregister := processors.RegisterEmitters(outer.All(), func(e beat.Event) {
+		published = append(published, e.Fields)
+	})
+
+	if assert.Len(t, emitter.emit, 1) {
+		emitter.emit[0](beat.Event{Fields: common.MapStr{"emitted": true}})
+	}
+	assert.Equal(t, []common.MapStr{{
+		"emitted": true,
+		"inner":   true,
+		"outer":   true,
+	}}, published)
+
+	unregister()
+	assert.Nil(t, emitter.emit)
+}
+
+func TestRegisterEmittersDropped(t *testing.T) {
+	emitter := &testEmitter{}
+
+	list := processors.NewList(nil)
+	list.AddProcessor(emitter)
+	list.AddProcessor(dropAll{})
+
+	published := 0
+	processors.RegisterEmitters(list.All(), func(beat.Event) { published++ })
+
+	emitter.emit[0](beat.Event{Fields: common.MapStr{"emitted": true}})
+	assert.Equal(t, 0, published)
+}
@@ -0,0 +1,102 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package geoip
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+)
+
+type cacheRecord struct {
+	result  *result
+	expires time.Time
+}
+
+func (r cacheRecord) IsExpired(now time.Time) bool {
+	return now.After(r.expires)
+}
+
+// lookupCache caches the results of lookups, including the addresses not
+// found in the databases.
+type lookupCache struct {
+	sync.RWMutex
+	data            map[string]cacheRecord
+	initialCapacity int
+	maxSize         int
+	ttl             time.Duration
+
+	hits   *monitoring.Int
+	misses *monitoring.Int
+}
+
+func newLookupCache(reg *monitoring.Registry, conf CacheConfig) *lookupCache {
+	return &lookupCache{
+		data:            make(map[string]cacheRecord, conf.InitialCapacity),
+		initialCapacity: conf.InitialCapacity,
+		maxSize:         conf.MaxCapacity,
+		ttl:             conf.TTL,
+		hits:            monitoring.NewInt(reg, "hits"),
+		misses:          monitoring.NewInt(reg, "misses"),
+	}
+}
+
+func (c *lookupCache) set(now time.Time, key string, r *result) {
+	c.Lock()
+	defer c.Unlock()
+
+	if len(c.data) >= c.maxSize {
+		c.evict()
+	}
+
+	c.data[key] = cacheRecord{
+		result:  r,
+		expires: now.Add(c.ttl),
+	}
+}
+
+// evict removes a single random key from the cache.
+func (c *lookupCache) evict() {
+	var key string
+	for k := range c.data {
+		key = k
+		break
+	}
+	delete(c.data, key)
+}
+
+func (c *lookupCache) get(now time.Time, key string) (*result, bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	r, found := c.data[key]
+	if found && !r.IsExpired(now) {
+		c.hits.Inc()
+		return r.result, true
+	}
+	c.misses.Inc()
+	return nil, false
+}
+
+// clear removes all entries, it is called when a database is reloaded.
+func (c *lookupCache) clear() {
+	c.Lock()
+	defer c.Unlock()
+	c.data = make(map[string]cacheRecord, c.initialCapacity)
+}
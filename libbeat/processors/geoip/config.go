@@ -0,0 +1,81 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package geoip
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// Config defines the configuration options for the geoip processor.
+type Config struct {
+	Databases      []string      `config:"databases" validate:"required"` // Paths of the City, Country or ASN databases.
+	Fields         common.MapStr `config:"fields" validate:"required"`    // Mapping of source IP fields to target fields.
+	Language       string        `config:"language"`                      // Language of the names.
+	ReloadInterval time.Duration `config:"reload_interval"`               // How often to check the databases for changes.
+	TagOnFailure   []string      `config:"tag_on_failure"`                // Tags to append when a failure occurs.
+	Cache          CacheConfig   `config:"cache"`
+	fieldsFlat     map[string]string
+}
+
+// CacheConfig defines the caching behavior of lookup results.
+type CacheConfig struct {
+	// TTL value for items in cache.
+	TTL time.Duration `config:"ttl" validate:"min=1ns"`
+
+	// Initial capacity. How much space is allocated at initialization.
+	InitialCapacity int `config:"capacity.initial" validate:"min=0"`
+
+	// Max capacity of the cache. When capacity is reached a random item is
+	// evicted from the cache.
+	MaxCapacity int `config:"capacity.max" validate:"min=1"`
+}
+
+// Validate validates the data contained in the config.
+func (c *Config) Validate() error {
+	// Flatten the mapping of source fields to target fields.
+	c.fieldsFlat = map[string]string{}
+	for k, v := range c.Fields.Flatten() {
+		target, ok := v.(string)
+		if !ok || target == "" {
+			return errors.Errorf("target field for geoip lookup of %v "+
+				"must be a non-empty string but got %v", k, v)
+		}
+		c.fieldsFlat[k] = target
+	}
+
+	if c.Cache.MaxCapacity < c.Cache.InitialCapacity {
+		return errors.Errorf("cache.capacity.max must be >= cache.capacity.initial")
+	}
+	return nil
+}
+
+func defaultConfig() Config {
+	return Config{
+		Language:       "en",
+		ReloadInterval: time.Minute,
+		Cache: CacheConfig{
+			TTL:             10 * time.Minute,
+			InitialCapacity: 1000,
+			MaxCapacity:     10000,
+		},
+	}
+}
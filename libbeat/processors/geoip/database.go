@@ -0,0 +1,157 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package geoip
+
+import (
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// database is a MaxMind DB file that is reloaded when it changes on disk.
+// Lookups use the current reader, which is swapped atomically on reload.
+// reload must not be called concurrently.
+type database struct {
+	path string
+
+	reader  atomic.Value // *reader
+	modTime time.Time
+	size    int64
+}
+
+func openDatabase(path string) (*database, error) {
+	db := &database{path: path}
+	if _, err := db.reload(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// reload loads the file again if its modification time or size changed. It
+// returns true if the file has been reloaded. The current reader is kept if
+// the new file can not be loaded.
+func (db *database) reload() (bool, error) {
+	info, err := os.Stat(db.path)
+	if err != nil {
+		return false, err
+	}
+
+	if db.current() != nil && info.ModTime().Equal(db.modTime) && info.Size() == db.size {
+		return false, nil
+	}
+
+	r, err := openReader(db.path)
+	if err != nil {
+		return false, err
+	}
+
+	db.reader.Store(r)
+	db.modTime = info.ModTime()
+	db.size = info.Size()
+	return true, nil
+}
+
+// current returns the reader of the last loaded version of the file.
+func (db *database) current() *reader {
+	r, _ := db.reader.Load().(*reader)
+	return r
+}
+
+func (db *database) lookup(ip net.IP) (map[string]interface{}, error) {
+	return db.current().lookup(ip)
+}
+
+// result contains the ECS geo and as fields of an address.
+type result struct {
+	geo common.MapStr
+	as  common.MapStr
+}
+
+// addRecord copies the fields of a City, Country or ASN database record into
+// the result. Fields already present are kept, so the first database
+// containing a field wins.
+func (r *result) addRecord(record map[string]interface{}, language string) {
+	putNew := func(m common.MapStr, key string, value interface{}) {
+		if value == nil {
+			return
+		}
+		if has, _ := m.HasKey(key); !has {
+			m.Put(key, value)
+		}
+	}
+
+	putNew(r.geo, "continent_name", name(record, "continent", language))
+	putNew(r.geo, "country_iso_code", str(record, "country", "iso_code"))
+	putNew(r.geo, "country_name", name(record, "country", language))
+	putNew(r.geo, "city_name", name(record, "city", language))
+
+	if subdivisions, ok := record["subdivisions"].([]interface{}); ok && len(subdivisions) > 0 {
+		if subdivision, ok := subdivisions[0].(map[string]interface{}); ok {
+			if code, ok := subdivision["iso_code"].(string); ok {
+				if country, ok := str(record, "country", "iso_code").(string); ok {
+					code = country + "-" + code
+				}
+				putNew(r.geo, "region_iso_code", code)
+			}
+			putNew(r.geo, "region_name", name(subdivision, "", language))
+		}
+	}
+
+	if location, ok := record["location"].(map[string]interface{}); ok {
+		lat, latOK := location["latitude"].(float64)
+		lon, lonOK := location["longitude"].(float64)
+		if latOK && lonOK {
+			putNew(r.geo, "location", common.MapStr{"lat": lat, "lon": lon})
+		}
+	}
+
+	if number, ok := record["autonomous_system_number"].(uint64); ok {
+		putNew(r.as, "number", number)
+	}
+	if org, ok := record["autonomous_system_organization"].(string); ok {
+		putNew(r.as, "organization.name", org)
+	}
+}
+
+// str returns the string at path in record, or nil.
+func str(record map[string]interface{}, path ...string) interface{} {
+	var v interface{} = record
+	for _, key := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return nil
+}
+
+// name returns the localized name of an entity of the record. If key is
+// empty, record is the entity.
+func name(record map[string]interface{}, key, language string) interface{} {
+	if key == "" {
+		return str(record, "names", language)
+	}
+	return str(record, key, "names", language)
+}
@@ -0,0 +1,220 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor"
+)
+
+const logName = "processor.geoip"
+
+// instanceID is used to assign each instance a unique monitoring namespace.
+var instanceID = atomic.MakeUint32(0)
+
+func init() {
+	processors.RegisterPlugin("geoip", New)
+	jsprocessor.RegisterPlugin("GeoIP", New)
+}
+
+type processor struct {
+	Config
+	databases []*database
+	cache     *lookupCache
+	log       *logp.Logger
+	reloads   *monitoring.Int
+
+	// clock returns the current time, it is replaced in tests.
+	clock func() time.Time
+
+	reloadMu   sync.Mutex
+	lastReload time.Time
+	reloading  atomic.Bool
+	reloadWG   sync.WaitGroup // pending reloads, used by tests
+}
+
+// New constructs a new geoip processor.
+func New(cfg *common.Config) (processors.Processor, error) {
+	c := defaultConfig()
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, errors.Wrap(err, "fail to unpack the geoip configuration")
+	}
+
+	// Logging and metrics (each processor instance has a unique ID).
+	var (
+		id      = int(instanceID.Inc())
+		log     = logp.NewLogger(logName).With("instance_id", id)
+		metrics = monitoring.Default.NewRegistry(logName+"."+strconv.Itoa(id), monitoring.DoNotReport)
+	)
+
+	databases := make([]*database, 0, len(c.Databases))
+	for _, path := range c.Databases {
+		db, err := openDatabase(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to open geoip database %v", path)
+		}
+		log.Debugf("Loaded geoip database %v of type %v", path, db.current().databaseType)
+		databases = append(databases, db)
+	}
+
+	return &processor{
+		Config:     c,
+		databases:  databases,
+		cache:      newLookupCache(metrics.NewRegistry("cache"), c.Cache),
+		log:        log,
+		reloads:    monitoring.NewInt(metrics, "reloads"),
+		clock:      time.Now,
+		lastReload: time.Now(),
+	}, nil
+}
+
+func (p *processor) Run(event *beat.Event) (*beat.Event, error) {
+	now := p.clock()
+	p.reloadDatabases(now)
+
+	var tagOnce sync.Once
+	for field, target := range p.fieldsFlat {
+		if err := p.processField(now, field, target, event); err != nil {
+			p.log.Debugf("GeoIP processor failed: %v", err)
+			tagOnce.Do(func() { common.AddTags(event.Fields, p.TagOnFailure) })
+		}
+	}
+	return event, nil
+}
+
+func (p *processor) processField(now time.Time, source, target string, event *beat.Event) error {
+	v, err := event.GetValue(source)
+	if err != nil {
+		return nil
+	}
+
+	maybeIP, ok := v.(string)
+	if !ok {
+		return nil
+	}
+
+	r, err := p.lookup(now, maybeIP)
+	if err != nil {
+		return fmt.Errorf("geoip lookup of %v value '%v' failed: %v", source, maybeIP, err)
+	}
+
+	if len(r.geo) > 0 {
+		if _, err := event.PutValue(target+".geo", r.geo.Clone()); err != nil {
+			return err
+		}
+	}
+	if len(r.as) > 0 {
+		if _, err := event.PutValue(target+".as", r.as.Clone()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookup returns the merged result of all databases for the address.
+func (p *processor) lookup(now time.Time, addr string) (*result, error) {
+	if r, found := p.cache.get(now, addr); found {
+		return r, nil
+	}
+
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, errors.New("invalid IP address")
+	}
+
+	r := &result{geo: common.MapStr{}, as: common.MapStr{}}
+	for _, db := range p.databases {
+		record, err := db.lookup(ip)
+		if err != nil {
+			return nil, errors.Wrapf(err, "lookup in %v failed", db.path)
+		}
+		if record != nil {
+			r.addRecord(record, p.Language)
+		}
+	}
+
+	p.cache.set(now, addr, r)
+	return r, nil
+}
+
+// reloadDatabases checks the databases for changes at most once per reload
+// interval. The check runs in the background, events are enriched using the
+// current databases until the new versions have been loaded.
+func (p *processor) reloadDatabases(now time.Time) {
+	if p.ReloadInterval <= 0 {
+		return
+	}
+
+	p.reloadMu.Lock()
+	if now.Sub(p.lastReload) < p.ReloadInterval {
+		p.reloadMu.Unlock()
+		return
+	}
+	p.lastReload = now
+	p.reloadMu.Unlock()
+
+	if !p.reloading.CAS(false, true) {
+		return
+	}
+	p.reloadWG.Add(1)
+	go func() {
+		defer p.reloadWG.Done()
+		defer p.reloading.Store(false)
+		p.reload()
+	}()
+}
+
+// reload loads the databases that have changed on disk, and clears the cache
+// if any database has been reloaded.
+func (p *processor) reload() {
+	reloaded := false
+	for _, db := range p.databases {
+		changed, err := db.reload()
+		if err != nil {
+			p.log.Warnf("Failed to reload geoip database %v, keeping the previous version: %v", db.path, err)
+			continue
+		}
+		if changed {
+			p.log.Infof("Reloaded geoip database %v", db.path)
+			p.reloads.Inc()
+			reloaded = true
+		}
+	}
+	if reloaded {
+		p.cache.clear()
+	}
+}
+
+func (p *processor) String() string {
+	return fmt.Sprintf("geoip=[databases=[%v], language=%v, fields=[%+v]]",
+		strings.Join(p.Databases, ","), p.Language, p.fieldsFlat)
+}
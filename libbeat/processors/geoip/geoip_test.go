@@ -0,0 +1,221 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package geoip
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+var testCityRecord = map[string]interface{}{
+	"city":      map[string]interface{}{"names": map[string]interface{}{"en": "Amsterdam", "de": "Amsterdam"}},
+	"continent": map[string]interface{}{"code": "EU", "names": map[string]interface{}{"en": "Europe", "de": "Europa"}},
+	"country":   map[string]interface{}{"iso_code": "NL", "names": map[string]interface{}{"en": "Netherlands", "de": "Niederlande"}},
+	"location":  map[string]interface{}{"latitude": 52.374, "longitude": 4.8897},
+	"subdivisions": []interface{}{
+		map[string]interface{}{"iso_code": "NH", "names": map[string]interface{}{"en": "North Holland", "de": "Nordholland"}},
+	},
+}
+
+var testASNRecord = map[string]interface{}{
+	"autonomous_system_number":       uint32(1136),
+	"autonomous_system_organization": "KPN B.V.",
+}
+
+func TestGeoIP(t *testing.T) {
+	dir := writeTestDatabases(t)
+	defer os.RemoveAll(dir)
+
+	p, err := New(common.MustNewConfigFrom(common.MapStr{
+		"databases":      []string{filepath.Join(dir, "city.mmdb"), filepath.Join(dir, "asn.mmdb")},
+		"fields":         common.MapStr{"source.ip": "source", "destination.ip": "destination"},
+		"tag_on_failure": []string{"_geoip_lookup_failure"},
+	}))
+	require.NoError(t, err)
+
+	cases := map[string]struct {
+		fields   common.MapStr
+		expected common.MapStr
+	}{
+		"city and asn": {
+			fields: common.MapStr{"source": common.MapStr{"ip": "1.2.3.4"}},
+			expected: common.MapStr{"source": common.MapStr{
+				"ip": "1.2.3.4",
+				"geo": common.MapStr{
+					"city_name":        "Amsterdam",
+					"continent_name":   "Europe",
+					"country_iso_code": "NL",
+					"country_name":     "Netherlands",
+					"region_iso_code":  "NL-NH",
+					"region_name":      "North Holland",
+					"location":         common.MapStr{"lat": 52.374, "lon": 4.8897},
+				},
+				"as": common.MapStr{
+					"number":       uint64(1136),
+					"organization": common.MapStr{"name": "KPN B.V."},
+				},
+			}},
+		},
+		"asn only": {
+			fields: common.MapStr{"destination": common.MapStr{"ip": "2001:db8::1"}},
+			expected: common.MapStr{"destination": common.MapStr{
+				"ip": "2001:db8::1",
+				"as": common.MapStr{
+					"number":       uint64(1136),
+					"organization": common.MapStr{"name": "KPN B.V."},
+				},
+			}},
+		},
+		"not found": {
+			fields:   common.MapStr{"source": common.MapStr{"ip": "192.168.0.1"}},
+			expected: common.MapStr{"source": common.MapStr{"ip": "192.168.0.1"}},
+		},
+		"missing field": {
+			fields:   common.MapStr{"message": "hello"},
+			expected: common.MapStr{"message": "hello"},
+		},
+		"invalid address": {
+			fields: common.MapStr{"source": common.MapStr{"ip": "not an ip"}},
+			expected: common.MapStr{
+				"source": common.MapStr{"ip": "not an ip"},
+				"tags":   []string{"_geoip_lookup_failure"},
+			},
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			out, err := p.Run(&beat.Event{Fields: test.fields})
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, out.Fields)
+		})
+	}
+}
+
+func TestGeoIPLanguage(t *testing.T) {
+	dir := writeTestDatabases(t)
+	defer os.RemoveAll(dir)
+
+	p, err := New(common.MustNewConfigFrom(common.MapStr{
+		"databases": []string{filepath.Join(dir, "city.mmdb")},
+		"fields":    common.MapStr{"client.ip": "client"},
+		"language":  "de",
+	}))
+	require.NoError(t, err)
+
+	out, err := p.Run(&beat.Event{Fields: common.MapStr{"client": common.MapStr{"ip": "1.2.3.4"}}})
+	require.NoError(t, err)
+	country, _ := out.GetValue("client.geo.country_name")
+	assert.Equal(t, "Niederlande", country)
+}
+
+func TestGeoIPCacheAndReload(t *testing.T) {
+	dir := writeTestDatabases(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "asn.mmdb")
+
+	p, err := New(common.MustNewConfigFrom(common.MapStr{
+		"databases":       []string{path},
+		"fields":          common.MapStr{"source.ip": "source"},
+		"reload_interval": "1m",
+	}))
+	require.NoError(t, err)
+	geoip := p.(*processor)
+	now := time.Now()
+	geoip.clock = func() time.Time { return now }
+
+	lookupOrg := func() interface{} {
+		out, err := p.Run(&beat.Event{Fields: common.MapStr{"source": common.MapStr{"ip": "1.2.3.4"}}})
+		require.NoError(t, err)
+		org, _ := out.GetValue("source.as.organization.name")
+		return org
+	}
+
+	assert.Equal(t, "KPN B.V.", lookupOrg())
+	assert.Equal(t, "KPN B.V.", lookupOrg())
+	assert.Equal(t, int64(1), geoip.cache.hits.Get())
+	assert.Equal(t, int64(1), geoip.cache.misses.Get())
+
+	writeTestDB(t, path, "GeoLite2-ASN", map[string]interface{}{
+		"1.2.3.0/24": map[string]interface{}{
+			"autonomous_system_number":       uint32(3320),
+			"autonomous_system_organization": "Deutsche Telekom AG",
+		},
+	})
+
+	// The database is checked for changes once per reload interval. The
+	// reload runs in the background, the event triggering it is enriched
+	// with the previous version of the database.
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, "KPN B.V.", lookupOrg())
+	geoip.reloadWG.Wait()
+	assert.Equal(t, int64(0), geoip.reloads.Get())
+	now = now.Add(time.Minute)
+	assert.Equal(t, "KPN B.V.", lookupOrg())
+	geoip.reloadWG.Wait()
+	assert.Equal(t, "Deutsche Telekom AG", lookupOrg())
+	assert.Equal(t, int64(1), geoip.reloads.Get())
+
+	// An invalid file does not replace the loaded database.
+	require.NoError(t, ioutil.WriteFile(path, []byte("corrupt"), 0644))
+	now = now.Add(time.Minute)
+	assert.Equal(t, "Deutsche Telekom AG", lookupOrg())
+	geoip.reloadWG.Wait()
+	assert.Equal(t, "Deutsche Telekom AG", lookupOrg())
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	dir := writeTestDatabases(t)
+	defer os.RemoveAll(dir)
+
+	cases := map[string]common.MapStr{
+		"missing databases": {"fields": common.MapStr{"source.ip": "source"}},
+		"missing fields":    {"databases": []string{filepath.Join(dir, "city.mmdb")}},
+		"unknown database":  {"databases": []string{filepath.Join(dir, "missing.mmdb")}, "fields": common.MapStr{"source.ip": "source"}},
+		"invalid target":    {"databases": []string{filepath.Join(dir, "city.mmdb")}, "fields": common.MapStr{"source.ip": 1}},
+	}
+	for name, config := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(common.MustNewConfigFrom(config))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func writeTestDatabases(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "geoip")
+	require.NoError(t, err)
+
+	writeTestDB(t, filepath.Join(dir, "city.mmdb"), "GeoLite2-City", map[string]interface{}{
+		"1.2.3.0/24": testCityRecord,
+	})
+	writeTestDB(t, filepath.Join(dir, "asn.mmdb"), "GeoLite2-ASN", map[string]interface{}{
+		"1.2.3.0/24":    testASNRecord,
+		"2001:db8::/32": testASNRecord,
+	})
+	return dir
+}
@@ -0,0 +1,412 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// The reader implements the MaxMind DB file format, version 2, as described
+// in https://maxmind.github.io/MaxMind-DB/.
+
+// metadataMarker separates the data section from the metadata.
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// maxMetadataSize is the maximum size of the metadata section, the marker is
+// searched in the last bytes of the file only.
+const maxMetadataSize = 128 * 1024
+
+// dataSectionSeparatorSize is the number of zero bytes between the search
+// tree and the data section.
+const dataSectionSeparatorSize = 16
+
+// maxDecodeDepth limits the nesting of maps, arrays and pointers.
+const maxDecodeDepth = 64
+
+// Data field types.
+const (
+	typeExtended  = 0
+	typePointer   = 1
+	typeString    = 2
+	typeDouble    = 3
+	typeBytes     = 4
+	typeUint16    = 5
+	typeUint32    = 6
+	typeMap       = 7
+	typeInt32     = 8
+	typeUint64    = 9
+	typeUint128   = 10
+	typeArray     = 11
+	typeContainer = 12
+	typeEndMarker = 13
+	typeBool      = 14
+	typeFloat     = 15
+)
+
+type metadata struct {
+	nodeCount    uint
+	recordSize   uint
+	ipVersion    uint
+	databaseType string
+}
+
+// reader looks up IP addresses in a MaxMind DB file loaded in memory.
+type reader struct {
+	metadata
+	buf          []byte
+	nodeByteSize uint
+	ipv4Start    uint
+	data         decoder
+}
+
+// openReader loads the MaxMind DB file at path.
+func openReader(path string) (*reader, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newReader(buf)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid MaxMind DB file %v", path)
+	}
+	return r, nil
+}
+
+func newReader(buf []byte) (*reader, error) {
+	start := 0
+	if len(buf) > maxMetadataSize {
+		start = len(buf) - maxMetadataSize
+	}
+	idx := bytes.LastIndex(buf[start:], metadataMarker)
+	if idx < 0 {
+		return nil, errors.New("metadata marker not found")
+	}
+	metadataStart := start + idx + len(metadataMarker)
+
+	meta, err := decodeMetadata(decoder{buf: buf[metadataStart:]})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode metadata")
+	}
+
+	r := &reader{metadata: meta, buf: buf}
+	switch meta.recordSize {
+	case 24, 28, 32:
+		r.nodeByteSize = meta.recordSize / 4
+	default:
+		return nil, fmt.Errorf("unsupported record size %v", meta.recordSize)
+	}
+
+	treeSize := meta.nodeCount * r.nodeByteSize
+	dataStart := treeSize + dataSectionSeparatorSize
+	if dataStart > uint(start+idx) {
+		return nil, errors.New("search tree exceeds the file size")
+	}
+	r.data = decoder{buf: buf[dataStart : start+idx]}
+
+	if meta.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < meta.nodeCount; i++ {
+			node = r.readNode(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+func decodeMetadata(d decoder) (metadata, error) {
+	v, _, err := d.decode(0, 0)
+	if err != nil {
+		return metadata{}, err
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return metadata{}, fmt.Errorf("metadata is a %T, not a map", v)
+	}
+
+	var meta metadata
+	fields := map[string]*uint{
+		"node_count":                  &meta.nodeCount,
+		"record_size":                 &meta.recordSize,
+		"ip_version":                  &meta.ipVersion,
+		"binary_format_major_version": new(uint),
+	}
+	for name, ptr := range fields {
+		n, ok := m[name].(uint64)
+		if !ok {
+			return metadata{}, fmt.Errorf("missing or invalid metadata field %v", name)
+		}
+		*ptr = uint(n)
+	}
+	if major := *fields["binary_format_major_version"]; major != 2 {
+		return metadata{}, fmt.Errorf("unsupported binary format version %v", major)
+	}
+	if meta.ipVersion != 4 && meta.ipVersion != 6 {
+		return metadata{}, fmt.Errorf("invalid IP version %v", meta.ipVersion)
+	}
+	meta.databaseType, _ = m["database_type"].(string)
+	return meta, nil
+}
+
+// lookup returns the record of the network containing ip, or nil if the
+// database contains no such network.
+func (r *reader) lookup(ip net.IP) (map[string]interface{}, error) {
+	node := uint(0)
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+		node = r.ipv4Start
+	} else if r.ipVersion == 4 {
+		return nil, fmt.Errorf("cannot look up IPv6 address %v in an IPv4 database", ip)
+	}
+
+	bitCount := len(ip) * 8
+	for i := 0; i < bitCount && node < r.nodeCount; i++ {
+		bit := uint(ip[i>>3]>>(7-uint(i&7))) & 1
+		node = r.readNode(node, bit)
+	}
+
+	switch {
+	case node == r.nodeCount:
+		return nil, nil
+	case node < r.nodeCount:
+		return nil, errors.New("invalid search tree")
+	}
+
+	offset := node - r.nodeCount - dataSectionSeparatorSize
+	v, _, err := r.data.decode(offset, 0)
+	if err != nil {
+		return nil, err
+	}
+	record, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("record is a %T, not a map", v)
+	}
+	return record, nil
+}
+
+// readNode returns the left (bit 0) or right (bit 1) record of a node.
+func (r *reader) readNode(node, bit uint) uint {
+	b := r.buf[node*r.nodeByteSize:]
+	switch r.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// decoder decodes the values of a data section. Offsets are relative to the
+// start of the section.
+type decoder struct {
+	buf []byte
+}
+
+var errTruncated = errors.New("unexpected end of data")
+
+// decode decodes the value at offset, and returns the offset following it.
+func (d decoder) decode(offset uint, depth int) (interface{}, uint, error) {
+	if depth > maxDecodeDepth {
+		return nil, 0, errors.New("maximum data structure depth exceeded")
+	}
+	if offset >= uint(len(d.buf)) {
+		return nil, 0, errTruncated
+	}
+
+	ctrl := d.buf[offset]
+	offset++
+	typ := ctrl >> 5
+	if typ == typeExtended {
+		if offset >= uint(len(d.buf)) {
+			return nil, 0, errTruncated
+		}
+		typ = 7 + d.buf[offset]
+		offset++
+	}
+
+	if typ == typePointer {
+		target, next, err := d.decodePointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		v, _, err := d.decode(target, depth+1)
+		return v, next, err
+	}
+
+	size, offset, err := d.decodeSize(ctrl, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch typ {
+	case typeMap, typeArray:
+		// Every element takes at least one byte, checking the size first
+		// avoids large allocations for corrupt files.
+		if size > uint(len(d.buf))-offset {
+			return nil, 0, errTruncated
+		}
+	}
+
+	switch typ {
+	case typeMap:
+		return d.decodeMap(size, offset, depth)
+	case typeArray:
+		return d.decodeArray(size, offset, depth)
+	case typeBool:
+		if size > 1 {
+			return nil, 0, fmt.Errorf("invalid boolean size %v", size)
+		}
+		return size == 1, offset, nil
+	}
+
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, errTruncated
+	}
+	b := d.buf[offset : offset+size]
+	next := offset + size
+
+	switch typ {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes:
+		return append([]byte(nil), b...), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double size %v", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float size %v", size)
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		maxSize := map[byte]uint{typeUint16: 2, typeUint32: 4, typeUint64: 8}[typ]
+		if size > maxSize {
+			return nil, 0, fmt.Errorf("invalid unsigned integer size %v", size)
+		}
+		return decodeUint(b), next, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("invalid int32 size %v", size)
+		}
+		return int32(uint32(decodeUint(b))), next, nil
+	case typeUint128:
+		if size > 16 {
+			return nil, 0, fmt.Errorf("invalid uint128 size %v", size)
+		}
+		return new(big.Int).SetBytes(b), next, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported data type %v", typ)
+	}
+}
+
+func (d decoder) decodeSize(ctrl byte, offset uint) (uint, uint, error) {
+	size := uint(ctrl & 0x1F)
+	if size < 29 {
+		return size, offset, nil
+	}
+
+	n := size - 28
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, errTruncated
+	}
+	v := uint(decodeUint(d.buf[offset : offset+n]))
+	switch size {
+	case 29:
+		v += 29
+	case 30:
+		v += 285
+	default:
+		v += 65821
+	}
+	return v, offset + n, nil
+}
+
+func (d decoder) decodePointer(ctrl byte, offset uint) (uint, uint, error) {
+	n := uint((ctrl>>3)&0x3) + 1
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, errTruncated
+	}
+	b := d.buf[offset : offset+n]
+
+	var target uint
+	switch n {
+	case 1:
+		target = uint(ctrl&0x7)<<8 | uint(b[0])
+	case 2:
+		target = (uint(ctrl&0x7)<<16 | uint(decodeUint(b))) + 2048
+	case 3:
+		target = (uint(ctrl&0x7)<<24 | uint(decodeUint(b))) + 526336
+	default:
+		target = uint(decodeUint(b))
+	}
+	return target, offset + n, nil
+}
+
+func (d decoder) decodeMap(size, offset uint, depth int) (interface{}, uint, error) {
+	m := make(map[string]interface{}, size)
+	for i := uint(0); i < size; i++ {
+		k, next, err := d.decode(offset, depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, 0, fmt.Errorf("map key is a %T, not a string", k)
+		}
+
+		m[key], offset, err = d.decode(next, depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return m, offset, nil
+}
+
+func (d decoder) decodeArray(size, offset uint, depth int) (interface{}, uint, error) {
+	a := make([]interface{}, size)
+	for i := range a {
+		var err error
+		a[i], offset, err = d.decode(offset, depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return a, offset, nil
+}
+
+func decodeUint(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
@@ -0,0 +1,381 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package geoip
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReaderLookup(t *testing.T) {
+	networks := map[string]interface{}{
+		"1.2.3.0/24": map[string]interface{}{"name": "v4 network", "values": []interface{}{uint16(1), uint32(70000), true}},
+		"10.0.0.0/8": map[string]interface{}{"name": "private"},
+		"2001:db8::/32": map[string]interface{}{
+			"name":   "v6 network",
+			"double": 1.5,
+			"float":  float32(2.5),
+			"int":    int32(-3),
+			"big":    big.NewInt(1 << 40),
+			"bytes":  []byte{1, 2},
+			"long":   uint64(math.MaxUint64),
+		},
+	}
+
+	for _, recordSize := range []int{24, 28, 32} {
+		for _, ipVersion := range []int{4, 6} {
+			nets := networks
+			if ipVersion == 4 {
+				nets = map[string]interface{}{"1.2.3.0/24": networks["1.2.3.0/24"], "10.0.0.0/8": networks["10.0.0.0/8"]}
+			}
+			r, err := newReader(buildTestDB(t, ipVersion, recordSize, "Test", nets))
+			require.NoError(t, err, "record size %d", recordSize)
+
+			record, err := r.lookup(net.ParseIP("1.2.3.4"))
+			require.NoError(t, err)
+			assert.Equal(t, map[string]interface{}{
+				"name":   "v4 network",
+				"values": []interface{}{uint64(1), uint64(70000), true},
+			}, record)
+
+			record, err = r.lookup(net.ParseIP("10.200.0.1"))
+			require.NoError(t, err)
+			assert.Equal(t, map[string]interface{}{"name": "private"}, record)
+
+			record, err = r.lookup(net.ParseIP("1.2.4.1"))
+			require.NoError(t, err)
+			assert.Nil(t, record)
+
+			if ipVersion == 4 {
+				_, err = r.lookup(net.ParseIP("2001:db8::1"))
+				assert.Error(t, err)
+				continue
+			}
+
+			record, err = r.lookup(net.ParseIP("2001:db8::1"))
+			require.NoError(t, err)
+			assert.Equal(t, networks["2001:db8::/32"], record)
+
+			record, err = r.lookup(net.ParseIP("2001:db9::1"))
+			require.NoError(t, err)
+			assert.Nil(t, record)
+		}
+	}
+}
+
+func TestReaderInvalidFiles(t *testing.T) {
+	valid := buildTestDB(t, 6, 24, "Test", map[string]interface{}{
+		"1.2.3.0/24": map[string]interface{}{"name": "network"},
+	})
+
+	cases := map[string][]byte{
+		"empty":              {},
+		"no metadata":        valid[:len(valid)/2],
+		"truncated tree":     append([]byte{}, valid[len(valid)-200:]...),
+		"truncated metadata": valid[:len(valid)-5],
+	}
+	for name, buf := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := newReader(buf)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestOpenDatabaseReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "geoip")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.mmdb")
+	writeTestDB(t, path, "Test", map[string]interface{}{
+		"1.2.3.0/24": map[string]interface{}{"name": "first"},
+	})
+
+	db, err := openDatabase(path)
+	require.NoError(t, err)
+	changed, err := db.reload()
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	writeTestDB(t, path, "Test", map[string]interface{}{
+		"1.2.3.0/24": map[string]interface{}{"name": "second version"},
+	})
+	changed, err = db.reload()
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	record, err := db.lookup(net.ParseIP("1.2.3.4"))
+	require.NoError(t, err)
+	assert.Equal(t, "second version", record["name"])
+}
+
+func writeTestDB(t testing.TB, path, dbType string, networks map[string]interface{}) {
+	t.Helper()
+	require.NoError(t, ioutil.WriteFile(path, buildTestDB(t, 6, 28, dbType, networks), 0644))
+}
+
+// buildTestDB creates a MaxMind DB file containing the networks. IPv4
+// networks are stored in the IPv4 subtree (::/96) of IPv6 databases.
+func buildTestDB(t testing.TB, ipVersion, recordSize int, dbType string, networks map[string]interface{}) []byte {
+	t.Helper()
+
+	type node struct {
+		children [2]*node
+		data     int
+	}
+	newNode := func() *node { return &node{data: -1} }
+	root := newNode()
+
+	var data testEncoder
+	cidrs := make([]string, 0, len(networks))
+	for cidr := range networks {
+		cidrs = append(cidrs, cidr)
+	}
+	sort.Strings(cidrs)
+
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		require.NoError(t, err)
+
+		ip := network.IP
+		ones, _ := network.Mask.Size()
+		if ipVersion == 6 {
+			if v4 := ip.To4(); v4 != nil {
+				ip = append(make(net.IP, 12), v4...)
+				ones += 96
+			}
+			ip = ip.To16()
+		}
+
+		offset := data.encode(networks[cidr])
+		n := root
+		for i := 0; i < ones; i++ {
+			bit := (ip[i/8] >> (7 - uint(i%8))) & 1
+			if n.children[bit] == nil {
+				n.children[bit] = newNode()
+			}
+			n = n.children[bit]
+		}
+		n.data = offset
+	}
+
+	// Number the internal nodes in breadth first order.
+	var nodes []*node
+	numbers := map[*node]int{}
+	queue := []*node{root}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if n.data >= 0 {
+			continue
+		}
+		numbers[n] = len(nodes)
+		nodes = append(nodes, n)
+		for _, c := range n.children {
+			if c != nil {
+				queue = append(queue, c)
+			}
+		}
+	}
+
+	nodeCount := len(nodes)
+	record := func(c *node) uint32 {
+		switch {
+		case c == nil:
+			return uint32(nodeCount)
+		case c.data >= 0:
+			return uint32(nodeCount + dataSectionSeparatorSize + c.data)
+		default:
+			return uint32(numbers[c])
+		}
+	}
+
+	var buf []byte
+	for _, n := range nodes {
+		left, right := record(n.children[0]), record(n.children[1])
+		switch recordSize {
+		case 24:
+			buf = append(buf, byte(left>>16), byte(left>>8), byte(left), byte(right>>16), byte(right>>8), byte(right))
+		case 28:
+			buf = append(buf, byte(left>>16), byte(left>>8), byte(left),
+				byte((left>>20)&0xF0)|byte((right>>24)&0x0F),
+				byte(right>>16), byte(right>>8), byte(right))
+		case 32:
+			buf = append(buf, make([]byte, 8)...)
+			binary.BigEndian.PutUint32(buf[len(buf)-8:], left)
+			binary.BigEndian.PutUint32(buf[len(buf)-4:], right)
+		}
+	}
+	buf = append(buf, make([]byte, dataSectionSeparatorSize)...)
+	buf = append(buf, data.buf...)
+	buf = append(buf, metadataMarker...)
+
+	var meta testEncoder
+	meta.encode(map[string]interface{}{
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(recordSize),
+		"ip_version":                  uint16(ipVersion),
+		"database_type":               dbType,
+		"languages":                   []interface{}{"en"},
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1600000000),
+		"description":                 map[string]interface{}{"en": "Test database"},
+	})
+	return append(buf, meta.buf...)
+}
+
+// testEncoder writes values in the data section format. Repeated strings
+// are written as pointers to their first occurrence.
+type testEncoder struct {
+	buf     []byte
+	strings map[string]int
+}
+
+func (e *testEncoder) encode(v interface{}) int {
+	offset := len(e.buf)
+	switch v := v.(type) {
+	case string:
+		if e.strings == nil {
+			e.strings = map[string]int{}
+		}
+		if prev, ok := e.strings[v]; ok {
+			e.pointer(prev)
+			break
+		}
+		e.strings[v] = offset
+		e.ctrl(typeString, len(v))
+		e.buf = append(e.buf, v...)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		e.ctrl(typeMap, len(v))
+		for _, k := range keys {
+			e.encode(k)
+			e.encode(v[k])
+		}
+	case []interface{}:
+		e.ctrl(typeArray, len(v))
+		for _, elem := range v {
+			e.encode(elem)
+		}
+	case bool:
+		n := 0
+		if v {
+			n = 1
+		}
+		e.ctrl(typeBool, n)
+	case float64:
+		e.ctrl(typeDouble, 8)
+		e.uintBytes(math.Float64bits(v), 8)
+	case float32:
+		e.ctrl(typeFloat, 4)
+		e.uintBytes(uint64(math.Float32bits(v)), 4)
+	case []byte:
+		e.ctrl(typeBytes, len(v))
+		e.buf = append(e.buf, v...)
+	case uint16:
+		e.uint(typeUint16, uint64(v))
+	case uint32:
+		e.uint(typeUint32, uint64(v))
+	case uint64:
+		e.uint(typeUint64, v)
+	case int32:
+		e.uint(typeInt32, uint64(uint32(v)))
+	case *big.Int:
+		b := v.Bytes()
+		e.ctrl(typeUint128, len(b))
+		e.buf = append(e.buf, b...)
+	default:
+		panic("unsupported type")
+	}
+	return offset
+}
+
+func (e *testEncoder) uint(typ byte, v uint64) {
+	var b []byte
+	for ; v > 0; v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+	}
+	e.ctrl(typ, len(b))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *testEncoder) uintBytes(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		e.buf = append(e.buf, byte(v>>(8*uint(i))))
+	}
+}
+
+func (e *testEncoder) ctrl(typ byte, size int) {
+	var ctrl byte
+	var extended []byte
+	if typ <= 7 {
+		ctrl = typ << 5
+	} else {
+		extended = []byte{typ - 7}
+	}
+
+	var sizeBytes []byte
+	switch {
+	case size < 29:
+		ctrl |= byte(size)
+	case size < 285:
+		ctrl |= 29
+		sizeBytes = []byte{byte(size - 29)}
+	case size < 65821:
+		ctrl |= 30
+		s := size - 285
+		sizeBytes = []byte{byte(s >> 8), byte(s)}
+	default:
+		ctrl |= 31
+		s := size - 65821
+		sizeBytes = []byte{byte(s >> 16), byte(s >> 8), byte(s)}
+	}
+
+	e.buf = append(e.buf, ctrl)
+	e.buf = append(e.buf, extended...)
+	e.buf = append(e.buf, sizeBytes...)
+}
+
+func (e *testEncoder) pointer(offset int) {
+	switch {
+	case offset < 2048:
+		e.buf = append(e.buf, typePointer<<5|byte(offset>>8), byte(offset))
+	case offset < 526336:
+		v := offset - 2048
+		e.buf = append(e.buf, typePointer<<5|1<<3|byte(v>>16), byte(v>>8), byte(v))
+	default:
+		v := offset - 526336
+		e.buf = append(e.buf, typePointer<<5|2<<3|byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+}
@@ -0,0 +1,70 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"fmt"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/conditions"
+)
+
+type config struct {
+	Field              string            `config:"field"`
+	Patterns           []patternConfig   `config:"patterns" validate:"required"`
+	PatternDefinitions map[string]string `config:"pattern_definitions"`
+	TargetPrefix       string            `config:"target_prefix"`
+	IgnoreMissing      bool              `config:"ignore_missing"`
+	IgnoreFailure      bool              `config:"ignore_failure"`
+	OverwriteKeys      bool              `config:"overwrite_keys"`
+}
+
+// patternConfig configures a grok expression. The expression is only
+// applied to events matching the optional condition.
+type patternConfig struct {
+	Pattern string             `config:"pattern" validate:"required"`
+	When    *conditions.Config `config:"when"`
+}
+
+var defaultConfig = config{
+	Field: "message",
+}
+
+// Unpack accepts the grok expression as plain string, or as object with
+// `pattern` and `when` settings.
+func (p *patternConfig) Unpack(v interface{}) error {
+	switch in := v.(type) {
+	case string:
+		*p = patternConfig{Pattern: in}
+		return nil
+	case map[string]interface{}:
+		cfg, err := common.NewConfigFrom(in)
+		if err != nil {
+			return err
+		}
+		type tmpConfig patternConfig
+		var tmp tmpConfig
+		if err := cfg.Unpack(&tmp); err != nil {
+			return err
+		}
+		*p = patternConfig(tmp)
+		return nil
+	default:
+		return fmt.Errorf("pattern must be a string or an object, got %T", v)
+	}
+}
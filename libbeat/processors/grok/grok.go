@@ -0,0 +1,223 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// Grok is a compiled grok expression.
+type Grok struct {
+	raw    string
+	re     *regexp.Regexp
+	fields []captureField
+}
+
+type captureField struct {
+	group int
+	name  string
+	typ   dataType
+}
+
+type dataType uint8
+
+// List of dataTypes.
+const (
+	typeString dataType = iota
+	typeInteger
+	typeLong
+	typeFloat
+	typeDouble
+	typeBoolean
+)
+
+var dataTypeNames = map[string]dataType{
+	"string":  typeString,
+	"int":     typeInteger,
+	"integer": typeInteger,
+	"long":    typeLong,
+	"float":   typeFloat,
+	"double":  typeDouble,
+	"boolean": typeBoolean,
+}
+
+var (
+	// patternRe matches references to other patterns: %{NAME}, %{NAME:field}
+	// or %{NAME:field:type}.
+	patternRe = regexp.MustCompile(`%\{(\w+)(?::([\w\[\].@-]+))?(?::(\w+))?\}`)
+
+	// namedGroupRe matches named capture groups in the Oniguruma syntax
+	// (?<field>...) or (?'field'...).
+	namedGroupRe = regexp.MustCompile(`\(\?(?:<([\w\[\].@-]+)>|'([\w\[\].@-]+)')`)
+)
+
+type compiler struct {
+	definitions map[string]string
+	captures    map[string]captureField
+}
+
+// Compile compiles a grok expression. References to other patterns are
+// resolved using the given definitions.
+func Compile(definitions map[string]string, expr string) (*Grok, error) {
+	c := &compiler{definitions: definitions, captures: map[string]captureField{}}
+
+	pattern, err := c.expand(expr, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to compile grok expression '%v'", expr)
+	}
+
+	g := &Grok{raw: expr, re: re}
+	for i, name := range re.SubexpNames() {
+		if field, ok := c.captures[name]; ok {
+			field.group = i
+			g.fields = append(g.fields, field)
+		}
+	}
+	return g, nil
+}
+
+func (c *compiler) expand(expr string, stack []string) (string, error) {
+	expr = namedGroupRe.ReplaceAllStringFunc(expr, func(s string) string {
+		m := namedGroupRe.FindStringSubmatch(s)
+		name := m[1]
+		if name == "" {
+			name = m[2]
+		}
+		return "(?P<" + c.capture(name, typeString) + ">"
+	})
+
+	var b strings.Builder
+	last := 0
+	for _, m := range patternRe.FindAllStringSubmatchIndex(expr, -1) {
+		b.WriteString(expr[last:m[0]])
+		last = m[1]
+
+		name := expr[m[2]:m[3]]
+		definition, exists := c.definitions[name]
+		if !exists {
+			return "", fmt.Errorf("unknown pattern %%{%v}", name)
+		}
+		for _, parent := range stack {
+			if parent == name {
+				return "", fmt.Errorf("pattern %%{%v} references itself", name)
+			}
+		}
+
+		inner, err := c.expand(definition, append(stack, name))
+		if err != nil {
+			return "", err
+		}
+
+		if m[4] < 0 {
+			b.WriteString("(?:" + inner + ")")
+			continue
+		}
+
+		typ := typeString
+		if m[6] >= 0 {
+			typeName := expr[m[6]:m[7]]
+			if typ, exists = dataTypeNames[typeName]; !exists {
+				return "", fmt.Errorf("unknown data type '%v' in %v", typeName, expr[m[0]:m[1]])
+			}
+		}
+		b.WriteString("(?P<" + c.capture(expr[m[4]:m[5]], typ) + ">" + inner + ")")
+	}
+	b.WriteString(expr[last:])
+
+	return b.String(), nil
+}
+
+// capture registers a new capture group and returns the name of the
+// group in the regular expression.
+func (c *compiler) capture(field string, typ dataType) string {
+	group := "_" + strconv.Itoa(len(c.captures))
+	c.captures[group] = captureField{name: fieldName(field), typ: typ}
+	return group
+}
+
+// fieldName converts field references like [http][request] into the dotted
+// notation.
+func fieldName(s string) string {
+	if !strings.HasPrefix(s, "[") {
+		return s
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	return strings.Replace(s, "][", ".", -1)
+}
+
+// Match applies the expression to s. The returned map contains all non-empty
+// captures. The map is nil if the expression does not match.
+func (g *Grok) Match(s string) (common.MapStr, error) {
+	m := g.re.FindStringSubmatchIndex(s)
+	if m == nil {
+		return nil, nil
+	}
+
+	fields := common.MapStr{}
+	for _, f := range g.fields {
+		start, end := m[2*f.group], m[2*f.group+1]
+		if start < 0 || start == end {
+			continue
+		}
+
+		value, err := convert(f.typ, s[start:end])
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to convert value of field %v", f.name)
+		}
+		if _, err := fields.Put(f.name, value); err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+// String returns the raw grok expression.
+func (g *Grok) String() string {
+	return g.raw
+}
+
+func convert(typ dataType, value string) (interface{}, error) {
+	switch typ {
+	case typeInteger:
+		i, err := strconv.ParseInt(value, 10, 32)
+		return int32(i), err
+	case typeLong:
+		return strconv.ParseInt(value, 10, 64)
+	case typeFloat:
+		f, err := strconv.ParseFloat(value, 32)
+		return float32(f), err
+	case typeDouble:
+		return strconv.ParseFloat(value, 64)
+	case typeBoolean:
+		return strconv.ParseBool(value)
+	default:
+		return value, nil
+	}
+}
@@ -0,0 +1,283 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+func TestDefaultPatternsCompile(t *testing.T) {
+	for name := range defaultDefinitions {
+		_, err := Compile(defaultDefinitions, "%{"+name+"}")
+		assert.NoError(t, err, "pattern %v", name)
+	}
+}
+
+func TestGrokMatch(t *testing.T) {
+	tests := map[string]struct {
+		expr        string
+		definitions map[string]string
+		input       string
+		expected    common.MapStr
+	}{
+		"named captures": {
+			expr:  `%{IP:client.ip} %{WORD:http.request.method} %{URIPATHPARAM:url.original}`,
+			input: `55.3.244.1 GET /index.html?q=1`,
+			expected: common.MapStr{
+				"client": common.MapStr{"ip": "55.3.244.1"},
+				"http":   common.MapStr{"request": common.MapStr{"method": "GET"}},
+				"url":    common.MapStr{"original": "/index.html?q=1"},
+			},
+		},
+		"type conversion": {
+			expr:  `%{NUMBER:bytes:int} %{NUMBER:duration:float} %{NUMBER:total:long} %{NUMBER:ratio:double} %{WORD:ok:boolean}`,
+			input: `15824 0.043 1588975628 0.5 true`,
+			expected: common.MapStr{
+				"bytes":    int32(15824),
+				"duration": float32(0.043),
+				"total":    int64(1588975628),
+				"ratio":    0.5,
+				"ok":       true,
+			},
+		},
+		"bracket field names": {
+			expr:     `%{WORD:[event][action]}`,
+			input:    `login`,
+			expected: common.MapStr{"event": common.MapStr{"action": "login"}},
+		},
+		"custom definitions": {
+			expr:        `%{TICKET:ticket}`,
+			definitions: map[string]string{"TICKET": `[A-Z]+-%{INT}`},
+			input:       `see JIRA-1234`,
+			expected:    common.MapStr{"ticket": "JIRA-1234"},
+		},
+		"oniguruma named groups": {
+			expr:     `user=(?<user.name>\w+)`,
+			input:    `user=alice`,
+			expected: common.MapStr{"user": common.MapStr{"name": "alice"}},
+		},
+		"oniguruma quoted named groups": {
+			expr:     `user=(?'user.name'\w+)`,
+			input:    `user=alice`,
+			expected: common.MapStr{"user": common.MapStr{"name": "alice"}},
+		},
+		"empty captures are ignored": {
+			expr:     `%{WORD:a}(?: %{WORD:b})?`,
+			input:    `one`,
+			expected: common.MapStr{"a": "one"},
+		},
+		"syslog": {
+			expr:  `%{SYSLOGLINE}`,
+			input: `Apr 12 06:25:01 host01 CRON[12345]: (root) CMD (run-parts /etc/cron.hourly)`,
+			expected: common.MapStr{
+				"timestamp": "Apr 12 06:25:01",
+				"logsource": "host01",
+				"program":   "CRON",
+				"pid":       "12345",
+				"message":   "(root) CMD (run-parts /etc/cron.hourly)",
+			},
+		},
+		"apache": {
+			expr:  `%{COMBINEDAPACHELOG}`,
+			input: `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08"`,
+			expected: common.MapStr{
+				"clientip":    "127.0.0.1",
+				"ident":       "-",
+				"auth":        "frank",
+				"timestamp":   "10/Oct/2000:13:55:36 -0700",
+				"verb":        "GET",
+				"request":     "/apache_pb.gif",
+				"httpversion": "1.0",
+				"response":    "200",
+				"bytes":       "2326",
+				"referrer":    `"http://www.example.com/start.html"`,
+				"agent":       `"Mozilla/4.08"`,
+			},
+		},
+		"syslog 5424": {
+			expr:  `%{SYSLOG5424LINE}`,
+			input: `<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - 'su root' failed for lonvick on /dev/pts/8`,
+			expected: common.MapStr{
+				"syslog5424_pri":   "34",
+				"syslog5424_ver":   "1",
+				"syslog5424_ts":    "2003-10-11T22:14:15.003Z",
+				"syslog5424_host":  "mymachine.example.com",
+				"syslog5424_app":   "su",
+				"syslog5424_msgid": "ID47",
+				"syslog5424_msg":   "'su root' failed for lonvick on /dev/pts/8",
+			},
+		},
+		"apache error": {
+			expr:  `%{HTTPD_ERRORLOG}`,
+			input: `[Mon Aug 31 16:30:04.123456 2020] [core:error] [pid 2345:tid 140123] [client 10.0.0.1:51234] AH00126: Invalid URI in request GET /x HTTP/1.1`,
+			expected: common.MapStr{
+				"timestamp":  "Mon Aug 31 16:30:04.123456 2020",
+				"module":     "core",
+				"loglevel":   "error",
+				"pid":        "2345",
+				"tid":        "140123",
+				"clientip":   "10.0.0.1",
+				"clientport": "51234",
+				"errorcode":  "AH00126",
+				"message":    "Invalid URI in request GET /x HTTP/1.1",
+			},
+		},
+		"mongodb": {
+			expr:  `%{MONGO3_LOG}`,
+			input: `2020-08-31T16:30:04.123+0000 I NETWORK  [conn42] end connection 127.0.0.1:53456`,
+			expected: common.MapStr{
+				"timestamp": "2020-08-31T16:30:04.123+0000",
+				"severity":  "I",
+				"component": "NETWORK",
+				"context":   "conn42",
+				"message":   "end connection 127.0.0.1:53456",
+			},
+		},
+		"java stack trace": {
+			expr:  `%{JAVASTACKTRACEPART}`,
+			input: `	at org.example.Service.<init>(Service.java:42)`,
+			expected: common.MapStr{
+				"class":  "org.example.Service",
+				"method": "<init>",
+				"file":   "Service.java",
+				"line":   "42",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			definitions := map[string]string{}
+			for k, v := range defaultDefinitions {
+				definitions[k] = v
+			}
+			for k, v := range test.definitions {
+				definitions[k] = v
+			}
+
+			g, err := Compile(definitions, test.expr)
+			require.NoError(t, err)
+
+			fields, err := g.Match(test.input)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, fields)
+		})
+	}
+}
+
+func TestGrokNoMatch(t *testing.T) {
+	g, err := Compile(defaultDefinitions, `^%{INT:id}$`)
+	require.NoError(t, err)
+
+	fields, err := g.Match("abc")
+	assert.NoError(t, err)
+	assert.Nil(t, fields)
+}
+
+func TestGrokConversionError(t *testing.T) {
+	g, err := Compile(defaultDefinitions, `%{WORD:value:int}`)
+	require.NoError(t, err)
+
+	_, err = g.Match("abc")
+	assert.Error(t, err)
+}
+
+func TestGrokCompileErrors(t *testing.T) {
+	tests := map[string]struct {
+		expr        string
+		definitions map[string]string
+	}{
+		"unknown pattern":   {expr: `%{UNKNOWN:field}`},
+		"unknown data type": {expr: `%{INT:field:decimal}`},
+		"recursive pattern": {expr: `%{A}`, definitions: map[string]string{"A": `a%{B}`, "B": `b%{A}`}},
+		"invalid regex":     {expr: `(unclosed`},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			definitions := test.definitions
+			if definitions == nil {
+				definitions = defaultDefinitions
+			}
+			_, err := Compile(definitions, test.expr)
+			assert.Error(t, err)
+		})
+	}
+}
+
+var benchResult common.MapStr
+
+// The benchmarks use the same messages as the dissect benchmarks to allow
+// comparing both processors.
+func BenchmarkGrokOneValue(b *testing.B) {
+	benchmarkGrok(b, `id=%{INT:id} msg="%{DATA:message}"`, `id=7736 msg="Single value OK"}`)
+}
+
+func BenchmarkGrokWithConversionOneValue(b *testing.B) {
+	benchmarkGrok(b, `id=%{INT:id:int} msg="%{DATA:message}"`, `id=7736 msg="Single value OK"}`)
+}
+
+func BenchmarkGrokMultipleValues(b *testing.B) {
+	benchmarkGrok(b,
+		`id=%{INT:id} status=%{INT:status} duration=%{NUMBER:duration} uptime=%{INT:uptime} success=%{WORD:success} msg="%{DATA:message}"`,
+		`id=7736 status=202 duration=0.975 uptime=1588975628 success=true msg="Request accepted"}`)
+}
+
+func BenchmarkGrokWithConversionMultipleValues(b *testing.B) {
+	benchmarkGrok(b,
+		`id=%{INT:id:int} status=%{INT:status:int} duration=%{NUMBER:duration:float} uptime=%{INT:uptime:long} success=%{WORD:success:boolean} msg="%{DATA:message}"`,
+		`id=7736 status=202 duration=0.975 uptime=1588975628 success=true msg="Request accepted"}`)
+}
+
+func BenchmarkGrokApacheLog(b *testing.B) {
+	benchmarkGrok(b, `%{COMBINEDAPACHELOG}`,
+		`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08"`)
+}
+
+func BenchmarkRegexpMultipleValues(b *testing.B) {
+	re := regexp.MustCompile(`id=(\d+) status=(\d+) duration=(\S+) uptime=(\d+) success=(\w+) msg="(.*?)"`)
+	msg := `id=7736 status=202 duration=0.975 uptime=1588975628 success=true msg="Request accepted"}`
+
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		if re.FindStringSubmatch(msg) == nil {
+			b.Fatal("no match")
+		}
+	}
+}
+
+func benchmarkGrok(b *testing.B, expr, msg string) {
+	g, err := Compile(defaultDefinitions, expr)
+	require.NoError(b, err)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		fields, err := g.Match(msg)
+		if err != nil || fields == nil {
+			b.Fatalf("failed to match: %v", err)
+		}
+		benchResult = fields
+	}
+}
@@ -0,0 +1,176 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/conditions"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor"
+)
+
+const flagParsingError = "grok_parsing_error"
+
+var (
+	errNoMatch = errors.New("provided grok expressions do not match field value")
+
+	defaultDefinitions = parsePatterns(defaultPatterns)
+)
+
+type processor struct {
+	config   config
+	patterns []pattern
+}
+
+type pattern struct {
+	grok *Grok
+	when conditions.Condition
+}
+
+func init() {
+	processors.RegisterPlugin("grok", New)
+	jsprocessor.RegisterPlugin("Grok", New)
+}
+
+// New constructs a new grok processor.
+func New(c *common.Config) (processors.Processor, error) {
+	config := defaultConfig
+	if err := c.Unpack(&config); err != nil {
+		return nil, err
+	}
+
+	definitions := DefaultPatterns()
+	for name, definition := range config.PatternDefinitions {
+		definitions[name] = definition
+	}
+
+	p := &processor{config: config}
+	for _, pc := range config.Patterns {
+		g, err := Compile(definitions, pc.Pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		var cond conditions.Condition
+		if pc.When != nil {
+			cond, err = conditions.NewCondition(pc.When)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to initialize condition of pattern '%v'", pc.Pattern)
+			}
+		}
+		p.patterns = append(p.patterns, pattern{grok: g, when: cond})
+	}
+
+	return p, nil
+}
+
+// Run applies the first matching grok expression to the configured field.
+// Expressions with a condition are only applied if the event matches the
+// condition.
+func (p *processor) Run(event *beat.Event) (*beat.Event, error) {
+	v, err := event.GetValue(p.config.Field)
+	if err != nil {
+		if p.config.IgnoreMissing && errors.Cause(err) == common.ErrKeyNotFound {
+			return event, nil
+		}
+		return event, err
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return event, fmt.Errorf("field is not a string, value: `%v`, field: `%s`", v, p.config.Field)
+	}
+
+	fields, err := p.match(event, s)
+	if err != nil {
+		return p.fail(event, err)
+	}
+
+	return p.mapper(event, fields)
+}
+
+func (p *processor) match(event *beat.Event, s string) (common.MapStr, error) {
+	for _, pat := range p.patterns {
+		if pat.when != nil && !pat.when.Check(event) {
+			continue
+		}
+
+		fields, err := pat.grok.Match(s)
+		if err != nil {
+			return nil, err
+		}
+		if fields != nil {
+			return fields, nil
+		}
+	}
+	return nil, errNoMatch
+}
+
+func (p *processor) fail(event *beat.Event, err error) (*beat.Event, error) {
+	if err := common.AddTagsWithKey(
+		event.Fields,
+		beat.FlagField,
+		[]string{flagParsingError},
+	); err != nil {
+		return event, errors.Wrap(err, "cannot add new flag the event")
+	}
+	if p.config.IgnoreFailure {
+		return event, nil
+	}
+	return event, err
+}
+
+func (p *processor) mapper(event *beat.Event, m common.MapStr) (*beat.Event, error) {
+	copy := event.Fields.Clone()
+
+	prefix := ""
+	if p.config.TargetPrefix != "" {
+		prefix = p.config.TargetPrefix + "."
+	}
+	for k, v := range m.Flatten() {
+		prefixKey := prefix + k
+		if _, err := event.GetValue(prefixKey); err == common.ErrKeyNotFound || p.config.OverwriteKeys {
+			event.PutValue(prefixKey, v)
+		} else {
+			event.Fields = copy
+			// When the target key exists but is a string instead of a map.
+			if err != nil {
+				return event, errors.Wrapf(err, "cannot override existing key with `%s`", prefixKey)
+			}
+			return event, fmt.Errorf("cannot override existing key with `%s`", prefixKey)
+		}
+	}
+
+	return event, nil
+}
+
+func (p *processor) String() string {
+	patterns := make([]string, len(p.patterns))
+	for i, pat := range p.patterns {
+		patterns[i] = pat.grok.String()
+	}
+	return "grok=[" + strings.Join(patterns, ", ") + "]" +
+		",field=" + p.config.Field +
+		",target_prefix=" + p.config.TargetPrefix
+}
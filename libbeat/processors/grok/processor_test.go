@@ -0,0 +1,154 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+func TestProcessor(t *testing.T) {
+	tests := map[string]struct {
+		config   common.MapStr
+		input    common.MapStr
+		expected common.MapStr
+		fail     bool
+	}{
+		"first matching pattern": {
+			config: common.MapStr{
+				"patterns": []string{`^%{INT:id:int}$`, `^%{WORD:name}$`},
+			},
+			input: common.MapStr{"message": "hello"},
+			expected: common.MapStr{
+				"message": "hello",
+				"name":    "hello",
+			},
+		},
+		"target prefix and custom definitions": {
+			config: common.MapStr{
+				"field":               "log",
+				"target_prefix":       "parsed",
+				"patterns":            []string{`%{TICKET:ticket}`},
+				"pattern_definitions": map[string]string{"TICKET": `[A-Z]+-\d+`},
+			},
+			input: common.MapStr{"log": "fixed ABC-12"},
+			expected: common.MapStr{
+				"log":    "fixed ABC-12",
+				"parsed": common.MapStr{"ticket": "ABC-12"},
+			},
+		},
+		"pattern selection by condition": {
+			config: common.MapStr{
+				"patterns": []interface{}{
+					map[string]interface{}{
+						"pattern": `%{GREEDYDATA:apache}`,
+						"when":    map[string]interface{}{"equals": map[string]interface{}{"service": "apache"}},
+					},
+					`%{GREEDYDATA:other}`,
+				},
+			},
+			input: common.MapStr{"message": "x", "service": "nginx"},
+			expected: common.MapStr{
+				"message": "x",
+				"service": "nginx",
+				"other":   "x",
+			},
+		},
+		"no match": {
+			config: common.MapStr{
+				"patterns": []string{`^%{INT:id}$`},
+			},
+			input: common.MapStr{"message": "hello"},
+			expected: common.MapStr{
+				"message": "hello",
+				"log":     common.MapStr{"flags": []string{flagParsingError}},
+			},
+			fail: true,
+		},
+		"ignore failure": {
+			config: common.MapStr{
+				"patterns":       []string{`^%{INT:id}$`},
+				"ignore_failure": true,
+			},
+			input: common.MapStr{"message": "hello"},
+			expected: common.MapStr{
+				"message": "hello",
+				"log":     common.MapStr{"flags": []string{flagParsingError}},
+			},
+		},
+		"ignore missing": {
+			config: common.MapStr{
+				"patterns":       []string{`%{GREEDYDATA:x}`},
+				"ignore_missing": true,
+			},
+			input:    common.MapStr{"other": "hello"},
+			expected: common.MapStr{"other": "hello"},
+		},
+		"existing key": {
+			config: common.MapStr{
+				"patterns": []string{`%{GREEDYDATA:message}`},
+			},
+			input:    common.MapStr{"message": "hello"},
+			expected: common.MapStr{"message": "hello"},
+			fail:     true,
+		},
+		"overwrite keys": {
+			config: common.MapStr{
+				"patterns":       []string{`%{WORD:message} %{WORD:rest}`},
+				"overwrite_keys": true,
+			},
+			input:    common.MapStr{"message": "hello world"},
+			expected: common.MapStr{"message": "hello", "rest": "world"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := New(common.MustNewConfigFrom(test.config))
+			require.NoError(t, err)
+
+			event, err := p.Run(&beat.Event{Fields: test.input})
+			if test.fail {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.expected, event.Fields)
+		})
+	}
+}
+
+func TestProcessorConfigErrors(t *testing.T) {
+	tests := map[string]common.MapStr{
+		"no patterns":       {},
+		"invalid pattern":   {"patterns": []string{`%{NOPE}`}},
+		"invalid condition": {"patterns": []interface{}{map[string]interface{}{"pattern": `x`, "when": map[string]interface{}{"unknown": 1}}}},
+	}
+
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(common.MustNewConfigFrom(config))
+			assert.Error(t, err)
+		})
+	}
+}
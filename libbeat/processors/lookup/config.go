@@ -0,0 +1,120 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package lookup
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// Config defines the configuration options for the lookup processor.
+type Config struct {
+	File           string        `config:"file" validate:"required"`  // Path of the CSV or JSON file.
+	Format         string        `config:"format"`                    // csv or json, detected from the file extension by default.
+	Separator      string        `config:"separator"`                 // Field separator of CSV files.
+	Key            string        `config:"key"`                       // Column containing the key.
+	Match          matchType     `config:"match"`                     // How keys are matched, exact or cidr.
+	Field          string        `config:"field" validate:"required"` // Event field containing the value to look up.
+	Target         string        `config:"target"`                    // Field receiving all columns, if columns is not set.
+	Columns        common.MapStr `config:"columns"`                   // Mapping of columns to target fields.
+	OverwriteKeys  bool          `config:"overwrite_keys"`            // Overwrite existing target fields.
+	IgnoreMissing  bool          `config:"ignore_missing"`            // Ignore events without the lookup field.
+	ReloadInterval time.Duration `config:"reload_interval"`           // How often to check the file for changes.
+	TagOnFailure   []string      `config:"tag_on_failure"`            // Tags to append when a failure occurs.
+	columnsFlat    map[string]string
+}
+
+type matchType uint8
+
+const (
+	matchExact matchType = iota
+	matchCIDR
+)
+
+var matchTypeNames = map[matchType]string{
+	matchExact: "exact",
+	matchCIDR:  "cidr",
+}
+
+// String returns the match type name.
+func (m matchType) String() string {
+	if name, found := matchTypeNames[m]; found {
+		return name
+	}
+	return "unknown"
+}
+
+// Unpack unpacks a string to a matchType.
+func (m *matchType) Unpack(v string) error {
+	switch strings.ToLower(v) {
+	case "", "exact":
+		*m = matchExact
+	case "cidr":
+		*m = matchCIDR
+	default:
+		return errors.Errorf("invalid lookup match type '%v' (valid values are: exact, cidr)", v)
+	}
+	return nil
+}
+
+// Validate validates the data contained in the config.
+func (c *Config) Validate() error {
+	if c.Format == "" {
+		c.Format = strings.TrimPrefix(strings.ToLower(filepath.Ext(c.File)), ".")
+	}
+	c.Format = strings.ToLower(c.Format)
+	switch c.Format {
+	case "csv":
+		if c.Key == "" {
+			return errors.New("key is required for csv files")
+		}
+		if len([]rune(c.Separator)) != 1 {
+			return errors.New("separator must be a single character")
+		}
+	case "json":
+	default:
+		return errors.Errorf("invalid lookup file format '%v' (valid values are: csv, json)", c.Format)
+	}
+
+	c.columnsFlat = map[string]string{}
+	for k, v := range c.Columns.Flatten() {
+		target, ok := v.(string)
+		if !ok || target == "" {
+			return fmt.Errorf("target field for lookup column %v must be a non-empty string but got %v", k, v)
+		}
+		c.columnsFlat[k] = target
+	}
+	if len(c.columnsFlat) == 0 && c.Target == "" {
+		return errors.New("either columns or target must be set")
+	}
+	return nil
+}
+
+func defaultConfig() Config {
+	return Config{
+		Separator:      ",",
+		Match:          matchExact,
+		ReloadInterval: time.Minute,
+	}
+}
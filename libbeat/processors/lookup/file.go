@@ -0,0 +1,73 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package lookup
+
+import (
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// lookupFile is a lookup file that is reloaded when it changes on disk.
+// Lookups use the current table, which is swapped atomically on reload.
+// reload must not be called concurrently.
+type lookupFile struct {
+	config Config
+
+	table   atomic.Value // *table
+	modTime time.Time
+	size    int64
+}
+
+func openLookupFile(c Config) (*lookupFile, error) {
+	f := &lookupFile{config: c}
+	if _, err := f.reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// reload loads the file again if its modification time or size changed. It
+// returns true if the file has been reloaded. The current table is kept if
+// the new file can not be loaded.
+func (f *lookupFile) reload() (bool, error) {
+	info, err := os.Stat(f.config.File)
+	if err != nil {
+		return false, err
+	}
+
+	if f.current() != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return false, nil
+	}
+
+	t, err := loadTable(f.config)
+	if err != nil {
+		return false, err
+	}
+
+	f.table.Store(t)
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+	return true, nil
+}
+
+// current returns the table of the last loaded version of the file.
+func (f *lookupFile) current() *table {
+	t, _ := f.table.Load().(*table)
+	return t
+}
@@ -0,0 +1,187 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package lookup
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor"
+)
+
+const logName = "processor.lookup"
+
+// instanceID is used to assign each instance a unique logger.
+var instanceID = atomic.MakeUint32(0)
+
+func init() {
+	processors.RegisterPlugin("lookup", New)
+	jsprocessor.RegisterPlugin("Lookup", New)
+}
+
+type processor struct {
+	Config
+	log *logp.Logger
+
+	// clock returns the current time, it is replaced in tests.
+	clock func() time.Time
+
+	file *lookupFile
+
+	reloadMu   sync.Mutex
+	lastReload time.Time
+	reloading  atomic.Bool
+	reloadWG   sync.WaitGroup // pending reloads, used by tests
+}
+
+// New constructs a new lookup processor.
+func New(cfg *common.Config) (processors.Processor, error) {
+	c := defaultConfig()
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, errors.Wrap(err, "fail to unpack the lookup configuration")
+	}
+
+	file, err := openLookupFile(c)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load the lookup file")
+	}
+
+	p := &processor{
+		Config: c,
+		log:    logp.NewLogger(logName).With("instance_id", int(instanceID.Inc())),
+		clock:  time.Now,
+		file:   file,
+	}
+	p.lastReload = p.clock()
+	return p, nil
+}
+
+func (p *processor) Run(event *beat.Event) (*beat.Event, error) {
+	p.reloadIfDue()
+
+	if err := p.enrich(event); err != nil {
+		p.log.Debugf("Lookup processor failed: %v", err)
+		common.AddTags(event.Fields, p.TagOnFailure)
+	}
+	return event, nil
+}
+
+func (p *processor) enrich(event *beat.Event) error {
+	v, err := event.GetValue(p.Field)
+	if err != nil {
+		if p.IgnoreMissing {
+			return nil
+		}
+		return fmt.Errorf("lookup field %v not found", p.Field)
+	}
+
+	var key string
+	switch v := v.(type) {
+	case string:
+		key = v
+	case fmt.Stringer:
+		key = v.String()
+	default:
+		key = fmt.Sprint(v)
+	}
+
+	row, found := p.file.current().get(key)
+	if !found {
+		return nil
+	}
+
+	if len(p.columnsFlat) == 0 {
+		return p.put(event, p.Target, row.Clone())
+	}
+	for column, target := range p.columnsFlat {
+		value, err := row.GetValue(column)
+		if err != nil {
+			continue
+		}
+		if m, ok := value.(common.MapStr); ok {
+			value = m.Clone()
+		}
+		if err := p.put(event, target, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *processor) put(event *beat.Event, key string, value interface{}) error {
+	if !p.OverwriteKeys {
+		if _, err := event.GetValue(key); err == nil {
+			return fmt.Errorf("target field %v already exists", key)
+		}
+	}
+	_, err := event.PutValue(key, value)
+	return err
+}
+
+// reloadIfDue checks the lookup file for changes at most once per reload
+// interval. The check runs in the background, events are enriched using the
+// current table until the new version of the file has been loaded.
+func (p *processor) reloadIfDue() {
+	if p.ReloadInterval <= 0 {
+		return
+	}
+
+	now := p.clock()
+	p.reloadMu.Lock()
+	if now.Sub(p.lastReload) < p.ReloadInterval {
+		p.reloadMu.Unlock()
+		return
+	}
+	p.lastReload = now
+	p.reloadMu.Unlock()
+
+	if !p.reloading.CAS(false, true) {
+		return
+	}
+	p.reloadWG.Add(1)
+	go func() {
+		defer p.reloadWG.Done()
+		defer p.reloading.Store(false)
+		p.reload()
+	}()
+}
+
+// reload loads the lookup file if it has changed on disk.
+func (p *processor) reload() {
+	reloaded, err := p.file.reload()
+	if err != nil {
+		p.log.Warnf("Failed to reload lookup file %v, keeping the previous version: %v", p.File, err)
+		return
+	}
+	if reloaded {
+		p.log.Infof("Reloaded lookup file %v with %v entries", p.File, p.file.current().len())
+	}
+}
+
+func (p *processor) String() string {
+	return fmt.Sprintf("lookup=[file=%v, format=%v, match=%v, field=%v, target=%v, columns=%+v]",
+		p.File, p.Format, p.Match, p.Field, p.Target, p.columnsFlat)
+}
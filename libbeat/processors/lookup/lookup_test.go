@@ -0,0 +1,354 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package lookup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/processors/script/javascript"
+
+	_ "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor"
+	_ "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/require"
+)
+
+const hostsCSV = `hostname,owner,criticality,tier
+web-01,team-web,high,1
+db-01, team-data ,critical,0
+`
+
+const networksJSON = `[
+  {"network": "10.0.0.0/8", "zone": "internal", "site": {"name": "any"}},
+  {"network": "10.1.0.0/16", "zone": "dmz", "site": {"name": "ams", "rack": 4}},
+  {"network": "10.1.2.3", "zone": "bastion"},
+  {"network": "2001:db8::/32", "zone": "v6"}
+]`
+
+const servicesJSON = `{
+  "checkout": {"tier": 1, "owner": "payments"},
+  "search": {"tier": 2, "owner": "discovery"}
+}`
+
+func TestLookup(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"hosts.csv":     hostsCSV,
+		"networks.json": networksJSON,
+		"services.json": servicesJSON,
+	})
+	defer os.RemoveAll(dir)
+
+	cases := map[string]struct {
+		config   common.MapStr
+		fields   common.MapStr
+		expected common.MapStr
+	}{
+		"csv columns": {
+			config: common.MapStr{
+				"file":    "hosts.csv",
+				"key":     "hostname",
+				"field":   "host.name",
+				"columns": common.MapStr{"owner": "host.owner", "criticality": "labels.criticality"},
+			},
+			fields: common.MapStr{"host": common.MapStr{"name": "db-01"}},
+			expected: common.MapStr{
+				"host":   common.MapStr{"name": "db-01", "owner": "team-data "},
+				"labels": common.MapStr{"criticality": "critical"},
+			},
+		},
+		"csv target": {
+			config: common.MapStr{
+				"file":   "hosts.csv",
+				"key":    "hostname",
+				"field":  "host.name",
+				"target": "cmdb",
+			},
+			fields: common.MapStr{"host": common.MapStr{"name": "web-01"}},
+			expected: common.MapStr{
+				"host": common.MapStr{"name": "web-01"},
+				"cmdb": common.MapStr{"owner": "team-web", "criticality": "high", "tier": "1"},
+			},
+		},
+		"not found": {
+			config: common.MapStr{
+				"file":   "hosts.csv",
+				"key":    "hostname",
+				"field":  "host.name",
+				"target": "cmdb",
+			},
+			fields:   common.MapStr{"host": common.MapStr{"name": "unknown"}},
+			expected: common.MapStr{"host": common.MapStr{"name": "unknown"}},
+		},
+		"json object": {
+			config: common.MapStr{
+				"file":    "services.json",
+				"field":   "service.name",
+				"columns": common.MapStr{"owner": "service.owner", "tier": "service.tier"},
+			},
+			fields: common.MapStr{"service": common.MapStr{"name": "checkout"}},
+			expected: common.MapStr{
+				"service": common.MapStr{"name": "checkout", "owner": "payments", "tier": int64(1)},
+			},
+		},
+		"cidr most specific network": {
+			config: common.MapStr{
+				"file":   "networks.json",
+				"key":    "network",
+				"match":  "cidr",
+				"field":  "source.ip",
+				"target": "source.network",
+			},
+			fields: common.MapStr{"source": common.MapStr{"ip": "10.1.200.7"}},
+			expected: common.MapStr{"source": common.MapStr{
+				"ip":      "10.1.200.7",
+				"network": common.MapStr{"zone": "dmz", "site": common.MapStr{"name": "ams", "rack": int64(4)}},
+			}},
+		},
+		"cidr single address": {
+			config: common.MapStr{
+				"file":    "networks.json",
+				"key":     "network",
+				"match":   "cidr",
+				"field":   "source.ip",
+				"columns": common.MapStr{"zone": "network.zone", "site.name": "network.site"},
+			},
+			fields: common.MapStr{"source": common.MapStr{"ip": "10.1.2.3"}},
+			expected: common.MapStr{
+				"source":  common.MapStr{"ip": "10.1.2.3"},
+				"network": common.MapStr{"zone": "bastion"},
+			},
+		},
+		"cidr ipv6": {
+			config: common.MapStr{
+				"file":    "networks.json",
+				"key":     "network",
+				"match":   "cidr",
+				"field":   "source.ip",
+				"columns": common.MapStr{"zone": "network.zone"},
+			},
+			fields: common.MapStr{"source": common.MapStr{"ip": "2001:db8::1"}},
+			expected: common.MapStr{
+				"source":  common.MapStr{"ip": "2001:db8::1"},
+				"network": common.MapStr{"zone": "v6"},
+			},
+		},
+		"existing target is kept": {
+			config: common.MapStr{
+				"file":           "hosts.csv",
+				"key":            "hostname",
+				"field":          "host.name",
+				"columns":        common.MapStr{"owner": "host.owner"},
+				"tag_on_failure": []string{"_lookup_failure"},
+			},
+			fields: common.MapStr{"host": common.MapStr{"name": "web-01", "owner": "someone"}},
+			expected: common.MapStr{
+				"host": common.MapStr{"name": "web-01", "owner": "someone"},
+				"tags": []string{"_lookup_failure"},
+			},
+		},
+		"overwrite keys": {
+			config: common.MapStr{
+				"file":           "hosts.csv",
+				"key":            "hostname",
+				"field":          "host.name",
+				"columns":        common.MapStr{"owner": "host.owner"},
+				"overwrite_keys": true,
+			},
+			fields:   common.MapStr{"host": common.MapStr{"name": "web-01", "owner": "someone"}},
+			expected: common.MapStr{"host": common.MapStr{"name": "web-01", "owner": "team-web"}},
+		},
+		"missing field": {
+			config: common.MapStr{
+				"file":           "hosts.csv",
+				"key":            "hostname",
+				"field":          "host.name",
+				"target":         "cmdb",
+				"tag_on_failure": []string{"_lookup_failure"},
+			},
+			fields:   common.MapStr{},
+			expected: common.MapStr{"tags": []string{"_lookup_failure"}},
+		},
+		"ignore missing field": {
+			config: common.MapStr{
+				"file":           "hosts.csv",
+				"key":            "hostname",
+				"field":          "host.name",
+				"target":         "cmdb",
+				"ignore_missing": true,
+				"tag_on_failure": []string{"_lookup_failure"},
+			},
+			fields:   common.MapStr{},
+			expected: common.MapStr{},
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			test.config["file"] = filepath.Join(dir, test.config["file"].(string))
+			p, err := New(common.MustNewConfigFrom(test.config))
+			require.NoError(t, err)
+
+			out, err := p.Run(&beat.Event{Fields: test.fields})
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, out.Fields)
+		})
+	}
+}
+
+func TestLookupResultsAreCopied(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"networks.json": networksJSON})
+	defer os.RemoveAll(dir)
+
+	p, err := New(common.MustNewConfigFrom(common.MapStr{
+		"file":   filepath.Join(dir, "networks.json"),
+		"key":    "network",
+		"match":  "cidr",
+		"field":  "ip",
+		"target": "network",
+	}))
+	require.NoError(t, err)
+
+	first, err := p.Run(&beat.Event{Fields: common.MapStr{"ip": "10.1.0.1"}})
+	require.NoError(t, err)
+	first.PutValue("network.site.name", "changed")
+
+	second, err := p.Run(&beat.Event{Fields: common.MapStr{"ip": "10.1.0.1"}})
+	require.NoError(t, err)
+	name, _ := second.GetValue("network.site.name")
+	assert.Equal(t, "ams", name)
+}
+
+func TestLookupReload(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"hosts.csv": hostsCSV})
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "hosts.csv")
+
+	p, err := New(common.MustNewConfigFrom(common.MapStr{
+		"file":            path,
+		"key":             "hostname",
+		"field":           "host.name",
+		"columns":         common.MapStr{"owner": "host.owner"},
+		"reload_interval": "1m",
+	}))
+	require.NoError(t, err)
+	lookup := p.(*processor)
+	now := time.Now()
+	lookup.clock = func() time.Time { return now }
+
+	owner := func() interface{} {
+		out, err := p.Run(&beat.Event{Fields: common.MapStr{"host": common.MapStr{"name": "web-01"}}})
+		require.NoError(t, err)
+		v, _ := out.GetValue("host.owner")
+		return v
+	}
+	assert.Equal(t, "team-web", owner())
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("hostname,owner\nweb-01,team-platform\n"), 0644))
+
+	// The file is checked for changes once per reload interval. The reload
+	// runs in the background, the event triggering it is enriched with the
+	// previous version of the file.
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, "team-web", owner())
+	lookup.reloadWG.Wait()
+	assert.Equal(t, "team-web", owner())
+	now = now.Add(time.Minute)
+	assert.Equal(t, "team-web", owner())
+	lookup.reloadWG.Wait()
+	assert.Equal(t, "team-platform", owner())
+
+	// An invalid file does not replace the loaded table.
+	require.NoError(t, ioutil.WriteFile(path, []byte("name,owner\n"), 0644))
+	now = now.Add(time.Minute)
+	assert.Equal(t, "team-platform", owner())
+	lookup.reloadWG.Wait()
+	assert.Equal(t, "team-platform", owner())
+}
+
+func TestLookupFromJavaScript(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"hosts.csv": hostsCSV})
+	defer os.RemoveAll(dir)
+
+	script := `
+var processor = require('processor');
+
+var cmdb = new processor.Lookup({
+    file: ` + strconv.Quote(filepath.Join(dir, "hosts.csv")) + `,
+    key: "hostname",
+    field: "host.name",
+    columns: {owner: "host.owner"},
+});
+
+function process(evt) {
+    cmdb.Run(evt);
+}
+`
+
+	p, err := javascript.NewFromConfig(javascript.Config{Source: script}, nil)
+	require.NoError(t, err)
+
+	out, err := p.Run(&beat.Event{Fields: common.MapStr{"host": common.MapStr{"name": "web-01"}}})
+	require.NoError(t, err)
+	owner, _ := out.GetValue("host.owner")
+	assert.Equal(t, "team-web", owner)
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"hosts.csv":    hostsCSV,
+		"hosts.txt":    hostsCSV,
+		"invalid.json": `{"a": 1}`,
+		"networks.csv": "network,zone\nnot-a-network,x\n",
+	})
+	defer os.RemoveAll(dir)
+
+	cases := map[string]common.MapStr{
+		"missing file":       {"file": "missing.csv", "key": "hostname", "field": "host.name", "target": "cmdb"},
+		"unknown format":     {"file": "hosts.txt", "key": "hostname", "field": "host.name", "target": "cmdb"},
+		"csv without key":    {"file": "hosts.csv", "field": "host.name", "target": "cmdb"},
+		"unknown key column": {"file": "hosts.csv", "key": "ip", "field": "host.name", "target": "cmdb"},
+		"no target":          {"file": "hosts.csv", "key": "hostname", "field": "host.name"},
+		"invalid match":      {"file": "hosts.csv", "key": "hostname", "field": "host.name", "target": "cmdb", "match": "prefix"},
+		"invalid json rows":  {"file": "invalid.json", "field": "host.name", "target": "cmdb"},
+		"invalid network":    {"file": "networks.csv", "key": "network", "match": "cidr", "field": "ip", "target": "cmdb"},
+	}
+	for name, config := range cases {
+		t.Run(name, func(t *testing.T) {
+			config["file"] = filepath.Join(dir, config["file"].(string))
+			_, err := New(common.MustNewConfigFrom(config))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "lookup")
+	require.NoError(t, err)
+	for name, content := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	return dir
+}
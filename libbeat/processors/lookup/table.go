@@ -0,0 +1,260 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package lookup
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// table maps keys to the rows of a lookup file.
+type table struct {
+	exact map[string]common.MapStr
+	v4    cidrTable
+	v6    cidrTable
+}
+
+// cidrTable contains the networks of one address family, grouped by prefix
+// length.
+type cidrTable struct {
+	lengths  []int // Prefix lengths in use, longest first.
+	networks map[int]map[string]common.MapStr
+}
+
+// loadTable reads a lookup file.
+func loadTable(c Config) (*table, error) {
+	data, err := ioutil.ReadFile(c.File)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows map[string]common.MapStr
+	switch c.Format {
+	case "csv":
+		rows, err = parseCSV(data, []rune(c.Separator)[0], c.Key)
+	default:
+		rows, err = parseJSON(data, c.Key)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse lookup file %v", c.File)
+	}
+
+	if c.Match == matchExact {
+		return &table{exact: rows}, nil
+	}
+
+	t := &table{}
+	for key, row := range rows {
+		if err := t.addNetwork(key, row); err != nil {
+			return nil, errors.Wrapf(err, "invalid key in lookup file %v", c.File)
+		}
+	}
+	return t, nil
+}
+
+func parseCSV(data []byte, separator rune, key string) (map[string]common.MapStr, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = separator
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the header")
+	}
+	keyIdx := -1
+	for i, name := range header {
+		if name == key {
+			keyIdx = i
+		}
+	}
+	if keyIdx < 0 {
+		return nil, fmt.Errorf("key column '%v' not found", key)
+	}
+
+	rows := map[string]common.MapStr{}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		row := common.MapStr{}
+		for i, value := range record {
+			if i != keyIdx {
+				row[header[i]] = value
+			}
+		}
+		rows[record[keyIdx]] = row
+	}
+}
+
+// parseJSON reads either an object mapping keys to rows, or an array of rows
+// containing the key.
+func parseJSON(data []byte, key string) (map[string]common.MapStr, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	rows := map[string]common.MapStr{}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, row := range v {
+			m, ok := row.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("value of key '%v' is not an object", k)
+			}
+			rows[k] = toMapStr(m)
+		}
+	case []interface{}:
+		if key == "" {
+			return nil, errors.New("key is required for arrays of objects")
+		}
+		for i, row := range v {
+			m, ok := row.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("element %v is not an object", i)
+			}
+			k, ok := m[key]
+			if !ok {
+				return nil, fmt.Errorf("element %v has no key field '%v'", i, key)
+			}
+			delete(m, key)
+			rows[fmt.Sprint(k)] = toMapStr(m)
+		}
+	default:
+		return nil, errors.New("expected an object or an array of objects")
+	}
+	return rows, nil
+}
+
+// toMapStr converts the decoded JSON objects to MapStr and the numbers to
+// int64 or float64.
+func toMapStr(m map[string]interface{}) common.MapStr {
+	out := make(common.MapStr, len(m))
+	for k, v := range m {
+		out[k] = convertJSON(v)
+	}
+	return out
+}
+
+func convertJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return toMapStr(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = convertJSON(v[i])
+		}
+		return v
+	case json.Number:
+		if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
+
+func (t *table) addNetwork(key string, row common.MapStr) error {
+	var network *net.IPNet
+	if ip := net.ParseIP(key); ip != nil {
+		bits := 128
+		if ip.To4() != nil {
+			bits = 32
+		}
+		network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	} else {
+		var err error
+		if _, network, err = net.ParseCIDR(key); err != nil {
+			return err
+		}
+	}
+
+	ones, bits := network.Mask.Size()
+	ct := &t.v6
+	if bits == 32 {
+		ct = &t.v4
+	}
+	if ct.networks == nil {
+		ct.networks = map[int]map[string]common.MapStr{}
+	}
+	networks, ok := ct.networks[ones]
+	if !ok {
+		networks = map[string]common.MapStr{}
+		ct.networks[ones] = networks
+		ct.lengths = append(ct.lengths, ones)
+		sort.Sort(sort.Reverse(sort.IntSlice(ct.lengths)))
+	}
+	networks[network.IP.Mask(network.Mask).String()] = row
+	return nil
+}
+
+// get returns the row of the key. In cidr mode, the row of the most specific
+// network containing the address is returned.
+func (t *table) get(value string) (common.MapStr, bool) {
+	if t.exact != nil {
+		row, found := t.exact[value]
+		return row, found
+	}
+
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, false
+	}
+	ct, bits := &t.v6, 128
+	if v4 := ip.To4(); v4 != nil {
+		ct, bits, ip = &t.v4, 32, v4
+	}
+	for _, ones := range ct.lengths {
+		if row, found := ct.networks[ones][ip.Mask(net.CIDRMask(ones, bits)).String()]; found {
+			return row, true
+		}
+	}
+	return nil, false
+}
+
+func (t *table) len() int {
+	if t.exact != nil {
+		return len(t.exact)
+	}
+	n := 0
+	for _, ct := range []cidrTable{t.v4, t.v6} {
+		for _, networks := range ct.networks {
+			n += len(networks)
+		}
+	}
+	return n
+}
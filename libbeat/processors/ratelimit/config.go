@@ -0,0 +1,128 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type config struct {
+	Limit           rate     `config:"limit"`
+	Fields          []string `config:"fields"`
+	BurstMultiplier float64  `config:"burst_multiplier" validate:"min=1"`
+	Action          action   `config:"action"`
+	Tag             string   `config:"tag"`
+}
+
+// rate is the number of events allowed per time unit.
+type rate struct {
+	events float64
+	unit   time.Duration
+}
+
+type action uint8
+
+const (
+	actionDrop action = iota
+	actionTag
+)
+
+var actionNames = map[string]action{
+	"drop": actionDrop,
+	"tag":  actionTag,
+}
+
+var rateUnits = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+}
+
+func defaultConfig() config {
+	return config{
+		BurstMultiplier: 1,
+		Action:          actionDrop,
+		Tag:             "rate_limited",
+	}
+}
+
+// Validate checks that a limit has been configured.
+func (c *config) Validate() error {
+	if c.Limit.events == 0 {
+		return errors.New("limit is required")
+	}
+	return nil
+}
+
+// Unpack parses a rate in the format <number>/<unit>, with the unit being one
+// of s, m or h.
+func (r *rate) Unpack(s string) error {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid rate '%v', expected format <number>/<unit>", s)
+	}
+
+	n, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil || n <= 0 {
+		return fmt.Errorf("invalid number of events in rate '%v'", s)
+	}
+	unit, ok := rateUnits[strings.TrimSpace(parts[1])]
+	if !ok {
+		return fmt.Errorf("invalid unit in rate '%v', expected one of s, m, h", s)
+	}
+
+	*r = rate{events: n, unit: unit}
+	return nil
+}
+
+// perSecond returns the number of events allowed per second.
+func (r rate) perSecond() float64 {
+	return r.events / r.unit.Seconds()
+}
+
+func (r rate) String() string {
+	for name, unit := range rateUnits {
+		if unit == r.unit {
+			return strconv.FormatFloat(r.events, 'f', -1, 64) + "/" + name
+		}
+	}
+	return strconv.FormatFloat(r.perSecond(), 'f', -1, 64) + "/s"
+}
+
+// Unpack validates the action name.
+func (a *action) Unpack(s string) error {
+	v, ok := actionNames[strings.ToLower(s)]
+	if !ok {
+		return fmt.Errorf("invalid action '%v', expected drop or tag", s)
+	}
+	*a = v
+	return nil
+}
+
+func (a action) String() string {
+	for name, v := range actionNames {
+		if v == a {
+			return name
+		}
+	}
+	return "unknown"
+}
@@ -0,0 +1,136 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor"
+)
+
+const (
+	processorName = "rate_limit"
+	logName       = "processor." + processorName
+
+	// gcInterval is the minimum time between two garbage collections of
+	// refilled buckets.
+	gcInterval = time.Minute
+)
+
+// instanceID is used to assign each instance a unique monitoring namespace.
+var instanceID = atomic.MakeUint32(0)
+
+func init() {
+	processors.RegisterPlugin(processorName, New)
+	jsprocessor.RegisterPlugin("RateLimit", New)
+}
+
+type rateLimit struct {
+	config  config
+	fields  []string
+	buckets *tokenBucket
+	log     *logp.Logger
+
+	// clock returns the current time, it is replaced in tests.
+	clock func() time.Time
+
+	dropped *monitoring.Int
+	tagged  *monitoring.Int
+}
+
+// New constructs a new rate_limit processor.
+func New(cfg *common.Config) (processors.Processor, error) {
+	c := defaultConfig()
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, errors.Wrap(err, "fail to unpack the rate_limit configuration")
+	}
+
+	// Logging and metrics (each processor instance has a unique ID).
+	var (
+		id      = int(instanceID.Inc())
+		log     = logp.NewLogger(logName).With("instance_id", id)
+		metrics = monitoring.Default.NewRegistry(logName+"."+strconv.Itoa(id), monitoring.DoNotReport)
+	)
+
+	// The fields are sorted, so the same values always map to the same
+	// bucket.
+	fields := common.MakeStringSet(c.Fields...).ToSlice()
+
+	return &rateLimit{
+		config:  c,
+		fields:  fields,
+		buckets: newTokenBucket(c.Limit.perSecond(), c.Limit.events*c.BurstMultiplier, gcInterval),
+		log:     log,
+		clock:   time.Now,
+		dropped: monitoring.NewInt(metrics, "dropped"),
+		tagged:  monitoring.NewInt(metrics, "tagged"),
+	}, nil
+}
+
+// Run drops or tags the event if the bucket of the event has been exhausted.
+func (p *rateLimit) Run(event *beat.Event) (*beat.Event, error) {
+	if p.buckets.allow(p.key(event), p.clock()) {
+		return event, nil
+	}
+
+	if p.config.Action == actionTag {
+		p.tagged.Inc()
+		if err := common.AddTags(event.Fields, []string{p.config.Tag}); err != nil {
+			return event, err
+		}
+		return event, nil
+	}
+
+	p.dropped.Inc()
+	p.log.Debug("Event dropped by rate limit")
+	return nil, nil
+}
+
+// key hashes the values of the configured fields. Events without any of
+// the fields share the same bucket.
+func (p *rateLimit) key(event *beat.Event) uint64 {
+	if len(p.fields) == 0 {
+		return 0
+	}
+
+	h := xxhash.New()
+	for _, k := range p.fields {
+		v, err := event.GetValue(k)
+		if err != nil {
+			v = nil
+		}
+		fmt.Fprintf(h, "|%v|%v", k, v)
+	}
+	return h.Sum64()
+}
+
+func (p *rateLimit) String() string {
+	return fmt.Sprintf("%v=[limit=[%v], fields=%v, action=%v]",
+		processorName, p.config.Limit, p.fields, p.config.Action)
+}
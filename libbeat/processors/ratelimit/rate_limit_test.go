@@ -0,0 +1,177 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+func TestNew(t *testing.T) {
+	cases := map[string]struct {
+		config common.MapStr
+		err    bool
+	}{
+		"per second": {
+			config: common.MapStr{"limit": "10/s"},
+		},
+		"per hour with fields": {
+			config: common.MapStr{"limit": "3600/h", "fields": []string{"host.name"}},
+		},
+		"missing limit": {
+			config: common.MapStr{},
+			err:    true,
+		},
+		"invalid unit": {
+			config: common.MapStr{"limit": "10/d"},
+			err:    true,
+		},
+		"invalid number": {
+			config: common.MapStr{"limit": "-1/s"},
+			err:    true,
+		},
+		"invalid action": {
+			config: common.MapStr{"limit": "10/s", "action": "block"},
+			err:    true,
+		},
+		"burst multiplier below one": {
+			config: common.MapStr{"limit": "10/s", "burst_multiplier": 0.5},
+			err:    true,
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(common.MustNewConfigFrom(test.config))
+			if test.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := map[string]struct {
+		config common.MapStr
+		// events contains the offset of each event from the start, and the
+		// value of the key field.
+		events []struct {
+			offset time.Duration
+			key    string
+		}
+		allowed []bool
+	}{
+		"limit": {
+			config: common.MapStr{"limit": "2/s"},
+			events: []struct {
+				offset time.Duration
+				key    string
+			}{{0, "a"}, {0, "a"}, {0, "a"}, {500 * time.Millisecond, "a"}, {time.Second, "a"}},
+			allowed: []bool{true, true, false, true, true},
+		},
+		"burst": {
+			config: common.MapStr{"limit": "1/s", "burst_multiplier": 3},
+			events: []struct {
+				offset time.Duration
+				key    string
+			}{{0, "a"}, {0, "a"}, {0, "a"}, {0, "a"}},
+			allowed: []bool{true, true, true, false},
+		},
+		"per key": {
+			config: common.MapStr{"limit": "1/m", "fields": []string{"key"}},
+			events: []struct {
+				offset time.Duration
+				key    string
+			}{{0, "a"}, {0, "b"}, {time.Second, "a"}, {time.Second, "b"}, {time.Minute, "a"}},
+			allowed: []bool{true, true, false, false, true},
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			p, err := New(common.MustNewConfigFrom(test.config))
+			require.NoError(t, err)
+
+			rl := p.(*rateLimit)
+			var now time.Time
+			rl.clock = func() time.Time { return now }
+
+			for i, e := range test.events {
+				now = start.Add(e.offset)
+				out, err := p.Run(&beat.Event{Fields: common.MapStr{"key": e.key}})
+				require.NoError(t, err)
+				assert.Equal(t, test.allowed[i], out != nil, "event %d", i)
+			}
+			assert.Equal(t, int64(len(test.events)-countTrue(test.allowed)), rl.dropped.Get())
+		})
+	}
+}
+
+func TestRateLimitTag(t *testing.T) {
+	p, err := New(common.MustNewConfigFrom(common.MapStr{
+		"limit":  "1/s",
+		"action": "tag",
+	}))
+	require.NoError(t, err)
+	rl := p.(*rateLimit)
+	rl.clock = func() time.Time { return time.Time{} }
+
+	first, err := p.Run(&beat.Event{Fields: common.MapStr{}})
+	require.NoError(t, err)
+	assert.Equal(t, common.MapStr{}, first.Fields)
+
+	second, err := p.Run(&beat.Event{Fields: common.MapStr{}})
+	require.NoError(t, err)
+	require.NotNil(t, second)
+	assert.Equal(t, common.MapStr{"tags": []string{"rate_limited"}}, second.Fields)
+	assert.Equal(t, int64(1), rl.tagged.Get())
+	assert.Equal(t, int64(0), rl.dropped.Get())
+}
+
+func TestTokenBucketGC(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newTokenBucket(1.0/60, 1, time.Minute)
+
+	assert.True(t, b.allow(1, start))
+	assert.True(t, b.allow(2, start.Add(30*time.Second)))
+	assert.Equal(t, 2, b.len())
+
+	// Bucket 1 is full again and is removed, bucket 2 is not.
+	assert.True(t, b.allow(3, start.Add(70*time.Second)))
+	assert.Equal(t, 2, b.len())
+}
+
+func countTrue(values []bool) int {
+	n := 0
+	for _, v := range values {
+		if v {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,108 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket tracks the available tokens of one bucket per key. Buckets
+// fill up at the configured rate, up to their capacity. Each allowed event
+// takes one token.
+type tokenBucket struct {
+	rate     float64
+	capacity float64
+
+	mu      sync.Mutex
+	buckets map[uint64]*bucket
+
+	gcInterval time.Duration
+	lastGC     time.Time
+}
+
+type bucket struct {
+	tokens      float64
+	lastUpdated time.Time
+}
+
+func newTokenBucket(rate, capacity float64, gcInterval time.Duration) *tokenBucket {
+	return &tokenBucket{
+		rate:       rate,
+		capacity:   capacity,
+		buckets:    map[uint64]*bucket{},
+		gcInterval: gcInterval,
+	}
+}
+
+// allow takes a token from the bucket of the key. It returns false if the
+// bucket is empty.
+func (t *tokenBucket) allow(key uint64, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.gc(now)
+
+	b, ok := t.buckets[key]
+	if !ok {
+		b = &bucket{tokens: t.capacity, lastUpdated: now}
+		t.buckets[key] = b
+	}
+	t.replenish(b, now)
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (t *tokenBucket) replenish(b *bucket, now time.Time) {
+	elapsed := now.Sub(b.lastUpdated).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	b.tokens += elapsed * t.rate
+	if b.tokens > t.capacity {
+		b.tokens = t.capacity
+	}
+	b.lastUpdated = now
+}
+
+// gc removes the buckets that have been refilled completely. A full bucket
+// behaves the same as a new bucket, so removing it does not change the
+// limits.
+func (t *tokenBucket) gc(now time.Time) {
+	if now.Sub(t.lastGC) < t.gcInterval {
+		return
+	}
+	t.lastGC = now
+
+	for key, b := range t.buckets {
+		t.replenish(b, now)
+		if b.tokens >= t.capacity {
+			delete(t.buckets, key)
+		}
+	}
+}
+
+func (t *tokenBucket) len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.buckets)
+}
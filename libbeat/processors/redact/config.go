@@ -0,0 +1,100 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type config struct {
+	Fields    []string        `config:"fields"`
+	Detectors []string        `config:"detectors"`
+	Patterns  []patternConfig `config:"patterns"`
+	Action    action          `config:"action"`
+	Mask      string          `config:"mask"`
+	HashKey   string          `config:"hash_key"`
+}
+
+type patternConfig struct {
+	Name    string `config:"name" validate:"required"`
+	Pattern string `config:"pattern" validate:"required"`
+}
+
+type action uint8
+
+const (
+	actionMask action = iota
+	actionRemove
+	actionHash
+)
+
+var actionNames = map[string]action{
+	"mask":   actionMask,
+	"remove": actionRemove,
+	"hash":   actionHash,
+}
+
+func defaultConfig() config {
+	return config{
+		Action: actionMask,
+		Mask:   "[REDACTED]",
+	}
+}
+
+// Validate checks that the detectors exist, that the custom patterns compile
+// and that a key is configured for hashing.
+func (c *config) Validate() error {
+	for _, name := range c.Detectors {
+		if _, ok := builtinDetectors[name]; !ok {
+			return fmt.Errorf("unknown detector '%v', expected one of %v",
+				name, strings.Join(builtinDetectorNames(), ", "))
+		}
+	}
+	for _, p := range c.Patterns {
+		if _, err := regexp.Compile(p.Pattern); err != nil {
+			return errors.Wrapf(err, "invalid pattern '%v'", p.Name)
+		}
+	}
+	if c.Action == actionHash && c.HashKey == "" {
+		return errors.New("hash_key is required for the hash action")
+	}
+	return nil
+}
+
+// Unpack validates the action name.
+func (a *action) Unpack(s string) error {
+	v, ok := actionNames[strings.ToLower(s)]
+	if !ok {
+		return fmt.Errorf("invalid action '%v', expected one of mask, remove, hash", s)
+	}
+	*a = v
+	return nil
+}
+
+func (a action) String() string {
+	for name, v := range actionNames {
+		if v == a {
+			return name
+		}
+	}
+	return "unknown"
+}
@@ -0,0 +1,124 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package redact
+
+import (
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// detector finds sensitive values in strings. The regular expression selects
+// the candidates, the optional validate function rejects false positives.
+type detector struct {
+	name     string
+	re       *regexp.Regexp
+	validate func(match string) bool
+}
+
+var builtinDetectors = map[string]detector{
+	"credit_card": {
+		re:       regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+		validate: luhnValid,
+	},
+	"email": {
+		re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	},
+	"ipv4": {
+		re: regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\.){3}(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\b`),
+	},
+	"ipv6": {
+		re:       regexp.MustCompile(`(?:\b[0-9A-Fa-f]{1,4}|:)(?::(?:(?:\d{1,3}\.){3}\d{1,3}|[0-9A-Fa-f]{0,4})){1,7}`),
+		validate: ipv6Valid,
+	},
+	"jwt": {
+		re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+	},
+	"aws_access_key": {
+		re: regexp.MustCompile(`\b(?:AKIA|ASIA|AIDA|AROA)[0-9A-Z]{16}\b`),
+	},
+}
+
+func builtinDetectorNames() []string {
+	names := make([]string, 0, len(builtinDetectors))
+	for name := range builtinDetectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newDetectors returns the configured built-in detectors followed by the
+// custom patterns. The config must have been validated.
+func newDetectors(c config) []detector {
+	var detectors []detector
+	for _, name := range common.MakeStringSet(c.Detectors...).ToSlice() {
+		d := builtinDetectors[name]
+		d.name = name
+		detectors = append(detectors, d)
+	}
+	for _, p := range c.Patterns {
+		detectors = append(detectors, detector{name: p.Name, re: regexp.MustCompile(p.Pattern)})
+	}
+	return detectors
+}
+
+// replace calls fn for every valid match in s, and replaces the match with
+// the returned string.
+func (d detector) replace(s string, fn func(string) string) (string, bool) {
+	found := false
+	out := d.re.ReplaceAllStringFunc(s, func(match string) string {
+		if d.validate != nil && !d.validate(match) {
+			return match
+		}
+		found = true
+		return fn(match)
+	})
+	return out, found
+}
+
+// luhnValid checks the digits of a card number with the Luhn algorithm.
+func luhnValid(s string) bool {
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(s)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+func ipv6Valid(s string) bool {
+	ip := net.ParseIP(s)
+	return ip != nil && !ip.IsUnspecified() && strings.Contains(s, ":")
+}
@@ -0,0 +1,171 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor"
+)
+
+const processorName = "redact"
+
+func init() {
+	processors.RegisterPlugin(processorName, New)
+	jsprocessor.RegisterPlugin("Redact", New)
+}
+
+type redact struct {
+	config    config
+	detectors []detector
+}
+
+// New constructs a new redact processor.
+func New(cfg *common.Config) (processors.Processor, error) {
+	c := defaultConfig()
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, errors.Wrap(err, "fail to unpack the redact configuration")
+	}
+
+	// All built-in detectors are enabled for the configured fields unless the
+	// detectors are listed explicitly, an empty list only enables the custom
+	// patterns. Scanning every string of the event with all the detectors is
+	// too expensive and prone to false positives, so it must be opted in by
+	// listing the detectors.
+	if !cfg.HasField("detectors") {
+		if len(c.Fields) == 0 {
+			return nil, errors.New("redact requires either fields or an explicit list of detectors")
+		}
+		c.Detectors = builtinDetectorNames()
+	}
+	if len(c.Detectors) == 0 && len(c.Patterns) == 0 {
+		return nil, errors.New("redact requires at least one detector or pattern")
+	}
+
+	return &redact{
+		config:    c,
+		detectors: newDetectors(c),
+	}, nil
+}
+
+// Run redacts the sensitive values found in the configured fields, or in all
+// string values of the event if no fields are configured.
+func (p *redact) Run(event *beat.Event) (*beat.Event, error) {
+	if len(p.config.Fields) == 0 {
+		p.redactMap(event.Fields)
+		return event, nil
+	}
+
+	for _, field := range p.config.Fields {
+		v, err := event.GetValue(field)
+		if err != nil {
+			continue
+		}
+
+		v, remove := p.redactValue(v)
+		if remove {
+			err = event.Delete(field)
+		} else {
+			_, err = event.PutValue(field, v)
+		}
+		if err != nil {
+			return event, errors.Wrapf(err, "failed to redact field '%v'", field)
+		}
+	}
+	return event, nil
+}
+
+// redactValue redacts strings, and the strings nested in maps and lists. It
+// returns true if the value must be removed.
+func (p *redact) redactValue(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case string:
+		return p.redactString(v)
+	case common.MapStr:
+		p.redactMap(v)
+	case map[string]interface{}:
+		p.redactMap(v)
+	case []interface{}:
+		// The list can be shared with other events, build a new one instead
+		// of modifying it in place.
+		out := make([]interface{}, 0, len(v))
+		for _, elem := range v {
+			if elem, remove := p.redactValue(elem); !remove {
+				out = append(out, elem)
+			}
+		}
+		return out, false
+	case []string:
+		out := make([]string, 0, len(v))
+		for _, elem := range v {
+			if elem, remove := p.redactString(elem); !remove {
+				out = append(out, elem.(string))
+			}
+		}
+		return out, false
+	}
+	return v, false
+}
+
+func (p *redact) redactMap(m map[string]interface{}) {
+	for k, v := range m {
+		if v, remove := p.redactValue(v); remove {
+			delete(m, k)
+		} else {
+			m[k] = v
+		}
+	}
+}
+
+func (p *redact) redactString(s string) (interface{}, bool) {
+	for _, d := range p.detectors {
+		var found bool
+		s, found = d.replace(s, p.replacement)
+		if found && p.config.Action == actionRemove {
+			return nil, true
+		}
+	}
+	return s, false
+}
+
+// replacement returns the string that replaces a sensitive value.
+func (p *redact) replacement(match string) string {
+	if p.config.Action == actionHash {
+		mac := hmac.New(sha256.New, []byte(p.config.HashKey))
+		mac.Write([]byte(match))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	return p.config.Mask
+}
+
+func (p *redact) String() string {
+	names := make([]string, len(p.detectors))
+	for i, d := range p.detectors {
+		names[i] = d.name
+	}
+	return fmt.Sprintf("%v=[fields=%v, detectors=%v, action=%v]",
+		processorName, p.config.Fields, names, p.config.Action)
+}
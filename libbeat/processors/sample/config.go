@@ -0,0 +1,33 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package sample
+
+import "errors"
+
+type config struct {
+	Rate   float64  `config:"rate" validate:"required"`
+	Fields []string `config:"fields"`
+}
+
+// Validate checks that the rate is a fraction of the events.
+func (c *config) Validate() error {
+	if c.Rate <= 0 || c.Rate > 1 {
+		return errors.New("rate must be greater than 0 and at most 1")
+	}
+	return nil
+}
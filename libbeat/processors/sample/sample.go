@@ -0,0 +1,124 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package sample
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/pkg/errors"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor"
+)
+
+const (
+	processorName = "sample"
+	logName       = "processor." + processorName
+)
+
+// instanceID is used to assign each instance a unique monitoring namespace.
+var instanceID = atomic.MakeUint32(0)
+
+func init() {
+	processors.RegisterPlugin(processorName, New)
+	jsprocessor.RegisterPlugin("Sample", New)
+}
+
+type sample struct {
+	config config
+	fields []string
+
+	// threshold is the largest hash of a kept event.
+	threshold uint64
+
+	// random is used when no fields are configured.
+	random func() float64
+
+	dropped *monitoring.Int
+}
+
+// New constructs a new sample processor.
+func New(cfg *common.Config) (processors.Processor, error) {
+	c := config{}
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, errors.Wrap(err, "fail to unpack the sample configuration")
+	}
+
+	id := int(instanceID.Inc())
+	metrics := monitoring.Default.NewRegistry(logName+"."+strconv.Itoa(id), monitoring.DoNotReport)
+
+	threshold := uint64(math.MaxUint64)
+	if c.Rate < 1 {
+		threshold = uint64(c.Rate * math.MaxUint64)
+	}
+
+	return &sample{
+		config:    c,
+		fields:    common.MakeStringSet(c.Fields...).ToSlice(),
+		threshold: threshold,
+		random:    rand.Float64,
+		dropped:   monitoring.NewInt(metrics, "dropped"),
+	}, nil
+}
+
+// Run drops the events that are not part of the sample. With fields
+// configured, events with the same values for the fields are either all
+// kept or all dropped.
+func (p *sample) Run(event *beat.Event) (*beat.Event, error) {
+	if p.keep(event) {
+		return event, nil
+	}
+	p.dropped.Inc()
+	return nil, nil
+}
+
+func (p *sample) keep(event *beat.Event) bool {
+	if len(p.fields) == 0 {
+		return p.random() < p.config.Rate
+	}
+	return p.hash(event) <= p.threshold
+}
+
+// hash computes the xxHash of the values of the configured fields.
+func (p *sample) hash(event *beat.Event) uint64 {
+	h := xxhash.New()
+	for _, k := range p.fields {
+		v, err := event.GetValue(k)
+		if err != nil {
+			v = nil
+		}
+		if t, ok := v.(time.Time); ok {
+			v = t.UTC()
+		}
+		fmt.Fprintf(h, "|%v|%v", k, v)
+	}
+	return h.Sum64()
+}
+
+func (p *sample) String() string {
+	return fmt.Sprintf("%v=[rate=%v, fields=%v]", processorName, p.config.Rate, p.fields)
+}
@@ -0,0 +1,124 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package sample
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+func TestNew(t *testing.T) {
+	cases := map[string]struct {
+		config common.MapStr
+		err    bool
+	}{
+		"rate": {
+			config: common.MapStr{"rate": 0.1},
+		},
+		"keep all": {
+			config: common.MapStr{"rate": 1, "fields": []string{"trace.id"}},
+		},
+		"missing rate": {
+			config: common.MapStr{},
+			err:    true,
+		},
+		"rate above one": {
+			config: common.MapStr{"rate": 1.5},
+			err:    true,
+		},
+		"negative rate": {
+			config: common.MapStr{"rate": -0.5},
+			err:    true,
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(common.MustNewConfigFrom(test.config))
+			if test.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSampleByFields(t *testing.T) {
+	p, err := New(common.MustNewConfigFrom(common.MapStr{
+		"rate":   0.25,
+		"fields": []string{"trace.id"},
+	}))
+	require.NoError(t, err)
+
+	const traces = 10000
+	kept := 0
+	for i := 0; i < traces; i++ {
+		id := strconv.Itoa(i)
+		first, err := p.Run(&beat.Event{Fields: common.MapStr{"trace": common.MapStr{"id": id}, "message": "a"}})
+		require.NoError(t, err)
+		second, err := p.Run(&beat.Event{Fields: common.MapStr{"trace": common.MapStr{"id": id}, "message": "b"}})
+		require.NoError(t, err)
+
+		// Events of the same trace are kept or dropped together.
+		assert.Equal(t, first != nil, second != nil, "trace %v", id)
+		if first != nil {
+			kept++
+		}
+	}
+
+	assert.InDelta(t, 0.25, float64(kept)/traces, 0.02)
+	assert.Equal(t, int64(2*(traces-kept)), p.(*sample).dropped.Get())
+}
+
+func TestSampleRandom(t *testing.T) {
+	p, err := New(common.MustNewConfigFrom(common.MapStr{"rate": 0.5}))
+	require.NoError(t, err)
+
+	values := []float64{0.1, 0.7, 0.5, 0.3}
+	p.(*sample).random = func() float64 {
+		v := values[0]
+		values = values[1:]
+		return v
+	}
+
+	var kept []bool
+	for i := 0; i < 4; i++ {
+		out, err := p.Run(&beat.Event{Fields: common.MapStr{}})
+		require.NoError(t, err)
+		kept = append(kept, out != nil)
+	}
+	assert.Equal(t, []bool{true, false, false, true}, kept)
+}
+
+func TestSampleKeepAll(t *testing.T) {
+	p, err := New(common.MustNewConfigFrom(common.MapStr{"rate": 1, "fields": []string{"id"}}))
+	require.NoError(t, err)
+
+	for i := 0; i < 1000; i++ {
+		out, err := p.Run(&beat.Event{Fields: common.MapStr{"id": i}})
+		require.NoError(t, err)
+		assert.NotNil(t, out)
+	}
+}
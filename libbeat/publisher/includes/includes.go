@@ -19,13 +19,19 @@ package includes
 
 import (
 	// import queue types
+	_ "github.com/elastic/beats/v7/libbeat/outputs/archive"
+	_ "github.com/elastic/beats/v7/libbeat/outputs/codec/avro"
+	_ "github.com/elastic/beats/v7/libbeat/outputs/codec/cbor"
 	_ "github.com/elastic/beats/v7/libbeat/outputs/codec/format"
 	_ "github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	_ "github.com/elastic/beats/v7/libbeat/outputs/codec/msgpack"
+	_ "github.com/elastic/beats/v7/libbeat/outputs/codec/protobuf"
 	_ "github.com/elastic/beats/v7/libbeat/outputs/console"
 	_ "github.com/elastic/beats/v7/libbeat/outputs/elasticsearch"
 	_ "github.com/elastic/beats/v7/libbeat/outputs/fileout"
 	_ "github.com/elastic/beats/v7/libbeat/outputs/kafka"
 	_ "github.com/elastic/beats/v7/libbeat/outputs/logstash"
+	_ "github.com/elastic/beats/v7/libbeat/outputs/otlp"
 	_ "github.com/elastic/beats/v7/libbeat/outputs/redis"
 	_ "github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
 	_ "github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
@@ -52,6 +52,10 @@ type client struct {
 	done      chan struct{} // the done channel will be closed if the closeReg gets closed, or Close is run.
 
 	eventer beat.ClientEventer
+
+	// unregisterEmitters stops processors from emitting events through the
+	// client.
+	unregisterEmitters func()
 }
 
 type clientCloseWaiter struct {
@@ -116,7 +120,28 @@ func (c *client) publish(e beat.Event) {
 		return
 	}
 
-	e = *event
+	c.enqueue(*event)
+}
+
+// emit publishes an event created asynchronously by a processor. The event
+// has already been run through the processors following the emitter.
+func (c *client) emit(e beat.Event) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.onNewEvent()
+	c.onEmitted(e)
+
+	if !c.isOpen.Load() {
+		c.onDroppedOnPublish(e)
+		return
+	}
+
+	c.acker.AddEvent(e, true)
+	c.enqueue(e)
+}
+
+func (c *client) enqueue(e beat.Event) {
 	pubEvent := publisher.Event{
 		Content: e,
 		Flags:   c.eventFlags,
@@ -151,6 +176,12 @@ func (c *client) Close() error {
 	c.closeOnce.Do(func() {
 		close(c.done)
 
+		// Processors can still emit pending events while unregistering.
+		if c.unregisterEmitters != nil {
+			log.Debug("client: unregister processor emitters")
+			c.unregisterEmitters()
+		}
+
 		c.isOpen.Store(false)
 		c.onClosing()
 
@@ -208,6 +239,12 @@ func (c *client) onNewEvent() {
 	c.pipeline.observer.newEvent()
 }
 
+func (c *client) onEmitted(e beat.Event) {
+	if emitEventer, ok := c.eventer.(beat.ClientEmitEventer); ok {
+		emitEventer.Emitted(e)
+	}
+}
+
 func (c *client) onPublished() {
 	c.pipeline.observer.publishedEvent()
 	if c.eventer != nil {
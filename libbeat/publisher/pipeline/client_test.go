@@ -23,9 +23,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
+
 	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
 	"github.com/elastic/beats/v7/libbeat/logp"
 	"github.com/elastic/beats/v7/libbeat/outputs"
+	libprocessors "github.com/elastic/beats/v7/libbeat/processors"
 	"github.com/elastic/beats/v7/libbeat/publisher"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
@@ -205,3 +209,76 @@ func TestClientWaitClose(t *testing.T) {
 		}
 	})
 }
+
+type flushingEmitter struct {
+	emit libprocessors.EmitFunc
+}
+
+func (e *flushingEmitter) Run(event *beat.Event) (*beat.Event, error) { return nil, nil }
+func (e *flushingEmitter) String() string                             { return "flushing_emitter" }
+
+func (e *flushingEmitter) RegisterEmitFunc(emit libprocessors.EmitFunc) func() {
+	e.emit = emit
+	return func() {
+		emit(beat.Event{Fields: common.MapStr{"message": "flushed"}})
+	}
+}
+
+// clientProcessors runs the processors of the client configuration only.
+type clientProcessors struct{}
+
+func (clientProcessors) Create(cfg beat.ProcessingConfig, _ bool) (beat.Processor, error) {
+	return cfg.Processor, nil
+}
+
+func TestClientEmit(t *testing.T) {
+	var mu sync.Mutex
+	var published []string
+	producer := func(queue.ProducerConfig) queue.Producer {
+		return &testProducer{
+			publish: func(_ bool, event publisher.Event) bool {
+				mu.Lock()
+				defer mu.Unlock()
+				published = append(published, event.Content.Fields["message"].(string))
+				return true
+			},
+		}
+	}
+
+	pipeline, err := New(beat.Info{},
+		Monitors{},
+		func(queue.ACKListener) (queue.Queue, error) {
+			return makeTestQueue(emptyConsumer, producer), nil
+		},
+		outputs.Group{},
+		Settings{Processors: clientProcessors{}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pipeline.Close()
+
+	emitter := &flushingEmitter{}
+	procs := libprocessors.NewList(nil)
+	procs.AddProcessor(emitter)
+
+	client, err := pipeline.ConnectWith(beat.ClientConfig{
+		Processing: beat.ProcessingConfig{Processor: procs},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Events passed to Publish are dropped by the emitter, emitted events are
+	// published.
+	client.Publish(beat.Event{Fields: common.MapStr{"message": "dropped"}})
+	emitter.emit(beat.Event{Fields: common.MapStr{"message": "emitted"}})
+
+	// Pending events are emitted while the client is closed.
+	client.Close()
+	emitter.emit(beat.Event{Fields: common.MapStr{"message": "after close"}})
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"emitted", "flushed"}, published)
+}
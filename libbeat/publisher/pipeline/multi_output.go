@@ -0,0 +1,485 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/conditions"
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+)
+
+// OutputDestination is an output of a multi output. It receives a copy of the
+// events matching its condition, or of all events if the condition is nil.
+type OutputDestination struct {
+	Name      string
+	Condition conditions.Condition
+	Factory   OutputFactory
+}
+
+// DestinationConfig is the configuration of an entry of the outputs list:
+//
+//	outputs:
+//	  - name: security
+//	    when.equals.event.kind: alert
+//	    elasticsearch:
+//	      hosts: ["localhost:9200"]
+type DestinationConfig struct {
+	Name   string
+	When   *conditions.Config
+	Output common.ConfigNamespace
+}
+
+// reservedDestinationNames can not be used as output names, as they are used
+// by the metrics of the output registry.
+var reservedDestinationNames = []string{"bulk", "events", "failover", "read", "type", "write"}
+
+var errMultiOutputClosed = errors.New("multi output closed")
+
+// Unpack reads the output name, its condition, and the output configuration
+// namespace from the remaining setting.
+func (c *DestinationConfig) Unpack(cfg *common.Config) error {
+	var base struct {
+		Name string             `config:"name"`
+		When *conditions.Config `config:"when"`
+	}
+	if err := cfg.Unpack(&base); err != nil {
+		return err
+	}
+	if base.Name == "" {
+		return errors.New("outputs require a name")
+	}
+	for _, reserved := range reservedDestinationNames {
+		if base.Name == reserved {
+			return fmt.Errorf("'%v' can not be used as output name", base.Name)
+		}
+	}
+
+	var types []string
+	for _, field := range cfg.GetFields() {
+		if field != "name" && field != "when" {
+			types = append(types, field)
+		}
+	}
+	if len(types) != 1 {
+		return fmt.Errorf("output %v must configure exactly one output type, found: %v",
+			base.Name, strings.Join(types, ", "))
+	}
+
+	sub, err := cfg.Child(types[0], -1)
+	if err != nil {
+		return err
+	}
+	ns, err := common.NewConfigFrom(map[string]interface{}{types[0]: sub})
+	if err != nil {
+		return err
+	}
+
+	*c = DestinationConfig{Name: base.Name, When: base.When}
+	return ns.Unpack(&c.Output)
+}
+
+// ReadDestinations reads the entries of the outputs list, creating the output
+// of each entry with makeFactory.
+func ReadDestinations(
+	cfgs []*common.Config,
+	makeFactory func(common.ConfigNamespace) OutputFactory,
+) ([]OutputDestination, error) {
+	names := map[string]bool{}
+	destinations := make([]OutputDestination, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		var config DestinationConfig
+		if err := config.Unpack(cfg); err != nil {
+			return nil, err
+		}
+		if !config.Output.Config().Enabled() {
+			continue
+		}
+		if names[config.Name] {
+			return nil, fmt.Errorf("output name %v is used more than once", config.Name)
+		}
+		names[config.Name] = true
+
+		var cond conditions.Condition
+		if config.When != nil {
+			var err error
+			if cond, err = conditions.NewCondition(config.When); err != nil {
+				return nil, fmt.Errorf("invalid condition of output %v: %v", config.Name, err)
+			}
+		}
+		destinations = append(destinations, OutputDestination{
+			Name:      config.Name,
+			Condition: cond,
+			Factory:   makeFactory(config.Output),
+		})
+	}
+	return destinations, nil
+}
+
+// MultiOutputFactory returns an output factory publishing events to all
+// destinations. Each destination has its own consumer, retryer and output
+// workers. Events are ACKed once all destinations with a matching condition
+// have ACKed them, so the slowest destination limits the throughput.
+// Metrics of each destination are reported in the output registry under the
+// destination name, and are added to the output metrics.
+func MultiOutputFactory(
+	beat beat.Info,
+	monitors Monitors,
+	destinations []OutputDestination,
+) OutputFactory {
+	if monitors.Logger == nil {
+		monitors.Logger = logp.NewLogger("publish")
+	}
+
+	return func(stats outputs.Observer) (string, outputs.Group, error) {
+		var metrics *monitoring.Registry
+		if monitors.Metrics != nil {
+			metrics = monitors.Metrics.GetRegistry("output")
+		}
+
+		out := &multiOutput{}
+		batchSize := 0
+		for _, dest := range destinations {
+			var destStats outputs.Observer
+			if metrics != nil {
+				reg := metrics.NewRegistry(dest.Name)
+				destStats = multiObserver{stats, outputs.NewStats(reg)}
+			}
+
+			typ, group, err := dest.Factory(destStats)
+			if err != nil {
+				out.Close()
+				return "", outputs.Group{}, fmt.Errorf("failed to create output %v: %v", dest.Name, err)
+			}
+			if metrics != nil {
+				monitoring.NewString(metrics.GetRegistry(dest.Name), "type").Set(typ)
+			}
+
+			out.destinations = append(out.destinations, newOutputDestination(beat, monitors, dest, group))
+			if batchSize >= 0 {
+				if group.BatchSize <= 0 {
+					batchSize = -1
+				} else if group.BatchSize > batchSize {
+					batchSize = group.BatchSize
+				}
+			}
+		}
+
+		return "multi", outputs.Group{
+			Clients:   []outputs.Client{out},
+			BatchSize: batchSize,
+			Retry:     -1, // events are never retried by the multi output itself
+		}, nil
+	}
+}
+
+// multiOutput is the client of the pipeline output, forwarding copies of the
+// events to the destinations.
+type multiOutput struct {
+	destinations []*destination
+}
+
+type destination struct {
+	name       string
+	condition  conditions.Condition
+	batchSize  int
+	queue      *destinationQueue
+	controller *outputController
+}
+
+func newOutputDestination(beat beat.Info, monitors Monitors, dest OutputDestination, group outputs.Group) *destination {
+	queue := newDestinationQueue()
+	controller := newOutputController(beat, monitors, destinationObserver{nilObserver}, queue)
+	controller.Set(group)
+	return &destination{
+		name:       dest.Name,
+		condition:  dest.Condition,
+		batchSize:  group.BatchSize,
+		queue:      queue,
+		controller: controller,
+	}
+}
+
+// Publish splits the batch into batches for the destinations. It does not
+// block, the destination batches are buffered until the destinations consume
+// them. The number of buffered events is limited by the pipeline queue.
+func (o *multiOutput) Publish(_ context.Context, batch publisher.Batch) error {
+	tracker := &multiBatch{batch: batch}
+	tracker.pending.Store(1)
+
+	events := batch.Events()
+	for _, dest := range o.destinations {
+		var selected []publisher.Event
+		for i := range events {
+			if dest.condition == nil || dest.condition.Check(&events[i].Content) {
+				selected = append(selected, events[i])
+			}
+		}
+
+		for len(selected) > 0 {
+			n := len(selected)
+			if dest.batchSize > 0 && n > dest.batchSize {
+				n = dest.batchSize
+			}
+			tracker.pending.Inc()
+			dest.queue.push(&destinationBatch{events: selected[:n:n], parent: tracker})
+			selected = selected[n:]
+		}
+	}
+
+	tracker.done()
+	return nil
+}
+
+func (o *multiOutput) Close() error {
+	for _, dest := range o.destinations {
+		dest.controller.Close()
+		dest.queue.Close()
+	}
+	return nil
+}
+
+func (o *multiOutput) String() string {
+	names := make([]string, len(o.destinations))
+	for i, dest := range o.destinations {
+		names[i] = dest.name
+	}
+	return "multi(" + strings.Join(names, ", ") + ")"
+}
+
+// multiBatch ACKs the pipeline batch once all destination batches are ACKed.
+type multiBatch struct {
+	batch   publisher.Batch
+	pending atomic.Int
+}
+
+func (b *multiBatch) done() {
+	if b.pending.Dec() == 0 {
+		b.batch.ACK()
+	}
+}
+
+// destinationBatch is a batch of a destination queue.
+type destinationBatch struct {
+	events []publisher.Event
+	parent *multiBatch
+}
+
+func (b *destinationBatch) Events() []publisher.Event { return b.events }
+func (b *destinationBatch) ACK()                      { b.parent.done() }
+
+// destinationQueue buffers the batches of a destination until its
+// consumer gets them. Only the Consumer of the queue is used.
+type destinationQueue struct {
+	mu      sync.Mutex
+	batches []queue.Batch
+	notify  chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+type destinationConsumer struct {
+	queue *destinationQueue
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newDestinationQueue() *destinationQueue {
+	return &destinationQueue{
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+func (q *destinationQueue) push(b queue.Batch) {
+	q.mu.Lock()
+	q.batches = append(q.batches, b)
+	q.mu.Unlock()
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *destinationQueue) pop() queue.Batch {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.batches) == 0 {
+		return nil
+	}
+	b := q.batches[0]
+	q.batches[0] = nil
+	q.batches = q.batches[1:]
+	return b
+}
+
+func (q *destinationQueue) Close() error {
+	q.once.Do(func() { close(q.done) })
+	return nil
+}
+
+func (q *destinationQueue) BufferConfig() queue.BufferConfig {
+	return queue.BufferConfig{MaxEvents: 0}
+}
+
+func (q *destinationQueue) Producer(queue.ProducerConfig) queue.Producer {
+	panic("destination queues have no producer")
+}
+
+func (q *destinationQueue) Consumer() queue.Consumer {
+	return &destinationConsumer{queue: q, done: make(chan struct{})}
+}
+
+// Get returns the next batch. Batches are sized by the multi output, so
+// eventCount is ignored.
+func (c *destinationConsumer) Get(_ int) (queue.Batch, error) {
+	for {
+		if b := c.queue.pop(); b != nil {
+			return b, nil
+		}
+		select {
+		case <-c.queue.notify:
+		case <-c.done:
+			return nil, errMultiOutputClosed
+		case <-c.queue.done:
+			return nil, errMultiOutputClosed
+		}
+	}
+}
+
+func (c *destinationConsumer) Close() error {
+	c.once.Do(func() { close(c.done) })
+	return nil
+}
+
+// destinationObserver reports the failures and retries of a destination. Sent
+// and ACKed events are reported by the pipeline output.
+type destinationObserver struct {
+	outputObserver
+}
+
+func (destinationObserver) updateOutputGroup() {}
+func (destinationObserver) outBatchSend(int)   {}
+func (destinationObserver) outBatchACKed(int)  {}
+
+// multiObserver reports output events to multiple observers.
+type multiObserver []outputs.Observer
+
+func (o multiObserver) NewBatch(n int) {
+	for _, obs := range o {
+		obs.NewBatch(n)
+	}
+}
+
+func (o multiObserver) Acked(n int) {
+	for _, obs := range o {
+		obs.Acked(n)
+	}
+}
+
+func (o multiObserver) Failed(n int) {
+	for _, obs := range o {
+		obs.Failed(n)
+	}
+}
+
+func (o multiObserver) Dropped(n int) {
+	for _, obs := range o {
+		obs.Dropped(n)
+	}
+}
+
+func (o multiObserver) Duplicate(n int) {
+	for _, obs := range o {
+		obs.Duplicate(n)
+	}
+}
+
+func (o multiObserver) Cancelled(n int) {
+	for _, obs := range o {
+		obs.Cancelled(n)
+	}
+}
+
+func (o multiObserver) WriteError(err error) {
+	for _, obs := range o {
+		obs.WriteError(err)
+	}
+}
+
+func (o multiObserver) WriteBytes(n int) {
+	for _, obs := range o {
+		obs.WriteBytes(n)
+	}
+}
+
+func (o multiObserver) ReadError(err error) {
+	for _, obs := range o {
+		obs.ReadError(err)
+	}
+}
+
+func (o multiObserver) ReadBytes(n int) {
+	for _, obs := range o {
+		obs.ReadBytes(n)
+	}
+}
+
+func (o multiObserver) ErrTooMany(n int) {
+	for _, obs := range o {
+		obs.ErrTooMany(n)
+	}
+}
+
+func (o multiObserver) FailoverActive(host string) {
+	for _, obs := range o {
+		if fo, ok := obs.(outputs.FailoverObserver); ok {
+			fo.FailoverActive(host)
+		}
+	}
+}
+
+func (o multiObserver) DeadLetter(n int) {
+	for _, obs := range o {
+		if dl, ok := obs.(outputs.DeadLetterObserver); ok {
+			dl.DeadLetter(n)
+		} else {
+			obs.Cancelled(n)
+		}
+	}
+}
+
+func (o multiObserver) BulkSize(events, concurrency int) {
+	for _, obs := range o {
+		if bo, ok := obs.(outputs.BulkSizeObserver); ok {
+			bo.BulkSize(events, concurrency)
+		}
+	}
+}
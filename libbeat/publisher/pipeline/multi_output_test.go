@@ -0,0 +1,212 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/monitoring"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+)
+
+func TestDestinationConfig(t *testing.T) {
+	tests := map[string]struct {
+		config  map[string]interface{}
+		typ     string
+		err     bool
+		hasCond bool
+	}{
+		"output without condition": {
+			config: map[string]interface{}{"name": "a", "console": map[string]interface{}{}},
+			typ:    "console",
+		},
+		"output with condition": {
+			config: map[string]interface{}{
+				"name":                   "a",
+				"when.equals.event.kind": "alert",
+				"file.path":              "/tmp",
+			},
+			typ:     "file",
+			hasCond: true,
+		},
+		"missing name": {
+			config: map[string]interface{}{"console": map[string]interface{}{}},
+			err:    true,
+		},
+		"reserved name": {
+			config: map[string]interface{}{"name": "events", "console": map[string]interface{}{}},
+			err:    true,
+		},
+		"reserved failover name": {
+			config: map[string]interface{}{"name": "failover", "console": map[string]interface{}{}},
+			err:    true,
+		},
+		"missing output type": {
+			config: map[string]interface{}{"name": "a"},
+			err:    true,
+		},
+		"multiple output types": {
+			config: map[string]interface{}{
+				"name":    "a",
+				"console": map[string]interface{}{},
+				"file":    map[string]interface{}{},
+			},
+			err: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var typ string
+			dests, err := ReadDestinations(
+				[]*common.Config{common.MustNewConfigFrom(test.config)},
+				func(ns common.ConfigNamespace) OutputFactory {
+					typ = ns.Name()
+					return nil
+				},
+			)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, dests, 1)
+			assert.Equal(t, test.typ, typ)
+			assert.Equal(t, test.hasCond, dests[0].Condition != nil)
+		})
+	}
+}
+
+func TestReadDestinationsDuplicateName(t *testing.T) {
+	cfg := map[string]interface{}{"name": "a", "console": map[string]interface{}{}}
+	_, err := ReadDestinations(
+		[]*common.Config{common.MustNewConfigFrom(cfg), common.MustNewConfigFrom(cfg)},
+		func(common.ConfigNamespace) OutputFactory { return nil },
+	)
+	assert.Error(t, err)
+}
+
+func TestMultiOutput(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received = map[string][]publisher.Event{}
+		blocked  = map[string][]publisher.Batch{}
+		block    = map[string]bool{"alerts": true}
+	)
+	makeFactory := func(name string, batchSize int) OutputFactory {
+		return func(outputs.Observer) (string, outputs.Group, error) {
+			client := newMockClient(func(batch publisher.Batch) error {
+				mu.Lock()
+				defer mu.Unlock()
+				received[name] = append(received[name], batch.Events()...)
+				if block[name] {
+					blocked[name] = append(blocked[name], batch)
+				} else {
+					batch.ACK()
+				}
+				return nil
+			})
+			return "mock", outputs.Group{Clients: []outputs.Client{client}, BatchSize: batchSize}, nil
+		}
+	}
+	receivedCount := func(name string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received[name])
+	}
+
+	dests, err := ReadDestinations(
+		[]*common.Config{
+			common.MustNewConfigFrom(map[string]interface{}{"name": "all", "mock": nil}),
+			common.MustNewConfigFrom(map[string]interface{}{
+				"name":                   "alerts",
+				"when.equals.event.kind": "alert",
+				"mock":                   nil,
+			}),
+		},
+		func(ns common.ConfigNamespace) OutputFactory { return nil },
+	)
+	require.NoError(t, err)
+	dests[0].Factory = makeFactory("all", 2)
+	dests[1].Factory = makeFactory("alerts", 0)
+
+	metrics := monitoring.NewRegistry()
+	outStats := outputs.NewStats(metrics.NewRegistry("output"))
+	typ, group, err := MultiOutputFactory(beat.Info{}, Monitors{Metrics: metrics}, dests)(outStats)
+	require.NoError(t, err)
+	assert.Equal(t, "multi", typ)
+	assert.Equal(t, -1, group.BatchSize)
+	require.Len(t, group.Clients, 1)
+	out := group.Clients[0]
+	defer out.Close()
+
+	assert.NotNil(t, metrics.Get("output.all.events.acked"))
+	assert.NotNil(t, metrics.Get("output.alerts.events.acked"))
+
+	var acked atomic.Int
+	batch := &mockBatch{
+		events: []publisher.Event{
+			{Content: beat.Event{Fields: common.MapStr{"event": common.MapStr{"kind": "alert"}}}},
+			{Content: beat.Event{Fields: common.MapStr{"event": common.MapStr{"kind": "event"}}}},
+			{Content: beat.Event{Fields: common.MapStr{"event": common.MapStr{"kind": "alert"}}}},
+		},
+		onACK: func() { acked.Inc() },
+	}
+	require.NoError(t, out.Publish(nil, batch))
+
+	require.True(t, waitUntilTrue(5*time.Second, func() bool {
+		return receivedCount("all") == 3 && receivedCount("alerts") == 2
+	}))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 0, acked.Load(), "batch must not be ACKed before all outputs ACKed")
+
+	mu.Lock()
+	for _, b := range blocked["alerts"] {
+		b.ACK()
+	}
+	mu.Unlock()
+	require.True(t, waitUntilTrue(5*time.Second, func() bool {
+		return acked.Load() == 1
+	}))
+
+	// batches not matching any destination condition are ACKed immediately
+	mu.Lock()
+	block["all"] = true
+	mu.Unlock()
+	dests[0].Condition = dests[1].Condition
+	_, group, err = MultiOutputFactory(beat.Info{}, Monitors{}, dests)(nil)
+	require.NoError(t, err)
+	defer group.Clients[0].Close()
+
+	var ackedUnmatched atomic.Int
+	unmatched := &mockBatch{
+		events: []publisher.Event{{Content: beat.Event{Fields: common.MapStr{}}}},
+		onACK:  func() { ackedUnmatched.Inc() },
+	}
+	require.NoError(t, group.Clients[0].Publish(nil, unmatched))
+	assert.Equal(t, 1, ackedUnmatched.Load())
+}
@@ -32,6 +32,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/common/reload"
 	"github.com/elastic/beats/v7/libbeat/logp"
 	"github.com/elastic/beats/v7/libbeat/outputs"
+	libprocessors "github.com/elastic/beats/v7/libbeat/processors"
 	"github.com/elastic/beats/v7/libbeat/publisher"
 	"github.com/elastic/beats/v7/libbeat/publisher/processing"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
@@ -333,6 +334,10 @@ func (p *Pipeline) ConnectWith(cfg beat.ClientConfig) (beat.Client, error) {
 	client.waiter = waiter
 	client.producer = p.queue.Producer(producerCfg)
 
+	if processors != nil {
+		client.unregisterEmitters = libprocessors.RegisterEmitters([]beat.Processor{processors}, client.emit)
+	}
+
 	p.observer.clientConnected()
 
 	if client.closeRef != nil {
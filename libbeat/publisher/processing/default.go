@@ -251,19 +251,21 @@ func newBuilder(
 //  7. (P) add builtins
 //  8. (P) pipeline processors list
 //  9. (P) timeseries mangling
-//  10. (P) (if publish/debug enabled) log event
-//  11. (P) (if output disabled) dropEvent
+//  10. (C) client post processors list
+//  11. (P) (if publish/debug enabled) log event
+//  12. (P) (if output disabled) dropEvent
 func (b *builder) Create(cfg beat.ProcessingConfig, drop bool) (beat.Processor, error) {
 	var (
 		// pipeline processors
 		processors = newGroup("processPipeline", b.log)
 
 		// client fields and metadata
-		clientMeta      = cfg.Meta
-		localProcessors = makeClientProcessors(b.log, cfg)
+		clientMeta          = cfg.Meta
+		localProcessors     = makeClientProcessors(b.log, "client", cfg.Processor)
+		localPostProcessors = makeClientProcessors(b.log, "clientPost", cfg.PostProcessor)
 	)
 
-	needsCopy := b.alwaysCopy || localProcessors != nil || b.processors != nil
+	needsCopy := b.alwaysCopy || localProcessors != nil || localPostProcessors != nil || b.processors != nil
 
 	builtin := b.builtinMeta
 	if cfg.DisableHost {
@@ -345,12 +347,15 @@ func (b *builder) Create(cfg beat.ProcessingConfig, drop bool) (beat.Processor,
 		processors.add(timeseries.NewTimeSeriesProcessor(b.timeseriesFields))
 	}
 
-	// setup 10: debug print final event (P)
+	// setup 10: client post processor list
+	processors.add(localPostProcessors)
+
+	// setup 11: debug print final event (P)
 	if b.log.IsDebug() {
 		processors.add(debugPrintProcessor(b.info, b.log))
 	}
 
-	// setup 11: drop all events if outputs are disabled (P)
+	// setup 12: drop all events if outputs are disabled (P)
 	if drop {
 		processors.add(dropDisabledProcessor)
 	}
@@ -360,14 +365,14 @@ func (b *builder) Create(cfg beat.ProcessingConfig, drop bool) (beat.Processor,
 
 func makeClientProcessors(
 	log *logp.Logger,
-	cfg beat.ProcessingConfig,
+	name string,
+	procs beat.ProcessorList,
 ) processors.Processor {
-	procs := cfg.Processor
 	if procs == nil || len(procs.All()) == 0 {
 		return nil
 	}
 
-	p := newGroup("client", log)
+	p := newGroup(name, log)
 	p.list = procs.All()
 	return p
 }
@@ -172,6 +172,23 @@ func TestProcessorsConfigs(t *testing.T) {
 			event: `{"value": "abc"}`,
 			want:  common.MapStr{"value": "abc", "custom": "value"},
 		},
+		"with client post processor": {
+			global: `{processors: [{add_fields: {target: "", fields: {shared: global, order: global}}}]}`,
+			local: beat.ProcessingConfig{
+				Processor: func() beat.ProcessorList {
+					g := newGroup("test", logp.L())
+					g.add(actions.NewAddFields(common.MapStr{"shared": "local"}, true, true))
+					return g
+				}(),
+				PostProcessor: func() beat.ProcessorList {
+					g := newGroup("test", logp.L())
+					g.add(actions.NewAddFields(common.MapStr{"order": "post"}, true, true))
+					return g
+				}(),
+			},
+			event: `{"value": "abc"}`,
+			want:  common.MapStr{"value": "abc", "shared": "global", "order": "post"},
+		},
 		"with beat default fields": {
 			factory: MakeDefaultBeatSupport(true),
 			global:  `{fields: {global: a, agent.foo: bar}, fields_under_root: true, tags: [tag]}`,
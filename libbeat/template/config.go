@@ -56,6 +56,13 @@ type TemplateConfig struct {
 	Order        int               `config:"order"`
 	Priority     int               `config:"priority"`
 	Type         IndexTemplateType `config:"type"`
+
+	// ComposedOf lists the component templates an index template is composed
+	// of. Index templates composed of component templates do not contain
+	// mappings.
+	ComposedOf []string `config:",ignore"`
+	// DataStream marks an index template as a data stream template.
+	DataStream bool `config:",ignore"`
 }
 
 // TemplateSettings are part of the Elasticsearch template and hold index and source specific information.
@@ -198,6 +198,9 @@ func (b *templateBuilder) buildBody(tmpl *Template, config TemplateConfig, field
 	if config.JSON.Enabled {
 		return b.buildBodyFromJSON(config)
 	}
+	if len(config.ComposedOf) > 0 {
+		return b.buildMinimalTemplate(tmpl)
+	}
 	if config.Fields != "" {
 		return b.buildBodyFromFile(tmpl, config)
 	}
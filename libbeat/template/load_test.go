@@ -84,6 +84,36 @@ func TestFileLoader_Load(t *testing.T) {
 	}
 }
 
+func TestFileLoader_LoadComposedDataStream(t *testing.T) {
+	ver := "7.10.0"
+	info := beat.Info{Version: ver, IndexPrefix: "mock"}
+
+	fc, err := newFileClient(ver)
+	require.NoError(t, err)
+	fl := NewFileLoader(fc)
+
+	cfg := DefaultConfig()
+	cfg.Type = IndexTemplateIndex
+	cfg.Name = "logs-mock"
+	cfg.Pattern = "logs-mock-*"
+	cfg.ComposedOf = []string{"logs-mock-mappings"}
+	cfg.DataStream = true
+
+	// fields are provided by the component template
+	err = fl.Load(cfg, info, []byte("- key: test\n  fields:\n  - name: field\n"), false)
+	require.NoError(t, err)
+
+	body := common.MapStr{
+		"index_patterns": []string{"logs-mock-*"},
+		"priority":       150,
+		"composed_of":    []string{"logs-mock-mappings"},
+		"data_stream":    common.MapStr{},
+		"_meta":          common.MapStr{"beat": "mock", "version": ver},
+	}
+	assert.Equal(t, "logs-mock", fc.name)
+	assert.Equal(t, body.StringToPrint()+"\n", fc.body)
+}
+
 type fileClient struct {
 	component, name, body, ver string
 }
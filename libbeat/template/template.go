@@ -232,12 +232,47 @@ func (t *Template) loadMinimalComponent() common.MapStr {
 }
 
 func (t *Template) loadMinimalIndex() common.MapStr {
+	if len(t.config.ComposedOf) > 0 {
+		return t.loadComposedIndex()
+	}
+
 	m := t.loadMinimalLegacy()
 	m["priority"] = t.priority
 	delete(m, "order")
+	t.addDataStream(m)
 	return m
 }
 
+// loadComposedIndex creates an index template whose mappings and settings are
+// provided by component templates.
+func (t *Template) loadComposedIndex() common.MapStr {
+	keyPattern, patterns := buildPatternSettings(t.esVersion, t.GetPattern())
+	m := common.MapStr{
+		keyPattern:    patterns,
+		"priority":    t.priority,
+		"composed_of": t.config.ComposedOf,
+		"_meta": common.MapStr{
+			"version": t.beatVersion.String(),
+			"beat":    t.beatName,
+		},
+	}
+	if t.config.Settings.Index != nil {
+		m["template"] = common.MapStr{
+			"settings": common.MapStr{
+				"index": t.config.Settings.Index,
+			},
+		}
+	}
+	t.addDataStream(m)
+	return m
+}
+
+func (t *Template) addDataStream(m common.MapStr) {
+	if t.config.DataStream {
+		m["data_stream"] = common.MapStr{}
+	}
+}
+
 // GetName returns the name of the template
 func (t *Template) GetName() string {
 	return t.name
@@ -304,6 +339,7 @@ func (t *Template) generateIndex(properties common.MapStr) common.MapStr {
 	tmpl := t.generateLegacy(properties)
 	tmpl["priority"] = t.priority
 	delete(tmpl, "order")
+	t.addDataStream(tmpl)
 	return tmpl
 }
 
@@ -133,6 +133,22 @@ func TestTemplate(t *testing.T) {
 	})
 }
 
+func TestDataStreamTemplate(t *testing.T) {
+	currentVersion := getVersion("")
+
+	config := DefaultConfig()
+	config.Type = IndexTemplateIndex
+	config.DataStream = true
+	template := createTestTemplate(t, currentVersion, "7.10.0", config)
+	template.Assert("data_stream", common.MapStr{})
+	template.Assert("priority", 150)
+	template.AssertMissing("order")
+
+	config.DataStream = false
+	template = createTestTemplate(t, currentVersion, "7.10.0", config)
+	template.AssertMissing("data_stream")
+}
+
 func createTestTemplate(t *testing.T, beatVersion, esVersion string, config TemplateConfig) *testTemplate {
 	beatVersion = getVersion(beatVersion)
 	esVersion = getVersion(esVersion)
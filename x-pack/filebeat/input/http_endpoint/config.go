@@ -7,6 +7,9 @@ package http_endpoint
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
 )
@@ -26,6 +29,14 @@ type config struct {
 	ContentType   string                  `config:"content_type"`
 	SecretHeader  string                  `config:"secret.header"`
 	SecretValue   string                  `config:"secret.value"`
+	HMACHeader    string                  `config:"hmac.header"`
+	HMACKey       string                  `config:"hmac.key"`
+	HMACType      string                  `config:"hmac.type"`
+	HMACPrefix    string                  `config:"hmac.prefix"`
+	HMACEncoding  string                  `config:"hmac.encoding"`
+	SplitEvents   bool                    `config:"split_events"`
+	WaitForACK    bool                    `config:"wait_for_ack"`
+	ACKTimeout    time.Duration           `config:"ack_timeout" validate:"positive"`
 }
 
 func defaultConfig() config {
@@ -42,6 +53,9 @@ func defaultConfig() config {
 		ContentType:   "application/json",
 		SecretHeader:  "",
 		SecretValue:   "",
+		HMACType:      "sha256",
+		HMACEncoding:  "hex",
+		ACKTimeout:    30 * time.Second,
 	}
 }
 
@@ -50,6 +64,10 @@ func (c *config) Validate() error {
 		return errors.New("response_body must be valid JSON")
 	}
 
+	if !strings.HasPrefix(c.URL, "/") {
+		return errors.New("url must start with /")
+	}
+
 	if c.BasicAuth {
 		if c.Username == "" || c.Password == "" {
 			return errors.New("Username and password required when basicauth is enabled")
@@ -60,5 +78,18 @@ func (c *config) Validate() error {
 		return errors.New("Both secret.header and secret.value must be set")
 	}
 
+	if (c.HMACHeader != "" && c.HMACKey == "") || (c.HMACHeader == "" && c.HMACKey != "") {
+		return errors.New("Both hmac.header and hmac.key must be set")
+	}
+
+	if c.HMACHeader != "" {
+		if _, found := hmacHashes[c.HMACType]; !found {
+			return fmt.Errorf("Unsupported hmac.type '%v', must be one of sha1, sha256 or sha512", c.HMACType)
+		}
+		if c.HMACEncoding != "hex" && c.HMACEncoding != "base64" {
+			return fmt.Errorf("Unsupported hmac.encoding '%v', must be hex or base64", c.HMACEncoding)
+		}
+	}
+
 	return nil
 }
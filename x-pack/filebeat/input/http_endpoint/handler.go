@@ -6,12 +6,14 @@ package http_endpoint
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"sync"
 	"time"
 
 	stateless "github.com/elastic/beats/v7/filebeat/input/v2/input-stateless"
@@ -23,25 +25,68 @@ import (
 type httpHandler struct {
 	log       *logp.Logger
 	publisher stateless.Publisher
+	hmac      *hmacValidator
 
 	messageField string
 	responseCode int
 	responseBody string
+	splitEvents  bool
+	waitForACK   bool
+	ackTimeout   time.Duration
 }
 
 var errBodyEmpty = errors.New("Body cannot be empty")
 var errUnsupportedType = errors.New("Only JSON objects are accepted")
+var errUnsupportedSplitType = errors.New("Only JSON objects, arrays of JSON objects or NDJSON are accepted")
+var errACKPending = errors.New("Events have been accepted, but have not been acknowledged yet")
 
 // Triggers if middleware validation returns successful
 func (h *httpHandler) apiResponse(w http.ResponseWriter, r *http.Request) {
-	obj, status, err := httpReadJsonObject(r.Body)
+	contents, status, err := httpReadBody(r.Body)
 	if err != nil {
-		w.Header().Add("Content-Type", "application/json")
 		sendErrorResponse(w, status, err)
 		return
 	}
 
-	h.publishEvent(obj)
+	if h.hmac != nil {
+		if status, err := h.hmac.ValidateBody(r, contents); err != nil {
+			sendErrorResponse(w, status, err)
+			return
+		}
+	}
+
+	var objs []common.MapStr
+	if h.splitEvents {
+		objs, status, err = decodeJSONObjects(contents)
+	} else {
+		objs, status, err = decodeJSONObject(contents)
+	}
+	if err != nil {
+		sendErrorResponse(w, status, err)
+		return
+	}
+
+	var tracker *batchACKTracker
+	if h.waitForACK {
+		tracker = newBatchACKTracker(len(objs))
+	}
+	for _, obj := range objs {
+		h.publishEvent(obj, tracker)
+	}
+
+	if tracker != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), h.ackTimeout)
+		defer cancel()
+		if err := tracker.Wait(ctx); err != nil {
+			// The events have already been published and will be delivered
+			// once the output is back. Asking the sender to retry would
+			// duplicate them.
+			h.log.Warnf("Failed to wait for %d events to be acknowledged: %v", len(objs), err)
+			sendErrorResponse(w, http.StatusAccepted, errACKPending)
+			return
+		}
+	}
+
 	w.Header().Add("Content-Type", "application/json")
 	h.sendResponse(w, h.responseCode, h.responseBody)
 }
@@ -51,13 +96,16 @@ func (h *httpHandler) sendResponse(w http.ResponseWriter, status int, message st
 	io.WriteString(w, message)
 }
 
-func (h *httpHandler) publishEvent(obj common.MapStr) {
+func (h *httpHandler) publishEvent(obj common.MapStr, tracker *batchACKTracker) {
 	event := beat.Event{
 		Timestamp: time.Now().UTC(),
 		Fields: common.MapStr{
 			h.messageField: obj,
 		},
 	}
+	if tracker != nil {
+		event.Private = tracker
+	}
 
 	h.publisher.Publish(event)
 }
@@ -78,26 +126,59 @@ func sendErrorResponse(w http.ResponseWriter, status int, err error) {
 	fmt.Fprintf(w, `{"message": %q}`, err.Error())
 }
 
-func httpReadJsonObject(body io.Reader) (obj common.MapStr, status int, err error) {
+func httpReadBody(body io.Reader) (contents []byte, status int, err error) {
 	if body == http.NoBody {
 		return nil, http.StatusNotAcceptable, errBodyEmpty
 	}
 
-	contents, err := ioutil.ReadAll(body)
+	contents, err = ioutil.ReadAll(body)
 	if err != nil {
 		return nil, http.StatusInternalServerError, fmt.Errorf("failed reading body: %w", err)
 	}
+	return contents, 0, nil
+}
 
+func decodeJSONObject(contents []byte) (objs []common.MapStr, status int, err error) {
 	if !isObject(contents) {
 		return nil, http.StatusBadRequest, errUnsupportedType
 	}
 
-	obj = common.MapStr{}
+	obj := common.MapStr{}
 	if err := json.Unmarshal(contents, &obj); err != nil {
 		return nil, http.StatusBadRequest, fmt.Errorf("Malformed JSON body: %w", err)
 	}
 
-	return obj, 0, nil
+	return []common.MapStr{obj}, 0, nil
+}
+
+// decodeJSONObjects decodes a single JSON object, a top-level JSON array of
+// objects or a stream of newline delimited JSON objects (NDJSON) into one
+// object per element.
+func decodeJSONObjects(contents []byte) (objs []common.MapStr, status int, err error) {
+	if isArray(contents) {
+		if err := json.Unmarshal(contents, &objs); err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("Malformed JSON body: %w", err)
+		}
+		return objs, 0, nil
+	}
+
+	if !isObject(contents) {
+		return nil, http.StatusBadRequest, errUnsupportedSplitType
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(contents))
+	for {
+		obj := common.MapStr{}
+		err := dec.Decode(&obj)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("Malformed JSON body: %w", err)
+		}
+		objs = append(objs, obj)
+	}
+	return objs, 0, nil
 }
 
 func isObject(b []byte) bool {
@@ -107,3 +188,50 @@ func isObject(b []byte) bool {
 	}
 	return false
 }
+
+func isArray(b []byte) bool {
+	arr := bytes.TrimLeft(b, " \t\r\n")
+	if len(arr) > 0 && arr[0] == '[' {
+		return true
+	}
+	return false
+}
+
+// batchACKTracker waits for all events published for a single request to be
+// acknowledged by the pipeline.
+type batchACKTracker struct {
+	mu      sync.Mutex
+	pending int
+	done    chan struct{}
+}
+
+func newBatchACKTracker(n int) *batchACKTracker {
+	t := &batchACKTracker{pending: n, done: make(chan struct{})}
+	if n == 0 {
+		close(t.done)
+	}
+	return t
+}
+
+// ACK marks one event as acknowledged.
+func (t *batchACKTracker) ACK() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.pending <= 0 {
+		return
+	}
+	t.pending--
+	if t.pending == 0 {
+		close(t.done)
+	}
+}
+
+// Wait blocks until all events have been acknowledged or ctx is done.
+func (t *batchACKTracker) Wait(ctx context.Context) error {
+	select {
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package http_endpoint
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+type publisherFunc func(beat.Event)
+
+func (f publisherFunc) Publish(event beat.Event) { f(event) }
+
+func TestDecodeJSONObjects(t *testing.T) {
+	cases := map[string]struct {
+		body    string
+		want    []common.MapStr
+		wantErr bool
+	}{
+		"object": {
+			body: `{"a": 1}`,
+			want: []common.MapStr{{"a": float64(1)}},
+		},
+		"array": {
+			body: ` [{"a": 1}, {"b": 2}]`,
+			want: []common.MapStr{{"a": float64(1)}, {"b": float64(2)}},
+		},
+		"ndjson": {
+			body: "{\"a\": 1}\n{\"b\": 2}\n",
+			want: []common.MapStr{{"a": float64(1)}, {"b": float64(2)}},
+		},
+		"array of scalars": {
+			body:    `[1, 2]`,
+			wantErr: true,
+		},
+		"scalar": {
+			body:    `"a"`,
+			wantErr: true,
+		},
+		"broken ndjson": {
+			body:    "{\"a\": 1}\n{\"b\": ",
+			wantErr: true,
+		},
+	}
+
+	for name, test := range cases {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			objs, status, err := decodeJSONObjects([]byte(test.body))
+			if test.wantErr {
+				assert.Error(t, err)
+				assert.Equal(t, http.StatusBadRequest, status)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, objs)
+		})
+	}
+}
+
+func TestHandlerWaitForACK(t *testing.T) {
+	var mu sync.Mutex
+	var events []beat.Event
+	handler := &httpHandler{
+		log: logp.NewLogger("test"),
+		publisher: publisherFunc(func(event beat.Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, event)
+			// ACK asynchronously, like the pipeline does.
+			go event.Private.(*batchACKTracker).ACK()
+		}),
+		messageField: "json",
+		responseCode: http.StatusOK,
+		responseBody: `{"message": "success"}`,
+		splitEvents:  true,
+		waitForACK:   true,
+		ackTimeout:   time.Second,
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`[{"a": 1}, {"a": 2}, {"a": 3}]`))
+	w := httptest.NewRecorder()
+	handler.apiResponse(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, events, 3)
+}
+
+func TestHandlerACKTimeout(t *testing.T) {
+	handler := &httpHandler{
+		log:          logp.NewLogger("test"),
+		publisher:    publisherFunc(func(beat.Event) {}),
+		messageField: "json",
+		responseCode: http.StatusOK,
+		waitForACK:   true,
+		ackTimeout:   10 * time.Millisecond,
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"a": 1}`))
+	w := httptest.NewRecorder()
+	handler.apiResponse(w, r)
+
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.JSONEq(t, `{"message": "Events have been accepted, but have not been acknowledged yet"}`, w.Body.String())
+}
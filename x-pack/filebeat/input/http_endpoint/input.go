@@ -11,11 +11,11 @@ import (
 	"net/http"
 
 	v2 "github.com/elastic/beats/v7/filebeat/input/v2"
-	stateless "github.com/elastic/beats/v7/filebeat/input/v2/input-stateless"
+	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/acker"
 	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
 	"github.com/elastic/beats/v7/libbeat/feature"
-	"github.com/elastic/go-concert/ctxtool"
 )
 
 const (
@@ -23,30 +23,34 @@ const (
 )
 
 type httpEndpoint struct {
+	servers   *pool
 	config    config
 	addr      string
 	tlsConfig *tls.Config
 }
 
 func Plugin() v2.Plugin {
+	servers := newPool()
 	return v2.Plugin{
 		Name:       inputName,
 		Stability:  feature.Beta,
 		Deprecated: false,
-		Manager:    stateless.NewInputManager(configure),
+		Manager: v2.ConfigureWith(func(cfg *common.Config) (v2.Input, error) {
+			return configure(servers, cfg)
+		}),
 	}
 }
 
-func configure(cfg *common.Config) (stateless.Input, error) {
+func configure(servers *pool, cfg *common.Config) (v2.Input, error) {
 	conf := defaultConfig()
 	if err := cfg.Unpack(&conf); err != nil {
 		return nil, err
 	}
 
-	return newHTTPEndpoint(conf)
+	return newHTTPEndpoint(servers, conf)
 }
 
-func newHTTPEndpoint(config config) (*httpEndpoint, error) {
+func newHTTPEndpoint(servers *pool, config config) (*httpEndpoint, error) {
 	if err := config.Validate(); err != nil {
 		return nil, err
 	}
@@ -63,6 +67,7 @@ func newHTTPEndpoint(config config) (*httpEndpoint, error) {
 	}
 
 	return &httpEndpoint{
+		servers:   servers,
 		config:    config,
 		tlsConfig: tlsConfig,
 		addr:      addr,
@@ -72,6 +77,10 @@ func newHTTPEndpoint(config config) (*httpEndpoint, error) {
 func (*httpEndpoint) Name() string { return inputName }
 
 func (e *httpEndpoint) Test(_ v2.TestContext) error {
+	if inUse, err := e.servers.check(e); inUse {
+		return err
+	}
+
 	l, err := net.Listen("tcp", e.addr)
 	if err != nil {
 		return err
@@ -79,9 +88,33 @@ func (e *httpEndpoint) Test(_ v2.TestContext) error {
 	return l.Close()
 }
 
-func (e *httpEndpoint) Run(ctx v2.Context, publisher stateless.Publisher) error {
+func (e *httpEndpoint) Run(ctx v2.Context, pipeline beat.PipelineConnector) error {
 	log := ctx.Logger.With("address", e.addr)
 
+	clientConfig := beat.ClientConfig{
+		PublishMode: beat.DefaultGuarantees,
+
+		// configure pipeline to disconnect input on stop signal.
+		CloseRef: ctx.Cancelation,
+	}
+	if e.config.WaitForACK {
+		clientConfig.ACKHandler = acker.ConnectionOnly(
+			acker.EventPrivateReporter(func(_ int, privates []interface{}) {
+				for _, private := range privates {
+					if tracker, ok := private.(*batchACKTracker); ok {
+						tracker.ACK()
+					}
+				}
+			}),
+		)
+	}
+
+	client, err := pipeline.ConnectWith(clientConfig)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
 	validator := &apiValidator{
 		basicAuth:    e.config.BasicAuth,
 		username:     e.config.Username,
@@ -94,32 +127,27 @@ func (e *httpEndpoint) Run(ctx v2.Context, publisher stateless.Publisher) error
 
 	handler := &httpHandler{
 		log:          log,
-		publisher:    publisher,
+		publisher:    client,
+		hmac:         newHMACValidator(e.config),
 		messageField: e.config.Prefix,
 		responseCode: e.config.ResponseCode,
 		responseBody: e.config.ResponseBody,
+		splitEvents:  e.config.SplitEvents,
+		waitForACK:   e.config.WaitForACK,
+		ackTimeout:   e.config.ACKTimeout,
 	}
 
-	mux := http.NewServeMux()
-	mux.HandleFunc(e.config.URL, withValidator(validator, handler.apiResponse))
-	server := &http.Server{Addr: e.addr, TLSConfig: e.tlsConfig, Handler: mux}
-	_, cancel := ctxtool.WithFunc(ctxtool.FromCanceller(ctx.Cancelation), func() {
-		server.Close()
-	})
-	defer cancel()
-
-	var err error
-	if server.TLSConfig != nil {
-		log.Infof("Starting HTTPS server on %s", server.Addr)
-		//certificate is already loaded. That's why the parameters are empty
-		err = server.ListenAndServeTLS("", "")
-	} else {
-		log.Infof("Starting HTTP server on %s", server.Addr)
-		err = server.ListenAndServe()
+	s, err := e.servers.register(log, e, withValidator(validator, handler.apiResponse))
+	if err != nil {
+		return err
 	}
-
-	if err != nil && err != http.ErrServerClosed {
-		return fmt.Errorf("Unable to start server due to error: %w", err)
+	defer e.servers.unregister(s, e.config.URL)
+
+	log.Infof("Accepting requests on %s", e.config.URL)
+	select {
+	case <-ctx.Cancelation.Done():
+		return nil
+	case <-s.Done():
+		return s.Err()
 	}
-	return nil
 }
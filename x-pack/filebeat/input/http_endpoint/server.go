@@ -0,0 +1,216 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package http_endpoint
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+var errNotFound = errors.New("Not found")
+
+// pool keeps track of the HTTP servers shared by all http_endpoint inputs.
+// Inputs listening on the same address share one server and register their
+// own URL path on it. The server is started by the first input registering a
+// route and stopped once the last route has been removed.
+type pool struct {
+	mu      sync.Mutex
+	servers map[string]*server
+}
+
+// server is a HTTP server that dispatches requests to the routes registered
+// by the inputs. Routes are matched like with http.ServeMux, routes ending in
+// a slash match all paths below them. Requests to unknown paths are answered
+// with 404.
+type server struct {
+	pool      *pool
+	log       *logp.Logger
+	addr      string
+	tlsConfig *tlscommon.ServerConfig
+	srv       *http.Server
+	listener  net.Listener
+
+	mu     sync.RWMutex
+	routes map[string]http.Handler
+
+	done chan struct{}
+	err  error
+}
+
+func newPool() *pool {
+	return &pool{servers: map[string]*server{}}
+}
+
+// register adds the handler for the path configured in e to the server
+// listening on e.addr. A new server is started if no input listens on the
+// address yet. Inputs sharing a server must use the same TLS settings.
+func (p *pool) register(log *logp.Logger, e *httpEndpoint, handler http.Handler) (*server, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if s, found := p.servers[e.addr]; found {
+		if !reflect.DeepEqual(s.tlsConfig, e.config.TLS) {
+			return nil, fmt.Errorf("the ssl configuration of the input does not match the ssl configuration of other inputs listening on %v", e.addr)
+		}
+		if err := s.addRoute(e.config.URL, handler); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+
+	s := &server{
+		pool:      p,
+		log:       log,
+		addr:      e.addr,
+		tlsConfig: e.config.TLS,
+		routes:    map[string]http.Handler{e.config.URL: handler},
+		done:      make(chan struct{}),
+	}
+	s.srv = &http.Server{Addr: e.addr, TLSConfig: e.tlsConfig, Handler: s}
+	if err := s.start(); err != nil {
+		return nil, err
+	}
+	p.servers[e.addr] = s
+	return s, nil
+}
+
+// check reports whether a server is already listening on the address of e.
+// If so, it verifies that e can be registered with the server.
+func (p *pool) check(e *httpEndpoint) (inUse bool, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s, found := p.servers[e.addr]
+	if !found {
+		return false, nil
+	}
+	if !reflect.DeepEqual(s.tlsConfig, e.config.TLS) {
+		return true, fmt.Errorf("the ssl configuration of the input does not match the ssl configuration of other inputs listening on %v", e.addr)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, exists := s.routes[e.config.URL]; exists {
+		return true, fmt.Errorf("url %v is already in use by another input listening on %v", e.config.URL, e.addr)
+	}
+	return true, nil
+}
+
+// remove removes a server that stopped on its own from the pool, so new inputs
+// on its address start a new server.
+func (p *pool) remove(s *server) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.servers[s.addr] == s {
+		delete(p.servers, s.addr)
+	}
+}
+
+// unregister removes the route from the server. The server is shut down when
+// no routes are left.
+func (p *pool) unregister(s *server, path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if s.removeRoute(path) > 0 {
+		return
+	}
+	if p.servers[s.addr] == s {
+		delete(p.servers, s.addr)
+	}
+	s.srv.Close()
+}
+
+func (s *server) start() error {
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("Unable to start server due to error: %w", err)
+	}
+	if s.srv.TLSConfig != nil {
+		s.log.Infof("Starting HTTPS server on %s", s.addr)
+		l = tls.NewListener(l, s.srv.TLSConfig)
+	} else {
+		s.log.Infof("Starting HTTP server on %s", s.addr)
+	}
+
+	s.listener = l
+
+	go func() {
+		defer close(s.done)
+		if err := s.srv.Serve(l); err != nil && err != http.ErrServerClosed {
+			s.err = fmt.Errorf("Unable to start server due to error: %w", err)
+			s.pool.remove(s)
+		}
+	}()
+	return nil
+}
+
+func (s *server) addRoute(path string, handler http.Handler) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.routes[path]; exists {
+		return fmt.Errorf("url %v is already in use by another input listening on %v", path, s.addr)
+	}
+	s.routes[path] = handler
+	return nil
+}
+
+func (s *server) removeRoute(path string) (remaining int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.routes, path)
+	return len(s.routes)
+}
+
+// Done is closed when the server has stopped.
+func (s *server) Done() <-chan struct{} { return s.done }
+
+// Err returns the error the server has been stopped with, if any.
+func (s *server) Err() error {
+	<-s.done
+	return s.err
+}
+
+// handler returns the handler of the route matching path. Like with
+// http.ServeMux, an exact match is preferred, followed by the longest route
+// ending in a slash that path starts with.
+func (s *server) handler(path string) (http.Handler, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if handler, found := s.routes[path]; found {
+		return handler, true
+	}
+
+	var match string
+	var handler http.Handler
+	for route, h := range s.routes {
+		if strings.HasSuffix(route, "/") && strings.HasPrefix(path, route) && len(route) > len(match) {
+			match, handler = route, h
+		}
+	}
+	return handler, handler != nil
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler, found := s.handler(r.URL.Path)
+	if !found {
+		sendErrorResponse(w, http.StatusNotFound, errNotFound)
+		return
+	}
+	handler.ServeHTTP(w, r)
+}
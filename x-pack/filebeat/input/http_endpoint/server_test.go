@@ -0,0 +1,147 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package http_endpoint
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/common/transport/tlscommon"
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+func newTestEndpoint(t *testing.T, servers *pool, url string) *httpEndpoint {
+	conf := defaultConfig()
+	conf.ListenPort = "0"
+	conf.URL = url
+	e, err := newHTTPEndpoint(servers, conf)
+	require.NoError(t, err)
+	return e
+}
+
+func routeHandler(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		io.WriteString(w, name)
+	})
+}
+
+func TestPoolSharedServer(t *testing.T) {
+	log := logp.NewLogger("test")
+	servers := newPool()
+
+	a := newTestEndpoint(t, servers, "/a")
+	sa, err := servers.register(log, a, routeHandler("a"))
+	require.NoError(t, err)
+
+	b := newTestEndpoint(t, servers, "/b")
+	inUse, err := servers.check(b)
+	assert.True(t, inUse)
+	assert.NoError(t, err)
+
+	sb, err := servers.register(log, b, routeHandler("b"))
+	require.NoError(t, err)
+	assert.Same(t, sa, sb)
+
+	base := "http://" + sa.listener.Addr().String()
+	assertGet(t, base+"/a", http.StatusOK, "a")
+	assertGet(t, base+"/b", http.StatusOK, "b")
+	assertGet(t, base+"/c", http.StatusNotFound, `{"message": "Not found"}`)
+
+	servers.unregister(sb, "/b")
+	assertGet(t, base+"/b", http.StatusNotFound, `{"message": "Not found"}`)
+	assertGet(t, base+"/a", http.StatusOK, "a")
+
+	servers.unregister(sa, "/a")
+	<-sa.Done()
+	assert.NoError(t, sa.Err())
+	assert.Empty(t, servers.servers)
+}
+
+func TestPoolConflicts(t *testing.T) {
+	log := logp.NewLogger("test")
+	servers := newPool()
+
+	a := newTestEndpoint(t, servers, "/a")
+	s, err := servers.register(log, a, routeHandler("a"))
+	require.NoError(t, err)
+	defer servers.unregister(s, "/a")
+
+	dup := newTestEndpoint(t, servers, "/a")
+	inUse, err := servers.check(dup)
+	assert.True(t, inUse)
+	assert.Error(t, err)
+	_, err = servers.register(log, dup, routeHandler("dup"))
+	assert.Error(t, err)
+
+	withTLS := newTestEndpoint(t, servers, "/tls")
+	withTLS.config.TLS = &tlscommon.ServerConfig{}
+	_, err = servers.register(log, withTLS, routeHandler("tls"))
+	assert.Error(t, err)
+}
+
+func TestPoolSubtreeRoutes(t *testing.T) {
+	log := logp.NewLogger("test")
+	servers := newPool()
+
+	var s *server
+	for _, url := range []string{"/", "/api/", "/api/exact"} {
+		e := newTestEndpoint(t, servers, url)
+		var err error
+		s, err = servers.register(log, e, routeHandler(url))
+		require.NoError(t, err)
+		defer servers.unregister(s, url)
+	}
+
+	base := "http://" + s.listener.Addr().String()
+	assertGet(t, base+"/", http.StatusOK, "/")
+	assertGet(t, base+"/other", http.StatusOK, "/")
+	assertGet(t, base+"/api", http.StatusOK, "/")
+	assertGet(t, base+"/api/", http.StatusOK, "/api/")
+	assertGet(t, base+"/api/a/b", http.StatusOK, "/api/")
+	assertGet(t, base+"/api/exact", http.StatusOK, "/api/exact")
+	assertGet(t, base+"/api/exact/a", http.StatusOK, "/api/")
+}
+
+func TestPoolRemovesFailedServer(t *testing.T) {
+	log := logp.NewLogger("test")
+	servers := newPool()
+
+	a := newTestEndpoint(t, servers, "/a")
+	s, err := servers.register(log, a, routeHandler("a"))
+	require.NoError(t, err)
+
+	// closing the listener makes Serve fail
+	s.listener.Close()
+	<-s.Done()
+	assert.Error(t, s.Err())
+	assert.Empty(t, servers.servers)
+
+	b := newTestEndpoint(t, servers, "/b")
+	inUse, err := servers.check(b)
+	assert.False(t, inUse)
+	assert.NoError(t, err)
+	sb, err := servers.register(log, b, routeHandler("b"))
+	require.NoError(t, err)
+	defer servers.unregister(sb, "/b")
+	assert.NotSame(t, s, sb)
+}
+
+func assertGet(t *testing.T, url string, status int, body string) {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	contents, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, status, resp.StatusCode)
+	assert.Equal(t, body, string(contents))
+}
@@ -5,9 +5,17 @@
 package http_endpoint
 
 import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash"
 	"net/http"
+	"strings"
 )
 
 type validator interface {
@@ -27,6 +35,14 @@ type apiValidator struct {
 
 var errIncorrectUserOrPass = errors.New("Incorrect username or password")
 var errIncorrectHeaderSecret = errors.New("Incorrect header or header secret")
+var errMissingHMACHeader = errors.New("Missing HMAC signature header")
+var errIncorrectHMACSignature = errors.New("Invalid HMAC signature")
+
+var hmacHashes = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
 
 func (v *apiValidator) ValidateHeader(r *http.Request) (int, error) {
 	if v.basicAuth {
@@ -52,3 +68,61 @@ func (v *apiValidator) ValidateHeader(r *http.Request) (int, error) {
 
 	return 0, nil
 }
+
+// hmacValidator checks the signature a webhook sender computed over the raw
+// request body. Senders like GitHub, Stripe or Slack put the hex or base64
+// encoded HMAC of the body into a request header, optionally prefixed with the
+// algorithm name (e.g. `sha256=`).
+type hmacValidator struct {
+	header   string
+	key      []byte
+	hash     func() hash.Hash
+	prefix   string
+	encoding string
+}
+
+func newHMACValidator(c config) *hmacValidator {
+	if c.HMACHeader == "" {
+		return nil
+	}
+	return &hmacValidator{
+		header:   c.HMACHeader,
+		key:      []byte(c.HMACKey),
+		hash:     hmacHashes[c.HMACType],
+		prefix:   c.HMACPrefix,
+		encoding: c.HMACEncoding,
+	}
+}
+
+// ValidateBody checks the signature header against the HMAC of body.
+func (v *hmacValidator) ValidateBody(r *http.Request, body []byte) (int, error) {
+	signature := r.Header.Get(v.header)
+	if signature == "" {
+		return http.StatusUnauthorized, errMissingHMACHeader
+	}
+	if v.prefix != "" {
+		if !strings.HasPrefix(signature, v.prefix) {
+			return http.StatusUnauthorized, errIncorrectHMACSignature
+		}
+		signature = signature[len(v.prefix):]
+	}
+
+	var expected []byte
+	var err error
+	switch v.encoding {
+	case "base64":
+		expected, err = base64.StdEncoding.DecodeString(signature)
+	default:
+		expected, err = hex.DecodeString(signature)
+	}
+	if err != nil {
+		return http.StatusUnauthorized, errIncorrectHMACSignature
+	}
+
+	mac := hmac.New(v.hash, v.key)
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return http.StatusUnauthorized, errIncorrectHMACSignature
+	}
+	return 0, nil
+}
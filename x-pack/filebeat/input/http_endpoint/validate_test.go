@@ -0,0 +1,108 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package http_endpoint
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHMACValidator(t *testing.T) {
+	body := []byte(`{"action":"opened"}`)
+	key := "secret"
+
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(body)
+	sum := mac.Sum(nil)
+
+	cases := map[string]struct {
+		encoding  string
+		prefix    string
+		signature string
+		status    int
+		err       error
+	}{
+		"hex with prefix": {
+			encoding:  "hex",
+			prefix:    "sha256=",
+			signature: "sha256=" + hex.EncodeToString(sum),
+		},
+		"base64": {
+			encoding:  "base64",
+			signature: base64.StdEncoding.EncodeToString(sum),
+		},
+		"missing header": {
+			encoding: "hex",
+			status:   http.StatusUnauthorized,
+			err:      errMissingHMACHeader,
+		},
+		"missing prefix": {
+			encoding:  "hex",
+			prefix:    "sha256=",
+			signature: hex.EncodeToString(sum),
+			status:    http.StatusUnauthorized,
+			err:       errIncorrectHMACSignature,
+		},
+		"wrong signature": {
+			encoding:  "hex",
+			signature: strings.Repeat("00", sha256.Size),
+			status:    http.StatusUnauthorized,
+			err:       errIncorrectHMACSignature,
+		},
+		"invalid encoding": {
+			encoding:  "hex",
+			signature: "not-hex",
+			status:    http.StatusUnauthorized,
+			err:       errIncorrectHMACSignature,
+		},
+	}
+
+	for name, test := range cases {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			conf := defaultConfig()
+			conf.HMACHeader = "X-Hub-Signature-256"
+			conf.HMACKey = key
+			conf.HMACPrefix = test.prefix
+			conf.HMACEncoding = test.encoding
+			if !assert.NoError(t, conf.Validate()) {
+				return
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			if test.signature != "" {
+				r.Header.Set("X-Hub-Signature-256", test.signature)
+			}
+
+			status, err := newHMACValidator(conf).ValidateBody(r, body)
+			assert.Equal(t, test.status, status)
+			assert.Equal(t, test.err, err)
+		})
+	}
+}
+
+func TestConfigValidateHMAC(t *testing.T) {
+	conf := defaultConfig()
+	conf.HMACHeader = "X-Signature"
+	assert.Error(t, conf.Validate())
+
+	conf.HMACKey = "secret"
+	assert.NoError(t, conf.Validate())
+
+	conf.HMACType = "md5"
+	assert.Error(t, conf.Validate())
+
+	conf.HMACType = "sha1"
+	conf.HMACEncoding = "base32"
+	assert.Error(t, conf.Validate())
+}